@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	achievementDefinitionCollection = "achievement_defs"
+	achievementCollection           = "achievements"
+	achievementKey                  = "progress"
+
+	achievementDefinitionPageSize = 100
+)
+
+var errUnknownAchievement = newError(CodeInvalidArgument, "unknown achievement")
+
+var achievementDefinitionCache = newCache[map[string]*AchievementDefinition]()
+
+type AchievementDefinition struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Target      int64   `json:"target"`
+	Reward      *Reward `json:"reward"`
+}
+
+type AchievementProgress struct {
+	Progress    int64 `json:"progress"`
+	Completed   bool  `json:"completed"`
+	CompletedAt int64 `json:"completed_at,omitempty"`
+}
+
+type AchievementState struct {
+	Achievements map[string]*AchievementProgress `json:"achievements"`
+}
+
+type Achievement struct {
+	Key string `json:"key"`
+	*AchievementDefinition
+	AchievementProgress
+}
+
+type ListAchievementsResponse struct {
+	Achievements []*Achievement `json:"achievements"`
+}
+
+func ListAchievementsRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ListAchievements Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	definitions, err := loadAchievementDefinitions(ctx, nk)
+	if err != nil {
+		logger.Error("Error loading achievement definitions: %v", err)
+		return errorResponse(CodeInternal, "error loading achievements")
+	}
+	state, err := readAchievementState(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Error reading achievement progress: %v", err)
+		return errorResponse(CodeInternal, "error reading achievement progress")
+	}
+
+	response := &ListAchievementsResponse{Achievements: make([]*Achievement, 0, len(definitions))}
+	for key, definition := range definitions {
+		achievement := &Achievement{Key: key, AchievementDefinition: definition}
+		if progress, ok := state.Achievements[key]; ok {
+			achievement.AchievementProgress = *progress
+		}
+		response.Achievements = append(response.Achievements, achievement)
+	}
+	sort.Slice(response.Achievements, func(i, j int) bool {
+		return response.Achievements[i].Key < response.Achievements[j].Key
+	})
+
+	return marshalResponse(response)
+}
+
+// progressAchievement adds delta towards the achievement target and grants the reward only on the call that completes it.
+// When the grant fails the achievement is marked incomplete again, so the next progress at the target grants it.
+func progressAchievement(ctx context.Context, nk runtime.NakamaModule, userID, key string, delta int64) (*AchievementProgress, error) {
+	definitions, err := loadAchievementDefinitions(ctx, nk)
+	if err != nil {
+		return nil, err
+	}
+	definition, ok := definitions[key]
+	if !ok {
+		return nil, errUnknownAchievement
+	}
+
+	var progress *AchievementProgress
+	completed := false
+	write := runtime.StorageWrite{
+		Collection:      achievementCollection,
+		Key:             achievementKey,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err = writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		state := &AchievementState{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), state); err != nil {
+				return "", err
+			}
+		}
+		if state.Achievements == nil {
+			state.Achievements = make(map[string]*AchievementProgress)
+		}
+		progress = state.Achievements[key]
+		if progress == nil {
+			progress = &AchievementProgress{}
+			state.Achievements[key] = progress
+		}
+
+		completed = false
+		if !progress.Completed {
+			progress.Progress = max(min(progress.Progress+delta, definition.Target), 0)
+			if progress.Progress >= definition.Target {
+				progress.Completed = true
+				progress.CompletedAt = time.Now().UTC().Unix()
+				completed = true
+			}
+		}
+
+		value, err := json.Marshal(state)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil || !completed {
+		return progress, err
+	}
+
+	metadata := map[string]interface{}{"reason": "achievement", "achievement": key}
+	if err := grantReward(ctx, nk, userID, definition.Reward, metadata); err != nil {
+		completedAt := progress.CompletedAt
+		_, releaseErr := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+			state := &AchievementState{}
+			if err := json.Unmarshal([]byte(current), state); err != nil {
+				return "", err
+			}
+			if released := state.Achievements[key]; released != nil && released.CompletedAt == completedAt {
+				released.Completed = false
+				released.CompletedAt = 0
+				progress = released
+			}
+			value, err := json.Marshal(state)
+			return string(value), err
+		}, storageWriteAttempts)
+		return progress, errors.Join(err, releaseErr)
+	}
+	content := map[string]interface{}{"achievement": key, "reward": definition.Reward}
+	if err := sendNotification(ctx, nk, userID, translate(userLocale(ctx, nk, userID), msgAchievementUnlocked, definition.Name), content, notificationAchievement, notificationPriorityLow); err != nil {
+		return progress, err
+	}
+	return progress, nil
+}
+
+func readAchievementState(ctx context.Context, nk runtime.NakamaModule, userID string) (*AchievementState, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: achievementCollection, Key: achievementKey, UserID: userID}})
+	if err != nil {
+		return nil, err
+	}
+	state := &AchievementState{}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].Value), state); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// loadAchievementDefinitions returns the cached definitions by key, callers must not modify them.
+func loadAchievementDefinitions(ctx context.Context, nk runtime.NakamaModule) (map[string]*AchievementDefinition, error) {
+	return achievementDefinitionCache.Get(achievementDefinitionCollection, func() (map[string]*AchievementDefinition, error) {
+		return listAchievementDefinitions(ctx, nk)
+	}, configCacheTTL)
+}
+
+func listAchievementDefinitions(ctx context.Context, nk runtime.NakamaModule) (map[string]*AchievementDefinition, error) {
+	definitions := make(map[string]*AchievementDefinition)
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", achievementDefinitionCollection, achievementDefinitionPageSize, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			definition := &AchievementDefinition{}
+			if err := json.Unmarshal([]byte(object.Value), definition); err != nil {
+				return nil, err
+			}
+			definitions[object.Key] = definition
+		}
+		if next == "" {
+			return definitions, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProgressAchievementReleasesCompletionWhenGrantFails(t *testing.T) {
+	_, nk := newTestRuntime(t)
+	writeTestObject(t, nk, achievementDefinitionCollection, "wins", "", &AchievementDefinition{
+		Name: "Winner", Target: 2, Reward: &Reward{Currency: map[string]int64{"gold": 5}, Items: map[string]int64{"trophy": 1}},
+	})
+	ctx := newTestContext("u1")
+
+	progress, err := progressAchievement(ctx, nk, "u1", "wins", 2)
+	if err == nil {
+		t.Fatal("completing with an undefined reward item succeeded")
+	}
+	if progress.Completed || progress.Progress != 2 {
+		t.Errorf("progress = %+v, want it at the target but not completed", progress)
+	}
+	if got := nk.Wallets["u1"]["gold"]; got != 0 {
+		t.Errorf("gold = %d after the failed grant, want it taken back", got)
+	}
+
+	defineTestItem(t, nk, "trophy", &ItemDefinition{Name: "Trophy"})
+	if progress, err = progressAchievement(ctx, nk, "u1", "wins", 1); err != nil || !progress.Completed {
+		t.Fatalf("retried progress = %+v, %v, want completed", progress, err)
+	}
+	if _, err := progressAchievement(ctx, nk, "u1", "wins", 1); err != nil {
+		t.Fatalf("progress after completion: %v", err)
+	}
+	if got := nk.Wallets["u1"]["gold"]; got != 5 {
+		t.Errorf("gold = %d, want the reward granted exactly once", got)
+	}
+	if len(nk.NotificationsFor("u1")) != 1 {
+		t.Errorf("sent %d unlock notifications, want 1", len(nk.NotificationsFor("u1")))
+	}
+}
+
+func TestProgressAchievement(t *testing.T) {
+	tests := []struct {
+		name          string
+		deltas        []int64
+		wantProgress  int64
+		wantCompleted bool
+		wantGold      int64
+	}{
+		{name: "partial progress", deltas: []int64{1, 1}, wantProgress: 2},
+		{name: "completion", deltas: []int64{2, 1}, wantProgress: 3, wantCompleted: true, wantGold: 10},
+		{name: "over completion is capped and grants once", deltas: []int64{5, 4}, wantProgress: 3, wantCompleted: true, wantGold: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, nk := newTestRuntime(t)
+			writeTestObject(t, nk, achievementDefinitionCollection, "wins", "", &AchievementDefinition{
+				Name: "Winner", Target: 3, Reward: &Reward{Currency: map[string]int64{"gold": 10}},
+			})
+			ctx := newTestContext("u1")
+
+			var progress *AchievementProgress
+			for _, delta := range tt.deltas {
+				var err error
+				if progress, err = progressAchievement(ctx, nk, "u1", "wins", delta); err != nil {
+					t.Fatalf("progressAchievement: %v", err)
+				}
+			}
+			if progress.Progress != tt.wantProgress || progress.Completed != tt.wantCompleted {
+				t.Errorf("progress = %+v, want %d completed %v", progress, tt.wantProgress, tt.wantCompleted)
+			}
+			if got := nk.Wallets["u1"]["gold"]; got != tt.wantGold {
+				t.Errorf("gold = %d, want %d", got, tt.wantGold)
+			}
+			wantNotifications := 0
+			if tt.wantCompleted {
+				wantNotifications = 1
+			}
+			if got := len(nk.NotificationsFor("u1")); got != wantNotifications {
+				t.Errorf("sent %d unlock notifications, want %d", got, wantNotifications)
+			}
+		})
+	}
+}
+
+func TestProgressAchievementUnknownKey(t *testing.T) {
+	_, nk := newTestRuntime(t)
+	if _, err := progressAchievement(newTestContext("u1"), nk, "u1", "missing", 1); !errors.Is(err, errUnknownAchievement) {
+		t.Errorf("progressAchievement = %v, want errUnknownAchievement", err)
+	}
+}
+
+func TestListAchievementsRpcMergesProgress(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestObject(t, nk, achievementDefinitionCollection, "wins", "", &AchievementDefinition{Name: "Winner", Target: 3})
+	writeTestObject(t, nk, achievementDefinitionCollection, "kills", "", &AchievementDefinition{Name: "Slayer", Target: 100})
+	ctx := newTestContext("u1")
+	if _, err := progressAchievement(ctx, nk, "u1", "wins", 2); err != nil {
+		t.Fatalf("progressAchievement: %v", err)
+	}
+
+	response, err := ListAchievementsRpc(ctx, logger, nil, nk, "")
+	if err != nil {
+		t.Fatalf("ListAchievementsRpc: %v", err)
+	}
+	achievements := decodeResponse[ListAchievementsResponse](t, response).Achievements
+	if len(achievements) != 2 || achievements[0].Key != "kills" || achievements[1].Key != "wins" {
+		t.Fatalf("achievements = %+v, want kills and wins in key order", achievements)
+	}
+	if achievements[0].Progress != 0 || achievements[1].Progress != 2 || achievements[1].Name != "Winner" {
+		t.Errorf("achievements = %+v, %+v, want the definitions with the caller's progress", achievements[0], achievements[1])
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const adminCollection = "admins"
+
+var errAdminOnly = newError(CodePermissionDenied, "admin only")
+
+// requireAdmin accepts server to server calls and users listed in the system owned admins collection, keyed by user
+// id. Session vars are never trusted for this, clients choose them at login and on session refresh. The collection is
+// read on every call, so removing someone from it takes effect immediately.
+func requireAdmin(ctx context.Context, nk runtime.NakamaModule) error {
+	if isServerCall(ctx) {
+		return nil
+	}
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	admin, err := isListedAdmin(ctx, nk, userID)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return errAdminOnly
+	}
+	return nil
+}
+
+// adminOnly rejects the call with permission denied before fn runs unless requireAdmin accepts the caller.
+func adminOnly(fn rpcFunc) rpcFunc {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		if err := requireAdmin(ctx, nk); err != nil {
+			if !errors.Is(err, errAdminOnly) {
+				logger.Error("Error checking admin: %v", err)
+				return errorResponse(CodeInternal, "error checking admin")
+			}
+			userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+			logger.Warn("Rejected admin call from %s", userID)
+			return "", err
+		}
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
+
+func isListedAdmin(ctx context.Context, nk runtime.NakamaModule, userID string) (bool, error) {
+	if userID == "" {
+		return false, nil
+	}
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: adminCollection, Key: userID}})
+	if err != nil {
+		return false, err
+	}
+	return len(objects) > 0, nil
+}
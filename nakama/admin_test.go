@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+var adminRpcs = []string{
+	rpcReloadConfig,
+	rpcReloadChatFilter,
+	rpcReloadFlags,
+	rpcAddItem,
+	rpcBroadcastNotification,
+	rpcReportResult,
+	rpcGrantCurrency,
+	rpcBanUser,
+	rpcUnbanUser,
+	rpcKickUser,
+	rpcStaffReplyTicket,
+}
+
+// testForgedAdminVars are session vars a client can send at login or on session refresh.
+var testForgedAdminVars = map[string]string{"role": "admin"}
+
+func TestAdminRpcsRejectPlayers(t *testing.T) {
+	callers := []struct {
+		name string
+		vars map[string]string
+	}{
+		{name: "player"},
+		{name: "forged role var", vars: testForgedAdminVars},
+	}
+	handlers := rpcHandlers(leaderboardDefaultMaxScore)
+	for _, caller := range callers {
+		for _, id := range adminRpcs {
+			t.Run(caller.name+"/"+id, func(t *testing.T) {
+				logger, nk := newTestRuntime(t)
+				ctx := testutil.NewContext("u1", caller.vars)
+				if _, err := handlers[id](ctx, logger, nil, nk, `{}`); errorCode(err) != CodePermissionDenied {
+					t.Errorf("player call = %v, want permission denied", err)
+				}
+			})
+		}
+	}
+}
+
+func TestAdminRpcsAllowAdmins(t *testing.T) {
+	callers := []struct {
+		name string
+		ctx  func(*testutil.NakamaModule) context.Context
+	}{
+		{name: "server to server", ctx: func(*testutil.NakamaModule) context.Context { return newTestContext("") }},
+		{name: "listed admin", ctx: func(nk *testutil.NakamaModule) context.Context {
+			writeTestObject(t, nk, adminCollection, "staff", "", map[string]string{})
+			return newTestContext("staff")
+		}},
+	}
+	handlers := rpcHandlers(leaderboardDefaultMaxScore)
+	for _, caller := range callers {
+		for _, id := range adminRpcs {
+			t.Run(caller.name+"/"+id, func(t *testing.T) {
+				logger, nk := newTestRuntime(t)
+				if _, err := handlers[id](caller.ctx(nk), logger, nil, nk, `{}`); errorCode(err) == CodePermissionDenied {
+					t.Errorf("admin call = %v, want it past the admin check", err)
+				}
+			})
+		}
+	}
+}
+
+func TestGrantCurrencyRpcAdminOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   string
+		vars     map[string]string
+		wantCode int
+		wantGold int64
+	}{
+		{name: "player cannot mint", caller: "u1", wantCode: CodePermissionDenied},
+		{name: "forged role var cannot mint", caller: "u1", vars: testForgedAdminVars, wantCode: CodePermissionDenied},
+		{name: "listed admin grants", caller: "staff", wantGold: 50},
+		{name: "server grants", wantGold: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			writeTestObject(t, nk, adminCollection, "staff", "", map[string]string{})
+			grant := rpcHandlers(leaderboardDefaultMaxScore)[rpcGrantCurrency]
+			_, err := grant(testutil.NewContext(tt.caller, tt.vars), logger, nil, nk, `{"user_id":"u1","currency":"gold","amount":50}`)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			if got := nk.Wallets["u1"]["gold"]; got != tt.wantGold {
+				t.Errorf("gold = %d, want %d", got, tt.wantGold)
+			}
+		})
+	}
+}
+
+func TestSendMailRpcAttachmentsAdminOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   string
+		vars     map[string]string
+		wantCode int
+	}{
+		{name: "player cannot attach", caller: "u1", wantCode: CodePermissionDenied},
+		{name: "forged role var cannot attach", caller: "u1", vars: testForgedAdminVars, wantCode: CodePermissionDenied},
+		{name: "listed admin attaches", caller: "staff"},
+		{name: "server attaches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			writeTestObject(t, nk, adminCollection, "staff", "", map[string]string{})
+			nk.AddUser("u2", "rin")
+			payload := `{"user_id":"u2","subject":"gift","attachments":{"currency":{"gold":10}}}`
+			_, err := SendMailRpc(testutil.NewContext(tt.caller, tt.vars), logger, nil, nk, payload)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	clientVersionConfigKey = "client_version"
+	deviceBanCollection    = "device_bans"
+
+	sessionVarClientVersion = "client_version"
+	sessionVarDeviceID      = "device_id"
+
+	userByDeviceQuery   = "SELECT user_id FROM user_device WHERE id = $1"
+	userByEmailQuery    = "SELECT id FROM users WHERE email = $1"
+	userByCustomIDQuery = "SELECT id FROM users WHERE custom_id = $1"
+)
+
+func BeforeAuthenticateDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *api.AuthenticateDeviceRequest) (*api.AuthenticateDeviceRequest, error) {
+	if in.Account == nil {
+		return in, nil
+	}
+	vars, err := prepareLogin(ctx, logger, db, nk, userByDeviceQuery, in.Account.Id, in.Account.Id, in.Account.Vars)
+	if err != nil {
+		return nil, err
+	}
+	in.Account.Vars = vars
+	return in, nil
+}
+
+func BeforeAuthenticateEmail(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *api.AuthenticateEmailRequest) (*api.AuthenticateEmailRequest, error) {
+	if in.Account == nil {
+		return in, nil
+	}
+	vars, err := prepareLogin(ctx, logger, db, nk, userByEmailQuery, strings.ToLower(in.Account.Email), in.Account.Vars[sessionVarDeviceID], in.Account.Vars)
+	if err != nil {
+		return nil, err
+	}
+	in.Account.Vars = vars
+	return in, nil
+}
+
+func BeforeAuthenticateCustom(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *api.AuthenticateCustomRequest) (*api.AuthenticateCustomRequest, error) {
+	if in.Account == nil {
+		return in, nil
+	}
+	vars, err := prepareLogin(ctx, logger, db, nk, userByCustomIDQuery, in.Account.Id, in.Account.Vars[sessionVarDeviceID], in.Account.Vars)
+	if err != nil {
+		return nil, err
+	}
+	in.Account.Vars = vars
+	return in, nil
+}
+
+func AfterAuthenticateDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateDeviceRequest) error {
+	flushDigestOnLogin(ctx, logger, nk)
+	return nil
+}
+
+func AfterAuthenticateEmail(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateEmailRequest) error {
+	flushDigestOnLogin(ctx, logger, nk)
+	return nil
+}
+
+func AfterAuthenticateCustom(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateCustomRequest) error {
+	flushDigestOnLogin(ctx, logger, nk)
+	return nil
+}
+
+// flushDigestOnLogin sends what was queued while the player was away, errors are logged and never fail the login.
+func flushDigestOnLogin(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+	if err := flushNotificationDigest(ctx, nk, userID); err != nil {
+		logger.Warn("Error sending notification digest to %s on login: %v", userID, err)
+	}
+}
+
+// prepareLogin is shared by every authentication variant so they gate clients and build session vars the same way.
+// The account being logged into is resolved with query, it is "" on the first login of a new account.
+func prepareLogin(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, query, value, deviceID string, vars map[string]string) (map[string]string, error) {
+	userID, err := existingUserID(ctx, db, query, value)
+	if err != nil {
+		logger.Error("Error resolving account: %v", err)
+		return nil, newError(CodeInternal, "error checking account")
+	}
+	if err := checkClientAllowed(ctx, logger, nk, deviceID, userID, vars); err != nil {
+		return nil, err
+	}
+	return enrichSessionVars(ctx, logger, nk, userID, vars), nil
+}
+
+func checkClientAllowed(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, deviceID, userID string, vars map[string]string) error {
+	var config ClientVersionConfig
+	if _, err := readConfig(ctx, nk, clientVersionConfigKey, &config); err != nil {
+		logger.Error("Error reading client version config: %v", err)
+		return newError(CodeInternal, "error checking client version")
+	}
+	if policy := config.policy(vars[sessionVarPlatform]); policy.status(vars[sessionVarClientVersion]) == clientVersionUnsupported {
+		logger.Info("Rejecting client version `%s` on `%s` below `%s`", vars[sessionVarClientVersion], vars[sessionVarPlatform], policy.floor())
+		return policy.updateRequiredError()
+	}
+
+	banned, err := isDeviceBanned(ctx, nk, deviceID)
+	if err != nil {
+		logger.Error("Error reading device banlist: %v", err)
+		return newError(CodeInternal, "error checking device")
+	}
+	if banned {
+		logger.Info("Rejecting banned device `%s`", deviceID)
+		return newError(CodePermissionDenied, "device is banned")
+	}
+
+	ban, err := activeBan(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Error reading user ban: %v", err)
+		return newError(CodeInternal, "error checking account")
+	}
+	if ban != nil {
+		logger.Info("Rejecting banned user `%s`", userID)
+		return ban.error()
+	}
+	return nil
+}
+
+func isDeviceBanned(ctx context.Context, nk runtime.NakamaModule, deviceID string) (bool, error) {
+	if deviceID == "" {
+		return false, nil
+	}
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: deviceBanCollection, Key: deviceID}})
+	if err != nil {
+		return false, err
+	}
+	return len(objects) > 0, nil
+}
+
+// compareVersions compares dotted numeric versions, missing or malformed parts count as zero.
+func compareVersions(a, b string) int {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+	for i := 0; i < max(len(partsA), len(partsB)); i++ {
+		var numA, numB int
+		if i < len(partsA) {
+			numA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numB, _ = strconv.Atoi(partsB[i])
+		}
+		if numA != numB {
+			if numA < numB {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// existingUserID resolves the account an authentication request is about to log into, "" when it does not exist yet.
+func existingUserID(ctx context.Context, db *sql.DB, query, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	var userID string
+	err := db.QueryRowContext(ctx, query, value).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return userID, err
+}
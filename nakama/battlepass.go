@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	battlepassConfigKey   = "battlepass"
+	battlepassCollection  = "battlepass"
+	battlepassProgressKey = "progress"
+	battlepassArchiveKey  = "season_"
+
+	battlepassTrackFree    = "free"
+	battlepassTrackPremium = "premium"
+
+	battlepassQuestXP = 100
+)
+
+var (
+	errBattlepassNoSeason       = newError(CodeFailedPrecondition, "no battle pass season is running")
+	errBattlepassTierNotReached = newError(CodeFailedPrecondition, "battle pass tier not reached")
+	errBattlepassPremiumLocked  = newError(CodeFailedPrecondition, "premium battle pass not unlocked")
+	errBattlepassAlreadyClaimed = newError(CodeAlreadyExists, "battle pass tier already claimed")
+)
+
+type BattlepassTier struct {
+	XP      int64   `json:"xp"`
+	Free    *Reward `json:"free,omitempty"`
+	Premium *Reward `json:"premium,omitempty"`
+}
+
+// BattlepassConfig describes the running season, tier XP thresholds are cumulative and tiers are numbered from 1.
+type BattlepassConfig struct {
+	SeasonID   string            `json:"season_id"`
+	PremiumSKU string            `json:"premium_sku"`
+	Tiers      []*BattlepassTier `json:"tiers"`
+}
+
+type BattlepassProgress struct {
+	SeasonID       string `json:"season_id"`
+	XP             int64  `json:"xp"`
+	Premium        bool   `json:"premium"`
+	ClaimedFree    []int  `json:"claimed_free"`
+	ClaimedPremium []int  `json:"claimed_premium"`
+}
+
+type ClaimBattlepassTierRequest struct {
+	Tier  int    `json:"tier"`
+	Track string `json:"track"`
+}
+
+type BattlepassResponse struct {
+	*BattlepassProgress
+	Tier  int               `json:"tier"`
+	Tiers []*BattlepassTier `json:"tiers"`
+}
+
+type ClaimBattlepassTierResponse struct {
+	*BattlepassProgress
+	Reward *Reward `json:"reward"`
+}
+
+func GetBattlepassRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GetBattlepass Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	config, progress, err := updateBattlepass(ctx, nk, userID, func(*BattlepassConfig, *BattlepassProgress) error { return nil })
+	if err != nil {
+		return "", runtimeError(logger, err, "updating battle pass")
+	}
+	return marshalResponse(&BattlepassResponse{BattlepassProgress: progress, Tier: battlepassTier(config, progress.XP), Tiers: config.Tiers})
+}
+
+func ClaimBattlepassTierRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ClaimBattlepassTier Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[ClaimBattlepassTierRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.Track == "" {
+		request.Track = battlepassTrackFree
+	}
+	if request.Track != battlepassTrackFree && request.Track != battlepassTrackPremium {
+		return errorResponse(CodeInvalidArgument, "track must be free or premium")
+	}
+
+	var reward *Reward
+	config, progress, err := updateBattlepass(ctx, nk, userID, func(config *BattlepassConfig, progress *BattlepassProgress) error {
+		if request.Tier < 1 || request.Tier > len(config.Tiers) {
+			return newError(CodeInvalidArgument, "tier out of range")
+		}
+		if battlepassTier(config, progress.XP) < request.Tier {
+			return errBattlepassTierNotReached
+		}
+		tier := config.Tiers[request.Tier-1]
+		claimed := &progress.ClaimedFree
+		reward = tier.Free
+		if request.Track == battlepassTrackPremium {
+			if !progress.Premium {
+				return errBattlepassPremiumLocked
+			}
+			claimed = &progress.ClaimedPremium
+			reward = tier.Premium
+		}
+		if slices.Contains(*claimed, request.Tier) {
+			return errBattlepassAlreadyClaimed
+		}
+		*claimed = append(*claimed, request.Tier)
+		return nil
+	})
+	if err != nil {
+		return "", runtimeError(logger, err, "updating battle pass")
+	}
+
+	metadata := map[string]interface{}{"reason": "battlepass", "season_id": config.SeasonID, "tier": request.Tier, "track": request.Track}
+	if err := grantReward(ctx, nk, userID, reward, metadata); err != nil {
+		logger.Error("Error granting battle pass tier %d to %s: %v", request.Tier, userID, err)
+		_, _, releaseErr := updateBattlepass(ctx, nk, userID, func(config *BattlepassConfig, progress *BattlepassProgress) error {
+			claimed := &progress.ClaimedFree
+			if request.Track == battlepassTrackPremium {
+				claimed = &progress.ClaimedPremium
+			}
+			*claimed = slices.DeleteFunc(*claimed, func(tier int) bool { return tier == request.Tier })
+			return nil
+		})
+		if releaseErr != nil {
+			logger.Error("Error releasing battle pass tier %d claim of %s: %v", request.Tier, userID, releaseErr)
+		}
+		return errorResponse(CodeInternal, "error granting battle pass reward")
+	}
+	return marshalResponse(&ClaimBattlepassTierResponse{BattlepassProgress: progress, Reward: reward})
+}
+
+func addBattlepassXP(ctx context.Context, nk runtime.NakamaModule, userID string, xp int64) (*BattlepassProgress, error) {
+	_, progress, err := updateBattlepass(ctx, nk, userID, func(config *BattlepassConfig, progress *BattlepassProgress) error {
+		progress.XP += max(xp, 0)
+		return nil
+	})
+	return progress, err
+}
+
+// unlockBattlepassPremium is called once the premium SKU purchase has been validated.
+func unlockBattlepassPremium(ctx context.Context, nk runtime.NakamaModule, userID string) error {
+	_, _, err := updateBattlepass(ctx, nk, userID, func(config *BattlepassConfig, progress *BattlepassProgress) error {
+		progress.Premium = true
+		return nil
+	})
+	return err
+}
+
+// updateBattlepass applies mutate to the caller's progress for the running season. Progress left over from an
+// earlier season is archived under its season id and reset first, premium included since it is bought per season.
+func updateBattlepass(ctx context.Context, nk runtime.NakamaModule, userID string, mutate func(*BattlepassConfig, *BattlepassProgress) error) (*BattlepassConfig, *BattlepassProgress, error) {
+	config := &BattlepassConfig{}
+	if _, err := readConfig(ctx, nk, battlepassConfigKey, config); err != nil {
+		return nil, nil, err
+	}
+	if config.SeasonID == "" {
+		return nil, nil, errBattlepassNoSeason
+	}
+
+	progress := &BattlepassProgress{}
+	write := runtime.StorageWrite{
+		Collection:      battlepassCollection,
+		Key:             battlepassProgressKey,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		progress = &BattlepassProgress{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), progress); err != nil {
+				return "", err
+			}
+		}
+		if progress.SeasonID != config.SeasonID {
+			if progress.SeasonID != "" {
+				// Overwriting the archive is harmless when a retry gets here again.
+				if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+					Collection:      battlepassCollection,
+					Key:             battlepassArchiveKey + progress.SeasonID,
+					UserID:          userID,
+					Value:           current,
+					PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+					PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+				}}); err != nil {
+					return "", err
+				}
+			}
+			progress = &BattlepassProgress{SeasonID: config.SeasonID}
+		}
+		if progress.ClaimedFree == nil {
+			progress.ClaimedFree = make([]int, 0)
+		}
+		if progress.ClaimedPremium == nil {
+			progress.ClaimedPremium = make([]int, 0)
+		}
+		if err := mutate(config, progress); err != nil {
+			return "", err
+		}
+		value, err := json.Marshal(progress)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, progress, nil
+}
+
+// battlepassTier returns the highest tier whose cumulative XP threshold has been reached, 0 when none.
+func battlepassTier(config *BattlepassConfig, xp int64) int {
+	tier := 0
+	for i, t := range config.Tiers {
+		if xp < t.XP {
+			break
+		}
+		tier = i + 1
+	}
+	return tier
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestClaimBattlepassTierRpcReleasesClaimWhenGrantFails(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, battlepassConfigKey, &BattlepassConfig{SeasonID: "s1", Tiers: []*BattlepassTier{
+		{XP: 0, Free: &Reward{Currency: map[string]int64{"gold": 10}, Items: map[string]int64{"badge": 1}}},
+	}})
+	ctx := newTestContext("u1")
+	claim := `{"tier":1}`
+
+	// The badge is not defined yet, so the grant fails after the gold was credited.
+	if _, err := ClaimBattlepassTierRpc(ctx, logger, nil, nk, claim); errorCode(err) != CodeInternal {
+		t.Fatalf("claim of an undefined item = %v, want internal", err)
+	}
+	if got := nk.Wallets["u1"]["gold"]; got != 0 {
+		t.Errorf("gold = %d after the failed grant, want it taken back", got)
+	}
+	progress := &BattlepassProgress{}
+	readTestObject(t, nk, battlepassCollection, battlepassProgressKey, "u1", progress)
+	if len(progress.ClaimedFree) != 0 {
+		t.Fatalf("claimed = %v, want the claim released", progress.ClaimedFree)
+	}
+
+	defineTestItem(t, nk, "badge", &ItemDefinition{Name: "Badge"})
+	if _, err := ClaimBattlepassTierRpc(ctx, logger, nil, nk, claim); err != nil {
+		t.Fatalf("retried claim: %v", err)
+	}
+	if got := nk.Wallets["u1"]["gold"]; got != 10 {
+		t.Errorf("gold = %d, want 10", got)
+	}
+	if _, err := ClaimBattlepassTierRpc(ctx, logger, nil, nk, claim); errorCode(err) != CodeAlreadyExists {
+		t.Errorf("second claim = %v, want already exists", err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	configCacheTTL = 30 * time.Second
+)
+
+var errCacheLoaderPanicked = errors.New("cache loader panicked")
+
+// configCache holds the raw value of config objects by key, "" when the object does not exist.
+var configCache = newCache[string]()
+
+type ReloadConfigRequest struct {
+	Key string `json:"key"`
+}
+
+type ReloadConfigResponse struct {
+	Key   string `json:"key"`
+	Found bool   `json:"found"`
+}
+
+type cacheEntry[T any] struct {
+	value    T
+	loadedAt time.Time
+	ttl      time.Duration
+}
+
+type cacheCall[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Cache memoizes loader results per key until their TTL expires. Concurrent misses on a key share a single loader call.
+type Cache[T any] struct {
+	mu      sync.RWMutex
+	entries map[string]*cacheEntry[T]
+	calls   map[string]*cacheCall[T]
+}
+
+func newCache[T any]() *Cache[T] {
+	return &Cache[T]{entries: make(map[string]*cacheEntry[T]), calls: make(map[string]*cacheCall[T])}
+}
+
+// Get returns the cached value for key, calling loader when it is missing or expired. Loader errors are not cached.
+func (c *Cache[T]) Get(key string, loader func() (T, error), ttl time.Duration) (T, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok && time.Since(entry.loadedAt) < entry.ttl {
+		return entry.value, nil
+	}
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && time.Since(entry.loadedAt) < entry.ttl {
+		c.mu.Unlock()
+		return entry.value, nil
+	}
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &cacheCall[T]{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	// The call is released even when loader panics, waiters then see the zero value and an error instead of
+	// blocking forever.
+	call.err = errCacheLoaderPanicked
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		if call.err == nil {
+			c.entries[key] = &cacheEntry[T]{value: call.value, loadedAt: time.Now(), ttl: ttl}
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	call.value, call.err = loader()
+	return call.value, call.err
+}
+
+// Peek returns the last loaded value for key even when it has expired.
+func (c *Cache[T]) Peek(key string) (T, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// Invalidate expires key so the next Get reloads it, the stale value stays available to Peek.
+func (c *Cache[T]) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok {
+		entry.loadedAt = time.Time{}
+	}
+}
+
+// readCachedConfig is readConfig served from configCache, every call unmarshals into its own out.
+func readCachedConfig(ctx context.Context, nk runtime.NakamaModule, key string, out interface{}) (bool, error) {
+	value, err := configCache.Get(key, func() (string, error) {
+		objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: configCollection, Key: key}})
+		if err != nil || len(objects) == 0 {
+			return "", err
+		}
+		return objects[0].Value, nil
+	}, configCacheTTL)
+	if err != nil || value == "" {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(value), out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReloadConfigRpc is registered admin only, it drops a cached config object so edits apply before the TTL runs out.
+func ReloadConfigRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ReloadConfig Called - Payload: `%s`", payload)
+	request, err := parsePayload[ReloadConfigRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.Key == "" {
+		return errorResponse(CodeInvalidArgument, "key is required")
+	}
+
+	if request.Key == achievementDefinitionCollection {
+		achievementDefinitionCache.Invalidate(request.Key)
+		definitions, err := loadAchievementDefinitions(ctx, nk)
+		if err != nil {
+			logger.Error("Error reloading achievement definitions: %v", err)
+			return errorResponse(CodeInternal, "error reloading config")
+		}
+		return marshalResponse(&ReloadConfigResponse{Key: request.Key, Found: len(definitions) > 0})
+	}
+	if request.Key == itemDefinitionCollection {
+		itemDefinitionCache.Invalidate(request.Key)
+		definitions, err := loadItemDefinitions(ctx, nk)
+		if err != nil {
+			logger.Error("Error reloading item definitions: %v", err)
+			return errorResponse(CodeInternal, "error reloading config")
+		}
+		return marshalResponse(&ReloadConfigResponse{Key: request.Key, Found: len(definitions) > 0})
+	}
+
+	var config json.RawMessage
+	configCache.Invalidate(request.Key)
+	found, err := readCachedConfig(ctx, nk, request.Key, &config)
+	if err != nil {
+		logger.Error("Error reloading config %s: %v", request.Key, err)
+		return errorResponse(CodeInternal, "error reloading config")
+	}
+	return marshalResponse(&ReloadConfigResponse{Key: request.Key, Found: found})
+}
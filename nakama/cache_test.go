@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+func TestCacheGet(t *testing.T) {
+	cache := newCache[int]()
+	loads := 0
+	loader := func() (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if value, err := cache.Get("key", loader, time.Minute); err != nil || value != 1 {
+			t.Fatalf("Get %d = %d, %v, want the first load", i, value, err)
+		}
+	}
+	cache.Invalidate("key")
+	if value, _ := cache.Get("key", loader, time.Minute); value != 2 {
+		t.Errorf("Get after Invalidate = %d, want a reload", value)
+	}
+	if value, _ := cache.Get("expired", loader, 0); value != 3 {
+		t.Errorf("Get with no ttl = %d, want a load", value)
+	}
+	if value, _ := cache.Get("expired", loader, 0); value != 4 {
+		t.Errorf("Get of an expired key = %d, want a reload", value)
+	}
+}
+
+func TestCacheGetDoesNotCacheErrors(t *testing.T) {
+	cache := newCache[int]()
+	if _, err := cache.Get("key", func() (int, error) { return 0, errors.New("down") }, time.Minute); err == nil {
+		t.Fatal("Get = nil error, want the loader error")
+	}
+	if value, err := cache.Get("key", func() (int, error) { return 7, nil }, time.Minute); err != nil || value != 7 {
+		t.Errorf("Get after an error = %d, %v, want a fresh load", value, err)
+	}
+}
+
+func TestCacheGetSharesConcurrentLoads(t *testing.T) {
+	cache := newCache[int]()
+	release := make(chan struct{})
+	var loads atomic.Int32
+	loader := func() (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := cache.Get("key", loader, time.Minute); err != nil || value != 42 {
+				t.Errorf("Get = %d, %v, want 42", value, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := loads.Load(); got != 1 {
+		t.Errorf("loader ran %d times, want once", got)
+	}
+}
+
+func TestCacheGetSurvivesPanickingLoader(t *testing.T) {
+	cache := newCache[int]()
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { _ = recover() }()
+		_, _ = cache.Get("key", func() (int, error) {
+			close(started)
+			<-release
+			panic("loader bug")
+		}, time.Minute)
+	}()
+	<-started
+
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := cache.Get("key", func() (int, error) { return 1, nil }, time.Minute)
+		waiter <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-waiter:
+		if !errors.Is(err, errCacheLoaderPanicked) {
+			t.Errorf("waiter error = %v, want errCacheLoaderPanicked", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter still blocked after the loader panicked")
+	}
+
+	done := make(chan int, 1)
+	go func() {
+		value, _ := cache.Get("key", func() (int, error) { return 2, nil }, time.Minute)
+		done <- value
+	}()
+	select {
+	case value := <-done:
+		if value != 2 {
+			t.Errorf("Get after the panic = %d, want a fresh load", value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get blocked after the loader panicked")
+	}
+}
+
+// countingListModule counts how often storage is listed.
+type countingListModule struct {
+	*testutil.NakamaModule
+	lists int
+}
+
+func (m *countingListModule) StorageList(ctx context.Context, callerID, userID, collection string, limit int, cursor string) ([]*api.StorageObject, string, error) {
+	m.lists++
+	return m.NakamaModule.StorageList(ctx, callerID, userID, collection, limit, cursor)
+}
+
+func TestLoadItemDefinitionsIsCached(t *testing.T) {
+	logger, fake := newTestRuntime(t)
+	nk := &countingListModule{NakamaModule: fake}
+	writeTestObject(t, nk, itemDefinitionCollection, "potion", "", &ItemDefinition{Name: "Potion", MaxStack: 5})
+	ctx := newTestContext("")
+
+	for i := 0; i < 3; i++ {
+		definitions, err := loadItemDefinitions(ctx, nk)
+		if err != nil || definitions["potion"] == nil {
+			t.Fatalf("loadItemDefinitions = %v, %v, want potion", definitions, err)
+		}
+	}
+	if nk.lists != 1 {
+		t.Errorf("listed item definitions %d times, want once", nk.lists)
+	}
+
+	writeTestObject(t, nk, itemDefinitionCollection, "sword", "", &ItemDefinition{Name: "Sword"})
+	if _, err := ReloadConfigRpc(ctx, logger, nil, nk, `{"key":"item_defs"}`); err != nil {
+		t.Fatalf("ReloadConfigRpc: %v", err)
+	}
+	definitions, err := loadItemDefinitions(ctx, nk)
+	if err != nil || definitions["sword"] == nil {
+		t.Errorf("definitions after reload = %v, %v, want sword", definitions, err)
+	}
+}
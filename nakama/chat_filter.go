@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	chatFilterConfigKey         = "chat_filter"
+	chatMinInterval             = time.Second
+	chatSenderRetention         = 10 * time.Minute
+	channelMessageSendMessageID = "ChannelMessageSend"
+)
+
+var (
+	errChatProfanity = newError(CodeInvalidArgument, "message contains blocked words")
+	errChatDuplicate = newError(CodeInvalidArgument, "duplicate message")
+	errChatTooFast   = newError(CodeResourceExhausted, "sending messages too fast")
+)
+
+var chatMessageFilter = newChatFilter(chatMinInterval)
+
+// ChatFilterConfig lists blocked words, Reject refuses the whole message instead of masking them.
+type ChatFilterConfig struct {
+	Words  []string `json:"words"`
+	Reject bool     `json:"reject"`
+}
+
+type ReloadChatFilterResponse struct {
+	Words int `json:"words"`
+}
+
+type chatSender struct {
+	content string
+	sentAt  time.Time
+}
+
+type chatFilter struct {
+	mu          sync.Mutex
+	minInterval time.Duration
+	loaded      bool
+	words       map[string]bool
+	reject      bool
+	senders     map[string]*chatSender
+	lastSweep   time.Time
+}
+
+func newChatFilter(minInterval time.Duration) *chatFilter {
+	return &chatFilter{minInterval: minInterval, words: make(map[string]bool), senders: make(map[string]*chatSender)}
+}
+
+// BeforeChannelMessageSend masks or rejects blocked words and drops spam before the message reaches the channel.
+func BeforeChannelMessageSend(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *rtapi.Envelope) (*rtapi.Envelope, error) {
+	message := in.GetChannelMessageSend()
+	if message == nil {
+		return in, nil
+	}
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := chatMessageFilter.ensureLoaded(ctx, nk); err != nil {
+		logger.Error("Error loading chat filter: %v", err)
+		return nil, newError(CodeInternal, "error loading chat filter")
+	}
+	content, err := chatMessageFilter.filter(userID, message.Content, time.Now())
+	if err != nil {
+		logger.Warn("Rejected chat message from %s: %v", userID, err)
+		return nil, err
+	}
+	message.Content = content
+	return in, nil
+}
+
+// ReloadChatFilterRpc is registered admin only, it picks up an edited word list without a restart.
+func ReloadChatFilterRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ReloadChatFilter Called - Payload: `%s`", payload)
+	words, err := chatMessageFilter.reload(ctx, nk)
+	if err != nil {
+		logger.Error("Error reloading chat filter: %v", err)
+		return errorResponse(CodeInternal, "error reloading chat filter")
+	}
+	return marshalResponse(&ReloadChatFilterResponse{Words: words})
+}
+
+func (f *chatFilter) ensureLoaded(ctx context.Context, nk runtime.NakamaModule) error {
+	f.mu.Lock()
+	loaded := f.loaded
+	f.mu.Unlock()
+	if loaded {
+		return nil
+	}
+	_, err := f.reload(ctx, nk)
+	return err
+}
+
+func (f *chatFilter) reload(ctx context.Context, nk runtime.NakamaModule) (int, error) {
+	var config ChatFilterConfig
+	if _, err := readConfig(ctx, nk, chatFilterConfigKey, &config); err != nil {
+		return 0, err
+	}
+	words := make(map[string]bool, len(config.Words))
+	for _, word := range config.Words {
+		words[strings.ToLower(word)] = true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.words = words
+	f.reject = config.Reject
+	f.loaded = true
+	return len(words), nil
+}
+
+// filter applies the spam checks for userID and returns the content with every string value sanitized.
+func (f *chatFilter) filter(userID, content string, now time.Time) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now.Sub(f.lastSweep) > chatSenderRetention {
+		for id, sender := range f.senders {
+			if now.Sub(sender.sentAt) > chatSenderRetention {
+				delete(f.senders, id)
+			}
+		}
+		f.lastSweep = now
+	}
+
+	if sender, ok := f.senders[userID]; ok {
+		if sender.content == content {
+			return "", errChatDuplicate
+		}
+		if now.Sub(sender.sentAt) < f.minInterval {
+			return "", errChatTooFast
+		}
+	}
+
+	var value map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return errorResponse(CodeInvalidArgument, "message content must be a JSON object")
+	}
+	blocked := false
+	for key, field := range value {
+		if text, ok := field.(string); ok {
+			masked, found := f.mask(text)
+			value[key] = masked
+			blocked = blocked || found
+		}
+	}
+	if blocked && f.reject {
+		return "", errChatProfanity
+	}
+
+	f.senders[userID] = &chatSender{content: content, sentAt: now}
+	if !blocked {
+		return content, nil
+	}
+	sanitized, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(sanitized), nil
+}
+
+// sanitize masks the blocked words of a plain text message, or rejects it when the filter is set to reject.
+func (f *chatFilter) sanitize(text string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	masked, found := f.mask(text)
+	if found && f.reject {
+		return "", errChatProfanity
+	}
+	return masked, nil
+}
+
+// mask replaces each blocked word with asterisks, matching whole words case insensitively.
+func (f *chatFilter) mask(text string) (string, bool) {
+	runes := []rune(text)
+	found := false
+	for start := 0; start < len(runes); {
+		if !unicode.IsLetter(runes[start]) && !unicode.IsDigit(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+			end++
+		}
+		if f.words[strings.ToLower(string(runes[start:end]))] {
+			for i := start; i < end; i++ {
+				runes[i] = '*'
+			}
+			found = true
+		}
+		start = end
+	}
+	return string(runes), found
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	sessionVarPlatform = "platform"
+
+	clientUpdateField = "client_update"
+)
+
+const (
+	clientVersionSupported = iota
+	clientVersionOutdated
+	clientVersionUnsupported
+)
+
+// PlatformVersionPolicy blocks clients below ToleratedVersion and warns the ones between it and MinVersion.
+// Without a ToleratedVersion there is no grace band and everything below MinVersion is blocked.
+type PlatformVersionPolicy struct {
+	MinVersion       string `json:"min_version"`
+	ToleratedVersion string `json:"tolerated_version,omitempty"`
+	StoreURL         string `json:"store_url,omitempty"`
+}
+
+// ClientVersionConfig applies its top level policy to platforms that have no entry of their own in Platforms.
+type ClientVersionConfig struct {
+	PlatformVersionPolicy
+	Platforms map[string]*PlatformVersionPolicy `json:"platforms,omitempty"`
+}
+
+// ClientUpdate is added under client_update to the successful responses of outdated but tolerated clients.
+type ClientUpdate struct {
+	UpdateAvailable bool   `json:"update_available"`
+	MinVersion      string `json:"min_version"`
+	StoreURL        string `json:"store_url,omitempty"`
+}
+
+// withClientVersion checks the client_version and platform session vars sent at login on every call, so a minimum
+// version raised after the session was issued still forces the update. Server to server calls are never checked.
+func withClientVersion(fn rpcFunc) rpcFunc {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		if isServerCall(ctx) {
+			return fn(ctx, logger, db, nk, payload)
+		}
+		var config ClientVersionConfig
+		if _, err := readCachedConfig(ctx, nk, clientVersionConfigKey, &config); err != nil {
+			// The login check already failed closed, an unreadable config must not take every RPC down with it.
+			logger.Warn("Error reading client version config: %v", err)
+			return fn(ctx, logger, db, nk, payload)
+		}
+
+		vars, _ := ctx.Value(runtime.RUNTIME_CTX_VARS).(map[string]string)
+		version := vars[sessionVarClientVersion]
+		policy := config.policy(vars[sessionVarPlatform])
+		switch policy.status(version) {
+		case clientVersionUnsupported:
+			logger.Info("Rejecting rpc from client version `%s` on `%s` below `%s`", version, vars[sessionVarPlatform], policy.floor())
+			err := policy.updateRequiredError()
+			return err.Message, err
+		case clientVersionOutdated:
+			response, err := fn(ctx, logger, db, nk, payload)
+			if err != nil {
+				return response, err
+			}
+			return addClientUpdate(response, &ClientUpdate{UpdateAvailable: true, MinVersion: policy.MinVersion, StoreURL: policy.StoreURL}), nil
+		}
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
+
+// policy returns the policy of platform, matched case insensitively, falling back to the top level one.
+func (c *ClientVersionConfig) policy(platform string) *PlatformVersionPolicy {
+	if policy, ok := c.Platforms[strings.ToLower(platform)]; ok && policy != nil {
+		return policy
+	}
+	return &c.PlatformVersionPolicy
+}
+
+// floor is the lowest version still allowed in, "" when every version is.
+func (p *PlatformVersionPolicy) floor() string {
+	if p.ToleratedVersion != "" {
+		return p.ToleratedVersion
+	}
+	return p.MinVersion
+}
+
+func (p *PlatformVersionPolicy) status(version string) int {
+	if floor := p.floor(); floor != "" && compareVersions(version, floor) < 0 {
+		return clientVersionUnsupported
+	}
+	if p.MinVersion != "" && compareVersions(version, p.MinVersion) < 0 {
+		return clientVersionOutdated
+	}
+	return clientVersionSupported
+}
+
+// updateRequiredError carries force_update so clients can tell it from other failed preconditions and open the store.
+func (p *PlatformVersionPolicy) updateRequiredError() *runtime.Error {
+	message := "client version no longer supported, please update"
+	body, err := json.Marshal(&ErrorResponse{Code: CodeFailedPrecondition, Message: message, ForceUpdate: true, StoreURL: p.StoreURL})
+	if err != nil {
+		return newError(CodeFailedPrecondition, message)
+	}
+	return runtime.NewError(string(body), CodeFailedPrecondition)
+}
+
+// addClientUpdate adds the warning to a JSON object response, any other response is returned unchanged.
+func addClientUpdate(response string, update *ClientUpdate) string {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal([]byte(response), &fields) != nil || fields == nil {
+		return response
+	}
+	value, err := json.Marshal(update)
+	if err != nil {
+		return response
+	}
+	fields[clientUpdateField] = value
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return response
+	}
+	return string(body)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "1.2.3", b: "1.2.3", want: 0},
+		{a: "1.2", b: "1.2.0", want: 0},
+		{a: "1.10.0", b: "1.9.9", want: 1},
+		{a: "1.9.9", b: "1.10.0", want: -1},
+		{a: "2", b: "1.99", want: 1},
+		{a: "1.x.5", b: "1.0.5", want: 0},
+		{a: "", b: "0.0.1", want: -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestWithClientVersion(t *testing.T) {
+	config := &ClientVersionConfig{
+		PlatformVersionPolicy: PlatformVersionPolicy{MinVersion: "2.0.0", ToleratedVersion: "1.5.0", StoreURL: "https://example.com/store"},
+		Platforms: map[string]*PlatformVersionPolicy{
+			"ios":     {MinVersion: "3.0.0", ToleratedVersion: "2.5.0", StoreURL: "https://example.com/ios"},
+			"android": {MinVersion: "2.0.0"},
+		},
+	}
+	tests := []struct {
+		name         string
+		userID       string
+		platform     string
+		version      string
+		wantBlocked  bool
+		wantWarned   bool
+		wantStoreURL string
+	}{
+		{name: "supported", userID: "u1", version: "2.1.0"},
+		{name: "tolerated gets a warning", userID: "u1", version: "1.6.0", wantWarned: true, wantStoreURL: "https://example.com/store"},
+		{name: "below the grace band is blocked", userID: "u1", version: "1.4.9", wantBlocked: true, wantStoreURL: "https://example.com/store"},
+		{name: "no version sent is blocked", userID: "u1", wantBlocked: true, wantStoreURL: "https://example.com/store"},
+		{name: "platform policy", userID: "u1", platform: "ios", version: "2.6.0", wantWarned: true, wantStoreURL: "https://example.com/ios"},
+		{name: "platform is matched case insensitively", userID: "u1", platform: "IOS", version: "2.2.0", wantBlocked: true, wantStoreURL: "https://example.com/ios"},
+		{name: "platform without a grace band", userID: "u1", platform: "android", version: "1.9.0", wantBlocked: true},
+		{name: "unknown platform falls back", userID: "u1", platform: "switch", version: "2.0.0"},
+		{name: "server calls are not checked", version: "0.1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			writeTestConfig(t, nk, clientVersionConfigKey, config)
+			called := false
+			handler := withClientVersion(func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+				called = true
+				return `{"ok":true}`, nil
+			})
+			ctx := testutil.NewContext(tt.userID, map[string]string{sessionVarClientVersion: tt.version, sessionVarPlatform: tt.platform})
+
+			response, err := handler(ctx, logger, nil, nk, "")
+			if tt.wantBlocked {
+				if code := errorCode(err); code != CodeFailedPrecondition {
+					t.Fatalf("error = %v, want failed precondition", err)
+				}
+				if called {
+					t.Error("a blocked client reached the handler")
+				}
+				body := decodeResponse[ErrorResponse](t, err.Error())
+				if !body.ForceUpdate || body.StoreURL != tt.wantStoreURL {
+					t.Errorf("error body = %+v, want force_update with store url %q", body, tt.wantStoreURL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+			fields := *decodeResponse[map[string]json.RawMessage](t, response)
+			if string(fields["ok"]) != "true" {
+				t.Errorf("response = %s, want the handler's fields kept", response)
+			}
+			raw, warned := fields[clientUpdateField]
+			if warned != tt.wantWarned {
+				t.Fatalf("response = %s, warned = %v, want %v", response, warned, tt.wantWarned)
+			}
+			if !warned {
+				return
+			}
+			update := &ClientUpdate{}
+			if err := json.Unmarshal(raw, update); err != nil {
+				t.Fatalf("unmarshalling client_update: %v", err)
+			}
+			if !update.UpdateAvailable || update.StoreURL != tt.wantStoreURL {
+				t.Errorf("client_update = %+v, want an update at %q", update, tt.wantStoreURL)
+			}
+		})
+	}
+}
+
+func TestWithClientVersionLeavesOutdatedFailuresAlone(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, clientVersionConfigKey, &ClientVersionConfig{PlatformVersionPolicy: PlatformVersionPolicy{MinVersion: "2.0.0", ToleratedVersion: "1.0.0"}})
+	ctx := testutil.NewContext("u1", map[string]string{sessionVarClientVersion: "1.5.0"})
+	wantErr := newError(CodeNotFound, "missing")
+
+	failing := withClientVersion(func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+		return "", wantErr
+	})
+	if _, err := failing(ctx, logger, nil, nk, ""); err != wantErr {
+		t.Errorf("error = %v, want the handler's error", err)
+	}
+
+	plain := withClientVersion(func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+		return `"pong"`, nil
+	})
+	if response, err := plain(ctx, logger, nil, nk, ""); err != nil || response != `"pong"` {
+		t.Errorf("response = %q, %v, want a non object response unchanged", response, err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	dailyRewardCollection = "daily_rewards"
+	dailyRewardKey        = "state"
+	dailyRewardCurrency   = "coins"
+)
+
+var dailyRewardAmounts = []int64{100, 150, 200, 250, 300, 400, 500}
+
+type DailyRewardState struct {
+	LastClaim int64 `json:"last_claim"`
+	Streak    int   `json:"streak"`
+}
+
+type ClaimDailyRewardResponse struct {
+	Streak    int              `json:"streak"`
+	Reward    map[string]int64 `json:"reward"`
+	NextClaim int64            `json:"next_claim"`
+}
+
+func ClaimDailyRewardRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ClaimDailyReward Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	today := utcDay(now)
+	nextClaim := today.AddDate(0, 0, 1)
+	state, previous := &DailyRewardState{}, DailyRewardState{}
+	write := runtime.StorageWrite{
+		Collection:      dailyRewardCollection,
+		Key:             dailyRewardKey,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err = writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		state = &DailyRewardState{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), state); err != nil {
+				return "", err
+			}
+		}
+		previous = *state
+		if state.LastClaim > 0 {
+			lastDay := utcDay(time.Unix(state.LastClaim, 0))
+			// A stored claim dated after today means clock skew, treat it as already claimed.
+			if !lastDay.Before(today) {
+				wait := int64(nextClaim.Sub(now).Seconds())
+				return "", newErrorf(CodeAlreadyExists, "daily reward already claimed, next claim in %ss", strconv.FormatInt(wait, 10))
+			}
+			if lastDay.Equal(today.AddDate(0, 0, -1)) {
+				state.Streak++
+			} else {
+				state.Streak = 1
+			}
+		} else {
+			state.Streak = 1
+		}
+		state.LastClaim = now.Unix()
+
+		value, err := json.Marshal(state)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return "", runtimeError(logger, err, "writing daily reward state")
+	}
+
+	reward := map[string]int64{dailyRewardCurrency: dailyRewardAmount(state.Streak)}
+	metadata := map[string]interface{}{"reason": "daily_reward", "streak": state.Streak}
+	if _, _, err := nk.WalletUpdate(ctx, userID, reward, metadata, true); err != nil {
+		logger.Error("Error granting daily reward: %v", err)
+		if err := releaseDailyReward(ctx, nk, write, state.LastClaim, &previous); err != nil {
+			logger.Error("Error releasing daily reward claim of %s: %v", userID, err)
+		}
+		return errorResponse(CodeInternal, "error granting daily reward")
+	}
+
+	return marshalResponse(&ClaimDailyRewardResponse{Streak: state.Streak, Reward: reward, NextClaim: nextClaim.Unix()})
+}
+
+// releaseDailyReward puts back the state from before a claim whose reward could not be granted, so the player can
+// claim again. It leaves the state alone once it no longer holds that claim.
+func releaseDailyReward(ctx context.Context, nk runtime.NakamaModule, write runtime.StorageWrite, claimedAt int64, previous *DailyRewardState) error {
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		state := &DailyRewardState{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), state); err != nil {
+				return "", err
+			}
+		}
+		if state.LastClaim == claimedAt {
+			state = previous
+		}
+		value, err := json.Marshal(state)
+		return string(value), err
+	}, storageWriteAttempts)
+	return err
+}
+
+func dailyRewardAmount(streak int) int64 {
+	index := min(streak, len(dailyRewardAmounts)) - 1
+	return dailyRewardAmounts[max(index, 0)]
+}
+
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
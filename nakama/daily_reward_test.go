@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestClaimDailyRewardRpcReleasesClaimWhenGrantFails(t *testing.T) {
+	logger, fake := newTestRuntime(t)
+	nk := &failingWalletModule{NakamaModule: fake, fail: true}
+	ctx := newTestContext("u1")
+
+	if _, err := ClaimDailyRewardRpc(ctx, logger, nil, nk, ""); errorCode(err) != CodeInternal {
+		t.Fatalf("claim with a failing wallet = %v, want internal", err)
+	}
+	state := &DailyRewardState{}
+	if readTestObject(t, nk, dailyRewardCollection, dailyRewardKey, "u1", state) && state.LastClaim != 0 {
+		t.Fatalf("state = %+v, want the claim released", state)
+	}
+
+	nk.fail = false
+	response, err := ClaimDailyRewardRpc(ctx, logger, nil, nk, "")
+	if err != nil {
+		t.Fatalf("retried claim: %v", err)
+	}
+	if claimed := decodeResponse[ClaimDailyRewardResponse](t, response); claimed.Streak != 1 {
+		t.Errorf("streak = %d, want 1", claimed.Streak)
+	}
+	if got := fake.Wallets["u1"][dailyRewardCurrency]; got != dailyRewardAmounts[0] {
+		t.Errorf("%s = %d, want %d", dailyRewardCurrency, got, dailyRewardAmounts[0])
+	}
+	if _, err := ClaimDailyRewardRpc(ctx, logger, nil, nk, ""); errorCode(err) != CodeAlreadyExists {
+		t.Errorf("second claim = %v, want already exists", err)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	energyConfigKey  = "energy"
+	energyCollection = "energy"
+	energyKey        = "state"
+
+	energyDefaultMax          = 100
+	energyDefaultRegenSeconds = 300
+
+	energyActionOpenLootbox = "open_lootbox"
+	// energyActionCreateHordeMatch prices every way into a match: creating one, or being matched by the matchmaker,
+	// where every matched player pays once the match is made. Tickets only check that the player could pay.
+	energyActionCreateHordeMatch = "create_horde_match"
+)
+
+// EnergyConfig regenerates one point every RegenSeconds up to Max, Costs prices the gated actions and an action
+// without a cost is free.
+type EnergyConfig struct {
+	Max          int64            `json:"max"`
+	RegenSeconds int64            `json:"regen_seconds"`
+	Costs        map[string]int64 `json:"costs"`
+}
+
+// EnergyState is only brought up to date when it is read for a change, UpdatedAt is when the last point was
+// regenerated so partial progress towards the next one survives a write.
+type EnergyState struct {
+	Energy    int64 `json:"energy"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+type SpendEnergyRequest struct {
+	Amount int64 `json:"amount"`
+}
+
+type EnergyResponse struct {
+	Energy        int64 `json:"energy"`
+	Max           int64 `json:"max"`
+	SecondsToNext int64 `json:"seconds_to_next"`
+	SecondsToFull int64 `json:"seconds_to_full"`
+	RegenSeconds  int64 `json:"regen_seconds"`
+	UpdatedAt     int64 `json:"updated_at"`
+	SpentEnergy   int64 `json:"spent,omitempty"`
+}
+
+func GetEnergyRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GetEnergy Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	config, err := readEnergyConfig(ctx, nk)
+	if err != nil {
+		logger.Error("Error reading energy config: %v", err)
+		return errorResponse(CodeInternal, "error reading energy config")
+	}
+	now := time.Now().UTC().Unix()
+	state, err := readEnergyState(ctx, nk, userID, config, now)
+	if err != nil {
+		logger.Error("Error reading energy: %v", err)
+		return errorResponse(CodeInternal, "error reading energy")
+	}
+	return marshalResponse(energyResponse(config, &state, now))
+}
+
+func SpendEnergyRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("SpendEnergy Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[SpendEnergyRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.Amount <= 0 {
+		return errorResponse(CodeInvalidArgument, "amount must be positive")
+	}
+
+	config, err := readEnergyConfig(ctx, nk)
+	if err != nil {
+		logger.Error("Error reading energy config: %v", err)
+		return errorResponse(CodeInternal, "error reading energy config")
+	}
+	state, err := spendEnergy(ctx, nk, userID, config, request.Amount)
+	if err != nil {
+		return "", runtimeError(logger, err, "updating energy")
+	}
+	response := energyResponse(config, state, time.Now().UTC().Unix())
+	response.SpentEnergy = request.Amount
+	return marshalResponse(response)
+}
+
+// requireEnergy charges the configured cost of action and returns what it charged so a failed action can hand it
+// back with refundEnergy. Not enough energy fails with resource exhausted and the seconds until there is.
+func requireEnergy(ctx context.Context, nk runtime.NakamaModule, userID, action string) (int64, error) {
+	config, err := readEnergyConfig(ctx, nk)
+	if err != nil {
+		return 0, err
+	}
+	cost := config.Costs[action]
+	if cost <= 0 {
+		return 0, nil
+	}
+	if _, err := spendEnergy(ctx, nk, userID, config, cost); err != nil {
+		return 0, err
+	}
+	return cost, nil
+}
+
+// checkEnergy fails like requireEnergy when userID cannot pay for action right now, without charging anything.
+func checkEnergy(ctx context.Context, nk runtime.NakamaModule, userID, action string) error {
+	config, err := readEnergyConfig(ctx, nk)
+	if err != nil {
+		return err
+	}
+	cost := config.Costs[action]
+	if cost <= 0 {
+		return nil
+	}
+	now := time.Now().UTC().Unix()
+	state, err := readEnergyState(ctx, nk, userID, config, now)
+	if err != nil {
+		return err
+	}
+	if state.Energy < cost {
+		return errNotEnoughEnergy(secondsUntilEnergy(config, state, cost, now))
+	}
+	return nil
+}
+
+func refundEnergy(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, amount int64) {
+	if amount <= 0 {
+		return
+	}
+	config, err := readEnergyConfig(ctx, nk)
+	if err == nil {
+		_, err = spendEnergy(ctx, nk, userID, config, -amount)
+	}
+	if err != nil {
+		logger.Error("Error refunding %d energy to %s: %v", amount, userID, err)
+	}
+}
+
+// requireEnergyEach charges the cost of action to every user, handing back what was charged already when one of them
+// is short. The returned charges are for refundEnergyEach.
+func requireEnergyEach(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userIDs []string, action string) (map[string]int64, error) {
+	charged := make(map[string]int64, len(userIDs))
+	for _, userID := range userIDs {
+		energy, err := requireEnergy(ctx, nk, userID, action)
+		if err != nil {
+			refundEnergyEach(ctx, logger, nk, charged)
+			var runtimeErr *runtime.Error
+			if errors.As(err, &runtimeErr) && runtimeErr.Code == CodeResourceExhausted {
+				return nil, newErrorf(CodeResourceExhausted, "not enough energy for %s", userID)
+			}
+			return nil, err
+		}
+		charged[userID] = energy
+	}
+	return charged, nil
+}
+
+func refundEnergyEach(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, charged map[string]int64) {
+	for userID, energy := range charged {
+		refundEnergy(ctx, logger, nk, userID, energy)
+	}
+}
+
+// spendEnergy regenerates the stored energy up to now and takes amount from it, a negative amount refunds and may
+// go over the cap.
+func spendEnergy(ctx context.Context, nk runtime.NakamaModule, userID string, config *EnergyConfig, amount int64) (*EnergyState, error) {
+	state := &EnergyState{}
+	write := runtime.StorageWrite{
+		Collection:      energyCollection,
+		Key:             energyKey,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		now := time.Now().UTC().Unix()
+		state = &EnergyState{Energy: config.Max, UpdatedAt: now}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), state); err != nil {
+				return "", err
+			}
+		}
+		*state = regenerateEnergy(config, *state, now)
+		if state.Energy < amount {
+			return "", errNotEnoughEnergy(secondsUntilEnergy(config, *state, amount, now))
+		}
+		state.Energy -= amount
+		value, err := json.Marshal(state)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// readEnergyState returns the stored energy of userID regenerated up to now, a user without one starts full.
+func readEnergyState(ctx context.Context, nk runtime.NakamaModule, userID string, config *EnergyConfig, now int64) (EnergyState, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: energyCollection, Key: energyKey, UserID: userID}})
+	if err != nil {
+		return EnergyState{}, err
+	}
+	state := EnergyState{Energy: config.Max, UpdatedAt: now}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].Value), &state); err != nil {
+			return EnergyState{}, err
+		}
+	}
+	return regenerateEnergy(config, state, now), nil
+}
+
+func errNotEnoughEnergy(wait int64) error {
+	return newErrorf(CodeResourceExhausted, "not enough energy, Retry-After: %s", strconv.FormatInt(wait, 10))
+}
+
+// regenerateEnergy adds the whole points earned since UpdatedAt, moving UpdatedAt forward by exactly those points.
+// Once at the cap UpdatedAt follows now since nothing accrues there.
+func regenerateEnergy(config *EnergyConfig, state EnergyState, now int64) EnergyState {
+	if state.Energy >= config.Max {
+		state.UpdatedAt = max(state.UpdatedAt, now)
+		return state
+	}
+	elapsed := now - state.UpdatedAt
+	if elapsed <= 0 {
+		return state
+	}
+	points := elapsed / config.RegenSeconds
+	if state.Energy+points >= config.Max {
+		return EnergyState{Energy: config.Max, UpdatedAt: now}
+	}
+	state.Energy += points
+	state.UpdatedAt += points * config.RegenSeconds
+	return state
+}
+
+// secondsUntilEnergy is how long until a regenerated state holds target, 0 when it already does.
+func secondsUntilEnergy(config *EnergyConfig, state EnergyState, target, now int64) int64 {
+	target = min(target, config.Max)
+	if state.Energy >= target {
+		return 0
+	}
+	return max((target-state.Energy)*config.RegenSeconds-(now-state.UpdatedAt), 0)
+}
+
+func energyResponse(config *EnergyConfig, state *EnergyState, now int64) *EnergyResponse {
+	return &EnergyResponse{
+		Energy:        state.Energy,
+		Max:           config.Max,
+		SecondsToNext: secondsUntilEnergy(config, *state, state.Energy+1, now),
+		SecondsToFull: secondsUntilEnergy(config, *state, config.Max, now),
+		RegenSeconds:  config.RegenSeconds,
+		UpdatedAt:     state.UpdatedAt,
+	}
+}
+
+func readEnergyConfig(ctx context.Context, nk runtime.NakamaModule) (*EnergyConfig, error) {
+	config := &EnergyConfig{}
+	if _, err := readCachedConfig(ctx, nk, energyConfigKey, config); err != nil {
+		return nil, err
+	}
+	if config.Max <= 0 {
+		config.Max = energyDefaultMax
+	}
+	if config.RegenSeconds <= 0 {
+		config.RegenSeconds = energyDefaultRegenSeconds
+	}
+	return config, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+func TestRegenerateEnergy(t *testing.T) {
+	config := &EnergyConfig{Max: 10, RegenSeconds: 60}
+	tests := []struct {
+		name  string
+		state EnergyState
+		now   int64
+		want  EnergyState
+	}{
+		{name: "at the cap follows now", state: EnergyState{Energy: 10, UpdatedAt: 100}, now: 500, want: EnergyState{Energy: 10, UpdatedAt: 500}},
+		{name: "refund over the cap is kept", state: EnergyState{Energy: 13, UpdatedAt: 100}, now: 500, want: EnergyState{Energy: 13, UpdatedAt: 500}},
+		{name: "partial interval keeps its progress", state: EnergyState{Energy: 5, UpdatedAt: 100}, now: 190, want: EnergyState{Energy: 6, UpdatedAt: 160}},
+		{name: "less than one interval", state: EnergyState{Energy: 5, UpdatedAt: 100}, now: 159, want: EnergyState{Energy: 5, UpdatedAt: 100}},
+		{name: "several intervals", state: EnergyState{Energy: 2, UpdatedAt: 0}, now: 250, want: EnergyState{Energy: 6, UpdatedAt: 240}},
+		{name: "exactly reaching the cap", state: EnergyState{Energy: 8, UpdatedAt: 0}, now: 120, want: EnergyState{Energy: 10, UpdatedAt: 120}},
+		{name: "gap past the cap", state: EnergyState{Energy: 5, UpdatedAt: 100}, now: 100 + 60*20 + 7, want: EnergyState{Energy: 10, UpdatedAt: 100 + 60*20 + 7}},
+		{name: "clock behind the state", state: EnergyState{Energy: 5, UpdatedAt: 200}, now: 100, want: EnergyState{Energy: 5, UpdatedAt: 200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := regenerateEnergy(config, tt.state, tt.now); got != tt.want {
+				t.Errorf("regenerateEnergy = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecondsUntilEnergy(t *testing.T) {
+	config := &EnergyConfig{Max: 10, RegenSeconds: 60}
+	tests := []struct {
+		name   string
+		state  EnergyState
+		target int64
+		now    int64
+		want   int64
+	}{
+		{name: "already holds the target", state: EnergyState{Energy: 5, UpdatedAt: 100}, target: 3, now: 100, want: 0},
+		{name: "next point with partial progress", state: EnergyState{Energy: 5, UpdatedAt: 100}, target: 6, now: 130, want: 30},
+		{name: "several points", state: EnergyState{Energy: 5, UpdatedAt: 100}, target: 8, now: 130, want: 150},
+		{name: "target above the cap waits for the cap", state: EnergyState{Energy: 5, UpdatedAt: 100}, target: 50, now: 100, want: 300},
+		{name: "over the cap", state: EnergyState{Energy: 13, UpdatedAt: 100}, target: 11, now: 100, want: 0},
+		{name: "at the cap the next point never comes", state: EnergyState{Energy: 10, UpdatedAt: 100}, target: 11, now: 100, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := secondsUntilEnergy(config, tt.state, tt.target, tt.now); got != tt.want {
+				t.Errorf("secondsUntilEnergy = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefundEnergyGoesOverTheCap(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, energyConfigKey, &EnergyConfig{Max: 10, RegenSeconds: 60})
+	ctx := newTestContext("u1")
+
+	refundEnergy(ctx, logger, nk, "u1", 3)
+	state := &EnergyState{}
+	readTestObject(t, nk, energyCollection, energyKey, "u1", state)
+	if state.Energy != 13 {
+		t.Errorf("energy = %d after refunding a full bar, want 13", state.Energy)
+	}
+}
+
+func TestBeforeMatchmakerAddOnlyChecksEnergy(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, energyConfigKey, &EnergyConfig{Max: 10, RegenSeconds: 3600, Costs: map[string]int64{energyActionCreateHordeMatch: 4}})
+	add := func(userID string) error {
+		_, err := BeforeMatchmakerAdd(newTestContext(userID), logger, nil, nk, &rtapi.Envelope{Message: &rtapi.Envelope_MatchmakerAdd{MatchmakerAdd: &rtapi.MatchmakerAdd{Query: "*"}}})
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := add("u1"); err != nil {
+			t.Fatalf("ticket %d: %v", i, err)
+		}
+	}
+	if readTestObject(t, nk, energyCollection, energyKey, "u1", &EnergyState{}) {
+		t.Error("a ticket spent energy before the match was made")
+	}
+	writeTestObject(t, nk, energyCollection, energyKey, "u2", &EnergyState{Energy: 3, UpdatedAt: time.Now().Unix()})
+	if err := add("u2"); errorCode(err) != CodeResourceExhausted {
+		t.Errorf("ticket without enough energy = %v, want resource exhausted", err)
+	}
+}
+
+func TestBeforePartyMatchmakerAddChecksEveryMember(t *testing.T) {
+	tests := []struct {
+		name        string
+		guestEnergy int64
+		wantCode    int
+	}{
+		{name: "every member can pay", guestEnergy: 10},
+		{name: "a short member blocks the ticket", guestEnergy: 3, wantCode: CodeResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			writeTestConfig(t, nk, energyConfigKey, &EnergyConfig{Max: 10, RegenSeconds: 3600, Costs: map[string]int64{energyActionCreateHordeMatch: 4}})
+			writeTestObject(t, nk, energyCollection, energyKey, "guest", &EnergyState{Energy: tt.guestEnergy, UpdatedAt: time.Now().Unix()})
+			newTestParty(t, logger, nk, "guest")
+
+			_, err := BeforePartyMatchmakerAdd(newTestContext("leader"), logger, nil, nk, partyMatchmakerAdd(4, "*"))
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			for userID, want := range map[string]int64{"leader": 10, "guest": tt.guestEnergy} {
+				state := &EnergyState{Energy: 10}
+				readTestObject(t, nk, energyCollection, energyKey, userID, state)
+				if state.Energy != want {
+					t.Errorf("%s energy = %d, want %d untouched", userID, state.Energy, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchmakerMatchedChargesEveryPlayer(t *testing.T) {
+	tests := []struct {
+		name        string
+		guestEnergy int64
+		wantErr     bool
+		wantEnergy  map[string]int64
+	}{
+		{name: "every player pays", guestEnergy: 10, wantEnergy: map[string]int64{"host": 6, "guest": 6}},
+		{name: "a short player refunds the others", guestEnergy: 3, wantErr: true, wantEnergy: map[string]int64{"host": 10, "guest": 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			writeTestConfig(t, nk, energyConfigKey, &EnergyConfig{Max: 10, RegenSeconds: 3600, Costs: map[string]int64{energyActionCreateHordeMatch: 4}})
+			writeTestObject(t, nk, energyCollection, energyKey, "guest", &EnergyState{Energy: tt.guestEnergy, UpdatedAt: time.Now().Unix()})
+			entries := []runtime.MatchmakerEntry{
+				&testutil.MatchmakerEntry{Presence: &testutil.Presence{UserID: "host"}, Properties: map[string]interface{}{}},
+				&testutil.MatchmakerEntry{Presence: &testutil.Presence{UserID: "guest"}, Properties: map[string]interface{}{}},
+			}
+
+			matchID, err := MatchmakerMatched(newTestContext(""), logger, nil, nk, entries)
+			if (err != nil) != tt.wantErr || (err == nil && matchID == "") {
+				t.Fatalf("MatchmakerMatched = %q, %v, want error %v", matchID, err, tt.wantErr)
+			}
+			if tt.wantErr && len(nk.Matches) != 0 {
+				t.Errorf("created %d matches for players that could not pay", len(nk.Matches))
+			}
+			for userID, want := range tt.wantEnergy {
+				state := &EnergyState{Energy: 10}
+				readTestObject(t, nk, energyCollection, energyKey, userID, state)
+				if state.Energy != want {
+					t.Errorf("%s energy = %d, want %d", userID, state.Energy, want)
+				}
+			}
+		})
+	}
+}
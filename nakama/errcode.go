@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Error codes follow the gRPC status codes Nakama maps onto HTTP statuses.
+const (
+	CodeCanceled           = 1
+	CodeUnknown            = 2
+	CodeInvalidArgument    = 3
+	CodeDeadlineExceeded   = 4
+	CodeNotFound           = 5
+	CodeAlreadyExists      = 6
+	CodePermissionDenied   = 7
+	CodeResourceExhausted  = 8
+	CodeFailedPrecondition = 9
+	CodeAborted            = 10
+	CodeOutOfRange         = 11
+	CodeUnimplemented      = 12
+	CodeInternal           = 13
+	CodeUnavailable        = 14
+	CodeDataLoss           = 15
+	CodeUnauthenticated    = 16
+)
+
+// ErrorResponse is the message body of every error returned to clients. Errors built with newErrorf also carry their
+// format as Key and the values formatted into it as Args, so the message can be translated as a whole.
+type ErrorResponse struct {
+	Code        int           `json:"code"`
+	Message     string        `json:"message"`
+	Key         string        `json:"key,omitempty"`
+	Args        []string      `json:"args,omitempty"`
+	Fields      []*FieldError `json:"fields,omitempty"`
+	ForceUpdate bool          `json:"force_update,omitempty"`
+	StoreURL    string        `json:"store_url,omitempty"`
+}
+
+func newError(code int, message string) *runtime.Error {
+	return newErrorBody(&ErrorResponse{Code: code, Message: message})
+}
+
+// newErrorf is newError for a message with values in it, every verb in format must be %s.
+func newErrorf(code int, format string, args ...string) *runtime.Error {
+	return newErrorBody(&ErrorResponse{Code: code, Message: formatArgs(format, args), Key: format, Args: args})
+}
+
+func newErrorBody(response *ErrorResponse) *runtime.Error {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return runtime.NewError(response.Message, response.Code)
+	}
+	return runtime.NewError(string(body), response.Code)
+}
+
+func formatArgs(format string, args []string) string {
+	if len(args) == 0 {
+		return format
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return fmt.Sprintf(format, values...)
+}
+
+func errorResponse(code int, message string) (string, error) {
+	err := newError(code, message)
+	return err.Message, err
+}
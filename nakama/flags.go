@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"maps"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	featureFlagsConfigKey   = "feature_flags"
+	featureFlagsCollection  = "feature_flags"
+	featureFlagsOverrideKey = "overrides"
+	featureFlagsTTL         = 30 * time.Second
+
+	flagHordeAntiCheat = "horde_anticheat"
+)
+
+// defaultFeatureFlags apply when the stored global flags do not mention a flag.
+var defaultFeatureFlags = map[string]bool{
+	flagHordeAntiCheat: true,
+}
+
+var flags *featureFlags
+
+type FeatureFlagsConfig struct {
+	Flags map[string]bool `json:"flags"`
+}
+
+type FeatureFlagsResponse struct {
+	Flags map[string]bool `json:"flags"`
+}
+
+type featureFlags struct {
+	nk    runtime.NakamaModule
+	ttl   time.Duration
+	cache *Cache[map[string]bool]
+}
+
+func newFeatureFlags(nk runtime.NakamaModule, ttl time.Duration) *featureFlags {
+	return &featureFlags{nk: nk, ttl: ttl, cache: newCache[map[string]bool]()}
+}
+
+// IsEnabled reports the global value of a flag, falling back to the last known or default value when storage is unavailable.
+func (f *featureFlags) IsEnabled(name string) bool {
+	global, err := f.Global(context.Background())
+	if err != nil {
+		if global, ok := f.cache.Peek(featureFlagsConfigKey); ok {
+			if value, ok := global[name]; ok {
+				return value
+			}
+		}
+		return defaultFeatureFlags[name]
+	}
+	return global[name]
+}
+
+// Global returns the cached global flags, reloading them from storage once the TTL expires.
+func (f *featureFlags) Global(ctx context.Context) (map[string]bool, error) {
+	return f.cache.Get(featureFlagsConfigKey, func() (map[string]bool, error) {
+		var config FeatureFlagsConfig
+		if _, err := readConfig(ctx, f.nk, featureFlagsConfigKey, &config); err != nil {
+			return nil, err
+		}
+		global := maps.Clone(defaultFeatureFlags)
+		maps.Copy(global, config.Flags)
+		return global, nil
+	}, f.ttl)
+}
+
+// ForUser merges the per user overrides on top of the global flags.
+func (f *featureFlags) ForUser(ctx context.Context, userID string) (map[string]bool, error) {
+	global, err := f.Global(ctx)
+	if err != nil {
+		return nil, err
+	}
+	effective := maps.Clone(global)
+
+	objects, err := f.nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: featureFlagsCollection, Key: featureFlagsOverrideKey, UserID: userID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) > 0 {
+		var overrides FeatureFlagsConfig
+		if err := json.Unmarshal([]byte(objects[0].Value), &overrides); err != nil {
+			return nil, err
+		}
+		maps.Copy(effective, overrides.Flags)
+	}
+	return effective, nil
+}
+
+func (f *featureFlags) Invalidate() {
+	f.cache.Invalidate(featureFlagsConfigKey)
+}
+
+func GetFlagsRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GetFlags Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	effective, err := flags.ForUser(ctx, userID)
+	if err != nil {
+		logger.Error("Error reading feature flags: %v", err)
+		return errorResponse(CodeInternal, "error reading feature flags")
+	}
+	return marshalResponse(&FeatureFlagsResponse{Flags: effective})
+}
+
+func ReloadFlagsRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ReloadFlags Called - Payload: `%s`", payload)
+	flags.Invalidate()
+	global, err := flags.Global(ctx)
+	if err != nil {
+		logger.Error("Error reloading feature flags: %v", err)
+		return errorResponse(CodeInternal, "error reloading feature flags")
+	}
+	return marshalResponse(&FeatureFlagsResponse{Flags: global})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+// failingReadModule fails every storage read while fail is set.
+type failingReadModule struct {
+	*testutil.NakamaModule
+	fail bool
+}
+
+func (m *failingReadModule) StorageRead(ctx context.Context, reads []*runtime.StorageRead) ([]*api.StorageObject, error) {
+	if m.fail {
+		return nil, errors.New("storage unavailable")
+	}
+	return m.NakamaModule.StorageRead(ctx, reads)
+}
+
+func TestGetFlagsRpcOverridePrecedence(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, featureFlagsConfigKey, &FeatureFlagsConfig{Flags: map[string]bool{"shop": true, "pvp": false}})
+	writeTestObject(t, nk, featureFlagsCollection, featureFlagsOverrideKey, "tester", &FeatureFlagsConfig{Flags: map[string]bool{"pvp": true, flagHordeAntiCheat: false}})
+
+	tests := []struct {
+		caller string
+		want   map[string]bool
+	}{
+		{caller: "player", want: map[string]bool{"shop": true, "pvp": false, flagHordeAntiCheat: true}},
+		{caller: "tester", want: map[string]bool{"shop": true, "pvp": true, flagHordeAntiCheat: false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.caller, func(t *testing.T) {
+			response, err := GetFlagsRpc(newTestContext(tt.caller), logger, nil, nk, "")
+			if err != nil {
+				t.Fatalf("GetFlagsRpc: %v", err)
+			}
+			got := decodeResponse[FeatureFlagsResponse](t, response).Flags
+			if len(got) != len(tt.want) {
+				t.Errorf("flags = %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s = %v, want %v", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestFeatureFlagsCacheExpiry(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	flags = newFeatureFlags(nk, 20*time.Millisecond)
+	writeTestConfig(t, nk, featureFlagsConfigKey, &FeatureFlagsConfig{Flags: map[string]bool{"shop": true}})
+	if !flags.IsEnabled("shop") {
+		t.Fatal("shop disabled, want the stored value")
+	}
+
+	writeTestConfig(t, nk, featureFlagsConfigKey, &FeatureFlagsConfig{Flags: map[string]bool{"shop": false}})
+	if !flags.IsEnabled("shop") {
+		t.Error("shop disabled inside the ttl, want the cached value")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if flags.IsEnabled("shop") {
+		t.Error("shop enabled after the ttl, want the reloaded value")
+	}
+
+	writeTestConfig(t, nk, featureFlagsConfigKey, &FeatureFlagsConfig{Flags: map[string]bool{"shop": true}})
+	flags = newFeatureFlags(nk, time.Hour)
+	flags.IsEnabled("shop")
+	writeTestConfig(t, nk, featureFlagsConfigKey, &FeatureFlagsConfig{Flags: map[string]bool{"shop": false}})
+	if _, err := ReloadFlagsRpc(newTestContext(""), logger, nil, nk, ""); err != nil {
+		t.Fatalf("ReloadFlagsRpc: %v", err)
+	}
+	if flags.IsEnabled("shop") {
+		t.Error("shop enabled after reload_flags, want the cache busted")
+	}
+}
+
+func TestFeatureFlagsIsEnabledWithoutStorage(t *testing.T) {
+	_, fake := newTestRuntime(t)
+	nk := &failingReadModule{NakamaModule: fake}
+	writeTestConfig(t, fake, featureFlagsConfigKey, &FeatureFlagsConfig{Flags: map[string]bool{"shop": true}})
+
+	cold := newFeatureFlags(nk, time.Millisecond)
+	nk.fail = true
+	if cold.IsEnabled("shop") || !cold.IsEnabled(flagHordeAntiCheat) {
+		t.Error("flags without storage or a cache, want the defaults")
+	}
+
+	nk.fail = false
+	warm := newFeatureFlags(nk, time.Millisecond)
+	warm.IsEnabled("shop")
+	time.Sleep(5 * time.Millisecond)
+	nk.fail = true
+	if !warm.IsEnabled("shop") {
+		t.Error("shop disabled while storage is down, want the last known value")
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	guildMaxMembers = 50
+
+	guildStateSuperadmin  = 0
+	guildStateAdmin       = 1
+	guildStateMember      = 2
+	guildStateJoinRequest = 3
+)
+
+type GuildMetadata struct {
+	Emblem string `json:"emblem"`
+	Motd   string `json:"motd"`
+	Level  int    `json:"level"`
+}
+
+type CreateGuildRequest struct {
+	Name   string `json:"name"`
+	Emblem string `json:"emblem"`
+	Motd   string `json:"motd"`
+}
+
+type GuildRequest struct {
+	GuildID string `json:"guild_id"`
+}
+
+type UpdateGuildMotdRequest struct {
+	GuildID string `json:"guild_id"`
+	Motd    string `json:"motd"`
+}
+
+type GuildMember struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	State    int32  `json:"state"`
+}
+
+type GuildInfoResponse struct {
+	GuildID  string         `json:"guild_id"`
+	Name     string         `json:"name"`
+	Metadata *GuildMetadata `json:"metadata"`
+	Members  []*GuildMember `json:"members"`
+}
+
+type LeaveGuildResponse struct {
+	Deleted bool `json:"deleted"`
+}
+
+func CreateGuildRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("CreateGuild Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[CreateGuildRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.Name == "" {
+		return errorResponse(CodeInvalidArgument, "name is required")
+	}
+
+	groups, _, err := nk.GroupsList(ctx, request.Name, "", nil, nil, 1, "")
+	if err != nil {
+		logger.Error("Error listing groups: %v", err)
+		return errorResponse(CodeInternal, "error checking guild name")
+	}
+	if len(groups) > 0 && groups[0].Name == request.Name {
+		return errorResponse(CodeAlreadyExists, "guild name already taken")
+	}
+
+	metadata := &GuildMetadata{Emblem: request.Emblem, Motd: request.Motd, Level: 1}
+	group, err := nk.GroupCreate(ctx, userID, request.Name, userID, "", "", "", true, guildMetadataMap(metadata), guildMaxMembers)
+	if errors.Is(err, runtime.ErrGroupNameInUse) {
+		return errorResponse(CodeAlreadyExists, "guild name already taken")
+	}
+	if err != nil {
+		logger.Error("Error creating group: %v", err)
+		return errorResponse(CodeInternal, "error creating guild")
+	}
+	return guildInfoResponse(ctx, logger, nk, group)
+}
+
+func JoinGuildRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("JoinGuild Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	group, err := guildFromPayload(ctx, logger, nk, payload)
+	if err != nil {
+		return "", err
+	}
+	if group.Open != nil && !group.Open.Value {
+		return errorResponse(CodeFailedPrecondition, "guild is closed")
+	}
+
+	if err := nk.GroupUsersAdd(ctx, "", group.Id, []string{userID}); err != nil {
+		if errors.Is(err, runtime.ErrGroupFull) {
+			return errorResponse(CodeFailedPrecondition, "guild is full")
+		}
+		logger.Error("Error adding user to group: %v", err)
+		return errorResponse(CodeInternal, "error joining guild")
+	}
+	return guildInfoResponse(ctx, logger, nk, group)
+}
+
+func GuildInfoRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GuildInfo Called - Payload: `%s`", payload)
+	group, err := guildFromPayload(ctx, logger, nk, payload)
+	if err != nil {
+		return "", err
+	}
+	return guildInfoResponse(ctx, logger, nk, group)
+}
+
+func UpdateGuildMotdRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("UpdateGuildMotd Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[UpdateGuildMotdRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	group, err := getGuild(ctx, logger, nk, request.GuildID)
+	if err != nil {
+		return "", err
+	}
+
+	members, err := listGuildMembers(ctx, nk, group.Id)
+	if err != nil {
+		logger.Error("Error listing group users: %v", err)
+		return errorResponse(CodeInternal, "error listing guild members")
+	}
+	if state, ok := guildMemberState(members, userID); !ok || state > guildStateAdmin {
+		return errorResponse(CodePermissionDenied, "only guild admins can update the motd")
+	}
+
+	metadata := parseGuildMetadata(group)
+	metadata.Motd = request.Motd
+	open := group.Open == nil || group.Open.Value
+	if err := nk.GroupUpdate(ctx, group.Id, "", "", "", "", "", "", open, guildMetadataMap(metadata), 0); err != nil {
+		logger.Error("Error updating group: %v", err)
+		return errorResponse(CodeInternal, "error updating guild")
+	}
+
+	group, err = getGuild(ctx, logger, nk, group.Id)
+	if err != nil {
+		return "", err
+	}
+	return guildInfoResponse(ctx, logger, nk, group)
+}
+
+// LeaveGuildRpc hands the guild over to the next most senior member when the last superadmin leaves, and deletes it once empty.
+func LeaveGuildRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("LeaveGuild Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+
+	group, err := guildFromPayload(ctx, logger, nk, payload)
+	if err != nil {
+		return "", err
+	}
+	members, err := listGuildMembers(ctx, nk, group.Id)
+	if err != nil {
+		logger.Error("Error listing group users: %v", err)
+		return errorResponse(CodeInternal, "error listing guild members")
+	}
+	state, ok := guildMemberState(members, userID)
+	if !ok {
+		return errorResponse(CodeFailedPrecondition, "not a guild member")
+	}
+
+	response := &LeaveGuildResponse{}
+	if state == guildStateSuperadmin {
+		var successor *api.GroupUserList_GroupUser
+		superadmins := 0
+		for _, member := range members {
+			memberState := member.State.GetValue()
+			if memberState == guildStateSuperadmin {
+				superadmins++
+			}
+			if member.User.Id == userID || memberState >= guildStateJoinRequest {
+				continue
+			}
+			if successor == nil || memberState < successor.State.GetValue() {
+				successor = member
+			}
+		}
+
+		switch {
+		case successor == nil:
+			if err := nk.GroupDelete(ctx, group.Id); err != nil {
+				logger.Error("Error deleting group: %v", err)
+				return errorResponse(CodeInternal, "error deleting guild")
+			}
+			response.Deleted = true
+		case superadmins == 1:
+			// Each promotion moves one rank up, repeat until the successor is superadmin.
+			for promoteState := successor.State.GetValue(); promoteState > guildStateSuperadmin; promoteState-- {
+				if err := nk.GroupUsersPromote(ctx, "", group.Id, []string{successor.User.Id}); err != nil {
+					logger.Error("Error promoting guild successor: %v", err)
+					return errorResponse(CodeInternal, "error promoting guild successor")
+				}
+			}
+		}
+	}
+
+	if !response.Deleted {
+		if err := nk.GroupUserLeave(ctx, group.Id, userID, username); err != nil {
+			logger.Error("Error leaving group: %v", err)
+			return errorResponse(CodeInternal, "error leaving guild")
+		}
+	}
+
+	return marshalResponse(response)
+}
+
+func guildFromPayload(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, payload string) (*api.Group, error) {
+	request, err := parsePayload[GuildRequest](payload)
+	if err != nil {
+		return nil, err
+	}
+	return getGuild(ctx, logger, nk, request.GuildID)
+}
+
+func getGuild(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, guildID string) (*api.Group, error) {
+	if guildID == "" {
+		return nil, newError(CodeInvalidArgument, "guild_id is required")
+	}
+	groups, err := nk.GroupsGetId(ctx, []string{guildID})
+	if err != nil {
+		logger.Error("Error getting group: %v", err)
+		return nil, newError(CodeInternal, "error getting guild")
+	}
+	if len(groups) == 0 {
+		return nil, newError(CodeNotFound, "guild not found")
+	}
+	return groups[0], nil
+}
+
+func listGuildMembers(ctx context.Context, nk runtime.NakamaModule, guildID string) ([]*api.GroupUserList_GroupUser, error) {
+	members, _, err := nk.GroupUsersList(ctx, guildID, guildMaxMembers+1, nil, "")
+	return members, err
+}
+
+func guildMemberState(members []*api.GroupUserList_GroupUser, userID string) (int32, bool) {
+	for _, member := range members {
+		if member.User.Id == userID {
+			return member.State.GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+func parseGuildMetadata(group *api.Group) *GuildMetadata {
+	metadata := &GuildMetadata{}
+	if group.Metadata != "" {
+		_ = json.Unmarshal([]byte(group.Metadata), metadata)
+	}
+	return metadata
+}
+
+func guildMetadataMap(metadata *GuildMetadata) map[string]interface{} {
+	return map[string]interface{}{"emblem": metadata.Emblem, "motd": metadata.Motd, "level": metadata.Level}
+}
+
+func guildInfoResponse(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, group *api.Group) (string, error) {
+	members, err := listGuildMembers(ctx, nk, group.Id)
+	if err != nil {
+		logger.Error("Error listing group users: %v", err)
+		return errorResponse(CodeInternal, "error listing guild members")
+	}
+
+	response := &GuildInfoResponse{
+		GuildID:  group.Id,
+		Name:     group.Name,
+		Metadata: parseGuildMetadata(group),
+		Members:  make([]*GuildMember, 0, len(members)),
+	}
+	for _, member := range members {
+		response.Members = append(response.Members, &GuildMember{
+			UserID:   member.User.Id,
+			Username: member.User.Username,
+			State:    member.State.GetValue(),
+		})
+	}
+
+	return marshalResponse(response)
+}
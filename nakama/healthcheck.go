@@ -3,23 +3,75 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 )
 
+const (
+	readinessCollection = "system"
+	readinessKey        = "readiness"
+)
+
+// Build metadata is set at build time, e.g. -ldflags "-X main.buildVersion=1.4.0 -X main.buildCommit=$(git rev-parse HEAD)".
+var (
+	buildVersion = "dev"
+	buildCommit  = "unknown"
+	buildTime    = "unknown"
+)
+
+// moduleStartTime is captured in InitModule, uptime counts from the plugin load rather than the Nakama process.
+var moduleStartTime = time.Now()
+
 type HealthcheckResponse struct {
-	Success bool `json:"success"`
+	Success       bool   `json:"success"`
+	Version       string `json:"version"`
+	GitCommit     string `json:"git_commit"`
+	BuiltAt       string `json:"built_at"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+type ReadinessResponse struct {
+	Success   bool   `json:"success"`
+	Failed    string `json:"failed,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
 }
 
 func HealthcheckRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 	logger.Debug("Healthcheck Called - Payload: `%s`", payload)
-	response := &HealthcheckResponse{Success: true}
+	response := &HealthcheckResponse{
+		Success:       true,
+		Version:       buildVersion,
+		GitCommit:     buildCommit,
+		BuiltAt:       buildTime,
+		UptimeSeconds: max(int64(time.Since(moduleStartTime).Seconds()), 0),
+	}
+
+	return marshalResponse(response)
+}
+
+func ReadinessRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("Readiness Called - Payload: `%s`", payload)
+	startTime := time.Now()
+	response := &ReadinessResponse{Success: true}
 
-	jsonResponse, err := json.Marshal(response)
+	if err := db.PingContext(ctx); err != nil {
+		logger.Error("Readiness database ping failed: %v", err)
+		response.Success = false
+		response.Failed = "database"
+	} else if _, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: readinessCollection, Key: readinessKey}}); err != nil {
+		logger.Error("Readiness storage read failed: %v", err)
+		response.Success = false
+		response.Failed = "storage"
+	}
+	response.LatencyMs = time.Since(startTime).Milliseconds()
+
+	jsonResponse, err := marshalResponse(response)
 	if err != nil {
-		logger.Error("Error marshalling response: %v", err)
-		return "", runtime.NewError("error marshalling response", 500)
+		return "", err
+	}
+	if !response.Success {
+		return "", runtime.NewError(jsonResponse, CodeUnavailable)
 	}
-	return string(jsonResponse), nil
+	return jsonResponse, nil
 }
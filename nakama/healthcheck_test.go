@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthcheckRpc(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    string
+		commit     string
+		builtAt    string
+		startedAgo time.Duration
+		minUptime  int64
+	}{
+		{name: "dev build", version: "dev", commit: "unknown", builtAt: "unknown"},
+		{name: "release build", version: "1.4.0", commit: "0123abc", builtAt: "2026-10-01T12:00:00Z", startedAgo: 90 * time.Second, minUptime: 90},
+		{name: "clock behind start time", version: "1.4.1", commit: "def4567", builtAt: "2026-10-02T08:00:00Z", startedAgo: -time.Minute},
+	}
+
+	savedVersion, savedCommit, savedTime, savedStart := buildVersion, buildCommit, buildTime, moduleStartTime
+	t.Cleanup(func() {
+		buildVersion, buildCommit, buildTime, moduleStartTime = savedVersion, savedCommit, savedTime, savedStart
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			buildVersion, buildCommit, buildTime = tt.version, tt.commit, tt.builtAt
+			moduleStartTime = time.Now().Add(-tt.startedAgo)
+
+			response, err := HealthcheckRpc(newTestContext(""), logger, nil, nk, "")
+			if err != nil {
+				t.Fatalf("HealthcheckRpc: %v", err)
+			}
+			health := decodeResponse[HealthcheckResponse](t, response)
+			if !health.Success {
+				t.Error("success = false")
+			}
+			if health.Version != tt.version || health.GitCommit != tt.commit || health.BuiltAt != tt.builtAt {
+				t.Errorf("build info = %q %q %q, want %q %q %q", health.Version, health.GitCommit, health.BuiltAt, tt.version, tt.commit, tt.builtAt)
+			}
+			if health.UptimeSeconds < tt.minUptime {
+				t.Errorf("uptime = %d, want at least %d", health.UptimeSeconds, tt.minUptime)
+			}
+		})
+	}
+}
+
+func TestHealthcheckRpcKeepsSuccessAlongsideBuildFields(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	response, err := HealthcheckRpc(newTestContext(""), logger, nil, nk, "")
+	if err != nil {
+		t.Fatalf("HealthcheckRpc: %v", err)
+	}
+	fields := *decodeResponse[map[string]interface{}](t, response)
+	for _, key := range []string{"success", "version", "git_commit", "built_at", "uptime_seconds"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("response %s has no %q field", response, key)
+		}
+	}
+	if fields["success"] != true {
+		t.Errorf("success = %v, want true", fields["success"])
+	}
+	if uptime, _ := fields["uptime_seconds"].(float64); uptime < 0 {
+		t.Errorf("uptime_seconds = %v, want non-negative", uptime)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var errUnauthenticated = newError(CodeUnauthenticated, "authenticated user required")
+
+// runtimeError passes a runtime error through to the client as is and logs anything else, answering with an internal
+// error that only says what failed, msg reads like "updating trade".
+func runtimeError(logger runtime.Logger, err error, msg string) error {
+	var runtimeErr *runtime.Error
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr
+	}
+	logger.Error("Error %s: %v", msg, err)
+	return newError(CodeInternal, "error "+msg)
+}
+
+func userIDFromContext(ctx context.Context) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", errUnauthenticated
+	}
+	return userID, nil
+}
+
+func intParam(params map[string]interface{}, key string, fallback int) int {
+	switch value := params[key].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	default:
+		return fallback
+	}
+}
+
+func envInt64(ctx context.Context, key string, fallback int64) int64 {
+	env, ok := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	if !ok {
+		return fallback
+	}
+	value, err := strconv.ParseInt(env[key], 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func envString(ctx context.Context, key string, fallback string) string {
+	env, ok := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	if !ok || env[key] == "" {
+		return fallback
+	}
+	return env[key]
+}
+
+const (
+	configCollection = "config"
+)
+
+// readConfig loads a system owned config object into out, reporting false when it has not been written yet.
+func readConfig(ctx context.Context, nk runtime.NakamaModule, key string, out interface{}) (bool, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: configCollection, Key: key}})
+	if err != nil {
+		return false, err
+	}
+	if len(objects) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func stringParam(params map[string]interface{}, key string, fallback string) string {
+	if value, ok := params[key].(string); ok {
+		return value
+	}
+	return fallback
+}
+
+// boolParam also accepts "true" since matchmaker string properties arrive as strings.
+func boolParam(params map[string]interface{}, key string, fallback bool) bool {
+	switch value := params[key].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return fallback
+}
+
+// isServerCall reports whether the call came in with the runtime http key rather than a user session.
+func isServerCall(ctx context.Context) bool {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	return userID == ""
+}
+
+// parsePayload decodes an RPC payload into T, an empty payload yields the zero value so optional payloads need no special casing.
+func parsePayload[T any](payload string) (T, error) {
+	var request T
+	if payload == "" {
+		return request, nil
+	}
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return request, newError(CodeInvalidArgument, "invalid payload")
+	}
+	return request, nil
+}
+
+func marshalResponse[T any](response T) (string, error) {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		return errorResponse(CodeInternal, "error marshalling response")
+	}
+	return string(jsonResponse), nil
+}
+
+// runEvery calls fn on a fixed interval in the background until ctx is done.
+func runEvery(ctx context.Context, interval time.Duration, fn func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+// failingWalletModule fails every wallet update while fail is set.
+type failingWalletModule struct {
+	*testutil.NakamaModule
+	fail bool
+}
+
+func (m *failingWalletModule) WalletUpdate(ctx context.Context, userID string, changeset map[string]int64, metadata map[string]interface{}, updateLedger bool) (map[string]int64, map[string]int64, error) {
+	if m.fail {
+		return nil, nil, errors.New("wallet unavailable")
+	}
+	return m.NakamaModule.WalletUpdate(ctx, userID, changeset, metadata, updateLedger)
+}
+
+// defineTestItem stores an item definition and drops the cached definitions so the next load sees it.
+func defineTestItem(t *testing.T, nk runtime.NakamaModule, itemID string, definition *ItemDefinition) {
+	t.Helper()
+	writeTestObject(t, nk, itemDefinitionCollection, itemID, "", definition)
+	itemDefinitionCache.Invalidate(itemDefinitionCollection)
+}
+
+// newTestContext returns the context of an RPC called by userID's session, "" is a server to server call.
+func newTestContext(userID string) context.Context {
+	return testutil.NewContext(userID, nil)
+}
+
+// newTestRuntime returns fresh fakes and drops the package level caches so no test sees the config of another.
+func newTestRuntime(t *testing.T) (*testutil.Logger, *testutil.NakamaModule) {
+	t.Helper()
+	configCache = newCache[string]()
+	achievementDefinitionCache = newCache[map[string]*AchievementDefinition]()
+	itemDefinitionCache = newCache[map[string]*ItemDefinition]()
+	rpcRateLimiter = newRateLimiter(rateLimitWindow)
+	nk := testutil.NewNakamaModule()
+	translations = newTranslator(nk)
+	flags = newFeatureFlags(nk, featureFlagsTTL)
+	chatMessageFilter = newChatFilter(chatMinInterval)
+	return testutil.NewLogger(), nk
+}
+
+func writeTestConfig(t *testing.T, nk runtime.NakamaModule, key string, config interface{}) {
+	t.Helper()
+	writeTestObject(t, nk, configCollection, key, "", config)
+}
+
+func writeTestObject(t *testing.T, nk runtime.NakamaModule, collection, key, userID string, value interface{}) {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("marshalling %s/%s: %v", collection, key, err)
+	}
+	if _, err := nk.StorageWrite(context.Background(), []*runtime.StorageWrite{{Collection: collection, Key: key, UserID: userID, Value: string(data)}}); err != nil {
+		t.Fatalf("writing %s/%s: %v", collection, key, err)
+	}
+}
+
+// readTestObject unmarshals a stored object into out and reports whether it exists.
+func readTestObject(t *testing.T, nk runtime.NakamaModule, collection, key, userID string, out interface{}) bool {
+	t.Helper()
+	objects, err := nk.StorageRead(context.Background(), []*runtime.StorageRead{{Collection: collection, Key: key, UserID: userID}})
+	if err != nil {
+		t.Fatalf("reading %s/%s: %v", collection, key, err)
+	}
+	if len(objects) == 0 {
+		return false
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), out); err != nil {
+		t.Fatalf("unmarshalling %s/%s: %v", collection, key, err)
+	}
+	return true
+}
+
+func decodeResponse[T any](t *testing.T, response string) *T {
+	t.Helper()
+	out := new(T)
+	if err := json.Unmarshal([]byte(response), out); err != nil {
+		t.Fatalf("unmarshalling response %q: %v", response, err)
+	}
+	return out
+}
+
+// errorCode returns the code of a *runtime.Error, 0 for nil and -1 for any other error.
+func errorCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var runtimeErr *runtime.Error
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr.Code
+	}
+	return -1
+}
+
+func TestRuntimeError(t *testing.T) {
+	logger := testutil.NewLogger()
+	if err := runtimeError(logger, errTradeNotFound, "updating trade"); err != errTradeNotFound {
+		t.Errorf("runtime error = %v, want it passed through", err)
+	}
+	if err := runtimeError(logger, errors.Join(errors.New("write failed"), errPartyFull), "updating party"); errorCode(err) != CodeFailedPrecondition {
+		t.Errorf("wrapped runtime error = %v, want the wrapped code", err)
+	}
+	err := runtimeError(logger, errors.New("storage down"), "updating trade")
+	if errorCode(err) != CodeInternal || !strings.Contains(err.Error(), "error updating trade") {
+		t.Errorf("storage error = %v, want an internal error updating trade", err)
+	}
+}
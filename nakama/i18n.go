@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	translationCollection = "translations"
+	defaultLocale         = "en"
+	sessionVarLocale      = "locale"
+
+	msgAchievementUnlocked = "notification.achievement_unlocked"
+	msgTournamentReward    = "notification.tournament_reward"
+	msgReferralReward      = "notification.referral_reward"
+	msgReferralJoined      = "notification.referral_joined"
+	msgMatchEnding         = "notification.match_ending"
+	msgLiveEventStarted    = "notification.live_event_started"
+	msgTicketReply         = "notification.ticket_reply"
+	msgLeaderboardReward   = "notification.leaderboard_reward"
+	msgRankPromoted        = "notification.rank_promoted"
+	msgRankDemoted         = "notification.rank_demoted"
+	msgRankedSeasonEnded   = "notification.ranked_season_ended"
+	msgMatchRecorded       = "notification.match_recorded"
+	msgNotificationDigest  = "notification.digest"
+)
+
+// defaultTranslations is the built in table of the default locale, a stored table for it overrides these entries.
+// Error messages are looked up by their English text, or by their %s format when built with newErrorf, so they need
+// no entry here.
+var defaultTranslations = map[string]string{
+	msgAchievementUnlocked: "Achievement unlocked: %s",
+	msgTournamentReward:    "You placed #%d in %s",
+	msgReferralReward:      "Referral reward",
+	msgReferralJoined:      "A friend joined with your code",
+	msgMatchEnding:         "Match ending",
+	msgLiveEventStarted:    "Event started: %s",
+	msgTicketReply:         "Support replied: %s",
+	msgLeaderboardReward:   "You finished the leaderboard at rank %d",
+	msgRankPromoted:        "Promoted to %s",
+	msgRankDemoted:         "Demoted to %s",
+	msgRankedSeasonEnded:   "Ranked season over, you finished in %s",
+	msgMatchRecorded:       "Match found",
+	msgNotificationDigest:  "You got %d updates while away",
+}
+
+var translations *translator
+
+// translator serves the tables stored in translationCollection, keyed by lower case locale, as a map of key to text.
+type translator struct {
+	nk    runtime.NakamaModule
+	cache *Cache[map[string]string]
+}
+
+func newTranslator(nk runtime.NakamaModule) *translator {
+	return &translator{nk: nk, cache: newCache[map[string]string]()}
+}
+
+// translate looks key up for locale, then its base language, then the default locale, and formats args into the
+// text. The key itself is returned when no table has it.
+func translate(locale, key string, args ...interface{}) string {
+	text, ok := translations.lookup(locale, key)
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+func (t *translator) lookup(locale, key string) (string, bool) {
+	for _, candidate := range localeChain(locale) {
+		if text, ok := t.table(candidate)[key]; ok {
+			return text, true
+		}
+	}
+	text, ok := defaultTranslations[key]
+	return text, ok
+}
+
+// table returns the stored table for locale, empty when it is missing or cannot be read so lookups fall through.
+func (t *translator) table(locale string) map[string]string {
+	table, err := t.cache.Get(locale, func() (map[string]string, error) {
+		objects, err := t.nk.StorageRead(context.Background(), []*runtime.StorageRead{{Collection: translationCollection, Key: locale}})
+		if err != nil {
+			return nil, err
+		}
+		table := make(map[string]string)
+		if len(objects) > 0 {
+			if err := json.Unmarshal([]byte(objects[0].Value), &table); err != nil {
+				return nil, err
+			}
+		}
+		return table, nil
+	}, configCacheTTL)
+	if err != nil {
+		table, _ = t.cache.Peek(locale)
+	}
+	return table
+}
+
+// localeChain turns "pt-BR" into "pt-br", "pt" and the default locale.
+func localeChain(locale string) []string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	chain := make([]string, 0, 3)
+	if locale != "" {
+		chain = append(chain, locale)
+		if base, _, found := strings.Cut(locale, "-"); found {
+			chain = append(chain, base)
+		}
+	}
+	if len(chain) == 0 || chain[len(chain)-1] != defaultLocale {
+		chain = append(chain, defaultLocale)
+	}
+	return chain
+}
+
+// localeFromContext prefers the locale session var sent at authentication, then the Accept-Language header of the request.
+func localeFromContext(ctx context.Context) string {
+	if vars, ok := ctx.Value(runtime.RUNTIME_CTX_VARS).(map[string]string); ok && vars[sessionVarLocale] != "" {
+		return vars[sessionVarLocale]
+	}
+	if headers, ok := ctx.Value(runtime.RUNTIME_CTX_HEADERS).(map[string][]string); ok {
+		for name, values := range headers {
+			if strings.EqualFold(name, "Accept-Language") && len(values) > 0 {
+				first, _, _ := strings.Cut(values[0], ",")
+				tag, _, _ := strings.Cut(first, ";")
+				if tag = strings.TrimSpace(tag); tag != "" && tag != "*" {
+					return tag
+				}
+			}
+		}
+	}
+	return defaultLocale
+}
+
+// userLocale is the locale to address userID in, the caller's own when it is them and their account language otherwise.
+func userLocale(ctx context.Context, nk runtime.NakamaModule, userID string) string {
+	if caller, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); caller == userID {
+		return localeFromContext(ctx)
+	}
+	users, err := nk.UsersGetId(ctx, []string{userID}, nil)
+	if err != nil || len(users) == 0 || users[0].GetLangTag() == "" {
+		return defaultLocale
+	}
+	return users[0].GetLangTag()
+}
+
+// withLocalizedErrors translates the message of error bodies returned by fn into the caller's locale, by the key and
+// args of errors built with newErrorf so messages with values in them are translated too.
+func withLocalizedErrors(fn rpcFunc) rpcFunc {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		response, err := fn(ctx, logger, db, nk, payload)
+		var runtimeErr *runtime.Error
+		if err == nil || !errors.As(err, &runtimeErr) {
+			return response, err
+		}
+		body := &ErrorResponse{}
+		if json.Unmarshal([]byte(runtimeErr.Message), body) != nil {
+			return response, err
+		}
+		key := body.Message
+		if body.Key != "" {
+			key = body.Key
+		}
+		text, ok := translations.lookup(localeFromContext(ctx), key)
+		if !ok {
+			return response, err
+		}
+		body.Message = formatArgs(text, body.Args)
+		localized, marshalErr := json.Marshal(body)
+		if marshalErr != nil {
+			return response, err
+		}
+		return string(localized), runtime.NewError(string(localized), runtimeErr.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+func TestTranslateFallback(t *testing.T) {
+	_, nk := newTestRuntime(t)
+	writeTestObject(t, nk, translationCollection, "pt", "", map[string]string{msgMatchEnding: "Partida terminando", msgRankPromoted: "Promovido a %s"})
+	writeTestObject(t, nk, translationCollection, "pt-br", "", map[string]string{msgMatchEnding: "A partida vai acabar"})
+	writeTestObject(t, nk, translationCollection, defaultLocale, "", map[string]string{msgReferralReward: "Referral bonus"})
+
+	tests := []struct {
+		name   string
+		locale string
+		key    string
+		args   []interface{}
+		want   string
+	}{
+		{name: "exact locale", locale: "pt-BR", key: msgMatchEnding, want: "A partida vai acabar"},
+		{name: "underscore separator", locale: "pt_BR", key: msgMatchEnding, want: "A partida vai acabar"},
+		{name: "base language", locale: "pt-PT", key: msgMatchEnding, want: "Partida terminando"},
+		{name: "base language with args", locale: "pt-BR", key: msgRankPromoted, args: []interface{}{"Ouro"}, want: "Promovido a Ouro"},
+		{name: "missing key falls back to the default table", locale: "pt-BR", key: msgMatchRecorded, want: "Match found"},
+		{name: "stored default overrides the built in text", locale: "fr", key: msgReferralReward, want: "Referral bonus"},
+		{name: "unknown locale", locale: "ja", key: msgMatchEnding, want: "Match ending"},
+		{name: "no locale", key: msgNotificationDigest, args: []interface{}{3}, want: "You got 3 updates while away"},
+		{name: "unknown key", locale: "pt", key: "notification.missing", want: "notification.missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := translate(tt.locale, tt.key, tt.args...); got != tt.want {
+				t.Errorf("translate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocaleFromContext(t *testing.T) {
+	withHeader := func(ctx context.Context, value string) context.Context {
+		return context.WithValue(ctx, runtime.RUNTIME_CTX_HEADERS, map[string][]string{"accept-language": {value}})
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "session var", ctx: withHeader(testutil.NewContext("u1", map[string]string{sessionVarLocale: "de"}), "fr"), want: "de"},
+		{name: "accept language", ctx: withHeader(newTestContext("u1"), "pt-BR,pt;q=0.9,en;q=0.8"), want: "pt-BR"},
+		{name: "quality on the first tag", ctx: withHeader(newTestContext("u1"), "es;q=0.9"), want: "es"},
+		{name: "wildcard", ctx: withHeader(newTestContext("u1"), "*"), want: defaultLocale},
+		{name: "nothing", ctx: newTestContext("u1"), want: defaultLocale},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localeFromContext(tt.ctx); got != tt.want {
+				t.Errorf("localeFromContext = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithLocalizedErrors(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestObject(t, nk, translationCollection, "es", "", map[string]string{"trade not found": "intercambio no encontrado"})
+	handler := withLocalizedErrors(func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		return "", errTradeNotFound
+	})
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{locale: "es", want: "intercambio no encontrado"},
+		{locale: "en", want: "trade not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			_, err := handler(testutil.NewContext("u1", map[string]string{sessionVarLocale: tt.locale}), logger, nil, nk, "")
+			if errorCode(err) != CodeNotFound {
+				t.Fatalf("error = %v, want the code kept", err)
+			}
+			body := decodeResponse[ErrorResponse](t, err.(*runtime.Error).Message)
+			if body.Message != tt.want {
+				t.Errorf("message = %q, want %q", body.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithLocalizedErrorsTranslatesMessagesWithValues(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestObject(t, nk, translationCollection, "es", "", map[string]string{"not enough energy, Retry-After: %s": "energía insuficiente, Retry-After: %s"})
+	handler := withLocalizedErrors(func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		return "", errNotEnoughEnergy(42)
+	})
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{locale: "es", want: "energía insuficiente, Retry-After: 42"},
+		{locale: "en", want: "not enough energy, Retry-After: 42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			_, err := handler(testutil.NewContext("u1", map[string]string{sessionVarLocale: tt.locale}), logger, nil, nk, "")
+			if errorCode(err) != CodeResourceExhausted {
+				t.Fatalf("error = %v, want the code kept", err)
+			}
+			body := decodeResponse[ErrorResponse](t, err.(*runtime.Error).Message)
+			if body.Message != tt.want || len(body.Args) != 1 || body.Args[0] != "42" {
+				t.Errorf("body = %+v, want message %q with the wait kept as an arg", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	itemDefinitionCollection = "item_defs"
+	inventoryCollection      = "inventory"
+	inventoryKey             = "items"
+
+	itemDefinitionPageSize = 100
+)
+
+// itemDefinitionCache holds every item definition by id under itemDefinitionCollection.
+var itemDefinitionCache = newCache[map[string]*ItemDefinition]()
+
+var (
+	errUnknownItem       = newError(CodeInvalidArgument, "unknown item")
+	errInsufficientItems = newError(CodeFailedPrecondition, "not enough items")
+)
+
+type ItemDefinition struct {
+	Name     string `json:"name"`
+	MaxStack int64  `json:"max_stack"`
+}
+
+type Inventory struct {
+	Items map[string]int64 `json:"items"`
+}
+
+type AddItemRequest struct {
+	UserID string `json:"user_id"`
+	ItemID string `json:"item_id"`
+	Count  int64  `json:"count"`
+}
+
+type ConsumeItemRequest struct {
+	ItemID string `json:"item_id"`
+	Count  int64  `json:"count"`
+}
+
+type InventoryResponse struct {
+	Items map[string]int64 `json:"items"`
+	Delta map[string]int64 `json:"delta,omitempty"`
+}
+
+func GetInventoryRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GetInventory Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	inventory, _, err := readInventory(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Error reading inventory: %v", err)
+		return errorResponse(CodeInternal, "error reading inventory")
+	}
+	return marshalResponse(&InventoryResponse{Items: inventory.Items})
+}
+
+// AddItemRpc is registered admin only, clients earn items through gameplay RPCs instead.
+func AddItemRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("AddItem Called - Payload: `%s`", payload)
+	request, err := parsePayload[AddItemRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.UserID == "" || request.ItemID == "" || request.Count <= 0 {
+		return errorResponse(CodeInvalidArgument, "user_id, item_id and a positive count are required")
+	}
+
+	inventory, applied, err := addInventoryItems(ctx, nk, request.UserID, map[string]int64{request.ItemID: request.Count})
+	if err != nil {
+		return "", runtimeError(logger, err, "updating inventory")
+	}
+	return marshalResponse(&InventoryResponse{Items: inventory.Items, Delta: applied})
+}
+
+func ConsumeItemRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ConsumeItem Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[ConsumeItemRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.ItemID == "" || request.Count <= 0 {
+		return errorResponse(CodeInvalidArgument, "item_id and a positive count are required")
+	}
+
+	delta := map[string]int64{request.ItemID: request.Count}
+	inventory, err := consumeInventoryItems(ctx, nk, userID, delta)
+	if err != nil {
+		return "", runtimeError(logger, err, "updating inventory")
+	}
+	return marshalResponse(&InventoryResponse{Items: inventory.Items, Delta: map[string]int64{request.ItemID: -request.Count}})
+}
+
+// addInventoryItems validates items against the definitions and stacks them onto the inventory, clamped to each max stack.
+// The returned counts are what was actually added, an item already at its max stack is left out.
+func addInventoryItems(ctx context.Context, nk runtime.NakamaModule, userID string, items map[string]int64) (*Inventory, map[string]int64, error) {
+	definitions, err := loadItemDefinitions(ctx, nk)
+	if err != nil {
+		return nil, nil, err
+	}
+	for itemID := range items {
+		if _, ok := definitions[itemID]; !ok {
+			return nil, nil, errUnknownItem
+		}
+	}
+
+	var applied map[string]int64
+	inventory, err := updateInventory(ctx, nk, userID, func(inventory *Inventory) error {
+		applied = make(map[string]int64, len(items))
+		for itemID, count := range items {
+			before := inventory.Items[itemID]
+			inventory.Items[itemID] += count
+			if maxStack := definitions[itemID].MaxStack; maxStack > 0 {
+				inventory.Items[itemID] = min(inventory.Items[itemID], max(maxStack, before))
+			}
+			if added := inventory.Items[itemID] - before; added > 0 {
+				applied[itemID] = added
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return inventory, applied, nil
+}
+
+func consumeInventoryItems(ctx context.Context, nk runtime.NakamaModule, userID string, items map[string]int64) (*Inventory, error) {
+	return updateInventory(ctx, nk, userID, func(inventory *Inventory) error {
+		for itemID, count := range items {
+			if inventory.Items[itemID] < count {
+				return errInsufficientItems
+			}
+		}
+		for itemID, count := range items {
+			inventory.Items[itemID] -= count
+			if inventory.Items[itemID] == 0 {
+				delete(inventory.Items, itemID)
+			}
+		}
+		return nil
+	})
+}
+
+// updateInventory applies mutate to the stored inventory, retrying from a fresh read when a concurrent write wins.
+func updateInventory(ctx context.Context, nk runtime.NakamaModule, userID string, mutate func(*Inventory) error) (*Inventory, error) {
+	inventory := &Inventory{}
+	write := runtime.StorageWrite{
+		Collection:      inventoryCollection,
+		Key:             inventoryKey,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		inventory = &Inventory{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), inventory); err != nil {
+				return "", err
+			}
+		}
+		if inventory.Items == nil {
+			inventory.Items = make(map[string]int64)
+		}
+		if err := mutate(inventory); err != nil {
+			return "", err
+		}
+		value, err := json.Marshal(inventory)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+func readInventory(ctx context.Context, nk runtime.NakamaModule, userID string) (*Inventory, string, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: inventoryCollection, Key: inventoryKey, UserID: userID}})
+	if err != nil {
+		return nil, "", err
+	}
+	inventory := &Inventory{}
+	version := "*"
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].Value), inventory); err != nil {
+			return nil, "", err
+		}
+		version = objects[0].Version
+	}
+	if inventory.Items == nil {
+		inventory.Items = make(map[string]int64)
+	}
+	return inventory, version, nil
+}
+
+// loadItemDefinitions returns the cached definitions by id, callers must not modify them.
+func loadItemDefinitions(ctx context.Context, nk runtime.NakamaModule) (map[string]*ItemDefinition, error) {
+	return itemDefinitionCache.Get(itemDefinitionCollection, func() (map[string]*ItemDefinition, error) {
+		return listItemDefinitions(ctx, nk)
+	}, configCacheTTL)
+}
+
+func listItemDefinitions(ctx context.Context, nk runtime.NakamaModule) (map[string]*ItemDefinition, error) {
+	definitions := make(map[string]*ItemDefinition)
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", itemDefinitionCollection, itemDefinitionPageSize, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			definition := &ItemDefinition{}
+			if err := json.Unmarshal([]byte(object.Value), definition); err != nil {
+				return nil, err
+			}
+			definitions[object.Key] = definition
+		}
+		if next == "" {
+			return definitions, nil
+		}
+		cursor = next
+	}
+}
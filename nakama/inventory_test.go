@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAddItemRpcReturnsTheAppliedCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		have      int64
+		count     int64
+		wantDelta int64
+		wantItems int64
+	}{
+		{name: "fits", count: 3, wantDelta: 3, wantItems: 3},
+		{name: "clamped to the max stack", have: 3, count: 5, wantDelta: 2, wantItems: 5},
+		{name: "already full", have: 5, count: 2, wantDelta: 0, wantItems: 5},
+		{name: "over a lowered max stack is kept", have: 7, count: 1, wantDelta: 0, wantItems: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			defineTestItem(t, nk, "potion", &ItemDefinition{Name: "Potion", MaxStack: 5})
+			writeTestObject(t, nk, inventoryCollection, inventoryKey, "u1", &Inventory{Items: map[string]int64{"potion": tt.have}})
+
+			response, err := AddItemRpc(newTestContext(""), logger, nil, nk, fmt.Sprintf(`{"user_id":"u1","item_id":"potion","count":%d}`, tt.count))
+			if err != nil {
+				t.Fatalf("AddItemRpc: %v", err)
+			}
+			added := decodeResponse[InventoryResponse](t, response)
+			if added.Delta["potion"] != tt.wantDelta || added.Items["potion"] != tt.wantItems {
+				t.Errorf("response = %+v, want delta %d and %d held", added, tt.wantDelta, tt.wantItems)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	leaderboardGlobalScore = "global_score"
+
+	leaderboardMaxScoreEnv     = "LEADERBOARD_MAX_SCORE"
+	leaderboardDefaultMaxScore = 1_000_000
+
+	leaderboardDefaultLimit = 10
+	leaderboardMaxLimit     = 100
+
+	friendsLeaderboardPageSize   = 100
+	friendsLeaderboardMaxFriends = 1000
+)
+
+type SubmitScoreRequest struct {
+	Score int64 `json:"score"`
+}
+
+type SubmitScoreResponse struct {
+	Rank  int64 `json:"rank"`
+	Score int64 `json:"score"`
+}
+
+type LeaderboardAroundMeRequest struct {
+	LeaderboardID string `json:"leaderboard_id"`
+	Limit         int    `json:"limit"`
+}
+
+type LeaderboardEntry struct {
+	OwnerID  string `json:"owner_id"`
+	Username string `json:"username"`
+	Score    int64  `json:"score"`
+	Rank     int64  `json:"rank"`
+}
+
+type LeaderboardAroundMeResponse struct {
+	HasRecord bool                `json:"has_record"`
+	Owner     *LeaderboardEntry   `json:"owner,omitempty"`
+	Records   []*LeaderboardEntry `json:"records"`
+}
+
+type FriendsLeaderboardRequest struct {
+	LeaderboardID string `json:"leaderboard_id"`
+}
+
+type FriendLeaderboardEntry struct {
+	*LeaderboardEntry
+	FriendRank int `json:"friend_rank"`
+}
+
+type FriendsLeaderboardResponse struct {
+	Owner   *FriendLeaderboardEntry   `json:"owner,omitempty"`
+	Records []*FriendLeaderboardEntry `json:"records"`
+}
+
+// createLeaderboards sets up global_score, whose reset cron comes from the environment, and the ranked MMR board.
+func createLeaderboards(ctx context.Context, nk runtime.NakamaModule, resetSchedule string) error {
+	// Creating an existing leaderboard is a no-op, so this is safe on every boot but a changed schedule
+	// only applies to a freshly created leaderboard.
+	if err := nk.LeaderboardCreate(ctx, leaderboardGlobalScore, true, "descending", "best", resetSchedule, map[string]interface{}{}, true); err != nil {
+		return err
+	}
+	return nk.LeaderboardCreate(ctx, rankedLeaderboard, true, "descending", "set", "", map[string]interface{}{}, true)
+}
+
+func SubmitScoreRpc(maxScore int64) func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		logger.Debug("SubmitScore Called - Payload: `%s`", payload)
+		userID, err := userIDFromContext(ctx)
+		if err != nil {
+			return "", err
+		}
+		username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+
+		request, err := parsePayload[SubmitScoreRequest](payload)
+		if err != nil {
+			return "", err
+		}
+		// the schema rejects this too, but server calls and other callers that skip the middleware must not get past it
+		if request.Score < 0 {
+			return errorResponse(CodeInvalidArgument, "score must be non-negative")
+		}
+		if request.Score > maxScore {
+			logger.Warn("User %s submitted score %d above max %d", userID, request.Score, maxScore)
+			return errorResponse(CodeInvalidArgument, "score exceeds maximum")
+		}
+
+		record, err := nk.LeaderboardRecordWrite(ctx, leaderboardGlobalScore, userID, username, request.Score, 0, nil, nil)
+		if err != nil {
+			logger.Error("Error writing leaderboard record: %v", err)
+			return errorResponse(CodeInternal, "error writing leaderboard record")
+		}
+		if err := progressQuest(ctx, nk, userID, questObjectiveSubmitScore, 1); err != nil {
+			logger.Warn("Error progressing quests for %s: %v", userID, err)
+		}
+
+		return marshalResponse(&SubmitScoreResponse{Rank: record.Rank, Score: record.Score})
+	}
+}
+
+// LeaderboardAroundMeRpc returns the window around the caller, or the top of the board when they have no record yet.
+func LeaderboardAroundMeRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("LeaderboardAroundMe Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[LeaderboardAroundMeRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.LeaderboardID == "" {
+		request.LeaderboardID = leaderboardGlobalScore
+	}
+	if request.Limit <= 0 {
+		request.Limit = leaderboardDefaultLimit
+	}
+	if request.Limit > leaderboardMaxLimit {
+		return errorResponse(CodeInvalidArgument, "limit must be at most 100")
+	}
+
+	_, ownerRecords, _, _, err := nk.LeaderboardRecordsList(ctx, request.LeaderboardID, []string{userID}, 0, "", 0)
+	if err != nil {
+		logger.Error("Error reading owner leaderboard record: %v", err)
+		return "", leaderboardError(err)
+	}
+
+	response := &LeaderboardAroundMeResponse{HasRecord: len(ownerRecords) > 0}
+	var records []*api.LeaderboardRecord
+	if response.HasRecord {
+		response.Owner = leaderboardEntry(ownerRecords[0])
+		haystack, err := nk.LeaderboardRecordsHaystack(ctx, request.LeaderboardID, userID, request.Limit, "", 0)
+		if err != nil {
+			logger.Error("Error listing leaderboard records around owner: %v", err)
+			return "", leaderboardError(err)
+		}
+		records = haystack.Records
+	} else {
+		records, _, _, _, err = nk.LeaderboardRecordsList(ctx, request.LeaderboardID, nil, request.Limit, "", 0)
+		if err != nil {
+			logger.Error("Error listing leaderboard records: %v", err)
+			return "", leaderboardError(err)
+		}
+	}
+
+	response.Records = make([]*LeaderboardEntry, 0, len(records))
+	for _, record := range records {
+		response.Records = append(response.Records, leaderboardEntry(record))
+	}
+	return marshalResponse(response)
+}
+
+// FriendsLeaderboardRpc ranks the caller among their mutual friends on a leaderboard. Friends without a record are
+// left out, FriendRank follows the board's own order and Owner is empty when the caller has no record either.
+func FriendsLeaderboardRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("FriendsLeaderboard Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[FriendsLeaderboardRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.LeaderboardID == "" {
+		request.LeaderboardID = leaderboardGlobalScore
+	}
+
+	ownerIDs := []string{userID}
+	state := friendStateMutual
+	cursor := ""
+	for len(ownerIDs) <= friendsLeaderboardMaxFriends {
+		friends, next, err := nk.FriendsList(ctx, userID, friendsLeaderboardPageSize, &state, cursor)
+		if err != nil {
+			logger.Error("Error listing friends: %v", err)
+			return errorResponse(CodeInternal, "error listing friends")
+		}
+		for _, friend := range friends {
+			ownerIDs = append(ownerIDs, friend.GetUser().GetId())
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	records := make([]*api.LeaderboardRecord, 0, len(ownerIDs))
+	for start := 0; start < len(ownerIDs); start += friendsLeaderboardPageSize {
+		end := min(start+friendsLeaderboardPageSize, len(ownerIDs))
+		_, ownerRecords, _, _, err := nk.LeaderboardRecordsList(ctx, request.LeaderboardID, ownerIDs[start:end], 0, "", 0)
+		if err != nil {
+			logger.Error("Error listing friend leaderboard records: %v", err)
+			return "", leaderboardError(err)
+		}
+		records = append(records, ownerRecords...)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Rank < records[j].Rank })
+
+	response := &FriendsLeaderboardResponse{Records: make([]*FriendLeaderboardEntry, 0, len(records))}
+	for i, record := range records {
+		entry := &FriendLeaderboardEntry{LeaderboardEntry: leaderboardEntry(record), FriendRank: i + 1}
+		response.Records = append(response.Records, entry)
+		if record.OwnerId == userID {
+			response.Owner = entry
+		}
+	}
+	return marshalResponse(response)
+}
+
+func leaderboardEntry(record *api.LeaderboardRecord) *LeaderboardEntry {
+	entry := &LeaderboardEntry{OwnerID: record.OwnerId, Score: record.Score, Rank: record.Rank}
+	if record.Username != nil {
+		entry.Username = record.Username.Value
+	}
+	return entry
+}
+
+func leaderboardError(err error) error {
+	if errors.Is(err, runtime.ErrLeaderboardNotFound) {
+		return newError(CodeNotFound, "leaderboard not found")
+	}
+	return newError(CodeInternal, "error listing leaderboard records")
+}
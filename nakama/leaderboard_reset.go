@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"mhth.net/matchmaking-server/lock"
+)
+
+const (
+	leaderboardResetScheduleEnv = "LEADERBOARD_RESET_SCHEDULE"
+	leaderboardRewardConfigKey  = "leaderboard_rewards"
+	leaderboardArchiveColl      = "leaderboard_archive"
+
+	leaderboardArchivePageSize   = 100
+	leaderboardArchiveMaxRecords = 1000
+	leaderboardResetLockTTL      = 5 * time.Minute
+	leaderboardResetLockKey      = "leaderboard_reset:"
+)
+
+// LeaderboardRewardTier rewards every rank from the previous tier's MaxRank plus one up to MaxRank, tiers are
+// listed in ascending MaxRank order.
+type LeaderboardRewardTier struct {
+	MaxRank int64   `json:"max_rank"`
+	Reward  *Reward `json:"reward"`
+}
+
+type LeaderboardRewardConfig struct {
+	Tiers []*LeaderboardRewardTier `json:"tiers"`
+}
+
+var defaultLeaderboardRewards = LeaderboardRewardConfig{
+	Tiers: []*LeaderboardRewardTier{
+		{MaxRank: 1, Reward: &Reward{Currency: map[string]int64{"coins": 2000}}},
+		{MaxRank: 3, Reward: &Reward{Currency: map[string]int64{"coins": 1000}}},
+		{MaxRank: 10, Reward: &Reward{Currency: map[string]int64{"coins": 500}}},
+		{MaxRank: 100, Reward: &Reward{Currency: map[string]int64{"coins": 100}}},
+	},
+}
+
+// LeaderboardArchive holds the final standings of one leaderboard period, keyed by leaderboard id and reset time.
+type LeaderboardArchive struct {
+	LeaderboardID string              `json:"leaderboard_id"`
+	Reset         int64               `json:"reset"`
+	Records       []*LeaderboardEntry `json:"records"`
+}
+
+// LeaderboardReset archives the standings of the period that just ended and rewards them. The archive is
+// written with a create only version before any reward goes out, so a duplicate callback for the same reset
+// finds it already taken and does nothing.
+func LeaderboardReset(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, leaderboard *api.Leaderboard, reset int64) error {
+	if leaderboard.Id != leaderboardGlobalScore {
+		return nil
+	}
+	logger.Info("Leaderboard %s reset at %d", leaderboard.Id, reset)
+
+	var rewards LeaderboardRewardConfig
+	found, err := readCachedConfig(ctx, nk, leaderboardRewardConfigKey, &rewards)
+	if err != nil {
+		logger.Error("Error reading leaderboard reward config, using defaults: %v", err)
+	}
+	if !found || err != nil {
+		rewards = defaultLeaderboardRewards
+	}
+
+	held, err := lock.TryLock(ctx, nk, leaderboardResetLockKey+leaderboard.Id, leaderboardResetLockTTL)
+	if err != nil {
+		logger.Error("Error taking leaderboard reset lock: %v", err)
+		return err
+	}
+	if held == nil {
+		logger.Info("Leaderboard %s reset %d is handled by another node", leaderboard.Id, reset)
+		return nil
+	}
+	defer held.Unlock(ctx)
+
+	archive, err := archiveLeaderboard(ctx, nk, leaderboard.Id, reset)
+	if errors.Is(err, runtime.ErrStorageRejectedVersion) {
+		logger.Warn("Leaderboard %s reset %d already archived, skipping rewards", leaderboard.Id, reset)
+		return nil
+	}
+	if err != nil {
+		logger.Error("Error archiving leaderboard %s: %v", leaderboard.Id, err)
+		return err
+	}
+
+	rewarded := 0
+	for _, record := range archive.Records {
+		reward := leaderboardRewardFor(&rewards, record.Rank)
+		if reward == nil {
+			continue
+		}
+		metadata := map[string]interface{}{"reason": "leaderboard_reward", "leaderboard_id": leaderboard.Id, "reset": reset, "rank": record.Rank}
+		if err := grantReward(ctx, nk, record.OwnerID, reward, metadata); err != nil {
+			logger.Error("Error granting leaderboard reward to %s: %v", record.OwnerID, err)
+			continue
+		}
+		rewarded++
+
+		content := map[string]interface{}{"leaderboard_id": leaderboard.Id, "rank": record.Rank, "reward": reward}
+		subject := translate(userLocale(ctx, nk, record.OwnerID), msgLeaderboardReward, record.Rank)
+		if err := sendNotification(ctx, nk, record.OwnerID, subject, content, notificationLeaderboardReward, notificationPriorityLow); err != nil {
+			logger.Error("Error notifying %s of leaderboard reward: %v", record.OwnerID, err)
+		}
+	}
+
+	emitEvent(ctx, logger, nk, eventLeaderboardReset, map[string]string{
+		"leaderboard_id": leaderboard.Id,
+		"reset":          strconv.FormatInt(reset, 10),
+		"records":        strconv.Itoa(len(archive.Records)),
+		"rewarded":       strconv.Itoa(rewarded),
+	})
+	return nil
+}
+
+// archiveLeaderboard snapshots up to leaderboardArchiveMaxRecords of the records expiring at reset.
+func archiveLeaderboard(ctx context.Context, nk runtime.NakamaModule, leaderboardID string, reset int64) (*LeaderboardArchive, error) {
+	key := leaderboardID + "_" + strconv.FormatInt(reset, 10)
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: leaderboardArchiveColl, Key: key}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) > 0 {
+		return nil, runtime.ErrStorageRejectedVersion
+	}
+
+	archive := &LeaderboardArchive{LeaderboardID: leaderboardID, Reset: reset, Records: make([]*LeaderboardEntry, 0)}
+	cursor := ""
+	for len(archive.Records) < leaderboardArchiveMaxRecords {
+		records, _, next, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, nil, leaderboardArchivePageSize, cursor, reset)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			archive.Records = append(archive.Records, leaderboardEntry(record))
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	value, err := json.Marshal(archive)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      leaderboardArchiveColl,
+		Key:             key,
+		Value:           string(value),
+		Version:         "*",
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}}); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func leaderboardRewardFor(config *LeaderboardRewardConfig, rank int64) *Reward {
+	for _, tier := range config.Tiers {
+		if rank <= tier.MaxRank {
+			return tier.Reward
+		}
+	}
+	return nil
+}
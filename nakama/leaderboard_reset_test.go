@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+)
+
+const testLeaderboardReset int64 = 1700000000
+
+func testArchiveKey(reset int64) string {
+	return fmt.Sprintf("%s_%d", leaderboardGlobalScore, reset)
+}
+
+func TestLeaderboardResetArchivesAndRewards(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, leaderboardRewardConfigKey, &LeaderboardRewardConfig{Tiers: []*LeaderboardRewardTier{
+		{MaxRank: 1, Reward: &Reward{Currency: map[string]int64{"gems": 10}}},
+		{MaxRank: 3, Reward: &Reward{Currency: map[string]int64{"gems": 5}}},
+	}})
+	for owner, score := range map[string]int64{"first": 400, "second": 300, "third": 200, "fourth": 100} {
+		nk.LeaderboardRecordWrite(newTestContext(""), leaderboardGlobalScore, owner, owner, score, 0, nil, nil)
+	}
+	leaderboard := &api.Leaderboard{Id: leaderboardGlobalScore}
+
+	for i := 0; i < 2; i++ {
+		if err := LeaderboardReset(newTestContext(""), logger, nil, nk, leaderboard, testLeaderboardReset); err != nil {
+			t.Fatalf("reset %d: %v", i, err)
+		}
+	}
+
+	archive := &LeaderboardArchive{}
+	if !readTestObject(t, nk, leaderboardArchiveColl, testArchiveKey(testLeaderboardReset), "", archive) {
+		t.Fatal("no archive written")
+	}
+	wantOrder := []string{"first", "second", "third", "fourth"}
+	if len(archive.Records) != len(wantOrder) {
+		t.Fatalf("archived %d records, want %d", len(archive.Records), len(wantOrder))
+	}
+	for i, want := range wantOrder {
+		if record := archive.Records[i]; record.OwnerID != want || record.Rank != int64(i+1) {
+			t.Errorf("record %d = %s at rank %d, want %s at rank %d", i, record.OwnerID, record.Rank, want, i+1)
+		}
+	}
+
+	// the second callback for the same reset finds the archive and pays nothing
+	for owner, want := range map[string]int64{"first": 10, "second": 5, "third": 5, "fourth": 0} {
+		if got := nk.Wallets[owner]["gems"]; got != want {
+			t.Errorf("%s gems = %d, want %d", owner, got, want)
+		}
+		wantNotifications := 1
+		if want == 0 {
+			wantNotifications = 0
+		}
+		if sent := len(nk.NotificationsFor(owner)); sent != wantNotifications {
+			t.Errorf("%s got %d notifications, want %d", owner, sent, wantNotifications)
+		}
+	}
+	if len(nk.Events) != 1 {
+		t.Fatalf("emitted %d events, want 1", len(nk.Events))
+	}
+	if event := nk.Events[0]; event.Name != eventLeaderboardReset || event.Properties["records"] != "4" || event.Properties["rewarded"] != "3" {
+		t.Errorf("event = %s %v, want %s with 4 records and 3 rewarded", event.Name, event.Properties, eventLeaderboardReset)
+	}
+}
+
+func TestLeaderboardResetArchivesEveryPage(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	records := leaderboardArchivePageSize + 50
+	for i := 0; i < records; i++ {
+		owner := fmt.Sprintf("u%03d", i)
+		nk.LeaderboardRecordWrite(newTestContext(""), leaderboardGlobalScore, owner, owner, int64(records-i), 0, nil, nil)
+	}
+
+	if err := LeaderboardReset(newTestContext(""), logger, nil, nk, &api.Leaderboard{Id: leaderboardGlobalScore}, testLeaderboardReset); err != nil {
+		t.Fatalf("LeaderboardReset: %v", err)
+	}
+
+	archive := &LeaderboardArchive{}
+	readTestObject(t, nk, leaderboardArchiveColl, testArchiveKey(testLeaderboardReset), "", archive)
+	if len(archive.Records) != records {
+		t.Fatalf("archived %d records, want %d", len(archive.Records), records)
+	}
+	if last := archive.Records[records-1]; last.Rank != int64(records) {
+		t.Errorf("last record rank = %d, want %d", last.Rank, records)
+	}
+	// the default tiers stop at rank 100
+	if got := nk.Wallets["u000"]["coins"]; got != 2000 {
+		t.Errorf("rank 1 coins = %d, want 2000", got)
+	}
+	if got := nk.Wallets["u099"]["coins"]; got != 100 {
+		t.Errorf("rank 100 coins = %d, want 100", got)
+	}
+	if got := nk.Wallets["u100"]["coins"]; got != 0 {
+		t.Errorf("rank 101 coins = %d, want 0", got)
+	}
+}
+
+func TestLeaderboardResetIgnoresOtherLeaderboards(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	nk.LeaderboardRecordWrite(newTestContext(""), "weekly", "u1", "u1", 100, 0, nil, nil)
+
+	if err := LeaderboardReset(newTestContext(""), logger, nil, nk, &api.Leaderboard{Id: "weekly"}, testLeaderboardReset); err != nil {
+		t.Fatalf("LeaderboardReset: %v", err)
+	}
+	if readTestObject(t, nk, leaderboardArchiveColl, "weekly_"+fmt.Sprint(testLeaderboardReset), "", &LeaderboardArchive{}) {
+		t.Error("archived a leaderboard that is not reset by the module")
+	}
+	if len(nk.Wallets["u1"]) != 0 || len(nk.Events) != 0 {
+		t.Errorf("wallet = %v, events = %d, want no reward and no event", nk.Wallets["u1"], len(nk.Events))
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestSubmitScoreRpcChecksBoundsWithoutTheSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		wantCode int
+	}{
+		{name: "negative score", payload: `{"score":-5}`, wantCode: CodeInvalidArgument},
+		{name: "above the max", payload: `{"score":1001}`, wantCode: CodeInvalidArgument},
+		{name: "in range", payload: `{"score":1000}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+
+			_, err := SubmitScoreRpc(1000)(newTestContext("u1"), logger, nil, nk, tt.payload)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			if _, written := nk.Leaderboards[leaderboardGlobalScore]["u1"]; written != (tt.wantCode == 0) {
+				t.Errorf("record written = %v, want %v", written, tt.wantCode == 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"mhth.net/matchmaking-server/lock"
+)
+
+const (
+	liveEventsConfigKey  = "live_events"
+	liveEventsCollection = "events"
+	liveEventsInterval   = time.Minute
+	liveEventsPageSize   = 100
+	liveEventsLockKey    = "live_events"
+)
+
+// LiveEventDefinition is one configured window, Start and End are unix times and Modifiers are free form
+// multipliers such as "xp": 2 for clients and rewards to apply while it runs.
+type LiveEventDefinition struct {
+	ID        string             `json:"id"`
+	Name      string             `json:"name"`
+	Start     int64              `json:"start"`
+	End       int64              `json:"end"`
+	Modifiers map[string]float64 `json:"modifiers,omitempty"`
+}
+
+type LiveEventsConfig struct {
+	Events []*LiveEventDefinition `json:"events"`
+}
+
+type LiveEvent struct {
+	*LiveEventDefinition
+	Active      bool  `json:"active"`
+	ActivatedAt int64 `json:"activated_at,omitempty"`
+}
+
+type ActiveEventsResponse struct {
+	Events     []*LiveEvent `json:"events"`
+	ServerTime int64        `json:"server_time"`
+}
+
+var (
+	liveEventsMu   sync.Mutex
+	liveEventsStop context.CancelFunc
+)
+
+// startLiveEvents flips event records on a ticker until ctx is done. A ticker left by an earlier InitModule in the
+// same process is stopped first so reloads never run two.
+func startLiveEvents(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	liveEventsMu.Lock()
+	defer liveEventsMu.Unlock()
+	if liveEventsStop != nil {
+		liveEventsStop()
+	}
+	ctx, liveEventsStop = context.WithCancel(ctx)
+
+	tick := func() {
+		held, err := lock.TryLock(ctx, nk, liveEventsLockKey, liveEventsInterval/2)
+		if err != nil {
+			logger.Error("Error taking live events lock: %v", err)
+			return
+		}
+		if held == nil {
+			return
+		}
+		defer held.Unlock(ctx)
+		if err := syncLiveEvents(ctx, logger, nk, time.Now().UTC().Unix()); err != nil {
+			logger.Error("Error syncing live events: %v", err)
+		}
+	}
+	go tick()
+	runEvery(ctx, liveEventsInterval, tick)
+}
+
+// syncLiveEvents brings every stored event in line with its configured window. The flip is a version checked write,
+// so with several nodes ticking only the one that activates an event broadcasts it.
+func syncLiveEvents(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, now int64) error {
+	var config LiveEventsConfig
+	if _, err := readConfig(ctx, nk, liveEventsConfigKey, &config); err != nil {
+		return err
+	}
+	stored, err := listLiveEvents(ctx, nk)
+	if err != nil {
+		return err
+	}
+
+	configured := make(map[string]bool, len(config.Events))
+	for _, definition := range config.Events {
+		if definition.ID == "" {
+			continue
+		}
+		configured[definition.ID] = true
+		active := definition.Start <= now && now < definition.End
+		existing, ok := stored[definition.ID]
+		if !ok && !active {
+			continue
+		}
+		if ok && existing.Active == active && sameLiveEvent(existing.LiveEventDefinition, definition) {
+			continue
+		}
+		started, err := setLiveEvent(ctx, nk, definition, active, now)
+		if err != nil {
+			logger.Error("Error updating live event %s: %v", definition.ID, err)
+			continue
+		}
+		if started {
+			logger.Info("Live event %s started", definition.ID)
+			content := map[string]interface{}{"event_id": definition.ID, "end": definition.End, "modifiers": definition.Modifiers}
+			if err := nk.NotificationSendAll(ctx, translate(defaultLocale, msgLiveEventStarted, definition.Name), content, notificationLiveEvent, false); err != nil {
+				logger.Error("Error broadcasting live event %s: %v", definition.ID, err)
+			}
+		}
+	}
+
+	for id, event := range stored {
+		if event.Active && !configured[id] {
+			if _, err := setLiveEvent(ctx, nk, event.LiveEventDefinition, false, now); err != nil {
+				logger.Error("Error deactivating removed live event %s: %v", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setLiveEvent writes the event with its new state and reports whether this call is the one that activated it.
+func setLiveEvent(ctx context.Context, nk runtime.NakamaModule, definition *LiveEventDefinition, active bool, now int64) (bool, error) {
+	started := false
+	write := runtime.StorageWrite{
+		Collection:      liveEventsCollection,
+		Key:             definition.ID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		event := &LiveEvent{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), event); err != nil {
+				return "", err
+			}
+		}
+		started = active && !event.Active
+		if started {
+			event.ActivatedAt = now
+		}
+		event.LiveEventDefinition = definition
+		event.Active = active
+		value, err := json.Marshal(event)
+		return string(value), err
+	}, storageWriteAttempts)
+	return started, err
+}
+
+func sameLiveEvent(a, b *LiveEventDefinition) bool {
+	return a.Name == b.Name && a.Start == b.Start && a.End == b.End && maps.Equal(a.Modifiers, b.Modifiers)
+}
+
+func listLiveEvents(ctx context.Context, nk runtime.NakamaModule) (map[string]*LiveEvent, error) {
+	events := make(map[string]*LiveEvent)
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", liveEventsCollection, liveEventsPageSize, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			event := &LiveEvent{}
+			if err := json.Unmarshal([]byte(object.Value), event); err != nil {
+				return nil, err
+			}
+			if event.LiveEventDefinition != nil {
+				events[object.Key] = event
+			}
+		}
+		if next == "" {
+			return events, nil
+		}
+		cursor = next
+	}
+}
+
+func GetActiveEventsRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GetActiveEvents Called - Payload: `%s`", payload)
+
+	events, err := listLiveEvents(ctx, nk)
+	if err != nil {
+		logger.Error("Error listing live events: %v", err)
+		return errorResponse(CodeInternal, "error listing live events")
+	}
+	now := time.Now().UTC().Unix()
+	response := &ActiveEventsResponse{Events: make([]*LiveEvent, 0, len(events)), ServerTime: now}
+	for _, event := range events {
+		// The ticker can lag the window by up to a minute, never report an event past its end.
+		if event.Active && now < event.End {
+			response.Events = append(response.Events, event)
+		}
+	}
+	sort.Slice(response.Events, func(i, j int) bool { return response.Events[i].End < response.Events[j].End })
+	return marshalResponse(response)
+}
@@ -0,0 +1,91 @@
+// Package lock is a best effort cluster wide lock on top of Nakama storage, for jobs such as season rollover or
+// reward distribution that every node runs but only one should carry out at a time.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	collection  = "locks"
+	holderBytes = 16
+)
+
+// Lock is held until Unlock or until its TTL runs out, whichever comes first. Work guarded by it must finish well
+// inside the TTL, after that another node may take the lock over.
+type Lock struct {
+	nk        runtime.NakamaModule
+	key       string
+	holder    string
+	version   string
+	ExpiresAt time.Time
+}
+
+type record struct {
+	Holder    string `json:"holder"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// TryLock takes the lock for key when it is free or its holder let it expire. It returns nil without an error when
+// another holder has it, including when a concurrent caller wins the race for it.
+func TryLock(ctx context.Context, nk runtime.NakamaModule, key string, ttl time.Duration) (*Lock, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: collection, Key: key}})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	version := "*"
+	if len(objects) > 0 {
+		current := &record{}
+		if err := json.Unmarshal([]byte(objects[0].Value), current); err != nil {
+			return nil, err
+		}
+		if now.Unix() < current.ExpiresAt {
+			return nil, nil
+		}
+		// Taking over an expired lock is guarded by its version, so only one caller replaces the stale holder.
+		version = objects[0].Version
+	}
+
+	buf := make([]byte, holderBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	lock := &Lock{nk: nk, key: key, holder: hex.EncodeToString(buf), ExpiresAt: now.Add(ttl)}
+	value, err := json.Marshal(&record{Holder: lock.holder, ExpiresAt: lock.ExpiresAt.Unix()})
+	if err != nil {
+		return nil, err
+	}
+	acks, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      collection,
+		Key:             key,
+		Value:           string(value),
+		Version:         version,
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	if errors.Is(err, runtime.ErrStorageRejectedVersion) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lock.version = acks[0].GetVersion()
+	return lock, nil
+}
+
+// Unlock releases the lock. When it expired and was taken over in the meantime the new holder keeps it.
+func (l *Lock) Unlock(ctx context.Context) error {
+	err := l.nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: collection, Key: l.key, Version: l.version}})
+	if errors.Is(err, runtime.ErrStorageRejectedVersion) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+// barrierModule holds every StorageRead until all callers have read, so they all see the same lock record before any
+// of them writes.
+type barrierModule struct {
+	*testutil.NakamaModule
+	reads sync.WaitGroup
+}
+
+func (m *barrierModule) StorageRead(ctx context.Context, reads []*runtime.StorageRead) ([]*api.StorageObject, error) {
+	objects, err := m.NakamaModule.StorageRead(ctx, reads)
+	m.reads.Done()
+	m.reads.Wait()
+	return objects, err
+}
+
+func contend(t *testing.T, nk *testutil.NakamaModule, callers int) []*Lock {
+	t.Helper()
+	module := &barrierModule{NakamaModule: nk}
+	module.reads.Add(callers)
+	locks := make([]*Lock, callers)
+	errs := make([]error, callers)
+	var done sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			locks[i], errs[i] = TryLock(context.Background(), module, "season", time.Minute)
+		}()
+	}
+	done.Wait()
+
+	held := make([]*Lock, 0, 1)
+	for i := range locks {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: %v", i, errs[i])
+		}
+		if locks[i] != nil {
+			held = append(held, locks[i])
+		}
+	}
+	return held
+}
+
+func TestTryLockContention(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, nk *testutil.NakamaModule)
+	}{
+		{name: "free lock", setup: func(t *testing.T, nk *testutil.NakamaModule) {}},
+		{name: "expired holder", setup: func(t *testing.T, nk *testutil.NakamaModule) {
+			if stale, err := TryLock(context.Background(), nk, "season", -time.Second); err != nil || stale == nil {
+				t.Fatalf("taking the stale lock = %v, %v", stale, err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nk := testutil.NewNakamaModule()
+			tt.setup(t, nk)
+			if held := contend(t, nk, 8); len(held) != 1 {
+				t.Errorf("%d of 8 callers took the lock, want exactly 1", len(held))
+			}
+		})
+	}
+}
+
+func TestTryLockWhileHeld(t *testing.T) {
+	ctx := context.Background()
+	nk := testutil.NewNakamaModule()
+	held, err := TryLock(ctx, nk, "season", time.Minute)
+	if err != nil || held == nil {
+		t.Fatalf("TryLock = %v, %v", held, err)
+	}
+
+	if other, err := TryLock(ctx, nk, "season", time.Minute); err != nil || other != nil {
+		t.Errorf("second TryLock = %v, %v, want nil while held", other, err)
+	}
+	if other, err := TryLock(ctx, nk, "rewards", time.Minute); err != nil || other == nil {
+		t.Errorf("TryLock on another key = %v, %v, want it taken", other, err)
+	}
+
+	if err := held.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if again, err := TryLock(ctx, nk, "season", time.Minute); err != nil || again == nil {
+		t.Errorf("TryLock after Unlock = %v, %v, want it taken", again, err)
+	}
+}
+
+func TestUnlockAfterTakeoverKeepsNewHolder(t *testing.T) {
+	ctx := context.Background()
+	nk := testutil.NewNakamaModule()
+	stale, err := TryLock(ctx, nk, "season", -time.Second)
+	if err != nil || stale == nil {
+		t.Fatalf("TryLock = %v, %v", stale, err)
+	}
+	current, err := TryLock(ctx, nk, "season", time.Minute)
+	if err != nil || current == nil {
+		t.Fatalf("taking over the expired lock = %v, %v", current, err)
+	}
+
+	if err := stale.Unlock(ctx); err != nil {
+		t.Fatalf("stale Unlock: %v", err)
+	}
+	if other, err := TryLock(ctx, nk, "season", time.Minute); err != nil || other != nil {
+		t.Errorf("TryLock after the stale holder unlocked = %v, %v, want the new holder to keep it", other, err)
+	}
+}
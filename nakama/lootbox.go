@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"mhth.net/matchmaking-server/rng"
+)
+
+const (
+	lootboxConfigKey       = "lootbox_tables"
+	lootboxPityCollection  = "lootbox_pity"
+	lootboxAuditCollection = "lootbox_audit"
+)
+
+var errLootboxInventoryFull = newError(CodeFailedPrecondition, "not enough inventory space")
+
+type LootboxCost struct {
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+}
+
+type LootboxTier struct {
+	Rarity string   `json:"rarity"`
+	Weight int      `json:"weight"`
+	Items  []string `json:"items"`
+}
+
+type LootboxPity struct {
+	Rarity string `json:"rarity"`
+	After  int    `json:"after"`
+}
+
+// LootboxTable lists tiers from most common to rarest, pity guarantees the pity rarity or better.
+type LootboxTable struct {
+	Cost  LootboxCost    `json:"cost"`
+	Rolls int            `json:"rolls"`
+	Tiers []*LootboxTier `json:"tiers"`
+	Pity  *LootboxPity   `json:"pity"`
+}
+
+type LootboxConfig struct {
+	Boxes map[string]*LootboxTable `json:"boxes"`
+}
+
+type LootboxPityState struct {
+	Counter int `json:"counter"`
+}
+
+type LootboxAudit struct {
+	BoxID      string      `json:"box_id"`
+	Nonce      string      `json:"nonce"`
+	Seed       int64       `json:"seed"`
+	PityBefore int         `json:"pity_before"`
+	PityAfter  int         `json:"pity_after"`
+	Cost       LootboxCost `json:"cost"`
+	Items      []string    `json:"items"`
+	CreatedAt  int64       `json:"created_at"`
+}
+
+type OpenLootboxRequest struct {
+	BoxID string `json:"box_id"`
+}
+
+type OpenLootboxResponse struct {
+	Items       []string `json:"items"`
+	PityCounter int      `json:"pity_counter"`
+	Nonce       string   `json:"nonce"`
+}
+
+func OpenLootboxRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("OpenLootbox Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[OpenLootboxRequest](payload)
+	if err != nil {
+		return "", err
+	}
+
+	var config LootboxConfig
+	if _, err := readCachedConfig(ctx, nk, lootboxConfigKey, &config); err != nil {
+		logger.Error("Error reading lootbox config: %v", err)
+		return errorResponse(CodeInternal, "error reading lootbox config")
+	}
+	table, ok := config.Boxes[request.BoxID]
+	if !ok || table == nil {
+		return errorResponse(CodeInvalidArgument, "unknown lootbox")
+	}
+	if err := validateLootboxTable(table); err != nil {
+		logger.Error("Invalid lootbox table %s: %v", request.BoxID, err)
+		return errorResponse(CodeInternal, "lootbox is misconfigured")
+	}
+
+	wallet, err := readWallet(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Error reading wallet: %v", err)
+		return errorResponse(CodeInternal, "error reading wallet")
+	}
+	if wallet[table.Cost.Currency] < table.Cost.Amount {
+		return "", errInsufficientFunds
+	}
+	definitions, err := loadItemDefinitions(ctx, nk)
+	if err != nil {
+		logger.Error("Error loading item definitions: %v", err)
+		return errorResponse(CodeInternal, "error reading inventory")
+	}
+	inventory, _, err := readInventory(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Error reading inventory: %v", err)
+		return errorResponse(CodeInternal, "error reading inventory")
+	}
+	if !lootboxFits(definitions, inventory, table) {
+		return "", errLootboxInventoryFull
+	}
+	energy, err := requireEnergy(ctx, nk, userID, energyActionOpenLootbox)
+	if err != nil {
+		return "", runtimeError(logger, err, "updating energy")
+	}
+
+	nonce, err := newLedgerRef()
+	if err != nil {
+		logger.Error("Error generating lootbox nonce: %v", err)
+		refundEnergy(ctx, logger, nk, userID, energy)
+		return errorResponse(CodeInternal, "error opening lootbox")
+	}
+	seed := rng.Seed(nonce)
+
+	audit := &LootboxAudit{BoxID: request.BoxID, Nonce: nonce, Seed: seed, Cost: table.Cost, CreatedAt: time.Now().UTC().Unix()}
+	_, err = updateLootboxPity(ctx, nk, userID, request.BoxID, func(pity *LootboxPityState) error {
+		audit.PityBefore = pity.Counter
+		audit.Items, pity.Counter = rollLootbox(table, seed, pity.Counter)
+		audit.PityAfter = pity.Counter
+		return nil
+	})
+	if err != nil {
+		refundEnergy(ctx, logger, nk, userID, energy)
+		logger.Error("Error rolling lootbox %s for %s: %v", nonce, userID, err)
+		return errorResponse(CodeInternal, "error opening lootbox")
+	}
+
+	costMetadata := map[string]interface{}{"reason": "lootbox", "box_id": request.BoxID, "nonce": nonce}
+	if table.Cost.Amount > 0 {
+		if _, _, err := nk.WalletUpdate(ctx, userID, map[string]int64{table.Cost.Currency: -table.Cost.Amount}, costMetadata, true); err != nil {
+			refundEnergy(ctx, logger, nk, userID, energy)
+			rollbackLootboxPity(ctx, logger, nk, userID, audit)
+			var negativeErr *runtime.WalletNegativeError
+			if errors.As(err, &negativeErr) {
+				return "", errInsufficientFunds
+			}
+			logger.Error("Error charging lootbox cost: %v", err)
+			return errorResponse(CodeInternal, "error charging lootbox cost")
+		}
+	}
+
+	_, applied, err := addInventoryItems(ctx, nk, userID, countItems(audit.Items))
+	if err != nil {
+		logger.Error("Error granting lootbox %s to %s, refunding: %v", nonce, userID, err)
+		refundEnergy(ctx, logger, nk, userID, energy)
+		rollbackLootboxPity(ctx, logger, nk, userID, audit)
+		if table.Cost.Amount > 0 {
+			costMetadata["reason"] = "lootbox_refund"
+			if _, _, refundErr := nk.WalletUpdate(ctx, userID, map[string]int64{table.Cost.Currency: table.Cost.Amount}, costMetadata, true); refundErr != nil {
+				logger.Error("Error refunding lootbox %s to %s: %v", nonce, userID, refundErr)
+			}
+		}
+		return errorResponse(CodeInternal, "error opening lootbox")
+	}
+	granted := grantedItems(audit.Items, applied)
+	if len(granted) < len(audit.Items) {
+		logger.Warn("Lootbox %s items %v did not all fit for %s after a concurrent grant, got %v", nonce, audit.Items, userID, granted)
+	}
+
+	value, err := json.Marshal(audit)
+	if err == nil {
+		_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+			Collection:      lootboxAuditCollection,
+			Key:             nonce,
+			UserID:          userID,
+			Value:           string(value),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		}})
+	}
+	if err != nil {
+		logger.Error("Error writing lootbox audit %s for %s: %v", nonce, userID, err)
+	}
+	if err := progressQuest(ctx, nk, userID, questObjectiveOpenLootbox, 1); err != nil {
+		logger.Warn("Error progressing quests for %s: %v", userID, err)
+	}
+
+	return marshalResponse(&OpenLootboxResponse{Items: granted, PityCounter: audit.PityAfter, Nonce: nonce})
+}
+
+// validateLootboxTable runs before anything is charged, rollLootbox relies on a pity rarity that names a tier.
+func validateLootboxTable(table *LootboxTable) error {
+	if len(table.Tiers) == 0 {
+		return errors.New("no tiers")
+	}
+	total := 0
+	for _, tier := range table.Tiers {
+		if tier == nil || tier.Weight < 0 {
+			return errors.New("tiers must have a non-negative weight")
+		}
+		total += tier.Weight
+	}
+	if total <= 0 {
+		return errors.New("tier weights must add up to more than zero")
+	}
+	if table.Pity == nil {
+		return nil
+	}
+	if table.Pity.After <= 0 {
+		return fmt.Errorf("pity after must be positive, got %d", table.Pity.After)
+	}
+	for _, tier := range table.Tiers {
+		if tier.Rarity == table.Pity.Rarity {
+			return nil
+		}
+	}
+	return fmt.Errorf("pity rarity %q matches no tier", table.Pity.Rarity)
+}
+
+// rollLootbox is a pure function of the table, seed and pity counter so support can replay any audited open.
+func rollLootbox(table *LootboxTable, seed int64, pityCounter int) ([]string, int) {
+	random := rng.New(seed)
+	pityTier := len(table.Tiers)
+	if table.Pity != nil {
+		for i, tier := range table.Tiers {
+			if tier.Rarity == table.Pity.Rarity {
+				pityTier = i
+				break
+			}
+		}
+	}
+
+	weights := make([]int, len(table.Tiers))
+	for i, tier := range table.Tiers {
+		weights[i] = tier.Weight
+	}
+
+	rolls := max(table.Rolls, 1)
+	items := make([]string, 0, rolls)
+	for i := 0; i < rolls; i++ {
+		tierIndex := max(random.Weighted(weights), 0)
+
+		pityCounter++
+		if table.Pity != nil && table.Pity.After > 0 && pityCounter >= table.Pity.After && tierIndex < pityTier && pityTier < len(table.Tiers) {
+			tierIndex = pityTier
+		}
+		if tierIndex >= pityTier {
+			pityCounter = 0
+		}
+
+		tier := table.Tiers[tierIndex]
+		if len(tier.Items) > 0 {
+			items = append(items, tier.Items[random.IntRange(0, len(tier.Items)-1)])
+		}
+	}
+	return items, pityCounter
+}
+
+// updateLootboxPity applies mutate to the pity state of userID for boxID, retrying from a fresh read when a concurrent
+// open wins.
+func updateLootboxPity(ctx context.Context, nk runtime.NakamaModule, userID, boxID string, mutate func(*LootboxPityState) error) (*LootboxPityState, error) {
+	pity := &LootboxPityState{}
+	write := runtime.StorageWrite{
+		Collection:      lootboxPityCollection,
+		Key:             boxID,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		pity = &LootboxPityState{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), pity); err != nil {
+				return "", err
+			}
+		}
+		if err := mutate(pity); err != nil {
+			return "", err
+		}
+		value, err := json.Marshal(pity)
+		return string(value), err
+	}, storageWriteAttempts)
+	return pity, err
+}
+
+// rollbackLootboxPity puts the pity counter back to before a refunded open, unless another open has moved it since.
+func rollbackLootboxPity(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, audit *LootboxAudit) {
+	_, err := updateLootboxPity(ctx, nk, userID, audit.BoxID, func(pity *LootboxPityState) error {
+		if pity.Counter == audit.PityAfter {
+			pity.Counter = audit.PityBefore
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Error rolling back lootbox %s pity of %s: %v", audit.Nonce, userID, err)
+	}
+}
+
+// lootboxFits reports whether the inventory has room for every roll of table landing on the same item, checked before
+// rolling so a full inventory cannot be used to reroll for free.
+func lootboxFits(definitions map[string]*ItemDefinition, inventory *Inventory, table *LootboxTable) bool {
+	rolls := int64(max(table.Rolls, 1))
+	for _, tier := range table.Tiers {
+		for _, itemID := range tier.Items {
+			definition, ok := definitions[itemID]
+			if ok && definition.MaxStack > 0 && inventory.Items[itemID]+rolls > definition.MaxStack {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// grantedItems keeps the rolled items, in roll order, that addInventoryItems actually applied.
+func grantedItems(items []string, applied map[string]int64) []string {
+	left := maps.Clone(applied)
+	granted := make([]string, 0, len(items))
+	for _, item := range items {
+		if left[item] > 0 {
+			left[item]--
+			granted = append(granted, item)
+		}
+	}
+	return granted
+}
+
+func countItems(items []string) map[string]int64 {
+	counts := make(map[string]int64, len(items))
+	for _, item := range items {
+		counts[item]++
+	}
+	return counts
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+
+	"mhth.net/matchmaking-server/rng"
+)
+
+func testLootboxTable() *LootboxTable {
+	return &LootboxTable{
+		Cost:  LootboxCost{Currency: "gold", Amount: 10},
+		Rolls: 1,
+		Tiers: []*LootboxTier{
+			{Rarity: "common", Weight: 70, Items: []string{"potion"}},
+			{Rarity: "rare", Weight: 25, Items: []string{"sword"}},
+			{Rarity: "epic", Weight: 5, Items: []string{"crown"}},
+		},
+		Pity: &LootboxPity{Rarity: "rare", After: 10},
+	}
+}
+
+func TestValidateLootboxTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*LootboxTable)
+		wantErr bool
+	}{
+		{name: "valid table", mutate: func(*LootboxTable) {}},
+		{name: "no pity", mutate: func(table *LootboxTable) { table.Pity = nil }},
+		{name: "no tiers", mutate: func(table *LootboxTable) { table.Tiers = nil }, wantErr: true},
+		{name: "all weights zero", mutate: func(table *LootboxTable) {
+			for _, tier := range table.Tiers {
+				tier.Weight = 0
+			}
+		}, wantErr: true},
+		{name: "negative weight", mutate: func(table *LootboxTable) { table.Tiers[1].Weight = -1 }, wantErr: true},
+		{name: "pity rarity matches no tier", mutate: func(table *LootboxTable) { table.Pity.Rarity = "mythic" }, wantErr: true},
+		{name: "pity after zero", mutate: func(table *LootboxTable) { table.Pity.After = 0 }, wantErr: true},
+		{name: "pity after negative", mutate: func(table *LootboxTable) { table.Pity.After = -3 }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := testLootboxTable()
+			tt.mutate(table)
+			if err := validateLootboxTable(table); (err != nil) != tt.wantErr {
+				t.Errorf("validateLootboxTable = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRollLootboxIsReproducible(t *testing.T) {
+	table := testLootboxTable()
+	table.Rolls = 5
+	seed := rng.Seed("nonce-1")
+
+	items, pity := rollLootbox(table, seed, 3)
+	for i := 0; i < 10; i++ {
+		again, againPity := rollLootbox(table, seed, 3)
+		if !slices.Equal(items, again) || pity != againPity {
+			t.Fatalf("replay %d = %v/%d, want %v/%d", i, again, againPity, items, pity)
+		}
+	}
+}
+
+func TestRollLootboxDistribution(t *testing.T) {
+	table := testLootboxTable()
+	table.Pity = nil
+	const opens = 20000
+
+	counts := make(map[string]int)
+	for i := 0; i < opens; i++ {
+		items, _ := rollLootbox(table, rng.Seed("nonce", strconv.Itoa(i)), 0)
+		counts[items[0]]++
+	}
+
+	want := map[string]float64{"potion": 0.70, "sword": 0.25, "crown": 0.05}
+	for item, share := range want {
+		if got := float64(counts[item]) / opens; math.Abs(got-share) > 0.02 {
+			t.Errorf("%s share = %.3f, want %.2f ± 0.02", item, got, share)
+		}
+	}
+}
+
+func TestRollLootboxPity(t *testing.T) {
+	table := testLootboxTable()
+	table.Tiers[1].Weight = 0
+	table.Tiers[2].Weight = 0
+	table.Pity.After = 3
+
+	counter := 0
+	var items []string
+	for i := 1; i <= 9; i++ {
+		items, counter = rollLootbox(table, rng.Seed("pity", strconv.Itoa(i)), counter)
+		wantItem, wantCounter := "potion", i%3
+		if i%3 == 0 {
+			wantItem = "sword"
+		}
+		if items[0] != wantItem || counter != wantCounter {
+			t.Fatalf("open %d = %s with counter %d, want %s with counter %d", i, items[0], counter, wantItem, wantCounter)
+		}
+	}
+}
+
+// A pity rarity that names no tier must never be rolled into, even when validation was bypassed.
+func TestRollLootboxUnknownPityRarity(t *testing.T) {
+	table := testLootboxTable()
+	table.Pity = &LootboxPity{Rarity: "mythic", After: 1}
+	for i := 0; i < 50; i++ {
+		if items, _ := rollLootbox(table, rng.Seed("unknown", strconv.Itoa(i)), 5); len(items) != 1 {
+			t.Fatalf("open %d rolled %v, want one item", i, items)
+		}
+	}
+}
+
+func TestOpenLootboxRpc(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	nk.Wallets["u1"] = map[string]int64{"gold": 25}
+	writeTestConfig(t, nk, lootboxConfigKey, &LootboxConfig{Boxes: map[string]*LootboxTable{"basic": testLootboxTable()}})
+	for _, item := range []string{"potion", "sword", "crown"} {
+		writeTestObject(t, nk, itemDefinitionCollection, item, "", &ItemDefinition{Name: item})
+	}
+
+	response, err := OpenLootboxRpc(newTestContext("u1"), logger, nil, nk, `{"box_id":"basic"}`)
+	if err != nil {
+		t.Fatalf("OpenLootboxRpc: %v", err)
+	}
+	opened := decodeResponse[OpenLootboxResponse](t, response)
+	if len(opened.Items) != 1 {
+		t.Fatalf("items = %v, want one", opened.Items)
+	}
+	if got := nk.Wallets["u1"]["gold"]; got != 15 {
+		t.Errorf("gold = %d, want 15", got)
+	}
+	inventory := &Inventory{}
+	if !readTestObject(t, nk, inventoryCollection, inventoryKey, "u1", inventory) || inventory.Items[opened.Items[0]] != 1 {
+		t.Errorf("inventory = %v, want one %s", inventory.Items, opened.Items[0])
+	}
+
+	audit := &LootboxAudit{}
+	if !readTestObject(t, nk, lootboxAuditCollection, opened.Nonce, "u1", audit) {
+		t.Fatal("no audit record for the open")
+	}
+	replayed, pity := rollLootbox(testLootboxTable(), audit.Seed, audit.PityBefore)
+	if !slices.Equal(replayed, audit.Items) || pity != audit.PityAfter {
+		t.Errorf("replay = %v/%d, want the audited %v/%d", replayed, pity, audit.Items, audit.PityAfter)
+	}
+}
+
+func TestOpenLootboxRpcRejectsBeforeCharging(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    func() *LootboxTable
+		gold     int64
+		wantCode int
+	}{
+		{name: "pity rarity matches no tier", table: func() *LootboxTable {
+			table := testLootboxTable()
+			table.Pity.Rarity = "mythic"
+			return table
+		}, gold: 100, wantCode: CodeInternal},
+		{name: "pity after zero", table: func() *LootboxTable {
+			table := testLootboxTable()
+			table.Pity.After = 0
+			return table
+		}, gold: 100, wantCode: CodeInternal},
+		{name: "cannot afford", table: testLootboxTable, gold: 5, wantCode: CodeFailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			nk.Wallets["u1"] = map[string]int64{"gold": tt.gold}
+			writeTestConfig(t, nk, lootboxConfigKey, &LootboxConfig{Boxes: map[string]*LootboxTable{"basic": tt.table()}})
+			writeTestConfig(t, nk, energyConfigKey, &EnergyConfig{Max: 10, Costs: map[string]int64{energyActionOpenLootbox: 1}})
+
+			_, err := OpenLootboxRpc(newTestContext("u1"), logger, nil, nk, `{"box_id":"basic"}`)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			if got := nk.Wallets["u1"]["gold"]; got != tt.gold {
+				t.Errorf("gold = %d, want %d untouched", got, tt.gold)
+			}
+			if readTestObject(t, nk, energyCollection, energyKey, "u1", &EnergyState{}) {
+				t.Error("energy was spent on a rejected open")
+			}
+		})
+	}
+}
+
+func TestOpenLootboxRpcRejectsAFullInventory(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	nk.Wallets["u1"] = map[string]int64{"gold": 25}
+	writeTestConfig(t, nk, lootboxConfigKey, &LootboxConfig{Boxes: map[string]*LootboxTable{"basic": testLootboxTable()}})
+	for _, item := range []string{"potion", "sword", "crown"} {
+		defineTestItem(t, nk, item, &ItemDefinition{Name: item, MaxStack: 1})
+	}
+	writeTestObject(t, nk, inventoryCollection, inventoryKey, "u1", &Inventory{Items: map[string]int64{"crown": 1}})
+
+	if _, err := OpenLootboxRpc(newTestContext("u1"), logger, nil, nk, `{"box_id":"basic"}`); err != errLootboxInventoryFull {
+		t.Fatalf("error = %v, want inventory full", err)
+	}
+	if got := nk.Wallets["u1"]["gold"]; got != 25 {
+		t.Errorf("gold = %d, want 25 untouched", got)
+	}
+	if readTestObject(t, nk, lootboxPityCollection, "basic", "u1", &LootboxPityState{}) {
+		t.Error("pity moved on a rejected open")
+	}
+}
+
+func TestOpenLootboxRpcRollsBackWhenGrantFails(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	nk.Wallets["u1"] = map[string]int64{"gold": 25}
+	writeTestConfig(t, nk, lootboxConfigKey, &LootboxConfig{Boxes: map[string]*LootboxTable{"basic": testLootboxTable()}})
+	writeTestConfig(t, nk, energyConfigKey, &EnergyConfig{Max: 10, Costs: map[string]int64{energyActionOpenLootbox: 1}})
+	writeTestObject(t, nk, lootboxPityCollection, "basic", "u1", &LootboxPityState{Counter: 4})
+
+	// no item definitions, so stacking the roll onto the inventory fails after the cost is charged
+	if _, err := OpenLootboxRpc(newTestContext("u1"), logger, nil, nk, `{"box_id":"basic"}`); errorCode(err) != CodeInternal {
+		t.Fatalf("error = %v, want internal", err)
+	}
+	if got := nk.Wallets["u1"]["gold"]; got != 25 {
+		t.Errorf("gold = %d, want the cost refunded", got)
+	}
+	energy := &EnergyState{}
+	if readTestObject(t, nk, energyCollection, energyKey, "u1", energy) && energy.Energy != 10 {
+		t.Errorf("energy = %d, want it refunded", energy.Energy)
+	}
+	pity := &LootboxPityState{}
+	if !readTestObject(t, nk, lootboxPityCollection, "basic", "u1", pity) || pity.Counter != 4 {
+		t.Errorf("pity = %+v, want it rolled back to 4", pity)
+	}
+}
+
+func TestGrantedItems(t *testing.T) {
+	got := grantedItems([]string{"potion", "sword", "potion", "crown"}, map[string]int64{"potion": 1, "crown": 1})
+	if !slices.Equal(got, []string{"potion", "crown"}) {
+		t.Errorf("grantedItems = %v, want the applied items in roll order", got)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	mailCollection = "mail"
+
+	mailDefaultExpiry   = 30 * 24 * time.Hour
+	mailMaxExpiry       = 90 * 24 * time.Hour
+	mailCleanupInterval = time.Hour
+	mailPageSize        = 100
+)
+
+var (
+	errMailNotFound       = newError(CodeNotFound, "mail not found")
+	errMailExpired        = newError(CodeFailedPrecondition, "mail expired")
+	errMailNoAttachments  = newError(CodeFailedPrecondition, "mail has no attachments")
+	errMailAlreadyClaimed = newError(CodeAlreadyExists, "mail attachments already claimed")
+)
+
+type Mail struct {
+	ID          string  `json:"id"`
+	SenderID    string  `json:"sender_id,omitempty"`
+	Subject     string  `json:"subject"`
+	Body        string  `json:"body"`
+	Attachments *Reward `json:"attachments,omitempty"`
+	CreatedAt   int64   `json:"created_at"`
+	ExpiresAt   int64   `json:"expires_at"`
+	Read        bool    `json:"read"`
+	Claimed     bool    `json:"claimed"`
+}
+
+type SendMailRequest struct {
+	UserID           string  `json:"user_id"`
+	Subject          string  `json:"subject"`
+	Body             string  `json:"body"`
+	Attachments      *Reward `json:"attachments"`
+	ExpiresInSeconds int64   `json:"expires_in_seconds"`
+}
+
+type MailRequest struct {
+	MailID string `json:"mail_id"`
+}
+
+type ListMailResponse struct {
+	Mail   []*Mail `json:"mail"`
+	Unread int     `json:"unread"`
+}
+
+type ClaimMailAttachmentResponse struct {
+	Mail        *Mail   `json:"mail"`
+	Attachments *Reward `json:"attachments"`
+}
+
+// SendMailRpc lets players send text mail to each other, only admins may attach currency or items.
+func SendMailRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("SendMail Called - Payload: `%s`", payload)
+	request, err := parsePayload[SendMailRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.UserID == "" || request.Subject == "" {
+		return errorResponse(CodeInvalidArgument, "user_id and subject are required")
+	}
+
+	senderID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	hasAttachments := request.Attachments != nil && (len(request.Attachments.Currency) > 0 || len(request.Attachments.Items) > 0)
+	if hasAttachments {
+		if err := requireAdmin(ctx, nk); err != nil {
+			if !errors.Is(err, errAdminOnly) {
+				logger.Error("Error checking admin: %v", err)
+				return errorResponse(CodeInternal, "error checking admin")
+			}
+			return errorResponse(CodePermissionDenied, "only admins can send attachments")
+		}
+	}
+	if !hasAttachments {
+		request.Attachments = nil
+	}
+
+	users, err := nk.UsersGetId(ctx, []string{request.UserID}, nil)
+	if err != nil {
+		logger.Error("Error getting mail recipient: %v", err)
+		return errorResponse(CodeInternal, "error sending mail")
+	}
+	if len(users) == 0 {
+		return errorResponse(CodeNotFound, "recipient not found")
+	}
+
+	expiry := mailDefaultExpiry
+	if request.ExpiresInSeconds > 0 {
+		expiry = min(time.Duration(request.ExpiresInSeconds)*time.Second, mailMaxExpiry)
+	}
+	id, err := newLedgerRef()
+	if err != nil {
+		logger.Error("Error generating mail id: %v", err)
+		return errorResponse(CodeInternal, "error sending mail")
+	}
+	now := time.Now().UTC()
+	mail := &Mail{
+		ID:          id,
+		SenderID:    senderID,
+		Subject:     request.Subject,
+		Body:        request.Body,
+		Attachments: request.Attachments,
+		CreatedAt:   now.Unix(),
+		ExpiresAt:   now.Add(expiry).Unix(),
+	}
+
+	value, err := json.Marshal(mail)
+	if err != nil {
+		logger.Error("Error marshalling mail: %v", err)
+		return errorResponse(CodeInternal, "error sending mail")
+	}
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      mailCollection,
+		Key:             id,
+		UserID:          request.UserID,
+		Value:           string(value),
+		Version:         "*",
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}}); err != nil {
+		logger.Error("Error writing mail: %v", err)
+		return errorResponse(CodeInternal, "error sending mail")
+	}
+
+	return marshalResponse(mail)
+}
+
+func ListMailRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ListMail Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC().Unix()
+	response := &ListMailResponse{Mail: make([]*Mail, 0)}
+	err = listMail(ctx, nk, userID, func(object *api.StorageObject, mail *Mail) error {
+		if mail.ExpiresAt <= now {
+			return nil
+		}
+		if !mail.Read {
+			response.Unread++
+		}
+		response.Mail = append(response.Mail, mail)
+		return nil
+	})
+	if err != nil {
+		logger.Error("Error listing mail: %v", err)
+		return errorResponse(CodeInternal, "error listing mail")
+	}
+	sort.Slice(response.Mail, func(i, j int) bool { return response.Mail[i].CreatedAt > response.Mail[j].CreatedAt })
+
+	return marshalResponse(response)
+}
+
+func ReadMailRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ReadMail Called - Payload: `%s`", payload)
+	mail, err := updateMailFromPayload(ctx, nk, payload, func(mail *Mail) error {
+		if mail.ExpiresAt <= time.Now().UTC().Unix() {
+			return errMailNotFound
+		}
+		mail.Read = true
+		return nil
+	})
+	if err != nil {
+		return "", runtimeError(logger, err, "updating mail")
+	}
+	return marshalResponse(mail)
+}
+
+func ClaimMailAttachmentRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ClaimMailAttachment Called - Payload: `%s`", payload)
+	mail, err := updateMailFromPayload(ctx, nk, payload, func(mail *Mail) error {
+		if mail.ExpiresAt <= time.Now().UTC().Unix() {
+			return errMailExpired
+		}
+		if mail.Attachments == nil {
+			return errMailNoAttachments
+		}
+		if mail.Claimed {
+			return errMailAlreadyClaimed
+		}
+		mail.Read = true
+		mail.Claimed = true
+		return nil
+	})
+	if err != nil {
+		return "", runtimeError(logger, err, "updating mail")
+	}
+
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	metadata := map[string]interface{}{"reason": "mail", "mail_id": mail.ID}
+	if err := grantReward(ctx, nk, userID, mail.Attachments, metadata); err != nil {
+		logger.Error("Error granting mail %s attachments to %s: %v", mail.ID, userID, err)
+		_, releaseErr := updateMailFromPayload(ctx, nk, payload, func(mail *Mail) error {
+			mail.Claimed = false
+			return nil
+		})
+		if releaseErr != nil {
+			logger.Error("Error releasing mail %s claim of %s: %v", mail.ID, userID, releaseErr)
+		}
+		return errorResponse(CodeInternal, "error granting mail attachments")
+	}
+
+	return marshalResponse(&ClaimMailAttachmentResponse{Mail: mail, Attachments: mail.Attachments})
+}
+
+// startMailCleanup prunes expired mail for every user on a fixed interval until ctx is done.
+func startMailCleanup(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	runEvery(ctx, mailCleanupInterval, func() {
+		pruned, err := pruneExpiredMail(ctx, nk)
+		if err != nil {
+			logger.Error("Error pruning expired mail: %v", err)
+			return
+		}
+		if pruned > 0 {
+			logger.Info("Pruned %d expired mail", pruned)
+		}
+	})
+}
+
+func pruneExpiredMail(ctx context.Context, nk runtime.NakamaModule) (int, error) {
+	now := time.Now().UTC().Unix()
+	deletes := make([]*runtime.StorageDelete, 0)
+	err := listMail(ctx, nk, "", func(object *api.StorageObject, mail *Mail) error {
+		if mail.ExpiresAt <= now {
+			deletes = append(deletes, &runtime.StorageDelete{Collection: mailCollection, Key: object.Key, UserID: object.UserId})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for start := 0; start < len(deletes); start += mailPageSize {
+		if err := nk.StorageDelete(ctx, deletes[start:min(start+mailPageSize, len(deletes))]); err != nil {
+			return start, err
+		}
+	}
+	return len(deletes), nil
+}
+
+// listMail walks the mail of userID, or of every user when userID is empty.
+func listMail(ctx context.Context, nk runtime.NakamaModule, userID string, fn func(*api.StorageObject, *Mail) error) error {
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", userID, mailCollection, mailPageSize, cursor)
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			mail := &Mail{}
+			if err := json.Unmarshal([]byte(object.Value), mail); err != nil {
+				return err
+			}
+			if err := fn(object, mail); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func updateMailFromPayload(ctx context.Context, nk runtime.NakamaModule, payload string, mutate func(*Mail) error) (*Mail, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	request, err := parsePayload[MailRequest](payload)
+	if err != nil {
+		return nil, err
+	}
+	if request.MailID == "" {
+		return nil, newError(CodeInvalidArgument, "mail_id is required")
+	}
+
+	mail := &Mail{}
+	write := runtime.StorageWrite{
+		Collection:      mailCollection,
+		Key:             request.MailID,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err = writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		if current == "" {
+			return "", errMailNotFound
+		}
+		mail = &Mail{}
+		if err := json.Unmarshal([]byte(current), mail); err != nil {
+			return "", err
+		}
+		if err := mutate(mail); err != nil {
+			return "", err
+		}
+		value, err := json.Marshal(mail)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return mail, nil
+}
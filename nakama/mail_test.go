@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaimMailAttachmentRpcReleasesClaimWhenGrantFails(t *testing.T) {
+	logger, fake := newTestRuntime(t)
+	nk := &failingWalletModule{NakamaModule: fake, fail: true}
+	ctx := newTestContext("u1")
+	writeTestObject(t, nk, mailCollection, "m1", "u1", &Mail{
+		ID:          "m1",
+		Subject:     "sorry for the downtime",
+		Attachments: &Reward{Currency: map[string]int64{"coins": 50}},
+		ExpiresAt:   time.Now().Add(time.Hour).Unix(),
+	})
+	payload := `{"mail_id":"m1"}`
+
+	if _, err := ClaimMailAttachmentRpc(ctx, logger, nil, nk, payload); errorCode(err) != CodeInternal {
+		t.Fatalf("claim with a failing wallet = %v, want internal", err)
+	}
+	mail := &Mail{}
+	if !readTestObject(t, nk, mailCollection, "m1", "u1", mail) || mail.Claimed {
+		t.Fatalf("mail = %+v, want the claim released", mail)
+	}
+
+	nk.fail = false
+	if _, err := ClaimMailAttachmentRpc(ctx, logger, nil, nk, payload); err != nil {
+		t.Fatalf("retried claim: %v", err)
+	}
+	if got := fake.Wallets["u1"]["coins"]; got != 50 {
+		t.Errorf("coins = %d, want 50", got)
+	}
+	if _, err := ClaimMailAttachmentRpc(ctx, logger, nil, nk, payload); errorCode(err) != CodeAlreadyExists {
+		t.Errorf("second claim = %v, want already exists", err)
+	}
+}
@@ -9,19 +9,285 @@ import (
 )
 
 const (
-	rpcHealthcheck = "healthcheck"
+	rpcHealthcheck           = "healthcheck"
+	rpcReadiness             = "readiness"
+	rpcCreateProfile         = "create_profile"
+	rpcCreateHordeMatch      = "create_horde_match"
+	rpcSubmitScore           = "submit_score"
+	rpcGrantCurrency         = "grant_currency"
+	rpcSpendCurrency         = "spend_currency"
+	rpcWalletHistory         = "wallet_history"
+	rpcValidatePurchase      = "validate_purchase"
+	rpcClaimDailyReward      = "claim_daily_reward"
+	rpcBroadcastNotification = "broadcast_notification"
+	rpcCreateGuild           = "create_guild"
+	rpcJoinGuild             = "join_guild"
+	rpcGuildInfo             = "guild_info"
+	rpcUpdateGuildMotd       = "update_guild_motd"
+	rpcLeaveGuild            = "leave_guild"
+	rpcGetInventory          = "get_inventory"
+	rpcAddItem               = "add_item"
+	rpcConsumeItem           = "consume_item"
+	rpcLeaderboardAroundMe   = "leaderboard_around_me"
+	rpcServerTime            = "server_time"
+	rpcGetFlags              = "get_flags"
+	rpcReloadFlags           = "reload_flags"
+	rpcOpenLootbox           = "open_lootbox"
+	rpcListAchievements      = "list_achievements"
+	rpcGetQuests             = "get_quests"
+	rpcClaimQuest            = "claim_quest"
+	rpcSendMail              = "send_mail"
+	rpcListMail              = "list_mail"
+	rpcReadMail              = "read_mail"
+	rpcClaimMailAttachment   = "claim_mail_attachment"
+	rpcReportResult          = "report_result"
+	rpcReloadChatFilter      = "reload_chat_filter"
+	rpcProposeTrade          = "propose_trade"
+	rpcAcceptTrade           = "accept_trade"
+	rpcCancelTrade           = "cancel_trade"
+	rpcGetBattlepass         = "get_battlepass"
+	rpcClaimBattlepassTier   = "claim_battlepass_tier"
+	rpcGetReferralCode       = "get_referral_code"
+	rpcRedeemReferral        = "redeem_referral"
+	rpcReloadConfig          = "reload_config"
+	rpcBanUser               = "ban_user"
+	rpcUnbanUser             = "unban_user"
+	rpcKickUser              = "kick_user"
+	rpcFriendsOnline         = "friends_online"
+	rpcCreateParty           = "create_party"
+	rpcJoinParty             = "join_party"
+	rpcLeaveParty            = "leave_party"
+	rpcGetActiveEvents       = "get_active_events"
+	rpcCreateTicket          = "create_ticket"
+	rpcListMyTickets         = "list_my_tickets"
+	rpcReplyTicket           = "reply_ticket"
+	rpcStaffReplyTicket      = "staff_reply_ticket"
+	rpcRequestKeyframe       = "request_keyframe"
+	rpcGetRank               = "get_rank"
+	rpcRestorePurchases      = "restore_purchases"
+	rpcReportMatchResult     = "report_match_result"
+	rpcFriendsLeaderboard    = "friends_leaderboard"
+	rpcGetEnergy             = "get_energy"
+	rpcSpendEnergy           = "spend_energy"
+	rpcGetReplay             = "get_replay"
 )
 
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
 	logger.Debug("Hello World!")
 	logger.Info("Server init modules MHTH")
 	startTime := time.Now()
+	moduleStartTime = startTime
 
-	if err := initializer.RegisterRpc(rpcHealthcheck, HealthcheckRpc); err != nil {
-		logger.Error("Error registering rpc healthcheck: %v", err)
+	if err := createLeaderboards(ctx, nk, envString(ctx, leaderboardResetScheduleEnv, "")); err != nil {
+		logger.Error("Error creating leaderboards: %v", err)
 		return err
 	}
 
+	if err := createTournaments(ctx, nk); err != nil {
+		logger.Error("Error creating tournaments: %v", err)
+		return err
+	}
+
+	flags = newFeatureFlags(nk, featureFlagsTTL)
+	translations = newTranslator(nk)
+	matchResultSecret = matchResultSigningKey(ctx, logger)
+	webhooks = newWebhookDispatcher(logger, nk, envString(ctx, webhookSecretEnv, ""))
+
+	maxScore := envInt64(ctx, leaderboardMaxScoreEnv, leaderboardDefaultMaxScore)
+	rpcs := rpcHandlers(maxScore)
+
+	// Byte limits above payloadDefaultLimit for RPCs that legitimately carry more.
+	payloadLimits := map[string]int{
+		rpcBroadcastNotification: 64 << 10,
+		rpcSendMail:              32 << 10,
+	}
+
+	schemas, err := compileSchemas(rpcSchemas)
+	if err != nil {
+		logger.Error("Error compiling rpc schemas: %v", err)
+		return err
+	}
+	for id, fn := range rpcs {
+		if err := initializer.RegisterRpc(id, withTracing(id, withMetrics(id, withRecovery(id, withLocalizedErrors(withClientVersion(withRateLimit(id, rateLimitFor(id), withPayloadLimit(id, payloadLimitFor(payloadLimits, id), withValidation(schemas[id], fn))))))))); err != nil {
+			logger.Error("Error registering rpc %s: %v", id, err)
+			return err
+		}
+	}
+
+	if err := initializer.RegisterMatch(hordeModuleName, NewMatchHandler); err != nil {
+		logger.Error("Error registering match horde: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterMatchmakerMatched(MatchmakerMatched); err != nil {
+		logger.Error("Error registering matchmaker matched: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterBeforeRt(matchmakerAddMessageID, BeforeMatchmakerAdd); err != nil {
+		logger.Error("Error registering before matchmaker add: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterBeforeRt(partyMatchmakerAddMessageID, BeforePartyMatchmakerAdd); err != nil {
+		logger.Error("Error registering before party matchmaker add: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterBeforeRt(channelMessageSendMessageID, BeforeChannelMessageSend); err != nil {
+		logger.Error("Error registering before channel message send: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterEvent(WebhookEvent); err != nil {
+		logger.Error("Error registering webhook event handler: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterEventSessionStart(SessionStart(nk)); err != nil {
+		logger.Error("Error registering session start event: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterEventSessionEnd(SessionEnd(nk)); err != nil {
+		logger.Error("Error registering session end event: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterTournamentEnd(TournamentEnd); err != nil {
+		logger.Error("Error registering tournament end: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterLeaderboardReset(LeaderboardReset); err != nil {
+		logger.Error("Error registering leaderboard reset: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterBeforeAuthenticateDevice(BeforeAuthenticateDevice); err != nil {
+		logger.Error("Error registering before authenticate device: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterBeforeAuthenticateEmail(BeforeAuthenticateEmail); err != nil {
+		logger.Error("Error registering before authenticate email: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterBeforeAuthenticateCustom(BeforeAuthenticateCustom); err != nil {
+		logger.Error("Error registering before authenticate custom: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterAfterAuthenticateDevice(AfterAuthenticateDevice); err != nil {
+		logger.Error("Error registering after authenticate device: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterAfterAuthenticateEmail(AfterAuthenticateEmail); err != nil {
+		logger.Error("Error registering after authenticate email: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterAfterAuthenticateCustom(AfterAuthenticateCustom); err != nil {
+		logger.Error("Error registering after authenticate custom: %v", err)
+		return err
+	}
+
+	if err := runMigrations(ctx, logger, nk, migrations); err != nil {
+		logger.Error("Error running migrations: %v", err)
+		return err
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(ctx)
+	if err := initializer.RegisterShutdown(Shutdown(stopBackground)); err != nil {
+		logger.Error("Error registering shutdown: %v", err)
+		stopBackground()
+		return err
+	}
+	if err := setupTracing(backgroundCtx, logger); err != nil {
+		logger.Error("Error setting up tracing: %v", err)
+		stopBackground()
+		return err
+	}
+	startMailCleanup(backgroundCtx, logger, nk)
+	startTradeExpiry(backgroundCtx, logger, nk)
+	startBanExpiry(backgroundCtx, logger, nk)
+	webhooks.start(backgroundCtx)
+	startMetricsGauges(backgroundCtx, logger, nk)
+	startLiveEvents(backgroundCtx, logger, nk)
+	startRankedSeasons(backgroundCtx, logger, nk)
+	startReplayCleanup(backgroundCtx, logger, nk)
+	startNotificationDigest(backgroundCtx, logger, nk)
+
 	logger.Info("Module MHTH init complete: %dms", time.Since(startTime).Milliseconds())
 	return nil
 }
+
+// rpcHandlers maps every rpc id to its handler, admin only handlers are wrapped here so the guard cannot be missed
+// by a handler that forgets to check.
+func rpcHandlers(maxScore int64) map[string]rpcFunc {
+	return map[string]rpcFunc{
+		rpcHealthcheck:           HealthcheckRpc,
+		rpcReadiness:             ReadinessRpc,
+		rpcCreateProfile:         CreateProfileRpc,
+		rpcCreateHordeMatch:      CreateHordeMatchRpc,
+		rpcSubmitScore:           SubmitScoreRpc(maxScore),
+		rpcGrantCurrency:         adminOnly(GrantCurrencyRpc),
+		rpcSpendCurrency:         SpendCurrencyRpc,
+		rpcWalletHistory:         WalletHistoryRpc,
+		rpcValidatePurchase:      ValidatePurchaseRpc,
+		rpcClaimDailyReward:      ClaimDailyRewardRpc,
+		rpcBroadcastNotification: adminOnly(BroadcastNotificationRpc),
+		rpcCreateGuild:           CreateGuildRpc,
+		rpcJoinGuild:             JoinGuildRpc,
+		rpcGuildInfo:             GuildInfoRpc,
+		rpcUpdateGuildMotd:       UpdateGuildMotdRpc,
+		rpcLeaveGuild:            LeaveGuildRpc,
+		rpcGetInventory:          GetInventoryRpc,
+		rpcAddItem:               adminOnly(AddItemRpc),
+		rpcConsumeItem:           ConsumeItemRpc,
+		rpcLeaderboardAroundMe:   LeaderboardAroundMeRpc,
+		rpcServerTime:            ServerTimeRpc,
+		rpcGetFlags:              GetFlagsRpc,
+		rpcReloadFlags:           adminOnly(ReloadFlagsRpc),
+		rpcOpenLootbox:           OpenLootboxRpc,
+		rpcListAchievements:      ListAchievementsRpc,
+		rpcGetQuests:             GetQuestsRpc,
+		rpcClaimQuest:            ClaimQuestRpc,
+		rpcSendMail:              SendMailRpc,
+		rpcListMail:              ListMailRpc,
+		rpcReadMail:              ReadMailRpc,
+		rpcClaimMailAttachment:   ClaimMailAttachmentRpc,
+		rpcReportResult:          adminOnly(ReportResultRpc),
+		rpcReloadChatFilter:      adminOnly(ReloadChatFilterRpc),
+		rpcProposeTrade:          ProposeTradeRpc,
+		rpcAcceptTrade:           AcceptTradeRpc,
+		rpcCancelTrade:           CancelTradeRpc,
+		rpcGetBattlepass:         GetBattlepassRpc,
+		rpcClaimBattlepassTier:   ClaimBattlepassTierRpc,
+		rpcGetReferralCode:       GetReferralCodeRpc,
+		rpcRedeemReferral:        RedeemReferralRpc,
+		rpcReloadConfig:          adminOnly(ReloadConfigRpc),
+		rpcBanUser:               adminOnly(BanUserRpc),
+		rpcUnbanUser:             adminOnly(UnbanUserRpc),
+		rpcKickUser:              adminOnly(KickUserRpc),
+		rpcFriendsOnline:         FriendsOnlineRpc,
+		rpcCreateParty:           CreatePartyRpc,
+		rpcJoinParty:             JoinPartyRpc,
+		rpcLeaveParty:            LeavePartyRpc,
+		rpcGetActiveEvents:       GetActiveEventsRpc,
+		rpcCreateTicket:          CreateTicketRpc,
+		rpcListMyTickets:         ListMyTicketsRpc,
+		rpcReplyTicket:           ReplyTicketRpc,
+		rpcStaffReplyTicket:      adminOnly(StaffReplyTicketRpc),
+		rpcRequestKeyframe:       RequestKeyframeRpc,
+		rpcGetRank:               GetRankRpc,
+		rpcRestorePurchases:      RestorePurchasesRpc,
+		rpcReportMatchResult:     ReportMatchResultRpc(maxScore),
+		rpcFriendsLeaderboard:    FriendsLeaderboardRpc,
+		rpcGetEnergy:             GetEnergyRpc,
+		rpcSpendEnergy:           SpendEnergyRpc,
+		rpcGetReplay:             GetReplayRpc,
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"mhth.net/matchmaking-server/rng"
+)
+
+const (
+	hordeModuleName = "horde"
+
+	hordeDefaultTickRate   = 10
+	hordeDefaultMaxPlayers = 4
+	hordeWaveLengthSeconds = 30
+	hordeMaxEmptySeconds   = 60
+	hordeRejoinGraceS      = 30
+
+	// Server maximums for the match settings a client may pick, larger requests are clamped to them.
+	hordeMaxTickRate              = 30
+	hordeMaxPlayers               = 16
+	hordeMaxBotFillTimeoutSeconds = 120
+	hordeMaxKeyframeIntervalTicks = 600
+)
+
+const (
+	OpCodeStateDelta int64 = iota + 1
+	OpCodeMove
+	OpCodeAttack
+	OpCodeKicked
+	OpCodeChat
+	OpCodeChatHistory
+	OpCodeKeyframe
+)
+
+type MatchHandler struct{}
+
+type HordeMatchState struct {
+	presences   map[string]runtime.Presence
+	players     map[string]*HordePlayer
+	antiCheat   *AntiCheatConfig
+	botFill     *BotFillConfig
+	tickRate    int
+	maxPlayers  int
+	region      string
+	difficulty  string
+	expected    map[string]bool
+	kicked      map[string]bool
+	partyIDs    []string
+	wave        int
+	waveTicks   int
+	emptyTicks  int
+	rejoinGrace int
+	chat        []*HordeChatLine
+	deltaConfig *HordeDeltaConfig
+	deltas      *hordeDeltaState
+	random      *rng.Rand
+	replay      *hordeReplay
+}
+
+type HordePlayer struct {
+	presence       runtime.Presence
+	x              float64
+	y              float64
+	lastMoveTick   int64
+	lastAttackTick int64
+	lastChatTick   int64
+	attacks        int
+	violations     []int64
+	isBot          bool
+	disconnected   bool
+	leftTick       int64
+	botTargetX     float64
+	botTargetY     float64
+}
+
+type HordePlayerDelta struct {
+	UserID       string  `json:"user_id"`
+	X            float64 `json:"x"`
+	Y            float64 `json:"y"`
+	Attacks      int     `json:"attacks"`
+	IsBot        bool    `json:"is_bot,omitempty"`
+	Disconnected bool    `json:"disconnected,omitempty"`
+}
+
+type CreateHordeMatchRequest struct {
+	TickRate              int  `json:"tick_rate"`
+	MaxPlayers            int  `json:"max_players"`
+	MinPlayers            int  `json:"min_players"`
+	BotFill               bool `json:"bot_fill"`
+	BotFillTimeoutSeconds int  `json:"bot_fill_timeout_seconds"`
+	KeyframeIntervalTicks int  `json:"keyframe_interval_ticks"`
+	RecordReplay          bool `json:"record_replay"`
+}
+
+type CreateHordeMatchResponse struct {
+	MatchID string `json:"match_id"`
+}
+
+type RequestKeyframeRequest struct {
+	MatchID string `json:"match_id"`
+}
+
+// RequestKeyframeResponse carries the tick the request was taken at, the keyframe is the next broadcast after it.
+type RequestKeyframeResponse struct {
+	MatchID string `json:"match_id"`
+	Tick    int64  `json:"tick"`
+}
+
+func NewMatchHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (runtime.Match, error) {
+	return &MatchHandler{}, nil
+}
+
+func (m *MatchHandler) MatchInit(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, params map[string]interface{}) (interface{}, int, string) {
+	state := &HordeMatchState{
+		presences:   make(map[string]runtime.Presence),
+		players:     make(map[string]*HordePlayer),
+		antiCheat:   newAntiCheatConfig(params),
+		tickRate:    intParam(params, "tick_rate", hordeDefaultTickRate),
+		maxPlayers:  intParam(params, "max_players", hordeDefaultMaxPlayers),
+		region:      stringParam(params, "region", ""),
+		difficulty:  stringParam(params, "difficulty", ""),
+		expected:    make(map[string]bool),
+		kicked:      make(map[string]bool),
+		wave:        1,
+		deltaConfig: newHordeDeltaConfig(params),
+		deltas:      &hordeDeltaState{},
+		replay:      newHordeReplay(params),
+	}
+	// Bots roll from a source of their own seeded by the match id rather than the global one.
+	matchID, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	state.random = rng.New(rng.Seed(matchID))
+	state.rejoinGrace = intParam(params, "rejoin_grace_seconds", hordeRejoinGraceS)
+	state.botFill = newBotFillConfig(params, state.maxPlayers)
+	if userIDs, ok := params["user_ids"].([]string); ok {
+		for _, userID := range userIDs {
+			state.expected[userID] = true
+		}
+	}
+	state.partyIDs, _ = params["party_ids"].([]string)
+	label, err := json.Marshal(map[string]interface{}{
+		"mode":        hordeModuleName,
+		"max_players": state.maxPlayers,
+		"region":      state.region,
+		"difficulty":  state.difficulty,
+		"mmr":         intParam(params, "mmr", 0),
+		"party_size":  intParam(params, "party_size", 0),
+	})
+	if err != nil {
+		logger.Error("Error marshalling match label: %v", err)
+		return nil, 0, ""
+	}
+	logger.Info("Horde match init - tick rate: %d, max players: %d, region: %s, difficulty: %s", state.tickRate, state.maxPlayers, state.region, state.difficulty)
+	return state, state.tickRate, string(label)
+}
+
+func (m *MatchHandler) MatchJoinAttempt(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presence runtime.Presence, metadata map[string]string) (interface{}, bool, string) {
+	hordeState := state.(*HordeMatchState)
+	if player, ok := hordeState.players[presence.GetUserId()]; ok && player.disconnected {
+		return hordeState, true, ""
+	}
+	humans := 0
+	for _, player := range hordeState.players {
+		if !player.isBot {
+			humans++
+		}
+	}
+	if humans >= hordeState.maxPlayers {
+		return hordeState, false, "match full"
+	}
+	if hordeState.kicked[presence.GetUserId()] {
+		return hordeState, false, "kicked from this match"
+	}
+	if len(hordeState.expected) > 0 && !hordeState.expected[presence.GetUserId()] {
+		return hordeState, false, "not part of this match"
+	}
+	return hordeState, true, ""
+}
+
+func (m *MatchHandler) MatchJoin(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presences []runtime.Presence) interface{} {
+	hordeState := state.(*HordeMatchState)
+	rejoined := make([]runtime.Presence, 0)
+	joined := make([]runtime.Presence, 0, len(presences))
+	for _, presence := range presences {
+		userID := presence.GetUserId()
+		hordeState.presences[userID] = presence
+		joined = append(joined, presence)
+		hordeState.replay.record(&ReplayEvent{Tick: tick, Type: replayEventJoin, UserID: userID})
+		if player, ok := hordeState.players[userID]; ok && player.disconnected {
+			logger.Info("Player %s rejoined horde match", userID)
+			player.presence = presence
+			player.disconnected = false
+			player.lastMoveTick = tick
+			rejoined = append(rejoined, presence)
+			continue
+		}
+		if len(hordeState.players) >= hordeState.maxPlayers {
+			replaceBot(hordeState)
+		}
+		hordeState.players[userID] = &HordePlayer{presence: presence, lastMoveTick: tick, lastAttackTick: -1, lastChatTick: hordeChatLastTickUnknown}
+	}
+
+	// Joining clients get a keyframe straight away since the next tick may only carry a delta.
+	sendKeyframe(logger, dispatcher, tick, hordeState, joined)
+	sendChatHistory(logger, dispatcher, hordeState, rejoined)
+	return hordeState
+}
+
+func (m *MatchHandler) MatchLeave(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presences []runtime.Presence) interface{} {
+	hordeState := state.(*HordeMatchState)
+	for _, presence := range presences {
+		delete(hordeState.presences, presence.GetUserId())
+		hordeState.replay.record(&ReplayEvent{Tick: tick, Type: replayEventLeave, UserID: presence.GetUserId()})
+		if player, ok := hordeState.players[presence.GetUserId()]; ok {
+			player.disconnected = true
+			player.leftTick = tick
+		}
+	}
+	return hordeState
+}
+
+func (m *MatchHandler) MatchLoop(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, messages []runtime.MatchData) interface{} {
+	hordeState := state.(*HordeMatchState)
+	ctx, span := startMatchTickSpan(ctx, tick)
+	defer span.End()
+
+	if len(hordeState.presences) == 0 {
+		hordeState.emptyTicks++
+		if hordeState.emptyTicks >= hordeMaxEmptySeconds*hordeState.tickRate {
+			logger.Info("Horde match empty for %ds, closing", hordeMaxEmptySeconds)
+			if err := persistReplay(ctx, nk, tick, hordeState); err != nil {
+				logger.Error("Error persisting horde match replay: %v", err)
+			}
+			matchID, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+			clearPartyMatch(ctx, logger, nk, hordeState.partyIDs, matchID)
+			return nil
+		}
+		return hordeState
+	}
+	hordeState.emptyTicks = 0
+
+	graceTicks := int64(hordeState.rejoinGrace * hordeState.tickRate)
+	for userID, player := range hordeState.players {
+		if player.disconnected && tick-player.leftTick >= graceTicks {
+			logger.Info("Freeing slot of %s after %ds rejoin grace", userID, hordeState.rejoinGrace)
+			delete(hordeState.players, userID)
+		}
+	}
+
+	fillBots(logger, tick, hordeState)
+	for _, message := range append(messages, botInputs(tick, hordeState)...) {
+		if message.GetOpCode() == OpCodeChat {
+			relayChat(ctx, logger, nk, dispatcher, tick, hordeState, message)
+			continue
+		}
+		applyPlayerInput(logger, dispatcher, tick, hordeState, message)
+	}
+
+	hordeState.waveTicks++
+	if hordeState.waveTicks >= hordeWaveLengthSeconds*hordeState.tickRate {
+		hordeState.wave++
+		hordeState.waveTicks = 0
+		hordeState.replay.record(&ReplayEvent{Tick: tick, Type: replayEventWave, Wave: hordeState.wave})
+	}
+
+	broadcastState(logger, dispatcher, tick, hordeState)
+	return hordeState
+}
+
+func (m *MatchHandler) MatchTerminate(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, graceSeconds int) interface{} {
+	logger.Info("Horde match terminating - grace seconds: %d", graceSeconds)
+	if err := persistSnapshot(ctx, nk, tick, state.(*HordeMatchState)); err != nil {
+		logger.Error("Error persisting horde match snapshot: %v", err)
+	}
+	if err := persistReplay(ctx, nk, tick, state.(*HordeMatchState)); err != nil {
+		logger.Error("Error persisting horde match replay: %v", err)
+	}
+	matchID, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	clearPartyMatch(ctx, logger, nk, state.(*HordeMatchState).partyIDs, matchID)
+	return state
+}
+
+// MatchSignal answers hordeSignalSnapshot with the serialized match state, drains the match on hordeSignalShutdown
+// and hands a keyframe request, hordeSignalKeyframe and the requesting user id, to requestKeyframe.
+func (m *MatchHandler) MatchSignal(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, data string) (interface{}, string) {
+	if userID, ok := strings.CutPrefix(data, hordeSignalKeyframe+":"); ok {
+		return state, requestKeyframe(state.(*HordeMatchState), userID, tick)
+	}
+	switch data {
+	case hordeSignalShutdown:
+		drainForShutdown(ctx, logger, nk, tick, state.(*HordeMatchState))
+	case hordeSignalSnapshot:
+		snapshot, err := json.Marshal(newHordeSnapshot(tick, state.(*HordeMatchState)))
+		if err != nil {
+			logger.Error("Error marshalling horde match snapshot: %v", err)
+			return state, ""
+		}
+		return state, string(snapshot)
+	}
+	return state, ""
+}
+
+func CreateHordeMatchRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("CreateHordeMatch Called - Payload: `%s`", payload)
+
+	request, err := parsePayload[CreateHordeMatchRequest](payload)
+	if err != nil {
+		return "", err
+	}
+
+	params := make(map[string]interface{})
+	if request.TickRate > 0 {
+		params["tick_rate"] = min(request.TickRate, hordeMaxTickRate)
+	}
+	maxPlayers := hordeDefaultMaxPlayers
+	if request.MaxPlayers > 0 {
+		maxPlayers = min(request.MaxPlayers, hordeMaxPlayers)
+		params["max_players"] = maxPlayers
+	}
+	if request.MinPlayers > 0 {
+		params["min_players"] = min(request.MinPlayers, maxPlayers)
+	}
+	if request.BotFill {
+		params["bot_fill"] = true
+	}
+	if request.BotFillTimeoutSeconds > 0 {
+		params["bot_fill_timeout_seconds"] = min(request.BotFillTimeoutSeconds, hordeMaxBotFillTimeoutSeconds)
+	}
+	if request.RecordReplay {
+		params["record_replay"] = true
+	}
+	if request.KeyframeIntervalTicks > 0 {
+		params["keyframe_interval_ticks"] = min(request.KeyframeIntervalTicks, hordeMaxKeyframeIntervalTicks)
+	}
+
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	energy := int64(0)
+	if userID != "" {
+		if energy, err = requireEnergy(ctx, nk, userID, energyActionCreateHordeMatch); err != nil {
+			return "", runtimeError(logger, err, "updating energy")
+		}
+	}
+	matchID, err := nk.MatchCreate(ctx, hordeModuleName, params)
+	if err != nil {
+		logger.Error("Error creating horde match: %v", err)
+		refundEnergy(ctx, logger, nk, userID, energy)
+		return errorResponse(CodeInternal, "error creating match")
+	}
+
+	return marshalResponse(&CreateHordeMatchResponse{MatchID: matchID})
+}
+
+// RequestKeyframeRpc lets a client that noticed a gap in the state sequence ask its match for a keyframe. Only the
+// match's participants may ask, the match checks the caller against its presences and expected players.
+func RequestKeyframeRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("RequestKeyframe Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[RequestKeyframeRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.MatchID == "" {
+		return errorResponse(CodeInvalidArgument, "match_id is required")
+	}
+
+	match, err := nk.MatchGet(ctx, request.MatchID)
+	if err != nil {
+		logger.Error("Error getting match: %v", err)
+		return errorResponse(CodeInternal, "error requesting keyframe")
+	}
+	if match == nil || !match.Authoritative {
+		return errorResponse(CodeNotFound, "match not found")
+	}
+	answer, err := nk.MatchSignal(ctx, request.MatchID, hordeSignalKeyframe+":"+userID)
+	if err != nil {
+		logger.Error("Error signalling match %s: %v", request.MatchID, err)
+		return errorResponse(CodeInternal, "error requesting keyframe")
+	}
+	tick, err := strconv.ParseInt(answer, 10, 64)
+	if err != nil {
+		return errorResponse(CodePermissionDenied, "not a participant of this match")
+	}
+	return marshalResponse(&RequestKeyframeResponse{MatchID: request.MatchID, Tick: tick})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	antiCheatDefaultMaxSpeed         = 8.0
+	antiCheatDefaultAttackCooldownMs = 500
+	antiCheatDefaultViolationLimit   = 5
+	antiCheatDefaultViolationWindowS = 10
+
+	// antiCheatMaxMoveSeconds caps the time a move is allowed to cover, so idling does not bank distance for a
+	// teleport.
+	antiCheatMaxMoveSeconds = 1.0
+)
+
+// AntiCheatConfig holds the per match thresholds read from the MatchInit params.
+type AntiCheatConfig struct {
+	maxSpeed         float64
+	attackCooldownMs int
+	violationLimit   int
+	violationWindowS int
+	kickEnabled      bool
+}
+
+type MoveInput struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type KickedMessage struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+func newAntiCheatConfig(params map[string]interface{}) *AntiCheatConfig {
+	maxSpeed := antiCheatDefaultMaxSpeed
+	switch value := params["max_speed"].(type) {
+	case float64:
+		maxSpeed = value
+	case int:
+		maxSpeed = float64(value)
+	}
+	return &AntiCheatConfig{
+		maxSpeed:         maxSpeed,
+		attackCooldownMs: intParam(params, "attack_cooldown_ms", antiCheatDefaultAttackCooldownMs),
+		violationLimit:   intParam(params, "violation_limit", antiCheatDefaultViolationLimit),
+		violationWindowS: intParam(params, "violation_window_seconds", antiCheatDefaultViolationWindowS),
+		kickEnabled:      flags.IsEnabled(flagHordeAntiCheat),
+	}
+}
+
+// applyPlayerInput validates a single input message and only then applies it to the match state.
+func applyPlayerInput(logger runtime.Logger, dispatcher runtime.MatchDispatcher, tick int64, state *HordeMatchState, message runtime.MatchData) {
+	player, ok := state.players[message.GetUserId()]
+	if !ok {
+		return
+	}
+
+	switch message.GetOpCode() {
+	case OpCodeMove:
+		var input MoveInput
+		if err := json.Unmarshal(message.GetData(), &input); err != nil {
+			recordViolation(logger, dispatcher, tick, state, player, "malformed move")
+			return
+		}
+		elapsed := min(float64(tick-player.lastMoveTick)/float64(state.tickRate), antiCheatMaxMoveSeconds)
+		distance := math.Hypot(input.X-player.x, input.Y-player.y)
+		if distance > 0 && (elapsed <= 0 || distance/elapsed > state.antiCheat.maxSpeed) {
+			recordViolation(logger, dispatcher, tick, state, player, "speed")
+			return
+		}
+		player.x, player.y = input.X, input.Y
+		player.lastMoveTick = tick
+		if data, err := json.Marshal(&input); err == nil {
+			state.replay.record(&ReplayEvent{Tick: tick, Type: replayEventInput, UserID: player.presence.GetUserId(), OpCode: OpCodeMove, Data: data})
+		}
+	case OpCodeAttack:
+		cooldownTicks := int64(state.antiCheat.attackCooldownMs * state.tickRate / 1000)
+		if player.lastAttackTick >= 0 && tick-player.lastAttackTick < cooldownTicks {
+			recordViolation(logger, dispatcher, tick, state, player, "attack cooldown")
+			return
+		}
+		player.lastAttackTick = tick
+		player.attacks++
+		state.replay.record(&ReplayEvent{Tick: tick, Type: replayEventInput, UserID: player.presence.GetUserId(), OpCode: OpCodeAttack})
+	}
+}
+
+// recordViolation drops the offending message and kicks the player once too many violations land inside the window.
+func recordViolation(logger runtime.Logger, dispatcher runtime.MatchDispatcher, tick int64, state *HordeMatchState, player *HordePlayer, reason string) {
+	userID := player.presence.GetUserId()
+	logger.Warn("Dropped invalid input from %s: %s", userID, reason)
+	if !state.antiCheat.kickEnabled {
+		return
+	}
+
+	windowStart := tick - int64(state.antiCheat.violationWindowS*state.tickRate)
+	recent := player.violations[:0]
+	for _, violationTick := range player.violations {
+		if violationTick > windowStart {
+			recent = append(recent, violationTick)
+		}
+	}
+	player.violations = append(recent, tick)
+	if len(player.violations) < state.antiCheat.violationLimit {
+		return
+	}
+
+	logger.Warn("Kicking %s after %d violations", userID, len(player.violations))
+	if data, err := json.Marshal(&KickedMessage{UserID: userID, Reason: "anti-cheat"}); err == nil {
+		if err := dispatcher.BroadcastMessage(OpCodeKicked, data, nil, nil, true); err != nil {
+			logger.Error("Error broadcasting kick: %v", err)
+		}
+	}
+	if !player.isBot {
+		if err := dispatcher.MatchKick([]runtime.Presence{player.presence}); err != nil {
+			logger.Error("Error kicking %s: %v", userID, err)
+		}
+	}
+	state.replay.record(&ReplayEvent{Tick: tick, Type: replayEventKick, UserID: userID})
+	delete(state.players, userID)
+	delete(state.presences, userID)
+	// The reservation is dropped without emptying expected, an empty set would open the match to anyone.
+	if _, ok := state.expected[userID]; ok {
+		state.expected[userID] = false
+	}
+	state.kicked[userID] = true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+func newTestHordeState(t *testing.T, userIDs ...string) *HordeMatchState {
+	t.Helper()
+	_, nk := newTestRuntime(t)
+	ctx := context.WithValue(newTestContext(""), runtime.RUNTIME_CTX_MATCH_ID, testHordeMatchID)
+	state, _, _ := (&MatchHandler{}).MatchInit(ctx, testutil.NewLogger(), nil, nk, map[string]interface{}{"user_ids": userIDs})
+	return state.(*HordeMatchState)
+}
+
+func addTestHordePlayer(state *HordeMatchState, userID string) *testutil.Presence {
+	presence := &testutil.Presence{UserID: userID, SessionID: userID + "-session"}
+	state.presences[userID] = presence
+	state.players[userID] = &HordePlayer{presence: presence, lastAttackTick: -1}
+	return presence
+}
+
+func moveMessage(presence *testutil.Presence, data string) *testutil.MatchData {
+	return &testutil.MatchData{Presence: presence, OpCode: OpCodeMove, Data: []byte(data)}
+}
+
+func TestApplyPlayerInputCapsTheMoveWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		idleTick int64
+		move     string
+		wantX    float64
+	}{
+		{name: "idling does not bank a teleport", idleTick: 600, move: `{"x":100,"y":0}`, wantX: 0},
+		{name: "a move within one second of speed after idling", idleTick: 600, move: `{"x":8,"y":0}`, wantX: 8},
+		{name: "too fast inside the window", idleTick: 5, move: `{"x":8,"y":0}`, wantX: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newTestHordeState(t)
+			presence := addTestHordePlayer(state, "u1")
+
+			applyPlayerInput(testutil.NewLogger(), &testutil.MatchDispatcher{}, tt.idleTick, state, moveMessage(presence, tt.move))
+			if got := state.players["u1"].x; got != tt.wantX {
+				t.Errorf("x = %v, want %v", got, tt.wantX)
+			}
+		})
+	}
+}
+
+func TestRecordViolationKeepsKickedPlayersOut(t *testing.T) {
+	state := newTestHordeState(t, "cheater", "friend")
+	state.antiCheat.kickEnabled = true
+	presence := addTestHordePlayer(state, "cheater")
+	dispatcher := &testutil.MatchDispatcher{}
+
+	for tick := int64(1); tick <= int64(state.antiCheat.violationLimit); tick++ {
+		applyPlayerInput(testutil.NewLogger(), dispatcher, tick, state, moveMessage(presence, `not json`))
+	}
+	if len(dispatcher.Kicked) != 1 || dispatcher.Kicked[0].GetUserId() != "cheater" {
+		t.Fatalf("kicked = %v, want the cheater", dispatcher.Kicked)
+	}
+	if _, ok := state.players["cheater"]; ok {
+		t.Error("cheater is still a player after the kick")
+	}
+	if state.expected["cheater"] || len(state.expected) != 2 {
+		t.Errorf("expected = %v, want the cheater's reservation dropped without emptying the set", state.expected)
+	}
+
+	for _, tt := range []struct {
+		userID string
+		want   bool
+	}{{"cheater", false}, {"friend", true}, {"stranger", false}} {
+		_, allowed, reason := (&MatchHandler{}).MatchJoinAttempt(context.Background(), testutil.NewLogger(), nil, nil, dispatcher, 10, state, &testutil.Presence{UserID: tt.userID}, nil)
+		if allowed != tt.want {
+			t.Errorf("%s join allowed = %v (%s), want %v", tt.userID, allowed, reason, tt.want)
+		}
+	}
+}
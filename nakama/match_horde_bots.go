@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	botFillDefaultTimeoutS = 15
+	botSpeedFactor         = 0.8
+	botArenaSize           = 50.0
+	botAttackChance        = 0.2
+	botUserIDPrefix        = "bot-"
+)
+
+// BotFillConfig controls whether bots top the match up to minPlayers once the fill timeout passes without enough humans.
+type BotFillConfig struct {
+	enabled    bool
+	timeoutS   int
+	minPlayers int
+	nextBotID  int
+	filled     bool
+}
+
+// botPresence stands in for a session so bots can share the player and input code paths with humans.
+type botPresence struct {
+	userID   string
+	username string
+}
+
+func (p *botPresence) GetHidden() bool                   { return false }
+func (p *botPresence) GetPersistence() bool              { return false }
+func (p *botPresence) GetUsername() string               { return p.username }
+func (p *botPresence) GetStatus() string                 { return "" }
+func (p *botPresence) GetReason() runtime.PresenceReason { return runtime.PresenceReasonUnknown }
+func (p *botPresence) GetUserId() string                 { return p.userID }
+func (p *botPresence) GetSessionId() string              { return "" }
+func (p *botPresence) GetNodeId() string                 { return "" }
+
+type botInput struct {
+	*botPresence
+	opCode int64
+	data   []byte
+}
+
+func (i *botInput) GetOpCode() int64      { return i.opCode }
+func (i *botInput) GetData() []byte       { return i.data }
+func (i *botInput) GetReliable() bool     { return false }
+func (i *botInput) GetReceiveTime() int64 { return time.Now().UnixMilli() }
+
+func newBotFillConfig(params map[string]interface{}, maxPlayers int) *BotFillConfig {
+	return &BotFillConfig{
+		enabled:    boolParam(params, "bot_fill", false),
+		timeoutS:   intParam(params, "bot_fill_timeout_seconds", botFillDefaultTimeoutS),
+		minPlayers: min(intParam(params, "min_players", maxPlayers), maxPlayers),
+	}
+}
+
+// fillBots runs once the timeout is reached, adding bots for every missing human below the minimum.
+func fillBots(logger runtime.Logger, tick int64, state *HordeMatchState) {
+	fill := state.botFill
+	if !fill.enabled || fill.filled || tick < int64(fill.timeoutS*state.tickRate) {
+		return
+	}
+	fill.filled = true
+
+	missing := fill.minPlayers - len(state.players)
+	for i := 0; i < missing; i++ {
+		fill.nextBotID++
+		id := strconv.Itoa(fill.nextBotID)
+		presence := &botPresence{userID: botUserIDPrefix + id, username: "Bot " + id}
+		state.players[presence.userID] = &HordePlayer{presence: presence, lastMoveTick: tick, lastAttackTick: -1, isBot: true}
+	}
+	if missing > 0 {
+		logger.Info("Filled horde match with %d bots after %ds", missing, fill.timeoutS)
+	}
+}
+
+// replaceBot frees a bot slot for a human joining after the fill.
+func replaceBot(state *HordeMatchState) {
+	for userID, player := range state.players {
+		if player.isBot {
+			delete(state.players, userID)
+			return
+		}
+	}
+}
+
+// botInputs produces this tick's bot actions as regular match data so they are validated like human input.
+func botInputs(tick int64, state *HordeMatchState) []runtime.MatchData {
+	inputs := make([]runtime.MatchData, 0)
+	step := state.antiCheat.maxSpeed * botSpeedFactor / float64(state.tickRate)
+	for _, player := range state.players {
+		if !player.isBot {
+			continue
+		}
+		presence := player.presence.(*botPresence)
+
+		dx, dy := player.botTargetX-player.x, player.botTargetY-player.y
+		distance := math.Hypot(dx, dy)
+		if distance < step {
+			player.botTargetX = (state.random.Float64()*2 - 1) * botArenaSize
+			player.botTargetY = (state.random.Float64()*2 - 1) * botArenaSize
+		} else if data, err := json.Marshal(&MoveInput{X: player.x + dx/distance*step, Y: player.y + dy/distance*step}); err == nil {
+			inputs = append(inputs, &botInput{botPresence: presence, opCode: OpCodeMove, data: data})
+		}
+
+		cooldownTicks := int64(state.antiCheat.attackCooldownMs * state.tickRate / 1000)
+		if (player.lastAttackTick < 0 || tick-player.lastAttackTick >= cooldownTicks) && state.random.Float64() < botAttackChance {
+			inputs = append(inputs, &botInput{botPresence: presence, opCode: OpCodeAttack})
+		}
+	}
+	return inputs
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	hordeChatMaxBytes        = 512
+	hordeChatMaxTextLength   = 200
+	hordeChatHistoryLines    = 20
+	hordeChatMinIntervalMs   = 1000
+	hordeChatLastTickUnknown = -1
+)
+
+type ChatInput struct {
+	Text string `json:"text"`
+}
+
+type HordeChatLine struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Text     string `json:"text"`
+	Tick     int64  `json:"tick"`
+}
+
+type HordeChatHistory struct {
+	Lines []*HordeChatLine `json:"lines"`
+}
+
+// relayChat filters a chat message from a connected player and rebroadcasts it to everyone in the match. Messages
+// that are oversized, too frequent or rejected by the chat filter are dropped without telling the sender.
+func relayChat(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state *HordeMatchState, message runtime.MatchData) {
+	userID := message.GetUserId()
+	player, ok := state.players[userID]
+	if _, connected := state.presences[userID]; !connected || !ok {
+		return
+	}
+	if len(message.GetData()) > hordeChatMaxBytes {
+		logger.Warn("Dropped oversized chat message from %s", userID)
+		return
+	}
+	minTicks := int64(hordeChatMinIntervalMs * state.tickRate / 1000)
+	if player.lastChatTick != hordeChatLastTickUnknown && tick-player.lastChatTick < minTicks {
+		logger.Warn("Dropped chat message from %s: sending too fast", userID)
+		return
+	}
+
+	var input ChatInput
+	if err := json.Unmarshal(message.GetData(), &input); err != nil {
+		logger.Warn("Dropped malformed chat message from %s", userID)
+		return
+	}
+	input.Text = strings.TrimSpace(input.Text)
+	if input.Text == "" || len([]rune(input.Text)) > hordeChatMaxTextLength {
+		return
+	}
+	if err := chatMessageFilter.ensureLoaded(ctx, nk); err != nil {
+		logger.Error("Error loading chat filter: %v", err)
+		return
+	}
+	text, err := chatMessageFilter.sanitize(input.Text)
+	if err != nil {
+		logger.Warn("Rejected chat message from %s: %v", userID, err)
+		return
+	}
+	player.lastChatTick = tick
+
+	line := &HordeChatLine{UserID: userID, Username: message.GetUsername(), Text: text, Tick: tick}
+	state.chat = append(state.chat, line)
+	if len(state.chat) > hordeChatHistoryLines {
+		state.chat = state.chat[len(state.chat)-hordeChatHistoryLines:]
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		logger.Error("Error marshalling chat message: %v", err)
+		return
+	}
+	if err := dispatcher.BroadcastMessage(OpCodeChat, data, nil, nil, true); err != nil {
+		logger.Error("Error broadcasting chat message: %v", err)
+	}
+}
+
+// sendChatHistory replays the recent chat lines to the given presences, usually players that just rejoined.
+func sendChatHistory(logger runtime.Logger, dispatcher runtime.MatchDispatcher, state *HordeMatchState, presences []runtime.Presence) {
+	if len(state.chat) == 0 || len(presences) == 0 {
+		return
+	}
+	data, err := json.Marshal(&HordeChatHistory{Lines: state.chat})
+	if err != nil {
+		logger.Error("Error marshalling chat history: %v", err)
+		return
+	}
+	if err := dispatcher.BroadcastMessage(OpCodeChatHistory, data, presences, nil, true); err != nil {
+		logger.Error("Error sending chat history: %v", err)
+	}
+}
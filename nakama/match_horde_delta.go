@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	hordeDefaultKeyframeTicks = 50
+	hordeSignalKeyframe       = "keyframe"
+)
+
+// HordeStateDelta is broadcast every tick. Keyframes carry every player, deltas only the players that changed
+// since the previous broadcast plus the ones that left. Seq grows by one per broadcast so clients that see a gap
+// can ask for a keyframe.
+type HordeStateDelta struct {
+	Seq          int64               `json:"seq"`
+	Tick         int64               `json:"tick"`
+	Wave         int                 `json:"wave"`
+	WaveTicks    int                 `json:"wave_ticks"`
+	Players      int                 `json:"players"`
+	PlayerStates []*HordePlayerDelta `json:"player_states"`
+	Removed      []string            `json:"removed,omitempty"`
+}
+
+type HordeDeltaConfig struct {
+	keyframeTicks int
+	deltaOpCode   int64
+}
+
+// hordeDeltaState is the baseline deltas are computed against, it is the player state of the last broadcast.
+type hordeDeltaState struct {
+	seq           int64
+	lastKeyframe  int64
+	keyframeDue   bool
+	sent          map[string]HordePlayerDelta
+	hasBroadcasts bool
+}
+
+func newHordeDeltaConfig(params map[string]interface{}) *HordeDeltaConfig {
+	return &HordeDeltaConfig{
+		keyframeTicks: max(intParam(params, "keyframe_interval_ticks", hordeDefaultKeyframeTicks), 1),
+		deltaOpCode:   int64(intParam(params, "delta_opcode", int(OpCodeStateDelta))),
+	}
+}
+
+// isKeyframeTick reports whether this tick's broadcast must carry the full state, either because none was sent
+// yet, the keyframe interval elapsed or a keyframe was requested.
+func isKeyframeTick(tick int64, config *HordeDeltaConfig, deltas *hordeDeltaState) bool {
+	return !deltas.hasBroadcasts || deltas.keyframeDue || tick-deltas.lastKeyframe >= int64(config.keyframeTicks)
+}
+
+// broadcastState sends this tick's keyframe or delta to every presence and moves the baseline forward.
+func broadcastState(logger runtime.Logger, dispatcher runtime.MatchDispatcher, tick int64, state *HordeMatchState) {
+	deltas := state.deltas
+	keyframe := isKeyframeTick(tick, state.deltaConfig, deltas)
+	current := playerDeltas(state)
+
+	update := newStateUpdate(tick, state)
+	for userID, player := range current {
+		if previous, ok := deltas.sent[userID]; keyframe || !ok || previous != player {
+			update.PlayerStates = append(update.PlayerStates, &player)
+		}
+	}
+	if !keyframe {
+		for userID := range deltas.sent {
+			if _, ok := current[userID]; !ok {
+				update.Removed = append(update.Removed, userID)
+			}
+		}
+	}
+	deltas.seq++
+	update.Seq = deltas.seq
+	deltas.sent = current
+	deltas.hasBroadcasts = true
+	opCode := state.deltaConfig.deltaOpCode
+	if keyframe {
+		deltas.lastKeyframe = tick
+		deltas.keyframeDue = false
+		opCode = OpCodeKeyframe
+	}
+
+	data, err := json.Marshal(update)
+	if err != nil {
+		logger.Error("Error marshalling state update: %v", err)
+		return
+	}
+	if err := dispatcher.BroadcastMessage(opCode, data, nil, nil, false); err != nil {
+		logger.Error("Error broadcasting state update: %v", err)
+	}
+}
+
+// requestKeyframe makes the next broadcast a keyframe when userID is connected or expected and answers with the
+// current tick, anyone else gets an empty answer and changes nothing.
+func requestKeyframe(state *HordeMatchState, userID string, tick int64) string {
+	if _, connected := state.presences[userID]; !connected && !state.expected[userID] {
+		return ""
+	}
+	state.deltas.keyframeDue = true
+	return strconv.FormatInt(tick, 10)
+}
+
+// sendKeyframe sends the full current state to presences, such as players that just joined, under the last
+// broadcast sequence number so the next delta follows on from it.
+func sendKeyframe(logger runtime.Logger, dispatcher runtime.MatchDispatcher, tick int64, state *HordeMatchState, presences []runtime.Presence) {
+	if len(presences) == 0 {
+		return
+	}
+	update := newStateUpdate(tick, state)
+	update.Seq = state.deltas.seq
+	for _, player := range playerDeltas(state) {
+		update.PlayerStates = append(update.PlayerStates, &player)
+	}
+	data, err := json.Marshal(update)
+	if err != nil {
+		logger.Error("Error marshalling keyframe: %v", err)
+		return
+	}
+	if err := dispatcher.BroadcastMessage(OpCodeKeyframe, data, presences, nil, true); err != nil {
+		logger.Error("Error sending keyframe: %v", err)
+	}
+}
+
+func newStateUpdate(tick int64, state *HordeMatchState) *HordeStateDelta {
+	return &HordeStateDelta{
+		Tick:         tick,
+		Wave:         state.wave,
+		WaveTicks:    state.waveTicks,
+		Players:      len(state.presences),
+		PlayerStates: make([]*HordePlayerDelta, 0),
+	}
+}
+
+func playerDeltas(state *HordeMatchState) map[string]HordePlayerDelta {
+	players := make(map[string]HordePlayerDelta, len(state.players))
+	for userID, player := range state.players {
+		players[userID] = HordePlayerDelta{UserID: userID, X: player.x, Y: player.y, Attacks: player.attacks, IsBot: player.isBot, Disconnected: player.disconnected}
+	}
+	return players
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	replayCollection       = "replays"
+	replayDefaultMaxEvents = 5000
+	replayTTL              = 7 * 24 * time.Hour
+	replayCleanupInterval  = time.Hour
+	replayPageSize         = 100
+
+	replayEventJoin  = "join"
+	replayEventLeave = "leave"
+	replayEventKick  = "kick"
+	replayEventInput = "input"
+	replayEventWave  = "wave"
+)
+
+var errReplayNotFound = newError(CodeNotFound, "replay not found")
+
+type ReplayEvent struct {
+	Tick   int64           `json:"tick"`
+	Type   string          `json:"type"`
+	UserID string          `json:"user_id,omitempty"`
+	OpCode int64           `json:"op_code,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Wave   int             `json:"wave,omitempty"`
+}
+
+// Replay is what a match leaves behind in storage. Dropped counts the oldest events the ring buffer let go of
+// once it was full, so a replay with Dropped above 0 does not start at StartTick.
+type Replay struct {
+	MatchID         string         `json:"match_id"`
+	Participants    []string       `json:"participants"`
+	TickRate        int            `json:"tick_rate"`
+	StartTick       int64          `json:"start_tick"`
+	EndTick         int64          `json:"end_tick"`
+	DurationSeconds int64          `json:"duration_seconds"`
+	Dropped         int            `json:"dropped"`
+	Events          []*ReplayEvent `json:"events"`
+	CreatedAt       int64          `json:"created_at"`
+	ExpiresAt       int64          `json:"expires_at"`
+}
+
+type GetReplayRequest struct {
+	MatchID string `json:"match_id"`
+}
+
+// hordeReplay is a ring buffer of the match events, a nil replay records nothing.
+type hordeReplay struct {
+	events       []*ReplayEvent
+	next         int
+	dropped      int
+	startTick    int64
+	startedAt    time.Time
+	participants map[string]bool
+	persisted    bool
+}
+
+func newHordeReplay(params map[string]interface{}) *hordeReplay {
+	if !boolParam(params, "record_replay", false) {
+		return nil
+	}
+	capacity := max(intParam(params, "replay_max_events", replayDefaultMaxEvents), 1)
+	return &hordeReplay{events: make([]*ReplayEvent, 0, capacity), startTick: -1, participants: make(map[string]bool)}
+}
+
+func (r *hordeReplay) record(event *ReplayEvent) {
+	if r == nil {
+		return
+	}
+	if r.startTick < 0 {
+		r.startTick = event.Tick
+		r.startedAt = time.Now().UTC()
+	}
+	if event.UserID != "" {
+		r.participants[event.UserID] = true
+	}
+	if len(r.events) < cap(r.events) {
+		r.events = append(r.events, event)
+		return
+	}
+	r.events[r.next] = event
+	r.next = (r.next + 1) % len(r.events)
+	r.dropped++
+}
+
+// ordered returns the buffered events oldest first.
+func (r *hordeReplay) ordered() []*ReplayEvent {
+	return append(append(make([]*ReplayEvent, 0, len(r.events)), r.events[r.next:]...), r.events[:r.next]...)
+}
+
+// persistReplay writes the replay once, both a match that empties out and one that is terminated end up here.
+func persistReplay(ctx context.Context, nk runtime.NakamaModule, tick int64, state *HordeMatchState) error {
+	replay := state.replay
+	if replay == nil || replay.persisted || len(replay.events) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	stored := &Replay{
+		Participants:    make([]string, 0, len(replay.participants)),
+		TickRate:        state.tickRate,
+		StartTick:       replay.startTick,
+		EndTick:         tick,
+		DurationSeconds: int64(now.Sub(replay.startedAt).Seconds()),
+		Dropped:         replay.dropped,
+		Events:          replay.ordered(),
+		CreatedAt:       now.Unix(),
+		ExpiresAt:       now.Add(replayTTL).Unix(),
+	}
+	stored.MatchID, _ = ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	for userID := range replay.participants {
+		stored.Participants = append(stored.Participants, userID)
+	}
+	sort.Strings(stored.Participants)
+
+	value, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      replayCollection,
+		Key:             stored.MatchID,
+		Value:           string(value),
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}}); err != nil {
+		return err
+	}
+	replay.persisted = true
+	return nil
+}
+
+// GetReplayRpc returns a stored replay to the players of its match and to admins, it holds their inputs and positions.
+func GetReplayRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GetReplay Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[GetReplayRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.MatchID == "" {
+		return errorResponse(CodeInvalidArgument, "match_id is required")
+	}
+
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: replayCollection, Key: request.MatchID}})
+	if err != nil {
+		logger.Error("Error reading replay: %v", err)
+		return errorResponse(CodeInternal, "error reading replay")
+	}
+	if len(objects) == 0 {
+		return "", errReplayNotFound
+	}
+	replay := &Replay{}
+	if err := json.Unmarshal([]byte(objects[0].Value), replay); err != nil {
+		logger.Error("Error unmarshalling replay %s: %v", request.MatchID, err)
+		return errorResponse(CodeInternal, "error reading replay")
+	}
+	if replay.ExpiresAt <= time.Now().UTC().Unix() {
+		return "", errReplayNotFound
+	}
+	if !slices.Contains(replay.Participants, userID) {
+		if err := requireAdmin(ctx, nk); err != nil {
+			if !errors.Is(err, errAdminOnly) {
+				logger.Error("Error checking admin: %v", err)
+				return errorResponse(CodeInternal, "error checking admin")
+			}
+			return errorResponse(CodePermissionDenied, "not a participant of this match")
+		}
+	}
+	return objects[0].Value, nil
+}
+
+// startReplayCleanup deletes replays past their expiry on a fixed interval until ctx is done.
+func startReplayCleanup(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	runEvery(ctx, replayCleanupInterval, func() {
+		now := time.Now().UTC().Unix()
+		deletes := make([]*runtime.StorageDelete, 0)
+		cursor := ""
+		for {
+			objects, next, err := nk.StorageList(ctx, "", "", replayCollection, replayPageSize, cursor)
+			if err != nil {
+				logger.Error("Error listing replays: %v", err)
+				return
+			}
+			for _, object := range objects {
+				var replay struct {
+					ExpiresAt int64 `json:"expires_at"`
+				}
+				if err := json.Unmarshal([]byte(object.Value), &replay); err != nil || replay.ExpiresAt <= now {
+					deletes = append(deletes, &runtime.StorageDelete{Collection: replayCollection, Key: object.Key})
+				}
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		for start := 0; start < len(deletes); start += replayPageSize {
+			if err := nk.StorageDelete(ctx, deletes[start:min(start+replayPageSize, len(deletes))]); err != nil {
+				logger.Error("Error deleting expired replays: %v", err)
+				return
+			}
+		}
+		if len(deletes) > 0 {
+			logger.Info("Deleted %d expired replays", len(deletes))
+		}
+	})
+}
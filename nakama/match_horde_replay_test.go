@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetReplayRpcIsLimitedToParticipantsAndAdmins(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   string
+		wantCode int
+	}{
+		{name: "participant", userID: "player"},
+		{name: "admin", userID: "staff"},
+		{name: "stranger", userID: "stranger", wantCode: CodePermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			writeTestObject(t, nk, adminCollection, "staff", "", map[string]string{})
+			writeTestObject(t, nk, replayCollection, "m1.node", "", &Replay{
+				MatchID:      "m1.node",
+				Participants: []string{"other", "player"},
+				Events:       []*ReplayEvent{{Tick: 1, Type: replayEventJoin, UserID: "player"}},
+				ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+			})
+
+			response, err := GetReplayRpc(newTestContext(tt.userID), logger, nil, nk, `{"match_id":"m1.node"}`)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			if tt.wantCode != 0 {
+				return
+			}
+			if replay := decodeResponse[Replay](t, response); replay.MatchID != "m1.node" || len(replay.Events) != 1 {
+				t.Errorf("replay = %+v, want the stored one", replay)
+			}
+		})
+	}
+}
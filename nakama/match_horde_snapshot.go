@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	hordeSignalSnapshot     = "snapshot"
+	hordeSignalShutdown     = "shutdown"
+	hordeSnapshotCollection = "match_snapshots"
+)
+
+type HordePlayerSnapshot struct {
+	UserID       string  `json:"user_id"`
+	X            float64 `json:"x"`
+	Y            float64 `json:"y"`
+	Attacks      int     `json:"attacks"`
+	Violations   int     `json:"violations"`
+	IsBot        bool    `json:"is_bot"`
+	Disconnected bool    `json:"disconnected"`
+}
+
+type HordeSnapshot struct {
+	MatchID    string                 `json:"match_id"`
+	Tick       int64                  `json:"tick"`
+	Region     string                 `json:"region"`
+	Difficulty string                 `json:"difficulty"`
+	Wave       int                    `json:"wave"`
+	WaveTicks  int                    `json:"wave_ticks"`
+	Players    []*HordePlayerSnapshot `json:"players"`
+	CreatedAt  int64                  `json:"created_at"`
+}
+
+func newHordeSnapshot(tick int64, state *HordeMatchState) *HordeSnapshot {
+	snapshot := &HordeSnapshot{
+		Tick:       tick,
+		Region:     state.region,
+		Difficulty: state.difficulty,
+		Wave:       state.wave,
+		WaveTicks:  state.waveTicks,
+		Players:    make([]*HordePlayerSnapshot, 0, len(state.players)),
+		CreatedAt:  time.Now().UTC().Unix(),
+	}
+	for userID, player := range state.players {
+		snapshot.Players = append(snapshot.Players, &HordePlayerSnapshot{
+			UserID:       userID,
+			X:            player.x,
+			Y:            player.y,
+			Attacks:      player.attacks,
+			Violations:   len(player.violations),
+			IsBot:        player.isBot,
+			Disconnected: player.disconnected,
+		})
+	}
+	return snapshot
+}
+
+// persistSnapshot stores the final match state under the match id for post-mortem inspection, clients cannot read it.
+func persistSnapshot(ctx context.Context, nk runtime.NakamaModule, tick int64, state *HordeMatchState) error {
+	snapshot := newHordeSnapshot(tick, state)
+	snapshot.MatchID, _ = ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      hordeSnapshotCollection,
+		Key:             snapshot.MatchID,
+		Value:           string(value),
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	return err
+}
+
+// drainForShutdown persists the snapshot and tells the connected players the match is about to end.
+func drainForShutdown(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, tick int64, state *HordeMatchState) {
+	if err := persistSnapshot(ctx, nk, tick, state); err != nil {
+		logger.Error("Error persisting horde match snapshot on shutdown: %v", err)
+	}
+	matchID, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	content := map[string]interface{}{"match_id": matchID, "reason": "server_shutdown"}
+	for userID := range state.presences {
+		if err := nk.NotificationSend(ctx, userID, translate(userLocale(ctx, nk, userID), msgMatchEnding), content, notificationMatchEnding, "", false); err != nil {
+			logger.Error("Error notifying %s of match shutdown: %v", userID, err)
+		}
+	}
+}
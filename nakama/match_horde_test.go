@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+const testHordeMatchID = "horde-1.node"
+
+// hordeMatchModule hosts one horde match in memory and runs its handler for MatchGet, MatchList and MatchSignal.
+type hordeMatchModule struct {
+	*testutil.NakamaModule
+	state interface{}
+	tick  int64
+}
+
+func newHordeMatchModule(t *testing.T, nk *testutil.NakamaModule, params map[string]interface{}) *hordeMatchModule {
+	t.Helper()
+	ctx := context.WithValue(newTestContext(""), runtime.RUNTIME_CTX_MATCH_ID, testHordeMatchID)
+	state, _, _ := (&MatchHandler{}).MatchInit(ctx, testutil.NewLogger(), nil, nk, params)
+	return &hordeMatchModule{NakamaModule: nk, state: state}
+}
+
+func (m *hordeMatchModule) MatchGet(ctx context.Context, id string) (*api.Match, error) {
+	if id != testHordeMatchID {
+		return nil, nil
+	}
+	return &api.Match{MatchId: id, Authoritative: true}, nil
+}
+
+func (m *hordeMatchModule) MatchList(ctx context.Context, limit int, authoritative bool, label string, minSize, maxSize *int, query string) ([]*api.Match, error) {
+	return []*api.Match{{MatchId: testHordeMatchID, Authoritative: true}}, nil
+}
+
+func (m *hordeMatchModule) MatchSignal(ctx context.Context, id, data string) (string, error) {
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_MATCH_ID, id)
+	state, answer := (&MatchHandler{}).MatchSignal(ctx, testutil.NewLogger(), nil, m, nil, m.tick, m.state, data)
+	m.state = state
+	return answer, nil
+}
+
+func TestRequestKeyframeRpc(t *testing.T) {
+	tests := []struct {
+		name         string
+		caller       string
+		matchID      string
+		wantCode     int
+		wantKeyframe bool
+	}{
+		{name: "expected player", caller: "expected", matchID: testHordeMatchID, wantKeyframe: true},
+		{name: "connected player", caller: "connected", matchID: testHordeMatchID, wantKeyframe: true},
+		{name: "stranger", caller: "stranger", matchID: testHordeMatchID, wantCode: CodePermissionDenied},
+		{name: "unknown match", caller: "expected", matchID: "missing.node", wantCode: CodeNotFound},
+		{name: "no match id", caller: "expected", wantCode: CodeInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, fake := newTestRuntime(t)
+			nk := newHordeMatchModule(t, fake, map[string]interface{}{"user_ids": []string{"expected"}})
+			state := nk.state.(*HordeMatchState)
+			state.presences["connected"] = &testutil.Presence{UserID: "connected", SessionID: "s1"}
+			nk.tick = 42
+
+			response, err := RequestKeyframeRpc(newTestContext(tt.caller), logger, nil, nk, `{"match_id":"`+tt.matchID+`"}`)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			if state.deltas.keyframeDue != tt.wantKeyframe {
+				t.Errorf("keyframe due = %v, want %v", state.deltas.keyframeDue, tt.wantKeyframe)
+			}
+			if tt.wantCode != 0 {
+				return
+			}
+			if requested := decodeResponse[RequestKeyframeResponse](t, response); requested.MatchID != tt.matchID || requested.Tick != 42 {
+				t.Errorf("response = %+v, want match %s at tick 42", requested, tt.matchID)
+			}
+		})
+	}
+}
+
+func TestCreateHordeMatchRpcClampsSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    map[string]interface{}
+	}{
+		{name: "defaults", payload: `{}`, want: map[string]interface{}{}},
+		{name: "within the maximums", payload: `{"tick_rate":20,"max_players":8,"min_players":2,"bot_fill_timeout_seconds":30,"keyframe_interval_ticks":100}`,
+			want: map[string]interface{}{"tick_rate": 20, "max_players": 8, "min_players": 2, "bot_fill_timeout_seconds": 30, "keyframe_interval_ticks": 100}},
+		{name: "over the maximums", payload: `{"tick_rate":1000,"max_players":500,"min_players":400,"bot_fill_timeout_seconds":86400,"keyframe_interval_ticks":1000000}`,
+			want: map[string]interface{}{"tick_rate": hordeMaxTickRate, "max_players": hordeMaxPlayers, "min_players": hordeMaxPlayers, "bot_fill_timeout_seconds": hordeMaxBotFillTimeoutSeconds, "keyframe_interval_ticks": hordeMaxKeyframeIntervalTicks}},
+		{name: "min players above the default max", payload: `{"min_players":10}`, want: map[string]interface{}{"min_players": hordeDefaultMaxPlayers}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			response, err := CreateHordeMatchRpc(newTestContext("u1"), logger, nil, nk, tt.payload)
+			if err != nil {
+				t.Fatalf("CreateHordeMatchRpc: %v", err)
+			}
+			params := nk.Matches[decodeResponse[CreateHordeMatchResponse](t, response).MatchID]
+			if len(params) != len(tt.want) {
+				t.Errorf("params = %v, want %v", params, tt.want)
+			}
+			for key, want := range tt.want {
+				if params[key] != want {
+					t.Errorf("%s = %v, want %v", key, params[key], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	matchRecordCollection = "match_records"
+	matchResultSecretEnv  = "MATCH_RESULT_SECRET"
+	matchResultKeyBytes   = 32
+
+	matchmakerPropertyRelayed = "relayed"
+
+	matchOutcomeWin  = "win"
+	matchOutcomeLoss = "loss"
+	matchOutcomeDraw = "draw"
+
+	questObjectivePlayMatch  = "play_match"
+	questObjectiveWinMatch   = "win_match"
+	achievementMatchesPlayed = "matches_played"
+	achievementMatchesWon    = "matches_won"
+)
+
+var (
+	errMatchNotRecorded     = newError(CodeNotFound, "match was not created by the server")
+	errMatchAlreadyReported = newError(CodeAlreadyExists, "match result already reported")
+	errMatchTokenInvalid    = newError(CodePermissionDenied, "invalid match token")
+	errMatchParticipants    = newError(CodeInvalidArgument, "results must list exactly the match participants")
+)
+
+// matchResultSecret signs match tokens, it is set in InitModule.
+var matchResultSecret []byte
+
+// MatchRecord is written system owned when the server starts a relayed match, it is the only proof a result can
+// be reported against. Reports holds what each participant reported until a quorum of them agree.
+type MatchRecord struct {
+	MatchID      string                           `json:"match_id"`
+	Participants []string                         `json:"participants"`
+	CreatedAt    int64                            `json:"created_at"`
+	Reports      map[string][]*ParticipantOutcome `json:"reports,omitempty"`
+	Reported     bool                             `json:"reported"`
+	ReportedBy   string                           `json:"reported_by,omitempty"`
+	ReportedAt   int64                            `json:"reported_at,omitempty"`
+	Results      []*ParticipantOutcome            `json:"results,omitempty"`
+}
+
+type ParticipantOutcome struct {
+	UserID  string `json:"user_id"`
+	Outcome string `json:"outcome"`
+	Score   int64  `json:"score"`
+}
+
+type ReportMatchResultRequest struct {
+	MatchID string                `json:"match_id"`
+	Token   string                `json:"token"`
+	Results []*ParticipantOutcome `json:"results"`
+}
+
+// ReportMatchResultResponse is pending while fewer than a quorum of participants reported the same results.
+type ReportMatchResultResponse struct {
+	MatchID string                   `json:"match_id"`
+	Pending bool                     `json:"pending"`
+	Ratings map[string]*PlayerRating `json:"ratings"`
+}
+
+// matchResultSigningKey reads the shared secret from the environment. Without one a random key is used, tokens
+// then only validate on this node until it restarts.
+func matchResultSigningKey(ctx context.Context, logger runtime.Logger) []byte {
+	if secret := envString(ctx, matchResultSecretEnv, ""); secret != "" {
+		return []byte(secret)
+	}
+	logger.Warn("%s is not set, match tokens will not survive a restart or validate on other nodes", matchResultSecretEnv)
+	key := make([]byte, matchResultKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		logger.Error("Error generating match result key: %v", err)
+	}
+	return key
+}
+
+// startRelayedMatch records a relayed match for userIDs and sends each of them the token their host reports the
+// result with. The returned empty match id lets Nakama relay the match itself.
+func startRelayedMatch(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userIDs []string) (string, error) {
+	matchID, err := newLedgerRef()
+	if err != nil {
+		return "", err
+	}
+	record := &MatchRecord{MatchID: matchID, Participants: userIDs, CreatedAt: time.Now().UTC().Unix()}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      matchRecordCollection,
+		Key:             matchID,
+		Value:           string(value),
+		Version:         "*",
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}}); err != nil {
+		return "", err
+	}
+
+	content := map[string]interface{}{"match_id": matchID, "token": matchToken(matchID, userIDs), "participants": userIDs}
+	for _, userID := range userIDs {
+		subject := translate(userLocale(ctx, nk, userID), msgMatchRecorded)
+		if err := nk.NotificationSend(ctx, userID, subject, content, notificationMatchRecorded, "", false); err != nil {
+			logger.Error("Error sending match token to %s: %v", userID, err)
+		}
+	}
+	return "", nil
+}
+
+// ReportMatchResultRpc collects the result of a relayed match from its participants. Every participant holds the
+// same token, so one report proves nothing on its own: the results are only applied once more than half of the
+// participants reported exactly the same ones, a server to server report is applied right away. The match record is
+// claimed before anything is applied, so a result can only ever count once.
+func ReportMatchResultRpc(maxScore int64) rpcFunc {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		logger.Debug("ReportMatchResult Called - Payload: `%s`", payload)
+		reporterID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+
+		request, err := parsePayload[ReportMatchResultRequest](payload)
+		if err != nil {
+			return "", err
+		}
+		if request.MatchID == "" || request.Token == "" {
+			return errorResponse(CodeInvalidArgument, "match_id and token are required")
+		}
+		for _, result := range request.Results {
+			if result.Outcome != matchOutcomeWin && result.Outcome != matchOutcomeLoss && result.Outcome != matchOutcomeDraw {
+				return errorResponse(CodeInvalidArgument, "outcome must be win, loss or draw")
+			}
+			if result.Score < 0 || result.Score > maxScore {
+				return errorResponse(CodeInvalidArgument, "score out of range")
+			}
+		}
+
+		record := &MatchRecord{}
+		write := runtime.StorageWrite{
+			Collection:      matchRecordCollection,
+			Key:             request.MatchID,
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		}
+		_, err = writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+			if current == "" {
+				return "", errMatchNotRecorded
+			}
+			record = &MatchRecord{}
+			if err := json.Unmarshal([]byte(current), record); err != nil {
+				return "", err
+			}
+			if !hmac.Equal([]byte(request.Token), []byte(matchToken(record.MatchID, record.Participants))) {
+				return "", errMatchTokenInvalid
+			}
+			if reporterID != "" && !slices.Contains(record.Participants, reporterID) {
+				return "", errMatchTokenInvalid
+			}
+			if record.Reported || record.Reports[reporterID] != nil {
+				return "", errMatchAlreadyReported
+			}
+			if !sameParticipants(record.Participants, request.Results) {
+				return "", errMatchParticipants
+			}
+			agreed := request.Results
+			if reporterID != "" {
+				if record.Reports == nil {
+					record.Reports = make(map[string][]*ParticipantOutcome, len(record.Participants))
+				}
+				record.Reports[reporterID] = request.Results
+				agreed = agreedMatchResults(record)
+			}
+			if agreed != nil {
+				record.Reported = true
+				record.ReportedBy = reporterID
+				record.ReportedAt = time.Now().UTC().Unix()
+				record.Results = agreed
+			}
+			value, err := json.Marshal(record)
+			return string(value), err
+		}, storageWriteAttempts)
+		if err != nil {
+			return "", runtimeError(logger, err, "reporting match result")
+		}
+
+		response := &ReportMatchResultResponse{MatchID: record.MatchID, Pending: !record.Reported}
+		if record.Reported {
+			response.Ratings = applyMatchResult(ctx, logger, nk, record)
+		}
+		return marshalResponse(response)
+	}
+}
+
+// applyMatchResult rates the winners against the losers as one game and feeds the leaderboard, quests and
+// achievements. The record is already claimed, so a failed step is logged rather than failing the report.
+func applyMatchResult(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, record *MatchRecord) map[string]*PlayerRating {
+	var winnerIDs, loserIDs []string
+	for _, result := range record.Results {
+		switch result.Outcome {
+		case matchOutcomeWin:
+			winnerIDs = append(winnerIDs, result.UserID)
+		case matchOutcomeLoss:
+			loserIDs = append(loserIDs, result.UserID)
+		}
+	}
+	ratings, err := rateMatch(ctx, logger, nk, winnerIDs, loserIDs)
+	if err != nil {
+		logger.Error("Error rating match %s: %v", record.MatchID, err)
+	}
+
+	for _, result := range record.Results {
+		if result.Score > 0 {
+			if _, err := nk.LeaderboardRecordWrite(ctx, leaderboardGlobalScore, result.UserID, "", result.Score, 0, nil, nil); err != nil {
+				logger.Error("Error writing match score of %s: %v", result.UserID, err)
+			}
+		}
+		objectives := map[string]string{questObjectivePlayMatch: achievementMatchesPlayed}
+		if result.Outcome == matchOutcomeWin {
+			objectives[questObjectiveWinMatch] = achievementMatchesWon
+		}
+		for objective, achievement := range objectives {
+			if err := progressQuest(ctx, nk, result.UserID, objective, 1); err != nil {
+				logger.Warn("Error progressing quests for %s: %v", result.UserID, err)
+			}
+			if _, err := progressAchievement(ctx, nk, result.UserID, achievement, 1); err != nil && !errors.Is(err, errUnknownAchievement) {
+				logger.Warn("Error progressing achievement %s for %s: %v", achievement, result.UserID, err)
+			}
+		}
+	}
+	return ratings
+}
+
+// agreedMatchResults returns the results a quorum of the participants reported, or nil while there is none.
+func agreedMatchResults(record *MatchRecord) []*ParticipantOutcome {
+	quorum := len(record.Participants)/2 + 1
+	counts := make(map[string]int, len(record.Reports))
+	for _, results := range record.Reports {
+		key := matchResultsKey(results)
+		if counts[key]++; counts[key] >= quorum {
+			return results
+		}
+	}
+	return nil
+}
+
+// matchResultsKey is the same for two reports that list the same outcomes and scores in any order.
+func matchResultsKey(results []*ParticipantOutcome) string {
+	entries := make([]string, 0, len(results))
+	for _, result := range results {
+		entries = append(entries, fmt.Sprintf("%s:%s:%d", result.UserID, result.Outcome, result.Score))
+	}
+	slices.Sort(entries)
+	return strings.Join(entries, ",")
+}
+
+func matchToken(matchID string, participants []string) string {
+	sorted := slices.Clone(participants)
+	slices.Sort(sorted)
+	mac := hmac.New(sha256.New, matchResultSecret)
+	mac.Write([]byte(matchID + ":" + strings.Join(sorted, ",")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func sameParticipants(participants []string, results []*ParticipantOutcome) bool {
+	if len(participants) != len(results) {
+		return false
+	}
+	seen := make(map[string]bool, len(results))
+	for _, result := range results {
+		if seen[result.UserID] || !slices.Contains(participants, result.UserID) {
+			return false
+		}
+		seen[result.UserID] = true
+	}
+	return true
+}
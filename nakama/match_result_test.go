@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+// startTestMatch records a relayed match for userIDs and returns its id and the token its participants were sent.
+func startTestMatch(t *testing.T, nk *testutil.NakamaModule, userIDs ...string) (string, string) {
+	t.Helper()
+	if _, err := startRelayedMatch(newTestContext(""), testutil.NewLogger(), nk, userIDs); err != nil {
+		t.Fatalf("startRelayedMatch: %v", err)
+	}
+	sent := nk.NotificationsFor(userIDs[0])
+	if len(sent) == 0 {
+		t.Fatal("no match token was sent")
+	}
+	content := sent[len(sent)-1].Content
+	return content["match_id"].(string), content["token"].(string)
+}
+
+func matchResultPayload(matchID, token, winner string, participants ...string) string {
+	results := ""
+	for i, userID := range participants {
+		outcome := matchOutcomeLoss
+		if userID == winner {
+			outcome = matchOutcomeWin
+		}
+		if i > 0 {
+			results += ","
+		}
+		results += fmt.Sprintf(`{"user_id":%q,"outcome":%q,"score":10}`, userID, outcome)
+	}
+	return fmt.Sprintf(`{"match_id":%q,"token":%q,"results":[%s]}`, matchID, token, results)
+}
+
+func TestReportMatchResultRpcQuorum(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	matchID, token := startTestMatch(t, nk, "a", "b", "c")
+	report := ReportMatchResultRpc(100)
+	aWins := matchResultPayload(matchID, token, "a", "a", "b", "c")
+	bWins := matchResultPayload(matchID, token, "b", "a", "b", "c")
+
+	steps := []struct {
+		reporter    string
+		payload     string
+		wantCode    int
+		wantPending bool
+	}{
+		{reporter: "a", payload: aWins, wantPending: true},
+		{reporter: "a", payload: aWins, wantCode: CodeAlreadyExists},
+		{reporter: "z", payload: aWins, wantCode: CodePermissionDenied},
+		{reporter: "b", payload: bWins, wantPending: true},
+		{reporter: "c", payload: aWins},
+		{reporter: "b", payload: aWins, wantCode: CodeAlreadyExists},
+	}
+	for i, step := range steps {
+		response, err := report(newTestContext(step.reporter), logger, nil, nk, step.payload)
+		if code := errorCode(err); code != step.wantCode {
+			t.Fatalf("step %d (%s): error code = %d (%v), want %d", i, step.reporter, code, err, step.wantCode)
+		}
+		if step.wantCode != 0 {
+			continue
+		}
+		result := decodeResponse[ReportMatchResultResponse](t, response)
+		if result.Pending != step.wantPending {
+			t.Fatalf("step %d (%s): pending = %v, want %v", i, step.reporter, result.Pending, step.wantPending)
+		}
+		if step.wantPending {
+			if len(result.Ratings) != 0 || len(nk.Leaderboards[rankedLeaderboard]) != 0 {
+				t.Fatalf("step %d (%s): ratings moved before a quorum agreed", i, step.reporter)
+			}
+			continue
+		}
+		if result.Ratings["a"].MMR <= ratingDefault || result.Ratings["b"].MMR >= ratingDefault {
+			t.Errorf("ratings = a:%d b:%d, want the agreed winner a up and b down", result.Ratings["a"].MMR, result.Ratings["b"].MMR)
+		}
+	}
+
+	record := &MatchRecord{}
+	readTestObject(t, nk, matchRecordCollection, matchID, "", record)
+	if !record.Reported || record.ReportedBy != "c" || record.Results[0].Outcome != matchOutcomeWin || record.Results[0].UserID != "a" {
+		t.Errorf("record = %+v, want a's win reported once c agreed", record)
+	}
+}
+
+func TestReportMatchResultRpcServerReport(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	matchID, token := startTestMatch(t, nk, "a", "b")
+
+	response, err := ReportMatchResultRpc(100)(newTestContext(""), logger, nil, nk, matchResultPayload(matchID, token, "a", "a", "b"))
+	if err != nil {
+		t.Fatalf("ReportMatchResultRpc: %v", err)
+	}
+	if result := decodeResponse[ReportMatchResultResponse](t, response); result.Pending || len(result.Ratings) != 2 {
+		t.Errorf("response = %+v, want the server report applied right away", result)
+	}
+}
+
+func TestReportMatchResultRpcTwoPlayersMustAgree(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	matchID, token := startTestMatch(t, nk, "a", "b")
+	report := ReportMatchResultRpc(100)
+
+	for _, reporter := range []string{"a", "b"} {
+		response, err := report(newTestContext(reporter), logger, nil, nk, matchResultPayload(matchID, token, reporter, "a", "b"))
+		if err != nil {
+			t.Fatalf("report by %s: %v", reporter, err)
+		}
+		if result := decodeResponse[ReportMatchResultResponse](t, response); !result.Pending {
+			t.Fatalf("report by %s applied, each claiming the win must leave the match pending", reporter)
+		}
+	}
+}
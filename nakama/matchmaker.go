@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	matchmakerPropertyMinCount = "min_count"
+	matchmakerPropertyMaxCount = "max_count"
+)
+
+// errMatchSizeOutOfRange rejects a matchmaker result outright, an empty match id would hand it to the relay instead.
+var errMatchSizeOutOfRange = errors.New("matched player count is outside the ticket bounds")
+
+var matchmakerSharedProperties = []string{"region", "difficulty", "bot_fill"}
+
+// MatchmakerMatched returns an empty match id to leave the match to the Nakama relay, the players then stay out of
+// the horde handler. Tickets that all set the relayed property get a recorded match they can report a result for. The
+// parties queued through PartyMatchmakerAdd are pointed at the horde match until it ends. Energy is charged here
+// rather than on the tickets, so a cancelled or expired ticket costs nothing. A result outside the ticket bounds is
+// rejected with an error, the only answer that creates no match at all.
+func MatchmakerMatched(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, entries []runtime.MatchmakerEntry) (string, error) {
+	if len(entries) == 0 {
+		return "", nil
+	}
+
+	userIDs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		userIDs = append(userIDs, entry.GetPresence().GetUserId())
+	}
+
+	properties := entries[0].GetProperties()
+	minCount := intParam(properties, matchmakerPropertyMinCount, 1)
+	maxCount := min(intParam(properties, matchmakerPropertyMaxCount, hordeDefaultMaxPlayers), hordeMaxPlayers)
+	if len(entries) < minCount || len(entries) > maxCount {
+		logger.Warn("Matchmaker matched %d players outside of [%d, %d], rejecting the match", len(entries), minCount, maxCount)
+		return "", errMatchSizeOutOfRange
+	}
+
+	// every matched player pays for the match here, once it is certain to start, an error leaves them all unmatched
+	charged, err := requireEnergyEach(ctx, logger, nk, userIDs, energyActionCreateHordeMatch)
+	if err != nil {
+		logger.Warn("Matchmaker matched %d players that cannot all pay for the match: %v", len(entries), err)
+		return "", err
+	}
+
+	if relayed, ok := commonMatchmakerProperty(entries, matchmakerPropertyRelayed); ok && relayed == "true" {
+		matchID, err := startRelayedMatch(ctx, logger, nk, userIDs)
+		if err != nil {
+			logger.Error("Error recording relayed match: %v", err)
+			refundEnergyEach(ctx, logger, nk, charged)
+		}
+		return matchID, err
+	}
+
+	partyIDs := matchedParties(entries)
+	params := map[string]interface{}{
+		"max_players": maxCount,
+		"min_players": minCount,
+		"user_ids":    userIDs,
+		"party_ids":   partyIDs,
+	}
+	for _, key := range matchmakerSharedProperties {
+		if value, ok := commonMatchmakerProperty(entries, key); ok {
+			params[key] = value
+		}
+	}
+
+	matchID, err := nk.MatchCreate(ctx, hordeModuleName, params)
+	if err != nil {
+		logger.Error("Error creating horde match from matchmaker: %v", err)
+		refundEnergyEach(ctx, logger, nk, charged)
+		return "", err
+	}
+	setPartyMatch(ctx, logger, nk, partyIDs, matchID)
+	return matchID, nil
+}
+
+func commonMatchmakerProperty(entries []runtime.MatchmakerEntry, key string) (interface{}, bool) {
+	value, ok := entries[0].GetProperties()[key]
+	if !ok {
+		return nil, false
+	}
+	for _, entry := range entries[1:] {
+		if other, ok := entry.GetProperties()[key]; !ok || other != value {
+			return nil, false
+		}
+	}
+	return value, true
+}
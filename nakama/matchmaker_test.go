@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+func TestMatchmakerMatchedRejectsCountsOutsideTheTicketBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		players int
+	}{
+		{name: "below min count", players: 1},
+		{name: "above max count", players: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			writeTestConfig(t, nk, energyConfigKey, &EnergyConfig{Max: 10, Costs: map[string]int64{energyActionCreateHordeMatch: 4}})
+			entries := make([]runtime.MatchmakerEntry, 0, tt.players)
+			for i := 0; i < tt.players; i++ {
+				properties := map[string]interface{}{matchmakerPropertyMinCount: 2.0, matchmakerPropertyMaxCount: 3.0, matchmakerPropertyRelayed: "true"}
+				entries = append(entries, &testutil.MatchmakerEntry{Presence: &testutil.Presence{UserID: "u" + strconv.Itoa(i+1)}, Properties: properties})
+			}
+
+			matchID, err := MatchmakerMatched(newTestContext(""), logger, nil, nk, entries)
+			if err != errMatchSizeOutOfRange || matchID != "" {
+				t.Fatalf("MatchmakerMatched = %q, %v, want the size rejected", matchID, err)
+			}
+			if len(nk.Matches) != 0 || len(nk.NotificationsFor("u1")) != 0 {
+				t.Error("a rejected result created a match")
+			}
+			if readTestObject(t, nk, energyCollection, energyKey, "u1", &EnergyState{}) {
+				t.Error("a rejected result spent energy")
+			}
+			if lines := logger.Lines["warn"]; len(lines) != 1 || !strings.Contains(lines[0], "rejecting the match") {
+				t.Errorf("warn lines = %v, want the rejection logged", lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	metricRPCCalls         = "rpc_calls_total"
+	metricRPCErrors        = "rpc_errors_total"
+	metricRPCDuration      = "rpc_duration_seconds"
+	metricActiveMatches    = "matches_active"
+	metricPlayersInMatches = "match_players"
+	metricOnlinePlayers    = "players_online"
+
+	metricsGaugeInterval = 15 * time.Second
+)
+
+// onlineSessions counts the sessions on this node, each node reports its own gauge.
+var onlineSessions atomic.Int64
+
+// withMetrics counts calls and errors and records the latency of fn, all tagged with the rpc name.
+func withMetrics(name string, fn rpcFunc) rpcFunc {
+	tags := map[string]string{"rpc": name}
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		start := time.Now()
+		response, err := fn(ctx, logger, db, nk, payload)
+		nk.MetricsTimerRecord(metricRPCDuration, tags, time.Since(start))
+		nk.MetricsCounterAdd(metricRPCCalls, tags, 1)
+		if err != nil {
+			code := CodeUnknown
+			var runtimeErr *runtime.Error
+			if errors.As(err, &runtimeErr) {
+				code = runtimeErr.Code
+			}
+			nk.MetricsCounterAdd(metricRPCErrors, map[string]string{"rpc": name, "code": strconv.Itoa(code)}, 1)
+		}
+		return response, err
+	}
+}
+
+func SessionStartMetrics(ctx context.Context, logger runtime.Logger, evt *api.Event) {
+	onlineSessions.Add(1)
+}
+
+func SessionEndMetrics(ctx context.Context, logger runtime.Logger, evt *api.Event) {
+	onlineSessions.Add(-1)
+}
+
+// startMetricsGauges publishes the match and online player gauges on a fixed interval until ctx is done.
+func startMetricsGauges(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	runEvery(ctx, metricsGaugeInterval, func() {
+		nk.MetricsGaugeSet(metricOnlinePlayers, nil, float64(onlineSessions.Load()))
+
+		matches, err := nk.MatchList(ctx, shutdownMatchListLimit, true, "", nil, nil, "+label.mode:"+hordeModuleName)
+		if err != nil {
+			logger.Warn("Error listing matches for metrics: %v", err)
+			return
+		}
+		players := int32(0)
+		for _, match := range matches {
+			players += match.GetSize()
+		}
+		tags := map[string]string{"mode": hordeModuleName}
+		nk.MetricsGaugeSet(metricActiveMatches, tags, float64(len(matches)))
+		nk.MetricsGaugeSet(metricPlayersInMatches, tags, float64(players))
+	})
+}
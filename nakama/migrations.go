@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	schemaCollection = "system"
+	schemaVersionKey = "schema_version"
+
+	migrationPageSize = 100
+)
+
+type migration struct {
+	name string
+	run  func(ctx context.Context, nk runtime.NakamaModule) error
+}
+
+// migrations run in order, the schema version is the number applied so only ever append to the list. Each one
+// must be safe to run again since a crash between a migration and its version bump repeats it on the next boot.
+var migrations = []migration{
+	{name: "profile_created_at", run: migrateProfileCreatedAt},
+	{name: "purchase_grants", run: migratePurchaseGrants},
+}
+
+type SchemaVersion struct {
+	Version int `json:"version"`
+}
+
+// runMigrations brings storage up to the latest schema, it is a no-op once the stored version is current.
+func runMigrations(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, migrations []migration) error {
+	current, err := readSchemaVersion(ctx, nk)
+	if err != nil {
+		return err
+	}
+	for version := current + 1; version <= len(migrations); version++ {
+		m := migrations[version-1]
+		logger.Info("Running migration %d `%s`", version, m.name)
+		if err := m.run(ctx, nk); err != nil {
+			return fmt.Errorf("migration %d `%s`: %w", version, m.name, err)
+		}
+		if err := writeSchemaVersion(ctx, nk, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSchemaVersion(ctx context.Context, nk runtime.NakamaModule) (int, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: schemaCollection, Key: schemaVersionKey}})
+	if err != nil {
+		return 0, err
+	}
+	schema := &SchemaVersion{}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].Value), schema); err != nil {
+			return 0, err
+		}
+	}
+	return schema.Version, nil
+}
+
+func writeSchemaVersion(ctx context.Context, nk runtime.NakamaModule, version int) error {
+	write := runtime.StorageWrite{
+		Collection:      schemaCollection,
+		Key:             schemaVersionKey,
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		schema := &SchemaVersion{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), schema); err != nil {
+				return "", err
+			}
+		}
+		// Another node booting at the same time may already be further along.
+		schema.Version = max(schema.Version, version)
+		value, err := json.Marshal(schema)
+		return string(value), err
+	}, storageWriteAttempts)
+	return err
+}
+
+// migrateProfileCreatedAt backfills created_at on profiles written before it existed from the account creation time.
+func migrateProfileCreatedAt(ctx context.Context, nk runtime.NakamaModule) error {
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", profileCollection, migrationPageSize, cursor)
+		if err != nil {
+			return err
+		}
+		userIDs := make([]string, 0, len(objects))
+		for _, object := range objects {
+			userIDs = append(userIDs, object.UserId)
+		}
+		createdAt := make(map[string]int64, len(userIDs))
+		if len(userIDs) > 0 {
+			users, err := nk.UsersGetId(ctx, userIDs, nil)
+			if err != nil {
+				return err
+			}
+			for _, user := range users {
+				createdAt[user.Id] = user.GetCreateTime().GetSeconds()
+			}
+		}
+
+		for _, object := range objects {
+			write := runtime.StorageWrite{
+				Collection:      profileCollection,
+				Key:             object.Key,
+				UserID:          object.UserId,
+				PermissionRead:  int(object.PermissionRead),
+				PermissionWrite: int(object.PermissionWrite),
+			}
+			if _, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+				profile := &Profile{}
+				if err := json.Unmarshal([]byte(current), profile); err != nil {
+					return "", err
+				}
+				if profile.CreatedAt == 0 {
+					profile.CreatedAt = createdAt[object.UserId]
+				}
+				value, err := json.Marshal(profile)
+				return string(value), err
+			}, storageWriteAttempts); err != nil {
+				return err
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// migratePurchaseGrants records every purchase validated before grant records existed as applied, so restore never
+// grants them a second time. Their season is unknown, which keeps them from restoring a later season's premium.
+func migratePurchaseGrants(ctx context.Context, nk runtime.NakamaModule) error {
+	cursor := ""
+	for {
+		list, err := nk.PurchasesList(ctx, "", migrationPageSize, cursor)
+		if err != nil {
+			return err
+		}
+		for _, purchase := range list.GetValidatedPurchases() {
+			grant := &PurchaseGrant{SKU: purchase.ProductId, GrantedAt: purchase.GetCreateTime().GetSeconds()}
+			if _, err := claimPurchaseGrant(ctx, nk, purchase.UserId, purchase.TransactionId, grant); err != nil {
+				return err
+			}
+		}
+		if list.GetCursor() == "" {
+			return nil
+		}
+		cursor = list.GetCursor()
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// countingMigrations returns n migrations that count their runs, the one at failAt fails until it is cleared.
+func countingMigrations(n int, runs []int, failAt *int) []migration {
+	list := make([]migration, n)
+	for i := range list {
+		list[i] = migration{name: "fake", run: func(ctx context.Context, nk runtime.NakamaModule) error {
+			if failAt != nil && *failAt == i {
+				return errors.New("migration failed")
+			}
+			runs[i]++
+			return nil
+		}}
+	}
+	return list
+}
+
+func TestRunMigrations(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	ctx := newTestContext("")
+	runs := make([]int, 3)
+
+	if err := runMigrations(ctx, logger, nk, countingMigrations(2, runs, nil)); err != nil {
+		t.Fatalf("runMigrations: %v", err)
+	}
+	if version, _ := readSchemaVersion(ctx, nk); version != 2 {
+		t.Errorf("schema version = %d, want 2", version)
+	}
+	if err := runMigrations(ctx, logger, nk, countingMigrations(3, runs, nil)); err != nil {
+		t.Fatalf("runMigrations with a new migration: %v", err)
+	}
+	if err := runMigrations(ctx, logger, nk, countingMigrations(3, runs, nil)); err != nil {
+		t.Fatalf("runMigrations when current: %v", err)
+	}
+	if runs[0] != 1 || runs[1] != 1 || runs[2] != 1 {
+		t.Errorf("runs = %v, want every migration applied once", runs)
+	}
+	if version, _ := readSchemaVersion(ctx, nk); version != 3 {
+		t.Errorf("schema version = %d, want 3", version)
+	}
+}
+
+func TestRunMigrationsStopsAtAFailure(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	ctx := newTestContext("")
+	runs := make([]int, 3)
+	failAt := 1
+
+	if err := runMigrations(ctx, logger, nk, countingMigrations(3, runs, &failAt)); err == nil {
+		t.Fatal("runMigrations = nil, want the migration error")
+	}
+	if version, _ := readSchemaVersion(ctx, nk); version != 1 {
+		t.Errorf("schema version = %d, want only the first migration recorded", version)
+	}
+	failAt = -1
+	if err := runMigrations(ctx, logger, nk, countingMigrations(3, runs, &failAt)); err != nil {
+		t.Fatalf("runMigrations after the fix: %v", err)
+	}
+	if runs[0] != 1 || runs[1] != 1 || runs[2] != 1 {
+		t.Errorf("runs = %v, want the rest applied once on the next boot", runs)
+	}
+}
+
+func TestWriteSchemaVersionNeverGoesBack(t *testing.T) {
+	_, nk := newTestRuntime(t)
+	ctx := newTestContext("")
+	if err := writeSchemaVersion(ctx, nk, 5); err != nil {
+		t.Fatalf("writeSchemaVersion: %v", err)
+	}
+	if err := writeSchemaVersion(ctx, nk, 3); err != nil {
+		t.Fatalf("writeSchemaVersion: %v", err)
+	}
+	if version, _ := readSchemaVersion(ctx, nk); version != 5 {
+		t.Errorf("schema version = %d, want a slower node to keep 5", version)
+	}
+}
+
+func TestMigrateProfileCreatedAt(t *testing.T) {
+	_, nk := newTestRuntime(t)
+	nk.Users["old"] = &api.User{Id: "old", CreateTime: timestamppb.New(timestamppb.Now().AsTime().AddDate(-1, 0, 0))}
+	nk.Users["new"] = &api.User{Id: "new", CreateTime: timestamppb.Now()}
+	writeTestObject(t, nk, profileCollection, "old", "old", &Profile{DisplayName: "Old"})
+	writeTestObject(t, nk, profileCollection, "new", "new", &Profile{DisplayName: "New", CreatedAt: 42})
+
+	if err := migrateProfileCreatedAt(newTestContext(""), nk); err != nil {
+		t.Fatalf("migrateProfileCreatedAt: %v", err)
+	}
+	old, current := &Profile{}, &Profile{}
+	readTestObject(t, nk, profileCollection, "old", "old", old)
+	readTestObject(t, nk, profileCollection, "new", "new", current)
+	if old.CreatedAt != nk.Users["old"].CreateTime.GetSeconds() || old.DisplayName != "Old" {
+		t.Errorf("old profile = %+v, want created_at backfilled from the account", old)
+	}
+	if current.CreatedAt != 42 {
+		t.Errorf("new profile created_at = %d, want it left alone", current.CreatedAt)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	banCollection     = "bans"
+	banExpiryInterval = time.Minute
+	banPageSize       = 100
+
+	streamModeNotifications = 0
+)
+
+// Ban is stored system owned under the banned user id, Until is a unix time and 0 bans permanently. The account is
+// banned in Nakama as well, so every login path and existing session is refused, and startBanExpiry lifts the Nakama
+// ban again once a temporary one runs out.
+type Ban struct {
+	UserID   string `json:"user_id"`
+	Reason   string `json:"reason"`
+	Until    int64  `json:"until"`
+	BannedAt int64  `json:"banned_at"`
+	BannedBy string `json:"banned_by"`
+}
+
+type BanUserRequest struct {
+	UserID          string `json:"user_id"`
+	Reason          string `json:"reason"`
+	DurationSeconds int64  `json:"duration_seconds"`
+}
+
+type ModerationRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type BanStateResponse struct {
+	UserID   string `json:"user_id"`
+	Banned   bool   `json:"banned"`
+	Reason   string `json:"reason,omitempty"`
+	Until    int64  `json:"until,omitempty"`
+	Sessions int    `json:"sessions_disconnected"`
+}
+
+func BanUserRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("BanUser Called - Payload: `%s`", payload)
+	request, err := parsePayload[BanUserRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if err := checkModerationTarget(ctx, logger, nk, request.UserID); err != nil {
+		return "", err
+	}
+	if request.DurationSeconds < 0 {
+		return errorResponse(CodeInvalidArgument, "duration_seconds must be non-negative")
+	}
+
+	now := time.Now().UTC()
+	bannedBy, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	ban := &Ban{UserID: request.UserID, Reason: request.Reason, BannedAt: now.Unix(), BannedBy: bannedBy}
+	if request.DurationSeconds > 0 {
+		ban.Until = now.Add(time.Duration(request.DurationSeconds) * time.Second).Unix()
+	}
+	value, err := json.Marshal(ban)
+	if err != nil {
+		logger.Error("Error marshalling ban: %v", err)
+		return errorResponse(CodeInternal, "error banning user")
+	}
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      banCollection,
+		Key:             ban.UserID,
+		Value:           string(value),
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}}); err != nil {
+		logger.Error("Error writing ban: %v", err)
+		return errorResponse(CodeInternal, "error banning user")
+	}
+	if err := nk.UsersBanId(ctx, []string{ban.UserID}); err != nil {
+		logger.Error("Error banning user %s in Nakama: %v", ban.UserID, err)
+		return errorResponse(CodeInternal, "error banning user")
+	}
+
+	sessions := disconnectUser(ctx, logger, nk, ban.UserID)
+	// Logging out invalidates the tokens so RPCs stop working too, not just the socket.
+	if err := nk.SessionLogout(ban.UserID, "", ""); err != nil {
+		logger.Warn("Error logging out banned user %s: %v", ban.UserID, err)
+	}
+	logger.Info("User %s banned by `%s` until %d: %s", ban.UserID, bannedBy, ban.Until, ban.Reason)
+	emitEvent(ctx, logger, nk, eventPlayerBanned, map[string]string{
+		"user_id":   ban.UserID,
+		"reason":    ban.Reason,
+		"until":     strconv.FormatInt(ban.Until, 10),
+		"banned_by": bannedBy,
+	})
+
+	return marshalResponse(&BanStateResponse{UserID: ban.UserID, Banned: true, Reason: ban.Reason, Until: ban.Until, Sessions: sessions})
+}
+
+func UnbanUserRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("UnbanUser Called - Payload: `%s`", payload)
+	request, err := parsePayload[ModerationRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if err := checkModerationTarget(ctx, logger, nk, request.UserID); err != nil {
+		return "", err
+	}
+
+	if err := nk.UsersUnbanId(ctx, []string{request.UserID}); err != nil {
+		logger.Error("Error unbanning user %s in Nakama: %v", request.UserID, err)
+		return errorResponse(CodeInternal, "error unbanning user")
+	}
+	if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: banCollection, Key: request.UserID}}); err != nil {
+		logger.Error("Error deleting ban: %v", err)
+		return errorResponse(CodeInternal, "error unbanning user")
+	}
+	logger.Info("User %s unbanned", request.UserID)
+	return marshalResponse(&BanStateResponse{UserID: request.UserID, Banned: false})
+}
+
+// KickUserRpc drops the user's live sessions without a ban, they are free to log straight back in.
+func KickUserRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("KickUser Called - Payload: `%s`", payload)
+	request, err := parsePayload[ModerationRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if err := checkModerationTarget(ctx, logger, nk, request.UserID); err != nil {
+		return "", err
+	}
+
+	ban, err := activeBan(ctx, nk, request.UserID)
+	if err != nil {
+		logger.Error("Error reading ban: %v", err)
+		return errorResponse(CodeInternal, "error reading ban")
+	}
+	response := &BanStateResponse{UserID: request.UserID, Sessions: disconnectUser(ctx, logger, nk, request.UserID)}
+	if ban != nil {
+		response.Banned, response.Reason, response.Until = true, ban.Reason, ban.Until
+	}
+	return marshalResponse(response)
+}
+
+// checkModerationTarget fails unless the target user exists.
+func checkModerationTarget(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) error {
+	if userID == "" {
+		return newError(CodeInvalidArgument, "user_id is required")
+	}
+	users, err := nk.UsersGetId(ctx, []string{userID}, nil)
+	if err != nil {
+		logger.Error("Error getting user: %v", err)
+		return newError(CodeInternal, "error getting user")
+	}
+	if len(users) == 0 {
+		return newError(CodeNotFound, "user not found")
+	}
+	return nil
+}
+
+// activeBan returns the user's ban, nil when there is none. A temporary ban that ran out is lifted on the way.
+func activeBan(ctx context.Context, nk runtime.NakamaModule, userID string) (*Ban, error) {
+	if userID == "" {
+		return nil, nil
+	}
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: banCollection, Key: userID}})
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+	ban := &Ban{}
+	if err := json.Unmarshal([]byte(objects[0].Value), ban); err != nil {
+		return nil, err
+	}
+	if ban.expired(time.Now().UTC().Unix()) {
+		return nil, liftBan(ctx, nk, userID, objects[0].Version)
+	}
+	return ban, nil
+}
+
+func (b *Ban) expired(now int64) bool {
+	return b.Until != 0 && b.Until <= now
+}
+
+// liftBan removes the stored ban at version and then the Nakama ban. Guarded by version so a ban issued meanwhile is
+// not the one removed.
+func liftBan(ctx context.Context, nk runtime.NakamaModule, userID, version string) error {
+	if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: banCollection, Key: userID, Version: version}}); err != nil {
+		return err
+	}
+	return nk.UsersUnbanId(ctx, []string{userID})
+}
+
+// startBanExpiry lifts temporary bans that ran out on a fixed interval until ctx is done, the login hooks only see the
+// players that still sign in through them.
+func startBanExpiry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	runEvery(ctx, banExpiryInterval, func() {
+		sweepExpiredBans(ctx, logger, nk, time.Now().UTC().Unix())
+	})
+}
+
+func sweepExpiredBans(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, now int64) {
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", banCollection, banPageSize, cursor)
+		if err != nil {
+			logger.Error("Error listing bans: %v", err)
+			return
+		}
+		for _, object := range objects {
+			ban := &Ban{}
+			if err := json.Unmarshal([]byte(object.Value), ban); err != nil {
+				logger.Error("Error unmarshalling ban %s: %v", object.Key, err)
+				continue
+			}
+			if !ban.expired(now) {
+				continue
+			}
+			if err := liftBan(ctx, nk, object.Key, object.Version); err != nil {
+				logger.Error("Error lifting expired ban of %s: %v", object.Key, err)
+				continue
+			}
+			logger.Info("Lifted expired ban of %s", object.Key)
+		}
+		if next == "" {
+			return
+		}
+		cursor = next
+	}
+}
+
+func (b *Ban) error() error {
+	if b.Until == 0 {
+		return newError(CodePermissionDenied, "account is banned")
+	}
+	return newErrorf(CodePermissionDenied, "account is banned until %s", time.Unix(b.Until, 0).UTC().Format(time.RFC3339))
+}
+
+// disconnectUser closes every live socket of the user, found through their notification stream presences.
+func disconnectUser(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) int {
+	presences, err := nk.StreamUserList(streamModeNotifications, userID, "", "", true, true)
+	if err != nil {
+		logger.Warn("Error listing sessions of %s: %v", userID, err)
+		return 0
+	}
+	disconnected := 0
+	for _, presence := range presences {
+		if err := nk.SessionDisconnect(ctx, presence.GetSessionId(), runtime.PresenceReasonDisconnect); err != nil {
+			logger.Warn("Error disconnecting session %s of %s: %v", presence.GetSessionId(), userID, err)
+			continue
+		}
+		disconnected++
+	}
+	return disconnected
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBanUserRpcBansInNakama(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	nk.AddUser("u1", "griefer")
+	ctx := newTestContext("")
+
+	if _, err := BanUserRpc(ctx, logger, nil, nk, `{"user_id":"u1","reason":"cheating"}`); err != nil {
+		t.Fatalf("BanUserRpc: %v", err)
+	}
+	if !nk.Banned["u1"] || !slices.Contains(nk.LoggedOut, "u1") {
+		t.Fatalf("banned = %v, logged out = %v, want the account banned and its sessions logged out", nk.Banned, nk.LoggedOut)
+	}
+
+	if _, err := UnbanUserRpc(ctx, logger, nil, nk, `{"user_id":"u1"}`); err != nil {
+		t.Fatalf("UnbanUserRpc: %v", err)
+	}
+	if nk.Banned["u1"] {
+		t.Error("account still banned in Nakama after the unban")
+	}
+	if readTestObject(t, nk, banCollection, "u1", "", &Ban{}) {
+		t.Error("ban record kept after the unban")
+	}
+}
+
+func TestSweepExpiredBansLiftsOnlyExpiredBans(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	now := time.Now().UTC().Unix()
+	bans := map[string]*Ban{
+		"expired":   {UserID: "expired", Until: now - 1},
+		"running":   {UserID: "running", Until: now + 3600},
+		"permanent": {UserID: "permanent"},
+	}
+	for userID, ban := range bans {
+		writeTestObject(t, nk, banCollection, userID, "", ban)
+		nk.Banned[userID] = true
+	}
+
+	sweepExpiredBans(newTestContext(""), logger, nk, now)
+
+	for userID := range bans {
+		want := userID != "expired"
+		if nk.Banned[userID] != want {
+			t.Errorf("%s banned = %v, want %v", userID, nk.Banned[userID], want)
+		}
+		if kept := readTestObject(t, nk, banCollection, userID, "", &Ban{}); kept != want {
+			t.Errorf("%s ban record kept = %v, want %v", userID, kept, want)
+		}
+	}
+}
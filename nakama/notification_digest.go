@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	notificationPriorityLow = iota
+	notificationPriorityNormal
+	notificationPriorityHigh
+)
+
+const (
+	notificationDigestConfigKey = "notification_digest"
+	notificationQueueCollection = "notif_queue"
+	notificationQueueKey        = "pending"
+
+	notificationDigestInterval      = time.Minute
+	notificationDigestDefaultItems  = 20
+	notificationDigestDefaultMaxAge = 5 * time.Minute
+	notificationQueuePageSize       = 100
+)
+
+// NotificationDigestConfig queues notifications with a priority below BatchBelow, 0 sends everything right away.
+// A queue is summarized into one digest once it holds MaxItems, once its oldest item is MaxAgeSeconds old or on
+// the next login of its owner, whichever comes first.
+type NotificationDigestConfig struct {
+	BatchBelow    int   `json:"batch_below"`
+	MaxItems      int   `json:"max_items"`
+	MaxAgeSeconds int64 `json:"max_age_seconds"`
+}
+
+type QueuedNotification struct {
+	Subject   string                 `json:"subject"`
+	Content   map[string]interface{} `json:"content"`
+	Code      int                    `json:"code"`
+	Priority  int                    `json:"priority"`
+	CreatedAt int64                  `json:"created_at"`
+}
+
+type NotificationQueue struct {
+	Items []*QueuedNotification `json:"items"`
+}
+
+// sendNotification sends a persistent notification, or queues it for the next digest when priority is low enough.
+func sendNotification(ctx context.Context, nk runtime.NakamaModule, userID, subject string, content map[string]interface{}, code, priority int) error {
+	config, err := readNotificationDigestConfig(ctx, nk)
+	if err != nil {
+		return err
+	}
+	if priority >= config.BatchBelow {
+		return nk.NotificationSend(ctx, userID, subject, content, code, "", true)
+	}
+
+	queued := 0
+	write := runtime.StorageWrite{
+		Collection:      notificationQueueCollection,
+		Key:             notificationQueueKey,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err = writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		queue := &NotificationQueue{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), queue); err != nil {
+				return "", err
+			}
+		}
+		queue.Items = append(queue.Items, &QueuedNotification{
+			Subject:   subject,
+			Content:   content,
+			Code:      code,
+			Priority:  priority,
+			CreatedAt: time.Now().UTC().Unix(),
+		})
+		queued = len(queue.Items)
+		value, err := json.Marshal(queue)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil || queued < config.MaxItems {
+		return err
+	}
+	return flushNotificationDigest(ctx, nk, userID)
+}
+
+// flushNotificationDigest drains the queue of userID and sends it as one notification, a single item goes out as is.
+func flushNotificationDigest(ctx context.Context, nk runtime.NakamaModule, userID string) error {
+	items, err := drainNotificationQueue(ctx, nk, userID)
+	if err != nil || len(items) == 0 {
+		return err
+	}
+	if len(items) == 1 {
+		return nk.NotificationSend(ctx, userID, items[0].Subject, items[0].Content, items[0].Code, "", true)
+	}
+	subject := translate(userLocale(ctx, nk, userID), msgNotificationDigest, len(items))
+	content := map[string]interface{}{"count": len(items), "items": items}
+	return nk.NotificationSend(ctx, userID, subject, content, notificationDigest, "", true)
+}
+
+// drainNotificationQueue deletes the queue guarded by the version it read, so of two concurrent drains only one
+// gets the items and a notification queued in between is never lost.
+func drainNotificationQueue(ctx context.Context, nk runtime.NakamaModule, userID string) ([]*QueuedNotification, error) {
+	for attempt := 1; attempt <= storageWriteAttempts; attempt++ {
+		objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: notificationQueueCollection, Key: notificationQueueKey, UserID: userID}})
+		if err != nil || len(objects) == 0 {
+			return nil, err
+		}
+		queue := &NotificationQueue{}
+		if err := json.Unmarshal([]byte(objects[0].Value), queue); err != nil {
+			return nil, err
+		}
+
+		err = nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: notificationQueueCollection, Key: notificationQueueKey, UserID: userID, Version: objects[0].Version}})
+		if err == nil {
+			return queue.Items, nil
+		}
+		if !errors.Is(err, runtime.ErrStorageRejectedVersion) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(attempt) * storageRetryBackoff):
+		}
+	}
+	return nil, errStorageConflict
+}
+
+// startNotificationDigest sends the digest of every queue whose oldest item is past the max age until ctx is done.
+func startNotificationDigest(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	runEvery(ctx, notificationDigestInterval, func() {
+		config, err := readNotificationDigestConfig(ctx, nk)
+		if err != nil {
+			logger.Error("Error reading notification digest config: %v", err)
+			return
+		}
+		cutoff := time.Now().UTC().Add(-time.Duration(config.MaxAgeSeconds) * time.Second).Unix()
+		due := make([]string, 0)
+		cursor := ""
+		for {
+			objects, next, err := nk.StorageList(ctx, "", "", notificationQueueCollection, notificationQueuePageSize, cursor)
+			if err != nil {
+				logger.Error("Error listing notification queues: %v", err)
+				return
+			}
+			for _, object := range objects {
+				queue := &NotificationQueue{}
+				if err := json.Unmarshal([]byte(object.Value), queue); err != nil {
+					logger.Error("Error unmarshalling notification queue of %s: %v", object.UserId, err)
+					continue
+				}
+				if len(queue.Items) > 0 && queue.Items[0].CreatedAt <= cutoff {
+					due = append(due, object.UserId)
+				}
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		for _, userID := range due {
+			if err := flushNotificationDigest(ctx, nk, userID); err != nil {
+				logger.Error("Error sending notification digest to %s: %v", userID, err)
+			}
+		}
+	})
+}
+
+func readNotificationDigestConfig(ctx context.Context, nk runtime.NakamaModule) (*NotificationDigestConfig, error) {
+	config := &NotificationDigestConfig{}
+	if _, err := readCachedConfig(ctx, nk, notificationDigestConfigKey, config); err != nil {
+		return nil, err
+	}
+	if config.MaxItems <= 0 {
+		config.MaxItems = notificationDigestDefaultItems
+	}
+	if config.MaxAgeSeconds <= 0 {
+		config.MaxAgeSeconds = int64(notificationDigestDefaultMaxAge / time.Second)
+	}
+	return config, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSendNotificationBatchesBelowThreshold(t *testing.T) {
+	tests := []struct {
+		name       string
+		batchBelow int
+		priority   int
+		wantQueued bool
+	}{
+		{name: "low is queued", batchBelow: notificationPriorityNormal, priority: notificationPriorityLow, wantQueued: true},
+		{name: "normal is sent", batchBelow: notificationPriorityNormal, priority: notificationPriorityNormal},
+		{name: "high is sent", batchBelow: notificationPriorityNormal, priority: notificationPriorityHigh},
+		{name: "batching off", batchBelow: 0, priority: notificationPriorityLow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, nk := newTestRuntime(t)
+			writeTestConfig(t, nk, notificationDigestConfigKey, &NotificationDigestConfig{BatchBelow: tt.batchBelow})
+
+			if err := sendNotification(newTestContext(""), nk, "u1", "reward", map[string]interface{}{"coins": 5}, notificationReferral, tt.priority); err != nil {
+				t.Fatalf("sendNotification: %v", err)
+			}
+			queue := &NotificationQueue{}
+			queued := readTestObject(t, nk, notificationQueueCollection, notificationQueueKey, "u1", queue)
+			if queued != tt.wantQueued || (queued && len(queue.Items) != 1) {
+				t.Errorf("queue = %v %+v, want queued %v", queued, queue.Items, tt.wantQueued)
+			}
+			if sent := len(nk.NotificationsFor("u1")); (sent == 0) != tt.wantQueued {
+				t.Errorf("sent %d notifications, want queued %v", sent, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestLoginCoalescesQueueIntoOneDigest(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, notificationDigestConfigKey, &NotificationDigestConfig{BatchBelow: notificationPriorityNormal})
+	ctx := newTestContext("u1")
+	for _, subject := range []string{"quest done", "reward ready", "friend joined"} {
+		if err := sendNotification(ctx, nk, "u1", subject, nil, notificationReferral, notificationPriorityLow); err != nil {
+			t.Fatalf("queueing %s: %v", subject, err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := AfterAuthenticateDevice(ctx, logger, nil, nk, nil, nil); err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+	}
+
+	sent := nk.NotificationsFor("u1")
+	if len(sent) != 1 {
+		t.Fatalf("sent %d notifications over two logins, want one digest", len(sent))
+	}
+	digest := sent[0]
+	if digest.Code != notificationDigest || digest.Subject != "You got 3 updates while away" {
+		t.Errorf("digest = %d %q, want code %d with the summary subject", digest.Code, digest.Subject, notificationDigest)
+	}
+	items, _ := digest.Content["items"].([]*QueuedNotification)
+	if digest.Content["count"] != 3 || len(items) != 3 || items[0].Subject != "quest done" {
+		t.Errorf("digest content = %+v, want the three items in order", digest.Content)
+	}
+	if readTestObject(t, nk, notificationQueueCollection, notificationQueueKey, "u1", &NotificationQueue{}) {
+		t.Error("queue was kept after the digest went out")
+	}
+}
+
+func TestNotificationDigestFlushesAtMaxItems(t *testing.T) {
+	_, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, notificationDigestConfigKey, &NotificationDigestConfig{BatchBelow: notificationPriorityNormal, MaxItems: 3})
+	ctx := newTestContext("")
+
+	for i := 0; i < 2; i++ {
+		sendNotification(ctx, nk, "u1", "reward", nil, notificationReferral, notificationPriorityLow)
+	}
+	if sent := len(nk.NotificationsFor("u1")); sent != 0 {
+		t.Fatalf("sent %d notifications below max items, want 0", sent)
+	}
+	sendNotification(ctx, nk, "u1", "reward", nil, notificationReferral, notificationPriorityLow)
+	if sent := nk.NotificationsFor("u1"); len(sent) != 1 || sent[0].Code != notificationDigest {
+		t.Errorf("notifications = %+v, want one digest once the queue is full", sent)
+	}
+}
+
+func TestFlushNotificationDigestSendsSingleItemAsIs(t *testing.T) {
+	_, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, notificationDigestConfigKey, &NotificationDigestConfig{BatchBelow: notificationPriorityNormal})
+	ctx := newTestContext("")
+	sendNotification(ctx, nk, "u1", "friend joined", map[string]interface{}{"friend": "u2"}, notificationReferral, notificationPriorityLow)
+
+	if err := flushNotificationDigest(ctx, nk, "u1"); err != nil {
+		t.Fatalf("flushNotificationDigest: %v", err)
+	}
+	if sent := nk.NotificationsFor("u1"); len(sent) != 1 || sent[0].Subject != "friend joined" || sent[0].Code != notificationReferral {
+		t.Errorf("notifications = %+v, want the queued one unchanged", sent)
+	}
+}
+
+func TestConcurrentFlushesSendOneDigest(t *testing.T) {
+	_, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, notificationDigestConfigKey, &NotificationDigestConfig{BatchBelow: notificationPriorityNormal})
+	ctx := newTestContext("")
+	for i := 0; i < 5; i++ {
+		sendNotification(ctx, nk, "u1", "reward", nil, notificationReferral, notificationPriorityLow)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := flushNotificationDigest(ctx, nk, "u1"); err != nil {
+				t.Errorf("flushNotificationDigest: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sent := nk.NotificationsFor("u1"); len(sent) != 1 || sent[0].Content["count"] != 5 {
+		t.Errorf("notifications = %+v, want a single digest of 5", sent)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	notificationTournamentReward = iota + 100
+	notificationAnnouncement
+	notificationAchievement
+	notificationMatchEnding
+	notificationReferral
+	notificationLiveEvent
+	notificationTicketReply
+	notificationLeaderboardReward
+	notificationRankChange
+	notificationMatchRecorded
+	notificationDigest
+)
+
+const (
+	announcementCollection = "announcements"
+)
+
+type BroadcastNotificationRequest struct {
+	Subject string                 `json:"subject"`
+	Content map[string]interface{} `json:"content"`
+	UserIDs []string               `json:"user_ids"`
+}
+
+type Announcement struct {
+	Subject   string                 `json:"subject"`
+	Content   map[string]interface{} `json:"content"`
+	CreatedAt int64                  `json:"created_at"`
+}
+
+type BroadcastNotificationResponse struct {
+	Delivered       int    `json:"delivered"`
+	AnnouncementKey string `json:"announcement_key,omitempty"`
+}
+
+// BroadcastNotificationRpc sends to the given users, or stores an announcement for clients to poll when no target is given.
+func BroadcastNotificationRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("BroadcastNotification Called - Payload: `%s`", payload)
+	request, err := parsePayload[BroadcastNotificationRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.Subject == "" {
+		return errorResponse(CodeInvalidArgument, "subject is required")
+	}
+
+	response := &BroadcastNotificationResponse{}
+	if len(request.UserIDs) > 0 {
+		notifications := make([]*runtime.NotificationSend, 0, len(request.UserIDs))
+		for _, userID := range request.UserIDs {
+			notifications = append(notifications, &runtime.NotificationSend{
+				UserID:     userID,
+				Subject:    request.Subject,
+				Content:    request.Content,
+				Code:       notificationAnnouncement,
+				Persistent: true,
+			})
+		}
+		if err := nk.NotificationsSend(ctx, notifications); err != nil {
+			logger.Error("Error sending notifications: %v", err)
+			return errorResponse(CodeInternal, "error sending notifications")
+		}
+		response.Delivered = len(notifications)
+	} else {
+		now := time.Now().UTC()
+		value, err := json.Marshal(&Announcement{Subject: request.Subject, Content: request.Content, CreatedAt: now.Unix()})
+		if err != nil {
+			logger.Error("Error marshalling announcement: %v", err)
+			return errorResponse(CodeInternal, "error marshalling announcement")
+		}
+		response.AnnouncementKey = strconv.FormatInt(now.UnixNano(), 10)
+		_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+			Collection:      announcementCollection,
+			Key:             response.AnnouncementKey,
+			Value:           string(value),
+			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		}})
+		if err != nil {
+			logger.Error("Error writing announcement: %v", err)
+			return errorResponse(CodeInternal, "error writing announcement")
+		}
+	}
+
+	return marshalResponse(response)
+}
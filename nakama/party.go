@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	partyCollection           = "parties"
+	partyMembershipCollection = "party_membership"
+	partyMembershipKey        = "current"
+
+	// streamModeParty carries roster and matchmaking updates, its subject is the party id.
+	streamModeParty = 101
+
+	partyEventRoster = "roster"
+	partyEventMatch  = "match"
+
+	matchmakerPropertyPartySize = "party_size"
+	partyMatchmakerAddMessageID = "PartyMatchmakerAdd"
+)
+
+var (
+	errPartyNotFound      = newError(CodeNotFound, "party not found")
+	errPartyFull          = newError(CodeFailedPrecondition, "party is full")
+	errPartyAlreadyMember = newError(CodeAlreadyExists, "already in a party")
+	errPartyNotMember     = newError(CodeFailedPrecondition, "not in a party")
+	errPartyNotLeader     = newError(CodePermissionDenied, "only the party leader can do this")
+	errPartyTaken         = newError(CodeAlreadyExists, "party already exists")
+	errPartyMatchMoved    = errors.New("party moved on to another match")
+)
+
+// Party is stored system owned under the id of the Nakama realtime party it tracks, so the party id of a realtime
+// PartyMatchmakerAdd and of the matched entries finds it. Members keeps join order so the longest standing member
+// inherits the lead.
+type Party struct {
+	ID        string   `json:"id"`
+	LeaderID  string   `json:"leader_id"`
+	Members   []string `json:"members"`
+	MaxSize   int      `json:"max_size"`
+	MatchID   string   `json:"match_id,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+type PartyMembership struct {
+	PartyID string `json:"party_id"`
+}
+
+// CreatePartyRequest names the realtime party the caller created over the socket and leads.
+type CreatePartyRequest struct {
+	PartyID string `json:"party_id"`
+	MaxSize int    `json:"max_size"`
+}
+
+type JoinPartyRequest struct {
+	PartyID string `json:"party_id"`
+}
+
+type PartyEvent struct {
+	Event string `json:"event"`
+	*Party
+}
+
+type LeavePartyResponse struct {
+	PartyID   string `json:"party_id"`
+	Disbanded bool   `json:"disbanded"`
+}
+
+func CreatePartyRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("CreateParty Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[CreatePartyRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.PartyID == "" {
+		return errorResponse(CodeInvalidArgument, "party_id is required")
+	}
+	maxSize := request.MaxSize
+	if maxSize <= 0 {
+		maxSize = hordeDefaultMaxPlayers
+	}
+	if maxSize < 2 || maxSize > hordeDefaultMaxPlayers {
+		return errorResponse(CodeInvalidArgument, "max_size out of range")
+	}
+
+	id := request.PartyID
+	if err := claimPartyMembership(ctx, nk, userID, id); err != nil {
+		return "", runtimeError(logger, err, "updating party")
+	}
+
+	party := &Party{ID: id, LeaderID: userID, Members: []string{userID}, MaxSize: maxSize, CreatedAt: time.Now().UTC().Unix()}
+	value, err := json.Marshal(party)
+	if err == nil {
+		_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+			Collection:      partyCollection,
+			Key:             id,
+			Value:           string(value),
+			Version:         "*",
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		}})
+	}
+	if err != nil {
+		releasePartyMembership(ctx, logger, nk, userID)
+		if errors.Is(err, runtime.ErrStorageRejectedVersion) {
+			return "", errPartyTaken
+		}
+		logger.Error("Error writing party %s: %v", id, err)
+		return errorResponse(CodeInternal, "error creating party")
+	}
+
+	joinPartyStream(ctx, logger, nk, party.ID, userID)
+	return marshalResponse(party)
+}
+
+func JoinPartyRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("JoinParty Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[JoinPartyRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.PartyID == "" {
+		return errorResponse(CodeInvalidArgument, "party_id is required")
+	}
+	if err := claimPartyMembership(ctx, nk, userID, request.PartyID); err != nil {
+		return "", runtimeError(logger, err, "updating party")
+	}
+
+	party, err := updateParty(ctx, nk, request.PartyID, func(party *Party) error {
+		if slices.Contains(party.Members, userID) {
+			return nil
+		}
+		if len(party.Members) >= party.MaxSize {
+			return errPartyFull
+		}
+		party.Members = append(party.Members, userID)
+		return nil
+	})
+	if err != nil {
+		releasePartyMembership(ctx, logger, nk, userID)
+		return "", runtimeError(logger, err, "updating party")
+	}
+
+	joinPartyStream(ctx, logger, nk, party.ID, userID)
+	broadcastParty(ctx, logger, nk, partyEventRoster, party)
+	return marshalResponse(party)
+}
+
+// LeavePartyRpc hands the lead to the longest standing remaining member and disbands the party once it is empty.
+func LeavePartyRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("LeaveParty Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	partyID, err := currentPartyID(ctx, nk, userID)
+	if err != nil {
+		return "", runtimeError(logger, err, "updating party")
+	}
+	party, err := updateParty(ctx, nk, partyID, func(party *Party) error {
+		party.Members = slices.DeleteFunc(party.Members, func(member string) bool { return member == userID })
+		if party.LeaderID == userID && len(party.Members) > 0 {
+			party.LeaderID = party.Members[0]
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPartyNotFound) {
+		return "", runtimeError(logger, err, "updating party")
+	}
+	releasePartyMembership(ctx, logger, nk, userID)
+	if sessionID, _ := ctx.Value(runtime.RUNTIME_CTX_SESSION_ID).(string); sessionID != "" {
+		if err := nk.StreamUserLeave(streamModeParty, partyID, "", "", userID, sessionID); err != nil {
+			logger.Warn("Error leaving party stream %s: %v", partyID, err)
+		}
+	}
+
+	disbanded := party == nil || len(party.Members) == 0
+	if disbanded {
+		if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: partyCollection, Key: partyID}}); err != nil {
+			logger.Error("Error deleting party %s: %v", partyID, err)
+		}
+	} else {
+		broadcastParty(ctx, logger, nk, partyEventRoster, party)
+	}
+	return marshalResponse(&LeavePartyResponse{PartyID: partyID, Disbanded: disbanded})
+}
+
+// BeforePartyMatchmakerAdd only lets the leader of the party named by the ticket queue it, stamps the party's average
+// MMR and size onto the ticket and charges every member the match start energy cost. As with BeforeMatchmakerAdd a ticket that is
+// removed or expires keeps the charge.
+func BeforePartyMatchmakerAdd(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *rtapi.Envelope) (*rtapi.Envelope, error) {
+	add := in.GetPartyMatchmakerAdd()
+	if add == nil {
+		return in, nil
+	}
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	party, err := stampPartyTicket(ctx, logger, nk, userID, add)
+	if err != nil {
+		return nil, runtimeError(logger, err, "updating party")
+	}
+	for _, memberID := range party.Members {
+		if err := checkEnergy(ctx, nk, memberID, energyActionCreateHordeMatch); err != nil {
+			var runtimeErr *runtime.Error
+			if errors.As(err, &runtimeErr) && runtimeErr.Code == CodeResourceExhausted {
+				return nil, newErrorf(CodeResourceExhausted, "not enough energy for %s", memberID)
+			}
+			return nil, runtimeError(logger, err, "reading energy")
+		}
+	}
+	return in, nil
+}
+
+// stampPartyTicket fills the ticket of the realtime party add.PartyId, which userID must lead: the max count is clamped
+// to the horde maximum and the query is bracketed around the party's average MMR.
+func stampPartyTicket(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, add *rtapi.PartyMatchmakerAdd) (*Party, error) {
+	add.MaxCount = min(add.MaxCount, hordeMaxPlayers)
+	if add.MaxCount <= 0 {
+		add.MaxCount = hordeDefaultMaxPlayers
+	}
+	add.MinCount = min(add.MinCount, add.MaxCount)
+
+	partyID, err := currentPartyID(ctx, nk, userID)
+	if err != nil {
+		return nil, err
+	}
+	if partyID != add.PartyId {
+		return nil, newError(CodeFailedPrecondition, "ticket is not for your party")
+	}
+	party, err := readParty(ctx, nk, partyID)
+	if err != nil {
+		return nil, err
+	}
+	if party.LeaderID != userID {
+		return nil, errPartyNotLeader
+	}
+	if len(party.Members) > int(add.MaxCount) {
+		return nil, newError(CodeFailedPrecondition, "party is larger than the match")
+	}
+
+	total := 0
+	for _, member := range party.Members {
+		rating, err := readRating(ctx, nk, member)
+		if err != nil {
+			logger.Error("Error reading rating of %s: %v", member, err)
+			return nil, newError(CodeInternal, "error reading party ratings")
+		}
+		total += rating.MMR
+	}
+	mmr := total / len(party.Members)
+
+	if add.NumericProperties == nil {
+		add.NumericProperties = make(map[string]float64)
+	}
+	add.NumericProperties[matchmakerPropertyMMR] = float64(mmr)
+	add.NumericProperties[matchmakerPropertyPartySize] = float64(len(party.Members))
+	add.NumericProperties[matchmakerPropertyMaxCount] = float64(add.MaxCount)
+	add.Query = bracketMatchmakerQuery(add.Query, mmr)
+	return party, nil
+}
+
+// setPartyMatch points every party in a new match at it and tells the members on the party stream.
+func setPartyMatch(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, partyIDs []string, matchID string) {
+	updatePartyMatches(ctx, logger, nk, partyIDs, func(party *Party) error {
+		party.MatchID = matchID
+		return nil
+	})
+}
+
+// clearPartyMatch forgets a match that is over, a party that already moved on to another match is left alone.
+func clearPartyMatch(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, partyIDs []string, matchID string) {
+	updatePartyMatches(ctx, logger, nk, partyIDs, func(party *Party) error {
+		if party.MatchID != matchID {
+			return errPartyMatchMoved
+		}
+		party.MatchID = ""
+		return nil
+	})
+}
+
+func updatePartyMatches(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, partyIDs []string, mutate func(*Party) error) {
+	for _, partyID := range partyIDs {
+		party, err := updateParty(ctx, nk, partyID, mutate)
+		if errors.Is(err, errPartyMatchMoved) || errors.Is(err, errPartyNotFound) {
+			continue
+		}
+		if err != nil {
+			logger.Error("Error updating match of party %s: %v", partyID, err)
+			continue
+		}
+		broadcastParty(ctx, logger, nk, partyEventMatch, party)
+	}
+}
+
+// matchedParties returns the ids of the parties whose tickets were matched together.
+func matchedParties(entries []runtime.MatchmakerEntry) []string {
+	partyIDs := make([]string, 0)
+	for _, entry := range entries {
+		if partyID := entry.GetPartyId(); partyID != "" && !slices.Contains(partyIDs, partyID) {
+			partyIDs = append(partyIDs, partyID)
+		}
+	}
+	return partyIDs
+}
+
+// claimPartyMembership records partyID as the user's party, failing when they are already in a different one.
+func claimPartyMembership(ctx context.Context, nk runtime.NakamaModule, userID, partyID string) error {
+	write := runtime.StorageWrite{
+		Collection:      partyMembershipCollection,
+		Key:             partyMembershipKey,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		membership := &PartyMembership{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), membership); err != nil {
+				return "", err
+			}
+		}
+		if membership.PartyID != "" && membership.PartyID != partyID {
+			return "", errPartyAlreadyMember
+		}
+		value, err := json.Marshal(&PartyMembership{PartyID: partyID})
+		return string(value), err
+	}, storageWriteAttempts)
+	return err
+}
+
+func releasePartyMembership(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) {
+	if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: partyMembershipCollection, Key: partyMembershipKey, UserID: userID}}); err != nil {
+		logger.Error("Error releasing party membership of %s: %v", userID, err)
+	}
+}
+
+func currentPartyID(ctx context.Context, nk runtime.NakamaModule, userID string) (string, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: partyMembershipCollection, Key: partyMembershipKey, UserID: userID}})
+	if err != nil {
+		return "", err
+	}
+	membership := &PartyMembership{}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].Value), membership); err != nil {
+			return "", err
+		}
+	}
+	if membership.PartyID == "" {
+		return "", errPartyNotMember
+	}
+	return membership.PartyID, nil
+}
+
+func updateParty(ctx context.Context, nk runtime.NakamaModule, partyID string, mutate func(*Party) error) (*Party, error) {
+	party := &Party{}
+	write := runtime.StorageWrite{
+		Collection:      partyCollection,
+		Key:             partyID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		if current == "" {
+			return "", errPartyNotFound
+		}
+		party = &Party{}
+		if err := json.Unmarshal([]byte(current), party); err != nil {
+			return "", err
+		}
+		if err := mutate(party); err != nil {
+			return "", err
+		}
+		value, err := json.Marshal(party)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return party, nil
+}
+
+func readParty(ctx context.Context, nk runtime.NakamaModule, partyID string) (*Party, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: partyCollection, Key: partyID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, errPartyNotFound
+	}
+	party := &Party{}
+	if err := json.Unmarshal([]byte(objects[0].Value), party); err != nil {
+		return nil, err
+	}
+	return party, nil
+}
+
+// joinPartyStream subscribes the calling socket to party updates, calls made over HTTP have no session to subscribe.
+func joinPartyStream(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, partyID, userID string) {
+	sessionID, _ := ctx.Value(runtime.RUNTIME_CTX_SESSION_ID).(string)
+	if sessionID == "" {
+		return
+	}
+	if _, err := nk.StreamUserJoin(streamModeParty, partyID, "", "", userID, sessionID, false, false, ""); err != nil {
+		logger.Warn("Error joining party stream %s: %v", partyID, err)
+	}
+}
+
+func broadcastParty(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, event string, party *Party) {
+	data, err := json.Marshal(&PartyEvent{Event: event, Party: party})
+	if err != nil {
+		logger.Error("Error marshalling party event: %v", err)
+		return
+	}
+	if err := nk.StreamSend(streamModeParty, party.ID, "", "", string(data), nil, true); err != nil {
+		logger.Warn("Error broadcasting party %s %s: %v", party.ID, event, err)
+	}
+}
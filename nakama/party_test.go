@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+// testRealtimePartyID is the Nakama realtime party the test parties track.
+const testRealtimePartyID = "nakama-party.node"
+
+// newTestParty has "leader" register the realtime party testRealtimePartyID and members join it.
+func newTestParty(t *testing.T, logger runtime.Logger, nk *testutil.NakamaModule, members ...string) *Party {
+	t.Helper()
+	response, err := CreatePartyRpc(newTestContext("leader"), logger, nil, nk, fmt.Sprintf(`{"party_id":%q}`, testRealtimePartyID))
+	if err != nil {
+		t.Fatalf("CreatePartyRpc: %v", err)
+	}
+	party := decodeResponse[Party](t, response)
+	for _, member := range members {
+		response, err = JoinPartyRpc(newTestContext(member), logger, nil, nk, fmt.Sprintf(`{"party_id":%q}`, party.ID))
+		if err != nil {
+			t.Fatalf("JoinPartyRpc: %v", err)
+		}
+		party = decodeResponse[Party](t, response)
+	}
+	return party
+}
+
+func partyMatchmakerAdd(maxCount int32, query string) *rtapi.Envelope {
+	return &rtapi.Envelope{Message: &rtapi.Envelope_PartyMatchmakerAdd{PartyMatchmakerAdd: &rtapi.PartyMatchmakerAdd{PartyId: testRealtimePartyID, MaxCount: maxCount, Query: query}}}
+}
+
+func TestBeforePartyMatchmakerAddRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   string
+		add      *rtapi.Envelope
+		wantCode int
+	}{
+		{name: "a member who is not the leader", caller: "guest", add: partyMatchmakerAdd(4, "*"), wantCode: CodePermissionDenied},
+		{name: "a party larger than the match", caller: "leader", add: partyMatchmakerAdd(2, "*"), wantCode: CodeFailedPrecondition},
+		{name: "a player without a party", caller: "stranger", add: partyMatchmakerAdd(4, "*"), wantCode: CodeFailedPrecondition},
+		{name: "a ticket for another realtime party", caller: "leader", wantCode: CodeFailedPrecondition,
+			add: &rtapi.Envelope{Message: &rtapi.Envelope_PartyMatchmakerAdd{PartyMatchmakerAdd: &rtapi.PartyMatchmakerAdd{PartyId: "other-party.node", MaxCount: 4}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			newTestParty(t, logger, nk, "guest", "friend")
+			if _, err := BeforePartyMatchmakerAdd(newTestContext(tt.caller), logger, nil, nk, tt.add); errorCode(err) != tt.wantCode {
+				t.Errorf("error code = %d (%v), want %d", errorCode(err), err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCreatePartyRpcNeedsAFreeRealtimeParty(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	if _, err := CreatePartyRpc(newTestContext("leader"), logger, nil, nk, `{}`); errorCode(err) != CodeInvalidArgument {
+		t.Errorf("create without a party id = %v, want invalid argument", err)
+	}
+	newTestParty(t, logger, nk)
+	if _, err := CreatePartyRpc(newTestContext("other"), logger, nil, nk, fmt.Sprintf(`{"party_id":%q}`, testRealtimePartyID)); errorCode(err) != CodeAlreadyExists {
+		t.Errorf("create over an existing party = %v, want already exists", err)
+	}
+	if _, err := JoinPartyRpc(newTestContext("other"), logger, nil, nk, fmt.Sprintf(`{"party_id":%q}`, testRealtimePartyID)); err != nil {
+		t.Errorf("other player left in a party after the failed create: %v", err)
+	}
+}
+
+func TestBeforePartyMatchmakerAddStampsTheTicket(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	party := newTestParty(t, logger, nk, "guest")
+
+	in := partyMatchmakerAdd(1000, "+properties.region:eu")
+	out, err := BeforePartyMatchmakerAdd(newTestContext("leader"), logger, nil, nk, in)
+	if err != nil {
+		t.Fatalf("BeforePartyMatchmakerAdd: %v", err)
+	}
+	add := out.GetPartyMatchmakerAdd()
+	if add.MaxCount != hordeMaxPlayers {
+		t.Errorf("max count = %d, want %d", add.MaxCount, hordeMaxPlayers)
+	}
+	if party.ID != add.PartyId || add.NumericProperties[matchmakerPropertyPartySize] != 2 {
+		t.Errorf("ticket of party %s = %+v, want the stored party %s of size 2", add.PartyId, add.NumericProperties, party.ID)
+	}
+	if want := "+properties.region:eu +properties.mmr:>=800 +properties.mmr:<=1200"; add.Query != want {
+		t.Errorf("query = %q, want %q", add.Query, want)
+	}
+
+	if _, err := BeforePartyMatchmakerAdd(newTestContext("guest"), logger, nil, nk, partyMatchmakerAdd(4, "*")); errorCode(err) != CodePermissionDenied {
+		t.Errorf("member ticket = %v, want permission denied", err)
+	}
+}
+
+func TestPartyMatchIsClearedWhenTheMatchEnds(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	party := newTestParty(t, logger, nk, "guest")
+	entries := make([]runtime.MatchmakerEntry, 0)
+	for _, userID := range []string{"leader", "guest", "solo"} {
+		entry := &testutil.MatchmakerEntry{Presence: &testutil.Presence{UserID: userID}, Properties: map[string]interface{}{}}
+		if userID != "solo" {
+			entry.PartyID = party.ID
+		}
+		entries = append(entries, entry)
+	}
+
+	matchID, err := MatchmakerMatched(newTestContext(""), logger, nil, nk, entries)
+	if err != nil || matchID == "" {
+		t.Fatalf("MatchmakerMatched = %q, %v, want a horde match", matchID, err)
+	}
+	matched := &Party{}
+	readTestObject(t, nk, partyCollection, party.ID, "", matched)
+	if matched.MatchID != matchID {
+		t.Fatalf("party match = %q, want %s", matched.MatchID, matchID)
+	}
+
+	ctx := context.WithValue(newTestContext(""), runtime.RUNTIME_CTX_MATCH_ID, matchID)
+	state, _, _ := (&MatchHandler{}).MatchInit(ctx, logger, nil, nk, nk.Matches[matchID])
+	(&MatchHandler{}).MatchTerminate(ctx, logger, nil, nk, &testutil.MatchDispatcher{}, 10, state, 0)
+	ended := &Party{}
+	readTestObject(t, nk, partyCollection, party.ID, "", ended)
+	if ended.MatchID != "" {
+		t.Errorf("party match = %q after the match ended, want it cleared", ended.MatchID)
+	}
+}
+
+func TestClearPartyMatchKeepsANewerMatch(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	party := newTestParty(t, logger, nk)
+	ctx := newTestContext("")
+	setPartyMatch(ctx, logger, nk, []string{party.ID}, "second.node")
+
+	clearPartyMatch(ctx, logger, nk, []string{party.ID}, "first.node")
+	stored := &Party{}
+	readTestObject(t, nk, partyCollection, party.ID, "", stored)
+	if stored.MatchID != "second.node" {
+		t.Errorf("party match = %q, want the newer match kept", stored.MatchID)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	payloadDefaultLimit = 16 << 10
+)
+
+// payloadLimitFor returns the byte limit of an RPC from limits, falling back to payloadDefaultLimit.
+func payloadLimitFor(limits map[string]int, id string) int {
+	if limit, ok := limits[id]; ok {
+		return limit
+	}
+	return payloadDefaultLimit
+}
+
+// withPayloadLimit rejects payloads over limit bytes before anything parses them, 0 disables the check. The rejection
+// is an invalid argument rather than the rate limiter's resource exhausted, so clients do not retry it.
+func withPayloadLimit(name string, limit int, fn rpcFunc) rpcFunc {
+	if limit <= 0 {
+		return fn
+	}
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		if len(payload) > limit {
+			logger.Warn("Rejected %d byte payload for rpc %s over limit %d", len(payload), name, limit)
+			err := newErrorf(CodeInvalidArgument, "payload too large, limit is %s bytes", strconv.Itoa(limit))
+			return err.Message, err
+		}
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func TestWithPayloadLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		size     int
+		wantCode int
+		wantRun  bool
+	}{
+		{name: "under the limit", limit: 16, size: 10, wantRun: true},
+		{name: "at the limit", limit: 16, size: 16, wantRun: true},
+		{name: "oversized", limit: 16, size: 17, wantCode: CodeInvalidArgument},
+		{name: "no limit", limit: 0, size: 1 << 20, wantRun: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			ran := false
+			handler := withPayloadLimit("test", tt.limit, func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+				ran = true
+				return "", nil
+			})
+			_, err := handler(newTestContext("u1"), logger, nil, nk, strings.Repeat("x", tt.size))
+			if code := errorCode(err); code != tt.wantCode {
+				t.Errorf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			if ran != tt.wantRun {
+				t.Errorf("handler ran = %v, want %v", ran, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestPayloadLimitFor(t *testing.T) {
+	limits := map[string]int{rpcSendMail: 32 << 10}
+	if got := payloadLimitFor(limits, rpcSendMail); got != 32<<10 {
+		t.Errorf("send_mail limit = %d, want the override", got)
+	}
+	if got := payloadLimitFor(limits, rpcProposeTrade); got != payloadDefaultLimit {
+		t.Errorf("propose_trade limit = %d, want the default %d", got, payloadDefaultLimit)
+	}
+}
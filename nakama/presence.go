@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// streamModePresence is a custom stream mode above Nakama's built in ones, its subject is the online user's id.
+	streamModePresence = 100
+
+	friendStateMutual       = 0
+	friendsOnlineDefaultLen = 50
+	friendsOnlineMaxLen     = 100
+)
+
+type PresenceStatus struct {
+	OnlineSince int64  `json:"online_since"`
+	GuildID     string `json:"guild_id,omitempty"`
+}
+
+type FriendsOnlineRequest struct {
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+type FriendPresence struct {
+	UserID   string          `json:"user_id"`
+	Username string          `json:"username"`
+	Online   bool            `json:"online"`
+	Status   *PresenceStatus `json:"status,omitempty"`
+}
+
+type FriendsOnlineResponse struct {
+	Friends []*FriendPresence `json:"friends"`
+	Cursor  string            `json:"cursor,omitempty"`
+}
+
+// SessionStart joins every new socket to its user's presence stream with a status built from the session vars.
+func SessionStart(nk runtime.NakamaModule) func(context.Context, runtime.Logger, *api.Event) {
+	return func(ctx context.Context, logger runtime.Logger, evt *api.Event) {
+		SessionStartMetrics(ctx, logger, evt)
+
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		sessionID, _ := ctx.Value(runtime.RUNTIME_CTX_SESSION_ID).(string)
+		vars, _ := ctx.Value(runtime.RUNTIME_CTX_VARS).(map[string]string)
+		status, err := json.Marshal(&PresenceStatus{OnlineSince: time.Now().UTC().Unix(), GuildID: vars[sessionVarGuildID]})
+		if err != nil {
+			logger.Error("Error marshalling presence status: %v", err)
+			return
+		}
+		if _, err := nk.StreamUserJoin(streamModePresence, userID, "", "", userID, sessionID, false, false, string(status)); err != nil {
+			logger.Warn("Error joining presence stream for %s: %v", userID, err)
+		}
+	}
+}
+
+// SessionEnd leaves the presence stream explicitly rather than relying on the socket teardown.
+func SessionEnd(nk runtime.NakamaModule) func(context.Context, runtime.Logger, *api.Event) {
+	return func(ctx context.Context, logger runtime.Logger, evt *api.Event) {
+		SessionEndMetrics(ctx, logger, evt)
+
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		sessionID, _ := ctx.Value(runtime.RUNTIME_CTX_SESSION_ID).(string)
+		if err := nk.StreamUserLeave(streamModePresence, userID, "", "", userID, sessionID); err != nil {
+			logger.Warn("Error leaving presence stream for %s: %v", userID, err)
+		}
+	}
+}
+
+// FriendsOnlineRpc pages through the caller's mutual friends and reports which of them have a live session.
+func FriendsOnlineRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("FriendsOnline Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[FriendsOnlineRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	limit := request.Limit
+	if limit <= 0 {
+		limit = friendsOnlineDefaultLen
+	}
+	limit = min(limit, friendsOnlineMaxLen)
+
+	state := friendStateMutual
+	friends, cursor, err := nk.FriendsList(ctx, userID, limit, &state, request.Cursor)
+	if err != nil {
+		logger.Error("Error listing friends: %v", err)
+		return errorResponse(CodeInternal, "error listing friends")
+	}
+
+	response := &FriendsOnlineResponse{Friends: make([]*FriendPresence, 0, len(friends)), Cursor: cursor}
+	for _, friend := range friends {
+		user := friend.GetUser()
+		presence := &FriendPresence{UserID: user.GetId(), Username: user.GetUsername()}
+		presences, err := nk.StreamUserList(streamModePresence, user.GetId(), "", "", false, true)
+		if err != nil {
+			logger.Warn("Error listing presence of %s: %v", user.GetId(), err)
+		}
+		if len(presences) > 0 {
+			presence.Online = true
+			status := &PresenceStatus{}
+			if err := json.Unmarshal([]byte(presences[0].GetStatus()), status); err == nil {
+				presence.Status = status
+			}
+		}
+		response.Friends = append(response.Friends, presence)
+	}
+	return marshalResponse(response)
+}
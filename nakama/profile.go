@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	profileCollection = "profiles"
+)
+
+type CreateProfileRequest struct {
+	DisplayName string `json:"display_name"`
+	Avatar      string `json:"avatar"`
+}
+
+type Profile struct {
+	DisplayName string `json:"display_name"`
+	Avatar      string `json:"avatar"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+func CreateProfileRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("CreateProfile Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[CreateProfileRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.DisplayName == "" {
+		return errorResponse(CodeInvalidArgument, "display_name is required")
+	}
+
+	existing, err := readProfile(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Error reading profile: %v", err)
+		return errorResponse(CodeInternal, "error reading profile")
+	}
+	if existing != "" {
+		return existing, nil
+	}
+
+	profile := &Profile{DisplayName: request.DisplayName, Avatar: request.Avatar, CreatedAt: time.Now().UTC().Unix()}
+	jsonProfile, err := json.Marshal(profile)
+	if err != nil {
+		logger.Error("Error marshalling response: %v", err)
+		return errorResponse(CodeInternal, "error marshalling response")
+	}
+
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      profileCollection,
+		Key:             userID,
+		UserID:          userID,
+		Value:           string(jsonProfile),
+		Version:         "*",
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	if errors.Is(err, runtime.ErrStorageRejectedVersion) {
+		// A concurrent call created the profile first, hand back the stored one.
+		if existing, readErr := readProfile(ctx, nk, userID); readErr == nil && existing != "" {
+			return existing, nil
+		}
+	}
+	if err != nil {
+		logger.Error("Error writing profile: %v", err)
+		return errorResponse(CodeInternal, "error writing profile")
+	}
+	return string(jsonProfile), nil
+}
+
+func readProfile(ctx context.Context, nk runtime.NakamaModule, userID string) (string, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: profileCollection, Key: userID, UserID: userID}})
+	if err != nil {
+		return "", err
+	}
+	if len(objects) == 0 {
+		return "", nil
+	}
+	return objects[0].Value, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCreateProfileRpc(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   string
+		existing *Profile
+		payload  string
+		wantCode int
+		wantName string
+	}{
+		{name: "creates the profile", userID: "u1", payload: `{"display_name":"Rin","avatar":"fox"}`, wantName: "Rin"},
+		{name: "keeps the stored profile", userID: "u1", existing: &Profile{DisplayName: "Old", CreatedAt: 1}, payload: `{"display_name":"New"}`, wantName: "Old"},
+		{name: "requires a display name", userID: "u1", payload: `{"avatar":"fox"}`, wantCode: CodeInvalidArgument},
+		{name: "rejects a malformed payload", userID: "u1", payload: `{`, wantCode: CodeInvalidArgument},
+		{name: "requires a session", payload: `{"display_name":"Rin"}`, wantCode: CodeUnauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			if tt.existing != nil {
+				writeTestObject(t, nk, profileCollection, tt.userID, tt.userID, tt.existing)
+			}
+
+			response, err := CreateProfileRpc(newTestContext(tt.userID), logger, nil, nk, tt.payload)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			if tt.wantCode != 0 {
+				return
+			}
+			if got := decodeResponse[Profile](t, response); got.DisplayName != tt.wantName {
+				t.Errorf("response display_name = %q, want %q", got.DisplayName, tt.wantName)
+			}
+			stored := &Profile{}
+			if !readTestObject(t, nk, profileCollection, tt.userID, tt.userID, stored) || stored.DisplayName != tt.wantName {
+				t.Errorf("stored display_name = %q, want %q", stored.DisplayName, tt.wantName)
+			}
+		})
+	}
+}
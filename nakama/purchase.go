@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	purchaseStoreApple  = "apple"
+	purchaseStoreGoogle = "google"
+
+	purchaseProductsConfigKey = "iap_products"
+	purchaseGrantCollection   = "purchase_grants"
+	purchaseRestorePageSize   = 100
+
+	entitlementBattlepassPremium = "battlepass_premium"
+)
+
+type ValidatePurchaseRequest struct {
+	Store   string `json:"store"`
+	Receipt string `json:"receipt"`
+}
+
+// PurchaseProduct is what a SKU grants. Durable products are permanent unlocks that restore_purchases applies when
+// their purchase was never granted, everything else is a consumable that is only ever granted on validation.
+type PurchaseProduct struct {
+	Currency map[string]int64 `json:"currency"`
+	Items    map[string]int64 `json:"items"`
+	Durable  bool             `json:"durable"`
+}
+
+// PurchaseGrant is stored per user under the transaction id once a purchase has been applied, SeasonID is the
+// battle pass season a premium purchase unlocked.
+type PurchaseGrant struct {
+	SKU       string `json:"sku"`
+	SeasonID  string `json:"season_id,omitempty"`
+	GrantedAt int64  `json:"granted_at"`
+}
+
+type PurchaseProductsConfig struct {
+	Products map[string]*PurchaseProduct `json:"products"`
+}
+
+type ValidatedPurchaseResult struct {
+	SKU           string `json:"sku"`
+	TransactionID string `json:"transaction_id"`
+	Granted       bool   `json:"granted"`
+}
+
+type ValidatePurchaseResponse struct {
+	Purchases []*ValidatedPurchaseResult `json:"purchases"`
+	Balance   map[string]int64           `json:"balance"`
+}
+
+func ValidatePurchaseRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ValidatePurchase Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[ValidatePurchaseRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	var validation *api.ValidatePurchaseResponse
+	switch request.Store {
+	case purchaseStoreApple:
+		validation, err = nk.PurchaseValidateApple(ctx, userID, request.Receipt, true)
+	case purchaseStoreGoogle:
+		validation, err = nk.PurchaseValidateGoogle(ctx, userID, request.Receipt, true)
+	default:
+		return errorResponse(CodeInvalidArgument, "store must be apple or google")
+	}
+	if err != nil {
+		logger.Warn("Invalid %s receipt for user %s: %v", request.Store, userID, err)
+		return errorResponse(CodeInvalidArgument, "invalid receipt")
+	}
+
+	var products PurchaseProductsConfig
+	if _, err := readCachedConfig(ctx, nk, purchaseProductsConfigKey, &products); err != nil {
+		logger.Error("Error reading purchase products config: %v", err)
+		return errorResponse(CodeInternal, "error reading purchase products")
+	}
+	var battlepass BattlepassConfig
+	if _, err := readConfig(ctx, nk, battlepassConfigKey, &battlepass); err != nil {
+		logger.Error("Error reading battle pass config: %v", err)
+		return errorResponse(CodeInternal, "error reading purchase products")
+	}
+
+	response := &ValidatePurchaseResponse{Purchases: make([]*ValidatedPurchaseResult, 0, len(validation.ValidatedPurchases))}
+	for _, purchase := range validation.ValidatedPurchases {
+		result := &ValidatedPurchaseResult{SKU: purchase.ProductId, TransactionID: purchase.TransactionId}
+		response.Purchases = append(response.Purchases, result)
+
+		// SeenBefore is not a grant guard, a retry after a failed grant comes back as seen before too. The grant record
+		// claimed in applyPurchase is what keeps a purchase from being applied twice.
+		premium := battlepass.PremiumSKU != "" && purchase.ProductId == battlepass.PremiumSKU
+		product, ok := products.Products[purchase.ProductId]
+		if !premium && !ok {
+			logger.Error("No product configured for sku %s", purchase.ProductId)
+			continue
+		}
+		granted, err := applyPurchase(ctx, nk, userID, purchase, &battlepass, product)
+		if err != nil {
+			logger.Error("Error granting purchase %s to %s: %v", purchase.TransactionId, userID, err)
+			return errorResponse(CodeInternal, "error granting purchase")
+		}
+		if !granted {
+			continue
+		}
+		result.Granted = true
+		emitEvent(ctx, logger, nk, eventPurchaseValidated, map[string]string{
+			"user_id":        userID,
+			"store":          request.Store,
+			"sku":            purchase.ProductId,
+			"transaction_id": purchase.TransactionId,
+		})
+	}
+
+	if response.Balance, err = readWallet(ctx, nk, userID); err != nil {
+		logger.Error("Error reading wallet: %v", err)
+		return errorResponse(CodeInternal, "error reading wallet")
+	}
+
+	return marshalResponse(response)
+}
+
+type RestoredEntitlement struct {
+	SKU           string           `json:"sku"`
+	TransactionID string           `json:"transaction_id"`
+	Entitlement   string           `json:"entitlement,omitempty"`
+	Items         map[string]int64 `json:"items,omitempty"`
+}
+
+type RestorePurchasesResponse struct {
+	Restored []*RestoredEntitlement `json:"restored"`
+	NoOp     bool                   `json:"no_op"`
+}
+
+// RestorePurchasesRpc re-applies the durable entitlements of the caller's unrefunded validated purchases. Only
+// purchases without a grant record are applied, plus the premium of the running season when the season it was
+// bought for is this one, so items traded away or consumed are never minted again and calling it twice restores
+// nothing.
+func RestorePurchasesRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("RestorePurchases Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var products PurchaseProductsConfig
+	if _, err := readCachedConfig(ctx, nk, purchaseProductsConfigKey, &products); err != nil {
+		logger.Error("Error reading purchase products config: %v", err)
+		return errorResponse(CodeInternal, "error reading purchase products")
+	}
+	var battlepass BattlepassConfig
+	if _, err := readConfig(ctx, nk, battlepassConfigKey, &battlepass); err != nil {
+		logger.Error("Error reading battle pass config: %v", err)
+		return errorResponse(CodeInternal, "error reading purchase products")
+	}
+
+	response := &RestorePurchasesResponse{Restored: make([]*RestoredEntitlement, 0)}
+	cursor := ""
+	for {
+		list, err := nk.PurchasesList(ctx, userID, purchaseRestorePageSize, cursor)
+		if err != nil {
+			logger.Error("Error listing purchases: %v", err)
+			return errorResponse(CodeInternal, "error listing purchases")
+		}
+		for _, purchase := range list.GetValidatedPurchases() {
+			if purchase.GetRefundTime() != nil {
+				continue
+			}
+			restored, err := restorePurchase(ctx, nk, userID, purchase, &battlepass, products.Products[purchase.ProductId])
+			if err != nil {
+				logger.Error("Error restoring purchase %s for %s: %v", purchase.TransactionId, userID, err)
+				return errorResponse(CodeInternal, "error restoring purchases")
+			}
+			if restored != nil {
+				response.Restored = append(response.Restored, restored)
+			}
+		}
+		if list.GetCursor() == "" {
+			break
+		}
+		cursor = list.GetCursor()
+	}
+
+	response.NoOp = len(response.Restored) == 0
+	if !response.NoOp {
+		logger.Info("Restored %d entitlements for %s", len(response.Restored), userID)
+	}
+	return marshalResponse(response)
+}
+
+// restorePurchase returns nil when the purchase grants nothing durable or its entitlement is already in place.
+func restorePurchase(ctx context.Context, nk runtime.NakamaModule, userID string, purchase *api.ValidatedPurchase, battlepass *BattlepassConfig, product *PurchaseProduct) (*RestoredEntitlement, error) {
+	restored := &RestoredEntitlement{SKU: purchase.ProductId, TransactionID: purchase.TransactionId}
+	premium := battlepass.PremiumSKU != "" && purchase.ProductId == battlepass.PremiumSKU
+	if !premium && (product == nil || !product.Durable || len(product.Items) == 0) {
+		return nil, nil
+	}
+
+	grant, err := readPurchaseGrant(ctx, nk, userID, purchase.TransactionId)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil {
+		granted, err := applyPurchase(ctx, nk, userID, purchase, battlepass, product)
+		if err != nil || !granted {
+			return nil, err
+		}
+		if premium {
+			restored.Entitlement = entitlementBattlepassPremium
+		} else {
+			restored.Items = product.Items
+		}
+		return restored, nil
+	}
+	if !premium || grant.SeasonID != battlepass.SeasonID {
+		return nil, nil
+	}
+
+	unlocked := false
+	_, _, err = updateBattlepass(ctx, nk, userID, func(config *BattlepassConfig, progress *BattlepassProgress) error {
+		unlocked = !progress.Premium
+		progress.Premium = true
+		return nil
+	})
+	if err != nil || !unlocked {
+		return nil, err
+	}
+	restored.Entitlement = entitlementBattlepassPremium
+	return restored, nil
+}
+
+// applyPurchase claims the grant record of the purchase before granting it and reports false when it was already
+// applied. The record is dropped again when the grant fails so a retry can apply it.
+func applyPurchase(ctx context.Context, nk runtime.NakamaModule, userID string, purchase *api.ValidatedPurchase, battlepass *BattlepassConfig, product *PurchaseProduct) (bool, error) {
+	premium := battlepass.PremiumSKU != "" && purchase.ProductId == battlepass.PremiumSKU
+	grant := &PurchaseGrant{SKU: purchase.ProductId, GrantedAt: time.Now().UTC().Unix()}
+	if premium {
+		grant.SeasonID = battlepass.SeasonID
+	}
+	claimed, err := claimPurchaseGrant(ctx, nk, userID, purchase.TransactionId, grant)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	if premium {
+		err = unlockBattlepassPremium(ctx, nk, userID)
+	} else {
+		err = grantPurchase(ctx, nk, userID, purchase, product)
+	}
+	if err != nil {
+		if deleteErr := nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: purchaseGrantCollection, Key: purchase.TransactionId, UserID: userID}}); deleteErr != nil {
+			return false, fmt.Errorf("%w, and releasing its grant record: %v", err, deleteErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// claimPurchaseGrant writes the grant record only when it does not exist yet.
+func claimPurchaseGrant(ctx context.Context, nk runtime.NakamaModule, userID, transactionID string, grant *PurchaseGrant) (bool, error) {
+	value, err := json.Marshal(grant)
+	if err != nil {
+		return false, err
+	}
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      purchaseGrantCollection,
+		Key:             transactionID,
+		UserID:          userID,
+		Value:           string(value),
+		Version:         "*",
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	if errors.Is(err, runtime.ErrStorageRejectedVersion) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func readPurchaseGrant(ctx context.Context, nk runtime.NakamaModule, userID, transactionID string) (*PurchaseGrant, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: purchaseGrantCollection, Key: transactionID, UserID: userID}})
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+	grant := &PurchaseGrant{}
+	if err := json.Unmarshal([]byte(objects[0].Value), grant); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+func grantPurchase(ctx context.Context, nk runtime.NakamaModule, userID string, purchase *api.ValidatedPurchase, product *PurchaseProduct) error {
+	metadata := map[string]interface{}{"reason": "purchase", "sku": purchase.ProductId, "transaction_id": purchase.TransactionId}
+	return grantReward(ctx, nk, userID, &Reward{Currency: product.Currency, Items: product.Items}, metadata)
+}
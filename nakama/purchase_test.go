@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+)
+
+func TestRestorePurchasesRpc(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, purchaseProductsConfigKey, &PurchaseProductsConfig{Products: map[string]*PurchaseProduct{
+		"skin_pack": {Items: map[string]int64{"skin": 1}, Durable: true},
+		"gems_100":  {Currency: map[string]int64{"gems": 100}},
+	}})
+	writeTestConfig(t, nk, battlepassConfigKey, &BattlepassConfig{SeasonID: "s1", PremiumSKU: "premium"})
+	writeTestObject(t, nk, itemDefinitionCollection, "skin", "", &ItemDefinition{Name: "Skin"})
+	nk.Purchases = []*api.ValidatedPurchase{
+		{UserId: "u1", ProductId: "skin_pack", TransactionId: "t-skin"},
+		{UserId: "u1", ProductId: "gems_100", TransactionId: "t-gems"},
+		{UserId: "u1", ProductId: "premium", TransactionId: "t-premium"},
+	}
+	ctx := newTestContext("u1")
+	restore := func() *RestorePurchasesResponse {
+		t.Helper()
+		response, err := RestorePurchasesRpc(ctx, logger, nil, nk, "")
+		if err != nil {
+			t.Fatalf("RestorePurchasesRpc: %v", err)
+		}
+		return decodeResponse[RestorePurchasesResponse](t, response)
+	}
+
+	// Nothing was applied yet, the durable pack and the premium are, the consumable gems are not.
+	first := restore()
+	if first.NoOp || len(first.Restored) != 2 {
+		t.Fatalf("first restore = %+v, want the skin pack and premium", first)
+	}
+	if gems := nk.Wallets["u1"]["gems"]; gems != 0 {
+		t.Errorf("gems = %d, consumables must not be restored", gems)
+	}
+
+	// Trading the skin away must not let a restore mint it again.
+	if _, err := consumeInventoryItems(ctx, nk, "u1", map[string]int64{"skin": 1}); err != nil {
+		t.Fatalf("consuming skin: %v", err)
+	}
+	if second := restore(); !second.NoOp {
+		t.Errorf("second restore = %+v, want a no-op", second)
+	}
+	inventory := &Inventory{}
+	readTestObject(t, nk, inventoryCollection, inventoryKey, "u1", inventory)
+	if inventory.Items["skin"] != 0 {
+		t.Errorf("skin = %d after restore, want 0", inventory.Items["skin"])
+	}
+
+	// Premium lost within its own season comes back.
+	if _, _, err := updateBattlepass(ctx, nk, "u1", func(config *BattlepassConfig, progress *BattlepassProgress) error {
+		progress.Premium = false
+		return nil
+	}); err != nil {
+		t.Fatalf("resetting premium: %v", err)
+	}
+	if third := restore(); len(third.Restored) != 1 || third.Restored[0].Entitlement != entitlementBattlepassPremium {
+		t.Errorf("third restore = %+v, want premium back", third)
+	}
+
+	// A purchase for season one does not unlock season two.
+	writeTestConfig(t, nk, battlepassConfigKey, &BattlepassConfig{SeasonID: "s2", PremiumSKU: "premium"})
+	if next := restore(); !next.NoOp {
+		t.Errorf("restore in the next season = %+v, want a no-op", next)
+	}
+	_, progress, err := updateBattlepass(ctx, nk, "u1", func(*BattlepassConfig, *BattlepassProgress) error { return nil })
+	if err != nil {
+		t.Fatalf("reading battle pass: %v", err)
+	}
+	if progress.Premium {
+		t.Error("season two premium unlocked by a season one purchase")
+	}
+}
+
+func TestMigratePurchaseGrants(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, purchaseProductsConfigKey, &PurchaseProductsConfig{Products: map[string]*PurchaseProduct{
+		"skin_pack": {Items: map[string]int64{"skin": 1}, Durable: true},
+	}})
+	writeTestObject(t, nk, itemDefinitionCollection, "skin", "", &ItemDefinition{Name: "Skin"})
+	nk.Purchases = []*api.ValidatedPurchase{{UserId: "u1", ProductId: "skin_pack", TransactionId: "t-skin"}}
+
+	for i := 0; i < 2; i++ {
+		if err := migratePurchaseGrants(newTestContext(""), nk); err != nil {
+			t.Fatalf("migratePurchaseGrants run %d: %v", i, err)
+		}
+	}
+	response, err := RestorePurchasesRpc(newTestContext("u1"), logger, nil, nk, "")
+	if err != nil {
+		t.Fatalf("RestorePurchasesRpc: %v", err)
+	}
+	if restored := decodeResponse[RestorePurchasesResponse](t, response); !restored.NoOp {
+		t.Errorf("restore after backfill = %+v, want a no-op", restored)
+	}
+}
+
+func TestValidatePurchaseRpcRetriesFailedGrant(t *testing.T) {
+	logger, fake := newTestRuntime(t)
+	writeTestConfig(t, fake, purchaseProductsConfigKey, &PurchaseProductsConfig{Products: map[string]*PurchaseProduct{
+		"gems_100": {Currency: map[string]int64{"gems": 100}},
+	}})
+	fake.Receipts["receipt-1"] = &api.ValidatedPurchase{ProductId: "gems_100", TransactionId: "t-gems"}
+	nk := &failingWalletModule{NakamaModule: fake, fail: true}
+	ctx := newTestContext("u1")
+	validate := func() (*ValidatePurchaseResponse, error) {
+		response, err := ValidatePurchaseRpc(ctx, logger, nil, nk, `{"store":"apple","receipt":"receipt-1"}`)
+		if err != nil {
+			return nil, err
+		}
+		return decodeResponse[ValidatePurchaseResponse](t, response), nil
+	}
+
+	if _, err := validate(); errorCode(err) != CodeInternal {
+		t.Fatalf("validation with a failing wallet = %v, want internal", err)
+	}
+	if readTestObject(t, nk, purchaseGrantCollection, "t-gems", "u1", &PurchaseGrant{}) {
+		t.Fatal("grant record kept after the grant failed")
+	}
+
+	// The store now reports the receipt as seen before, the purchase was never granted so it still must be.
+	nk.fail = false
+	retried, err := validate()
+	if err != nil {
+		t.Fatalf("retried validation: %v", err)
+	}
+	if len(retried.Purchases) != 1 || !retried.Purchases[0].Granted || retried.Balance["gems"] != 100 {
+		t.Errorf("retry = %+v, want the gems granted", retried)
+	}
+
+	again, err := validate()
+	if err != nil {
+		t.Fatalf("third validation: %v", err)
+	}
+	if again.Purchases[0].Granted || nk.Wallets["u1"]["gems"] != 100 {
+		t.Errorf("third validation = %+v with %d gems, want no second grant", again.Purchases[0], nk.Wallets["u1"]["gems"])
+	}
+}
+
+func TestValidatePurchaseRpcHidesStoreErrors(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	_, err := ValidatePurchaseRpc(newTestContext("u1"), logger, nil, nk, `{"store":"google","receipt":"forged"}`)
+	if code := errorCode(err); code != CodeInvalidArgument {
+		t.Fatalf("error = %v, want invalid argument", err)
+	}
+	if body := decodeResponse[ErrorResponse](t, err.Error()); body.Message != "invalid receipt" {
+		t.Errorf("message = %q, want the fixed invalid receipt message", body.Message)
+	}
+	if len(logger.Lines["warn"]) != 1 || !strings.Contains(logger.Lines["warn"][0], "store rejected receipt forged") {
+		t.Errorf("warnings = %v, want the store error logged", logger.Lines["warn"])
+	}
+}
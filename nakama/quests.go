@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"mhth.net/matchmaking-server/rng"
+)
+
+const (
+	questPoolConfigKey = "quest_pool"
+	questCollection    = "quests"
+	questDailyKey      = "daily"
+
+	questDefaultDailyCount = 3
+
+	questObjectiveSubmitScore = "submit_score"
+	questObjectiveOpenLootbox = "open_lootbox"
+)
+
+var (
+	errUnknownQuest        = newError(CodeNotFound, "quest not assigned today")
+	errQuestAlreadyClaimed = newError(CodeAlreadyExists, "quest already claimed")
+	errQuestIncomplete     = newError(CodeFailedPrecondition, "quest objective not met")
+)
+
+type QuestDefinition struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Objective string  `json:"objective"`
+	Target    int64   `json:"target"`
+	Reward    *Reward `json:"reward"`
+}
+
+type QuestPoolConfig struct {
+	DailyCount int                `json:"daily_count"`
+	Quests     []*QuestDefinition `json:"quests"`
+}
+
+type Quest struct {
+	*QuestDefinition
+	Progress int64 `json:"progress"`
+	Claimed  bool  `json:"claimed"`
+}
+
+type QuestState struct {
+	Date   string   `json:"date"`
+	Quests []*Quest `json:"quests"`
+}
+
+type ClaimQuestRequest struct {
+	QuestID string `json:"quest_id"`
+}
+
+type QuestsResponse struct {
+	Date    string   `json:"date"`
+	Quests  []*Quest `json:"quests"`
+	Refresh int64    `json:"refresh"`
+}
+
+type ClaimQuestResponse struct {
+	Quest  *Quest  `json:"quest"`
+	Reward *Reward `json:"reward"`
+}
+
+func GetQuestsRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GetQuests Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := updateQuests(ctx, nk, userID, func(*QuestState) error { return nil })
+	if err != nil {
+		logger.Error("Error assigning daily quests: %v", err)
+		return errorResponse(CodeInternal, "error assigning daily quests")
+	}
+	day, _ := time.Parse(time.DateOnly, state.Date)
+	return marshalResponse(&QuestsResponse{Date: state.Date, Quests: state.Quests, Refresh: day.AddDate(0, 0, 1).Unix()})
+}
+
+func ClaimQuestRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ClaimQuest Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[ClaimQuestRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.QuestID == "" {
+		return errorResponse(CodeInvalidArgument, "quest_id is required")
+	}
+
+	var claimed *Quest
+	state, err := updateQuests(ctx, nk, userID, func(state *QuestState) error {
+		claimed = nil
+		for _, quest := range state.Quests {
+			if quest.ID != request.QuestID {
+				continue
+			}
+			if quest.Claimed {
+				return errQuestAlreadyClaimed
+			}
+			if quest.Progress < quest.Target {
+				return errQuestIncomplete
+			}
+			quest.Claimed = true
+			claimed = quest
+			return nil
+		}
+		return errUnknownQuest
+	})
+	if err != nil {
+		var runtimeErr *runtime.Error
+		if errors.As(err, &runtimeErr) {
+			return "", runtimeErr
+		}
+		logger.Error("Error claiming quest: %v", err)
+		return errorResponse(CodeInternal, "error claiming quest")
+	}
+
+	metadata := map[string]interface{}{"reason": "quest", "quest": claimed.ID, "date": state.Date}
+	if err := grantReward(ctx, nk, userID, claimed.Reward, metadata); err != nil {
+		logger.Error("Error granting quest %s reward to %s: %v", claimed.ID, userID, err)
+		_, releaseErr := updateQuests(ctx, nk, userID, func(current *QuestState) error {
+			for _, quest := range current.Quests {
+				if current.Date == state.Date && quest.ID == claimed.ID {
+					quest.Claimed = false
+				}
+			}
+			return nil
+		})
+		if releaseErr != nil {
+			logger.Error("Error releasing quest %s claim of %s: %v", claimed.ID, userID, releaseErr)
+		}
+		return errorResponse(CodeInternal, "error granting quest reward")
+	}
+	if _, err := addBattlepassXP(ctx, nk, userID, battlepassQuestXP); err != nil && !errors.Is(err, errBattlepassNoSeason) {
+		logger.Warn("Error adding battle pass xp for %s: %v", userID, err)
+	}
+
+	return marshalResponse(&ClaimQuestResponse{Quest: claimed, Reward: claimed.Reward})
+}
+
+// progressQuest advances every unclaimed quest assigned today that tracks objective, capped at each target.
+func progressQuest(ctx context.Context, nk runtime.NakamaModule, userID, objective string, delta int64) error {
+	_, err := updateQuests(ctx, nk, userID, func(state *QuestState) error {
+		for _, quest := range state.Quests {
+			if quest.Objective == objective && !quest.Claimed {
+				quest.Progress = max(min(quest.Progress+delta, quest.Target), 0)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// updateQuests applies mutate to today's quests, assigning a fresh set first when the stored day has rolled over.
+func updateQuests(ctx context.Context, nk runtime.NakamaModule, userID string, mutate func(*QuestState) error) (*QuestState, error) {
+	today := utcDay(time.Now()).Format(time.DateOnly)
+	var pool *QuestPoolConfig
+	state := &QuestState{}
+	write := runtime.StorageWrite{
+		Collection:      questCollection,
+		Key:             questDailyKey,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		state = &QuestState{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), state); err != nil {
+				return "", err
+			}
+		}
+		if state.Date != today {
+			if pool == nil {
+				pool = &QuestPoolConfig{}
+				if _, err := readCachedConfig(ctx, nk, questPoolConfigKey, pool); err != nil {
+					return "", err
+				}
+			}
+			state = &QuestState{Date: today, Quests: assignDailyQuests(pool, userID, today)}
+		}
+		if err := mutate(state); err != nil {
+			return "", err
+		}
+		value, err := json.Marshal(state)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// assignDailyQuests picks the same quests for a user and date regardless of how often it is called.
+func assignDailyQuests(pool *QuestPoolConfig, userID, date string) []*Quest {
+	definitions := make([]*QuestDefinition, len(pool.Quests))
+	copy(definitions, pool.Quests)
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].ID < definitions[j].ID })
+
+	rng.New(rng.Seed(userID, date)).Shuffle(len(definitions), func(i, j int) { definitions[i], definitions[j] = definitions[j], definitions[i] })
+
+	count := pool.DailyCount
+	if count <= 0 {
+		count = questDefaultDailyCount
+	}
+	quests := make([]*Quest, 0, count)
+	for _, definition := range definitions[:min(count, len(definitions))] {
+		quests = append(quests, &Quest{QuestDefinition: definition})
+	}
+	return quests
+}
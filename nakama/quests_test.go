@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestClaimQuestRpcReleasesClaimWhenGrantFails(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, questPoolConfigKey, &QuestPoolConfig{DailyCount: 1, Quests: []*QuestDefinition{
+		{ID: "play", Objective: questObjectivePlayMatch, Target: 1, Reward: &Reward{Currency: map[string]int64{"gold": 5}, Items: map[string]int64{"badge": 1}}},
+	}})
+	ctx := newTestContext("u1")
+	if err := progressQuest(ctx, nk, "u1", questObjectivePlayMatch, 1); err != nil {
+		t.Fatalf("progressQuest: %v", err)
+	}
+	claim := `{"quest_id":"play"}`
+
+	if _, err := ClaimQuestRpc(ctx, logger, nil, nk, claim); errorCode(err) != CodeInternal {
+		t.Fatalf("claim of an undefined item = %v, want internal", err)
+	}
+	if got := nk.Wallets["u1"]["gold"]; got != 0 {
+		t.Errorf("gold = %d after the failed grant, want it taken back", got)
+	}
+	state := &QuestState{}
+	readTestObject(t, nk, questCollection, questDailyKey, "u1", state)
+	if state.Quests[0].Claimed {
+		t.Fatal("quest still claimed after the failed grant")
+	}
+
+	defineTestItem(t, nk, "badge", &ItemDefinition{Name: "Badge"})
+	if _, err := ClaimQuestRpc(ctx, logger, nil, nk, claim); err != nil {
+		t.Fatalf("retried claim: %v", err)
+	}
+	if got := nk.Wallets["u1"]["gold"]; got != 5 {
+		t.Errorf("gold = %d, want 5", got)
+	}
+	if _, err := ClaimQuestRpc(ctx, logger, nil, nk, claim); errorCode(err) != CodeAlreadyExists {
+		t.Errorf("second claim = %v, want already exists", err)
+	}
+}
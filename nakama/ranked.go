@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"mhth.net/matchmaking-server/lock"
+)
+
+const (
+	rankedConfigKey         = "ranked"
+	rankedLeaderboard       = "ranked_mmr"
+	rankedCollection        = "ranked"
+	rankedSeasonKey         = "season_"
+	rankedSeasonsCollection = "ranked_seasons"
+	rankedSeasonLockKey     = "ranked_season"
+
+	rankedTiersPerDivision    = 3
+	rankedDefaultCompression  = 0.5
+	rankedSeasonCheckInterval = 5 * time.Minute
+	rankedPageSize            = 100
+)
+
+// RankedDivision starts at MinMMR and runs up to the next division, divisions are listed in ascending MinMMR order.
+type RankedDivision struct {
+	Name   string  `json:"name"`
+	MinMMR int     `json:"min_mmr"`
+	Reward *Reward `json:"reward,omitempty"`
+}
+
+// RankedConfig bounds the running season in unix seconds. Once End passes every ranked player has their final
+// division archived and rewarded, and their MMR pulled towards ratingDefault by Compression.
+type RankedConfig struct {
+	SeasonID    string            `json:"season_id"`
+	Start       int64             `json:"start"`
+	End         int64             `json:"end"`
+	Compression float64           `json:"compression"`
+	Divisions   []*RankedDivision `json:"divisions"`
+}
+
+var defaultRankedDivisions = []*RankedDivision{
+	{Name: "Bronze", MinMMR: 0, Reward: &Reward{Currency: map[string]int64{"coins": 100}}},
+	{Name: "Silver", MinMMR: 900, Reward: &Reward{Currency: map[string]int64{"coins": 250}}},
+	{Name: "Gold", MinMMR: 1100, Reward: &Reward{Currency: map[string]int64{"coins": 500}}},
+	{Name: "Platinum", MinMMR: 1300, Reward: &Reward{Currency: map[string]int64{"coins": 1000}}},
+	{Name: "Diamond", MinMMR: 1500, Reward: &Reward{Currency: map[string]int64{"coins": 2000}}},
+}
+
+// Rank places an MMR inside its division. Tiers count down from rankedTiersPerDivision to 1 as the player climbs,
+// the top division has a single tier and no next threshold.
+type Rank struct {
+	MMR          int     `json:"mmr"`
+	Division     string  `json:"division"`
+	Tier         int     `json:"tier"`
+	NextDivision string  `json:"next_division,omitempty"`
+	NextMMR      int     `json:"next_mmr,omitempty"`
+	Progress     float64 `json:"progress"`
+}
+
+type GetRankResponse struct {
+	*Rank
+	SeasonID    string `json:"season_id"`
+	SeasonStart int64  `json:"season_start"`
+	SeasonEnd   int64  `json:"season_end"`
+}
+
+// RankedSeasonResult is the archived final standing of a player for one season.
+type RankedSeasonResult struct {
+	SeasonID   string  `json:"season_id"`
+	MMR        int     `json:"mmr"`
+	Division   string  `json:"division"`
+	Tier       int     `json:"tier"`
+	NewMMR     int     `json:"new_mmr"`
+	Reward     *Reward `json:"reward,omitempty"`
+	Compressed bool    `json:"compressed"`
+	Rewarded   bool    `json:"rewarded"`
+}
+
+func GetRankRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GetRank Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	config, err := readRankedConfig(ctx, nk)
+	if err != nil {
+		logger.Error("Error reading ranked config: %v", err)
+		return errorResponse(CodeInternal, "error reading ranked config")
+	}
+	rating, err := readRating(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Error reading rating: %v", err)
+		return errorResponse(CodeInternal, "error reading rating")
+	}
+	return marshalResponse(&GetRankResponse{Rank: rankFor(config.Divisions, rating.MMR), SeasonID: config.SeasonID, SeasonStart: config.Start, SeasonEnd: config.End})
+}
+
+// rankFor maps mmr to its division and tier, an mmr below the first division counts as its lowest tier.
+func rankFor(divisions []*RankedDivision, mmr int) *Rank {
+	rank := &Rank{MMR: mmr}
+	if len(divisions) == 0 {
+		return rank
+	}
+	index := 0
+	for i, division := range divisions {
+		if mmr >= division.MinMMR {
+			index = i
+		}
+	}
+	division := divisions[index]
+	rank.Division = division.Name
+	if index == len(divisions)-1 {
+		rank.Tier = 1
+		rank.Progress = 1
+		return rank
+	}
+
+	next := divisions[index+1]
+	width := float64(next.MinMMR-division.MinMMR) / rankedTiersPerDivision
+	step := min(max(int((float64(mmr-division.MinMMR))/width), 0), rankedTiersPerDivision-1)
+	tierStart := division.MinMMR + int(math.Round(float64(step)*width))
+	rank.Tier = rankedTiersPerDivision - step
+	rank.NextDivision = next.Name
+	rank.NextMMR = division.MinMMR + int(math.Round(float64(step+1)*width))
+	if step == rankedTiersPerDivision-1 {
+		rank.NextMMR = next.MinMMR
+	}
+	if rank.NextMMR > tierStart {
+		rank.Progress = min(max(float64(mmr-tierStart)/float64(rank.NextMMR-tierStart), 0), 1)
+	}
+	return rank
+}
+
+// compressMMR pulls mmr towards ratingDefault by factor, 0 keeps it and 1 resets everyone to the default.
+func compressMMR(mmr int, factor float64) int {
+	factor = min(max(factor, 0), 1)
+	return ratingDefault + int(math.Round(float64(mmr-ratingDefault)*(1-factor)))
+}
+
+// updateRank publishes the new mmr on the ranked leaderboard and notifies the player when it moved them into
+// another division.
+func updateRank(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, before, after int) {
+	if _, err := nk.LeaderboardRecordWrite(ctx, rankedLeaderboard, userID, "", int64(after), 0, nil, nil); err != nil {
+		logger.Error("Error writing ranked record for %s: %v", userID, err)
+	}
+
+	config, err := readRankedConfig(ctx, nk)
+	if err != nil {
+		logger.Error("Error reading ranked config: %v", err)
+		return
+	}
+	previous, current := rankFor(config.Divisions, before), rankFor(config.Divisions, after)
+	if previous.Division == current.Division {
+		return
+	}
+	key := msgRankPromoted
+	if after < before {
+		key = msgRankDemoted
+	}
+	content := map[string]interface{}{"from": previous.Division, "to": current.Division, "tier": current.Tier, "mmr": after}
+	if err := sendNotification(ctx, nk, userID, translate(userLocale(ctx, nk, userID), key, current.Division), content, notificationRankChange, notificationPriorityNormal); err != nil {
+		logger.Error("Error notifying %s of rank change: %v", userID, err)
+	}
+}
+
+// startRankedSeasons checks on a fixed interval whether the configured season has ended and closes it once.
+func startRankedSeasons(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	runEvery(ctx, rankedSeasonCheckInterval, func() {
+		config, err := readRankedConfig(ctx, nk)
+		if err != nil {
+			logger.Error("Error reading ranked config: %v", err)
+			return
+		}
+		if config.SeasonID == "" || config.End == 0 || time.Now().UTC().Unix() < config.End {
+			return
+		}
+		held, err := lock.TryLock(ctx, nk, rankedSeasonLockKey, rankedSeasonCheckInterval)
+		if err != nil {
+			logger.Error("Error taking ranked season lock: %v", err)
+			return
+		}
+		if held == nil {
+			return
+		}
+		defer held.Unlock(ctx)
+		if err := endRankedSeason(ctx, logger, nk, config); err != nil {
+			logger.Error("Error ending ranked season %s: %v", config.SeasonID, err)
+		}
+	})
+}
+
+// endRankedSeason archives, compresses and rewards every player on the ranked leaderboard. Each player's archive
+// records which steps are done, so a rerun after a failure or a crash resumes the players left unfinished. The season
+// is only marked ended once every player closed cleanly.
+func endRankedSeason(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, config *RankedConfig) error {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: rankedSeasonsCollection, Key: config.SeasonID}})
+	if err != nil {
+		return err
+	}
+	if len(objects) > 0 {
+		return nil
+	}
+	logger.Info("Ending ranked season %s", config.SeasonID)
+
+	players, failed := 0, 0
+	cursor := ""
+	for {
+		records, _, next, _, err := nk.LeaderboardRecordsList(ctx, rankedLeaderboard, nil, rankedPageSize, cursor, 0)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			closed, err := closeRankedSeason(ctx, logger, nk, config, record.OwnerId)
+			if err != nil {
+				logger.Error("Error closing ranked season %s for %s: %v", config.SeasonID, record.OwnerId, err)
+				failed++
+				continue
+			}
+			if closed {
+				players++
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d players failed to close, the season stays open for the next run", failed)
+	}
+
+	value, err := json.Marshal(map[string]interface{}{"season_id": config.SeasonID, "players": players, "ended_at": time.Now().UTC().Unix()})
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      rankedSeasonsCollection,
+		Key:             config.SeasonID,
+		Value:           string(value),
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	return err
+}
+
+// closeRankedSeason archives the final standing of userID and then compresses and rewards them, skipping the steps the
+// archive already records as done. It reports whether any step was left to do.
+func closeRankedSeason(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, config *RankedConfig, userID string) (bool, error) {
+	rating, err := readRating(ctx, nk, userID)
+	if err != nil {
+		return false, fmt.Errorf("reading rating: %w", err)
+	}
+	result, err := updateRankedSeasonResult(ctx, nk, config.SeasonID, userID, func(result *RankedSeasonResult) error {
+		if result.SeasonID != "" {
+			return nil
+		}
+		rank := rankFor(config.Divisions, rating.MMR)
+		*result = RankedSeasonResult{
+			SeasonID: config.SeasonID,
+			MMR:      rating.MMR,
+			Division: rank.Division,
+			Tier:     rank.Tier,
+			NewMMR:   compressMMR(rating.MMR, config.Compression),
+		}
+		for _, division := range config.Divisions {
+			if division.Name == rank.Division {
+				result.Reward = division.Reward
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("archiving: %w", err)
+	}
+	if result.Compressed && result.Rewarded {
+		return false, nil
+	}
+
+	if !result.Compressed {
+		// the delta is taken from the current mmr, so a compression that went through before a crash adds nothing
+		if _, err := updateRating(ctx, nk, userID, result.NewMMR-rating.MMR, 0); err != nil {
+			return false, fmt.Errorf("compressing rating: %w", err)
+		}
+		if _, err := nk.LeaderboardRecordWrite(ctx, rankedLeaderboard, userID, "", int64(result.NewMMR), 0, nil, nil); err != nil {
+			return false, fmt.Errorf("writing ranked record: %w", err)
+		}
+		if result, err = updateRankedSeasonResult(ctx, nk, config.SeasonID, userID, func(result *RankedSeasonResult) error {
+			result.Compressed = true
+			return nil
+		}); err != nil {
+			return false, fmt.Errorf("marking compressed: %w", err)
+		}
+	}
+
+	if !result.Rewarded {
+		// the reward is claimed on the archive before granting and released again when the grant fails
+		if result, err = updateRankedSeasonResult(ctx, nk, config.SeasonID, userID, func(result *RankedSeasonResult) error {
+			result.Rewarded = true
+			return nil
+		}); err != nil {
+			return false, fmt.Errorf("claiming reward: %w", err)
+		}
+		metadata := map[string]interface{}{"reason": "ranked_season", "season_id": config.SeasonID, "division": result.Division}
+		if err := grantReward(ctx, nk, userID, result.Reward, metadata); err != nil {
+			if _, releaseErr := updateRankedSeasonResult(ctx, nk, config.SeasonID, userID, func(result *RankedSeasonResult) error {
+				result.Rewarded = false
+				return nil
+			}); releaseErr != nil {
+				return false, fmt.Errorf("granting reward: %w, and releasing its claim: %v", err, releaseErr)
+			}
+			return false, fmt.Errorf("granting reward: %w", err)
+		}
+		content := map[string]interface{}{"season_id": config.SeasonID, "division": result.Division, "tier": result.Tier, "reward": result.Reward}
+		subject := translate(userLocale(ctx, nk, userID), msgRankedSeasonEnded, result.Division)
+		if err := sendNotification(ctx, nk, userID, subject, content, notificationRankChange, notificationPriorityLow); err != nil {
+			logger.Error("Error notifying %s of ranked season end: %v", userID, err)
+		}
+	}
+	return true, nil
+}
+
+// updateRankedSeasonResult applies mutate to the archived result of userID for seasonID, which is empty when missing.
+func updateRankedSeasonResult(ctx context.Context, nk runtime.NakamaModule, seasonID, userID string, mutate func(*RankedSeasonResult) error) (*RankedSeasonResult, error) {
+	result := &RankedSeasonResult{}
+	write := runtime.StorageWrite{
+		Collection:      rankedCollection,
+		Key:             rankedSeasonKey + seasonID,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		result = &RankedSeasonResult{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), result); err != nil {
+				return "", err
+			}
+		}
+		if err := mutate(result); err != nil {
+			return "", err
+		}
+		value, err := json.Marshal(result)
+		return string(value), err
+	}, storageWriteAttempts)
+	return result, err
+}
+
+func readRankedConfig(ctx context.Context, nk runtime.NakamaModule) (*RankedConfig, error) {
+	config := &RankedConfig{Compression: rankedDefaultCompression}
+	if _, err := readCachedConfig(ctx, nk, rankedConfigKey, config); err != nil {
+		return nil, err
+	}
+	if len(config.Divisions) == 0 {
+		config.Divisions = defaultRankedDivisions
+	}
+	return config, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import "testing"
+
+func TestRankFor(t *testing.T) {
+	tests := []struct {
+		name string
+		mmr  int
+		want Rank
+	}{
+		{name: "below the first division", mmr: -50, want: Rank{MMR: -50, Division: "Bronze", Tier: 3, NextDivision: "Silver", NextMMR: 300}},
+		{name: "bottom of bronze", mmr: 0, want: Rank{MMR: 0, Division: "Bronze", Tier: 3, NextDivision: "Silver", NextMMR: 300}},
+		{name: "halfway through a tier", mmr: 450, want: Rank{MMR: 450, Division: "Bronze", Tier: 2, NextDivision: "Silver", NextMMR: 600, Progress: 0.5}},
+		{name: "last tier points at the next division", mmr: 750, want: Rank{MMR: 750, Division: "Bronze", Tier: 1, NextDivision: "Silver", NextMMR: 900, Progress: 0.5}},
+		{name: "exactly on a division threshold", mmr: 900, want: Rank{MMR: 900, Division: "Silver", Tier: 3, NextDivision: "Gold", NextMMR: 967}},
+		{name: "tier widths are rounded", mmr: 1000, want: Rank{MMR: 1000, Division: "Silver", Tier: 2, NextDivision: "Gold", NextMMR: 1033, Progress: 0.5}},
+		{name: "top division has a single tier", mmr: 1600, want: Rank{MMR: 1600, Division: "Diamond", Tier: 1, Progress: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rankFor(defaultRankedDivisions, tt.mmr)
+			if *got != tt.want {
+				t.Errorf("rankFor(%d) = %+v, want %+v", tt.mmr, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankForWithoutDivisions(t *testing.T) {
+	if got := rankFor(nil, 1200); *got != (Rank{MMR: 1200}) {
+		t.Errorf("rankFor without divisions = %+v, want the bare mmr", *got)
+	}
+}
+
+func TestCompressMMR(t *testing.T) {
+	tests := []struct {
+		name   string
+		mmr    int
+		factor float64
+		want   int
+	}{
+		{name: "above the default", mmr: 1600, factor: 0.5, want: 1300},
+		{name: "below the default", mmr: 600, factor: 0.5, want: 800},
+		{name: "at the default", mmr: ratingDefault, factor: 0.5, want: ratingDefault},
+		{name: "no compression", mmr: 1600, factor: 0, want: 1600},
+		{name: "full reset", mmr: 1600, factor: 1, want: ratingDefault},
+		{name: "factor above one is clamped", mmr: 1600, factor: 3, want: ratingDefault},
+		{name: "negative factor is clamped", mmr: 1600, factor: -1, want: 1600},
+		{name: "half points round away from the default", mmr: 1003, factor: 0.5, want: 1002},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compressMMR(tt.mmr, tt.factor); got != tt.want {
+				t.Errorf("compressMMR(%d, %v) = %d, want %d", tt.mmr, tt.factor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateRankNotifiesDivisionChanges(t *testing.T) {
+	tests := []struct {
+		name        string
+		before      int
+		after       int
+		wantSubject string
+	}{
+		{name: "promotion", before: 1050, after: 1150, wantSubject: "Promoted to Gold"},
+		{name: "demotion", before: 1120, after: 1080, wantSubject: "Demoted to Silver"},
+		{name: "same division", before: 1110, after: 1290},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			updateRank(newTestContext("u1"), logger, nk, "u1", tt.before, tt.after)
+
+			if score := nk.Leaderboards[rankedLeaderboard]["u1"]; score != int64(tt.after) {
+				t.Errorf("ranked score = %d, want %d", score, tt.after)
+			}
+			sent := nk.NotificationsFor("u1")
+			if tt.wantSubject == "" {
+				if len(sent) != 0 {
+					t.Errorf("sent %d notifications inside one division, want none", len(sent))
+				}
+				return
+			}
+			if len(sent) != 1 || sent[0].Subject != tt.wantSubject || sent[0].Code != notificationRankChange {
+				t.Fatalf("notifications = %+v, want one %q", sent, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestEndRankedSeason(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	ctx := newTestContext("")
+	config := &RankedConfig{SeasonID: "s1", Compression: 0.5, Divisions: defaultRankedDivisions}
+	for userID, mmr := range map[string]int{"diamond": 1600, "bronze": 600, "resumed": 1400, "half": 1400} {
+		writeTestObject(t, nk, ratingCollection, ratingKey, userID, &PlayerRating{MMR: mmr, Games: 20})
+		nk.LeaderboardRecordWrite(ctx, rankedLeaderboard, userID, "", int64(mmr), 0, nil, nil)
+	}
+	// a player a previous run finished must not be paid or compressed again, one it only archived is picked up
+	writeTestObject(t, nk, rankedCollection, rankedSeasonKey+"s1", "resumed", &RankedSeasonResult{SeasonID: "s1", MMR: 1400, Division: "Platinum", NewMMR: 1200, Compressed: true, Rewarded: true})
+	writeTestObject(t, nk, rankedCollection, rankedSeasonKey+"s1", "half", &RankedSeasonResult{SeasonID: "s1", MMR: 1400, Division: "Platinum", NewMMR: 1200, Reward: &Reward{Currency: map[string]int64{"coins": 1000}}})
+
+	for i := 0; i < 2; i++ {
+		if err := endRankedSeason(ctx, logger, nk, config); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+
+	tests := []struct {
+		userID       string
+		wantDivision string
+		wantMMR      int
+		wantCoins    int64
+	}{
+		{userID: "diamond", wantDivision: "Diamond", wantMMR: 1300, wantCoins: 2000},
+		{userID: "bronze", wantDivision: "Bronze", wantMMR: 800, wantCoins: 100},
+		{userID: "resumed", wantDivision: "Platinum", wantMMR: 1400},
+		{userID: "half", wantDivision: "Platinum", wantMMR: 1200, wantCoins: 1000},
+	}
+	for _, tt := range tests {
+		result := &RankedSeasonResult{}
+		readTestObject(t, nk, rankedCollection, rankedSeasonKey+"s1", tt.userID, result)
+		if result.Division != tt.wantDivision || !result.Compressed || !result.Rewarded {
+			t.Errorf("%s archive = %+v, want division %q compressed and rewarded", tt.userID, result, tt.wantDivision)
+		}
+		rating := &PlayerRating{}
+		readTestObject(t, nk, ratingCollection, ratingKey, tt.userID, rating)
+		if rating.MMR != tt.wantMMR || rating.Games != 20 {
+			t.Errorf("%s rating = %+v, want mmr %d over 20 games", tt.userID, rating, tt.wantMMR)
+		}
+		if score := nk.Leaderboards[rankedLeaderboard][tt.userID]; score != int64(tt.wantMMR) {
+			t.Errorf("%s ranked score = %d, want %d", tt.userID, score, tt.wantMMR)
+		}
+		if coins := nk.Wallets[tt.userID]["coins"]; coins != tt.wantCoins {
+			t.Errorf("%s coins = %d, want %d", tt.userID, coins, tt.wantCoins)
+		}
+	}
+
+	season := map[string]interface{}{}
+	if !readTestObject(t, nk, rankedSeasonsCollection, "s1", "", &season) {
+		t.Fatal("season was not marked as ended")
+	}
+	if season["players"] != float64(3) {
+		t.Errorf("season closed %v players, want 3", season["players"])
+	}
+}
+
+func TestEndRankedSeasonStaysOpenUntilEveryPlayerCloses(t *testing.T) {
+	logger, fake := newTestRuntime(t)
+	nk := &failingWalletModule{NakamaModule: fake, fail: true}
+	ctx := newTestContext("")
+	config := &RankedConfig{SeasonID: "s1", Compression: 0.5, Divisions: defaultRankedDivisions}
+	writeTestObject(t, nk, ratingCollection, ratingKey, "u1", &PlayerRating{MMR: 1600, Games: 20})
+	nk.LeaderboardRecordWrite(ctx, rankedLeaderboard, "u1", "", 1600, 0, nil, nil)
+
+	if err := endRankedSeason(ctx, logger, nk, config); err == nil {
+		t.Fatal("run with a failing wallet succeeded")
+	}
+	if readTestObject(t, nk, rankedSeasonsCollection, "s1", "", &map[string]interface{}{}) {
+		t.Fatal("season was marked as ended with a player left unrewarded")
+	}
+	result := &RankedSeasonResult{}
+	if !readTestObject(t, nk, rankedCollection, rankedSeasonKey+"s1", "u1", result) || !result.Compressed || result.Rewarded {
+		t.Fatalf("archive = %+v, want compressed with the reward claim released", result)
+	}
+
+	nk.fail = false
+	if err := endRankedSeason(ctx, logger, nk, config); err != nil {
+		t.Fatalf("rerun: %v", err)
+	}
+	rating := &PlayerRating{}
+	readTestObject(t, nk, ratingCollection, ratingKey, "u1", rating)
+	if rating.MMR != 1300 {
+		t.Errorf("mmr = %d, want 1300 compressed once", rating.MMR)
+	}
+	if coins := fake.Wallets["u1"]["coins"]; coins != 2000 {
+		t.Errorf("coins = %d, want 2000", coins)
+	}
+	if !readTestObject(t, nk, rankedSeasonsCollection, "s1", "", &map[string]interface{}{}) {
+		t.Error("season was not marked as ended after the rerun")
+	}
+}
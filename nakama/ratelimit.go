@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	rateLimitWindow           = time.Minute
+	rateLimitDefaultPerMinute = 60
+)
+
+type rpcFunc = func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error)
+
+// rpcRateLimits overrides the per minute call budget of an RPC, 0 disables the limit.
+var rpcRateLimits = map[string]int{
+	rpcHealthcheck:       0,
+	rpcReadiness:         0,
+	rpcCreateProfile:     5,
+	rpcCreateHordeMatch:  10,
+	rpcSubmitScore:       30,
+	rpcSpendCurrency:     30,
+	rpcValidatePurchase:  10,
+	rpcClaimDailyReward:  10,
+	rpcCreateGuild:       5,
+	rpcJoinGuild:         10,
+	rpcUpdateGuildMotd:   10,
+	rpcLeaveGuild:        10,
+	rpcRedeemReferral:    5,
+	rpcCreateTicket:      5,
+	rpcRestorePurchases:  5,
+	rpcReportMatchResult: 10,
+}
+
+var rpcRateLimiter = newRateLimiter(rateLimitWindow)
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	window    time.Duration
+	calls     map[string][]time.Time
+	lastSweep time.Time
+}
+
+func newRateLimiter(window time.Duration) *rateLimiter {
+	return &rateLimiter{window: window, calls: make(map[string][]time.Time)}
+}
+
+func rateLimitFor(id string) int {
+	if limit, ok := rpcRateLimits[id]; ok {
+		return limit
+	}
+	return rateLimitDefaultPerMinute
+}
+
+// withRateLimit counts calls per user in a sliding window, server to server calls are never limited.
+func withRateLimit(name string, perMinute int, fn rpcFunc) rpcFunc {
+	if perMinute <= 0 {
+		return fn
+	}
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID == "" {
+			return fn(ctx, logger, db, nk, payload)
+		}
+		if ok, retryAfter := rpcRateLimiter.allow(name+":"+userID, perMinute, time.Now()); !ok {
+			seconds := int64(math.Ceil(retryAfter.Seconds()))
+			logger.Warn("Rate limit exceeded for rpc %s by user %s", name, userID)
+			err := newErrorf(CodeResourceExhausted, "rate limit exceeded, Retry-After: %s", strconv.FormatInt(seconds, 10))
+			return err.Message, err
+		}
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
+
+// allow records a call for key when it fits the limit, otherwise it returns how long until the oldest call leaves the window.
+func (r *rateLimiter) allow(key string, limit int, now time.Time) (bool, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.lastSweep) > r.window {
+		for k, calls := range r.calls {
+			if len(calls) == 0 || now.Sub(calls[len(calls)-1]) > r.window {
+				delete(r.calls, k)
+			}
+		}
+		r.lastSweep = now
+	}
+
+	calls := r.calls[key]
+	cutoff := now.Add(-r.window)
+	start := 0
+	for start < len(calls) && !calls[start].After(cutoff) {
+		start++
+	}
+	calls = calls[start:]
+
+	if len(calls) >= limit {
+		r.calls[key] = calls
+		return false, calls[0].Sub(cutoff)
+	}
+	r.calls[key] = append(calls, now)
+	return true, 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func TestRateLimiterSlidingWindow(t *testing.T) {
+	limiter := newRateLimiter(time.Minute)
+	start := time.Unix(1700000000, 0)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("rpc:u1", 3, start.Add(time.Duration(i)*10*time.Second)); !ok {
+			t.Fatalf("call %d refused inside the limit", i)
+		}
+	}
+	ok, retryAfter := limiter.allow("rpc:u1", 3, start.Add(30*time.Second))
+	if ok || retryAfter != 30*time.Second {
+		t.Errorf("fourth call = %v, retry after %v, want refused for 30s", ok, retryAfter)
+	}
+	if ok, _ := limiter.allow("rpc:u2", 3, start.Add(30*time.Second)); !ok {
+		t.Error("another user shares the first user's budget")
+	}
+
+	// a refused call is not counted, once the first call leaves the window one more fits
+	if ok, _ := limiter.allow("rpc:u1", 3, start.Add(time.Minute+time.Second)); !ok {
+		t.Error("call refused after the oldest one left the window")
+	}
+	if ok, retryAfter := limiter.allow("rpc:u1", 3, start.Add(time.Minute+2*time.Second)); ok || retryAfter != 8*time.Second {
+		t.Errorf("call = %v, retry after %v, want refused until the second call leaves", ok, retryAfter)
+	}
+}
+
+func TestRateLimiterSweepsIdleKeys(t *testing.T) {
+	limiter := newRateLimiter(time.Minute)
+	start := time.Unix(1700000000, 0)
+	limiter.allow("rpc:idle", 5, start)
+	limiter.allow("rpc:busy", 5, start.Add(2*time.Minute))
+
+	if _, ok := limiter.calls["rpc:idle"]; ok {
+		t.Error("idle key kept after the sweep")
+	}
+	if len(limiter.calls["rpc:busy"]) != 1 {
+		t.Errorf("busy key = %v, want its call kept", limiter.calls["rpc:busy"])
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	calls := 0
+	handler := withRateLimit("limited", 2, func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+		calls++
+		return "{}", nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := handler(newTestContext("u1"), logger, nil, nk, ""); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	_, err := handler(newTestContext("u1"), logger, nil, nk, "")
+	if code := errorCode(err); code != CodeResourceExhausted {
+		t.Fatalf("third call = %v, want resource exhausted", err)
+	}
+	if body := decodeResponse[ErrorResponse](t, err.Error()); !strings.Contains(body.Message, "Retry-After: 60") {
+		t.Errorf("message = %q, want a Retry-After hint", body.Message)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := handler(newTestContext(""), logger, nil, nk, ""); err != nil {
+			t.Errorf("server call %d limited: %v", i, err)
+		}
+	}
+	if calls != 5 {
+		t.Errorf("handler ran %d times, want 5", calls)
+	}
+}
+
+func TestRateLimitFor(t *testing.T) {
+	if got := rateLimitFor(rpcCreateProfile); got != 5 {
+		t.Errorf("create profile limit = %d, want 5", got)
+	}
+	if got := rateLimitFor("not_configured"); got != rateLimitDefaultPerMinute {
+		t.Errorf("default limit = %d, want %d", got, rateLimitDefaultPerMinute)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	ratingCollection = "ratings"
+	ratingKey        = "mmr"
+
+	ratingDefault          = 1000
+	ratingKFactor          = 32.0
+	ratingPlacementKFactor = 64.0
+	ratingPlacementGames   = 10
+
+	matchmakerPropertyMMR  = "mmr"
+	matchmakerMMRBracket   = 200
+	matchmakerAddMessageID = "MatchmakerAdd"
+)
+
+type PlayerRating struct {
+	MMR   int `json:"mmr"`
+	Games int `json:"games"`
+}
+
+type ReportResultRequest struct {
+	WinnerID string `json:"winner_id"`
+	LoserID  string `json:"loser_id"`
+}
+
+type ReportResultResponse struct {
+	Winner *PlayerRating `json:"winner"`
+	Loser  *PlayerRating `json:"loser"`
+}
+
+// UpdateElo returns the new winner and loser ratings, the loser drops by exactly what the winner gains.
+func UpdateElo(winner, loser int, k float64) (int, int) {
+	delta := int(math.Round(k * (1 - eloExpected(winner, loser))))
+	return winner + delta, loser - delta
+}
+
+// eloExpected is the chance the winner was given to beat the loser.
+func eloExpected(winner, loser int) float64 {
+	return 1 / (1 + math.Pow(10, float64(loser-winner)/400))
+}
+
+// ReportResultRpc is registered admin only, match results must come from an authoritative source.
+func ReportResultRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ReportResult Called - Payload: `%s`", payload)
+	request, err := parsePayload[ReportResultRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.WinnerID == "" || request.LoserID == "" || request.WinnerID == request.LoserID {
+		return errorResponse(CodeInvalidArgument, "distinct winner_id and loser_id are required")
+	}
+
+	winner, loser, err := recordMatchResult(ctx, logger, nk, request.WinnerID, request.LoserID)
+	if err != nil {
+		logger.Error("Error updating ratings: %v", err)
+		return errorResponse(CodeInternal, "error updating ratings")
+	}
+	return marshalResponse(&ReportResultResponse{Winner: winner, Loser: loser})
+}
+
+// recordMatchResult applies one game to both ratings, players still in placement move with the higher K factor.
+func recordMatchResult(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, winnerID, loserID string) (*PlayerRating, *PlayerRating, error) {
+	ratings, err := rateMatch(ctx, logger, nk, []string{winnerID}, []string{loserID})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ratings[winnerID], ratings[loserID], nil
+}
+
+// rateMatch counts one game for every winner and loser, each moving by the average of its Elo changes against the
+// players on the other side. All changes are computed from the ratings before the match, so a player's change does
+// not depend on how many opponents there were or the order they are rated in.
+func rateMatch(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, winnerIDs, loserIDs []string) (map[string]*PlayerRating, error) {
+	ratings := make(map[string]*PlayerRating, len(winnerIDs)+len(loserIDs))
+	if len(winnerIDs) == 0 || len(loserIDs) == 0 {
+		return ratings, nil
+	}
+	before := make(map[string]*PlayerRating, len(winnerIDs)+len(loserIDs))
+	for _, userID := range append(slices.Clone(winnerIDs), loserIDs...) {
+		rating, err := readRating(ctx, nk, userID)
+		if err != nil {
+			return nil, err
+		}
+		before[userID] = rating
+	}
+
+	deltas := make(map[string]float64, len(before))
+	for _, winnerID := range winnerIDs {
+		for _, loserID := range loserIDs {
+			winner, loser := before[winnerID], before[loserID]
+			gain := 1 - eloExpected(winner.MMR, loser.MMR)
+			deltas[winnerID] += ratingK(winner) * gain / float64(len(loserIDs))
+			deltas[loserID] -= ratingK(loser) * gain / float64(len(winnerIDs))
+		}
+	}
+	for userID, delta := range deltas {
+		rating, err := updateRating(ctx, nk, userID, int(math.Round(delta)), 1)
+		if err != nil {
+			return nil, err
+		}
+		updateRank(ctx, logger, nk, userID, before[userID].MMR, rating.MMR)
+		ratings[userID] = rating
+	}
+	return ratings, nil
+}
+
+func ratingK(rating *PlayerRating) float64 {
+	if rating.Games < ratingPlacementGames {
+		return ratingPlacementKFactor
+	}
+	return ratingKFactor
+}
+
+// updateRating applies the change as a delta so a concurrent result for the same player is not lost, games is
+// how many played games the change accounts for.
+func updateRating(ctx context.Context, nk runtime.NakamaModule, userID string, delta, games int) (*PlayerRating, error) {
+	rating := &PlayerRating{}
+	write := runtime.StorageWrite{
+		Collection:      ratingCollection,
+		Key:             ratingKey,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		rating = &PlayerRating{MMR: ratingDefault}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), rating); err != nil {
+				return "", err
+			}
+		}
+		rating.MMR = max(rating.MMR+delta, 0)
+		rating.Games += games
+		value, err := json.Marshal(rating)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return rating, nil
+}
+
+func readRating(ctx context.Context, nk runtime.NakamaModule, userID string) (*PlayerRating, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: ratingCollection, Key: ratingKey, UserID: userID}})
+	if err != nil {
+		return nil, err
+	}
+	rating := &PlayerRating{MMR: ratingDefault}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].Value), rating); err != nil {
+			return nil, err
+		}
+	}
+	return rating, nil
+}
+
+// bracketMatchmakerQuery adds an MMR range around mmr to query unless it already filters on it.
+func bracketMatchmakerQuery(query string, mmr int) string {
+	property := "properties." + matchmakerPropertyMMR
+	if strings.Contains(query, property) {
+		return query
+	}
+	bracket := fmt.Sprintf("+%s:>=%d +%s:<=%d", property, mmr-matchmakerMMRBracket, property, mmr+matchmakerMMRBracket)
+	if query == "" || query == "*" {
+		return bracket
+	}
+	return query + " " + bracket
+}
+
+// BeforeMatchmakerAdd stamps the caller's MMR onto the ticket and brackets the query around it unless the client already
+// filters on it. The match start energy cost is charged for the ticket, a ticket that is removed or expires keeps it.
+func BeforeMatchmakerAdd(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *rtapi.Envelope) (*rtapi.Envelope, error) {
+	add := in.GetMatchmakerAdd()
+	if add == nil {
+		return in, nil
+	}
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rating, err := readRating(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Error reading rating for matchmaker ticket: %v", err)
+		return nil, newError(CodeInternal, "error reading rating")
+	}
+
+	if add.NumericProperties == nil {
+		add.NumericProperties = make(map[string]float64)
+	}
+	add.NumericProperties[matchmakerPropertyMMR] = float64(rating.MMR)
+
+	add.Query = bracketMatchmakerQuery(add.Query, rating.MMR)
+
+	// energy is charged in MatchmakerMatched, a ticket that is cancelled or expires costs nothing
+	if err := checkEnergy(ctx, nk, userID, energyActionCreateHordeMatch); err != nil {
+		return nil, runtimeError(logger, err, "reading energy")
+	}
+	return in, nil
+}
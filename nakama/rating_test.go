@@ -0,0 +1,167 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUpdateEloIsSymmetric(t *testing.T) {
+	tests := []struct {
+		name       string
+		winner     int
+		loser      int
+		k          float64
+		wantWinner int
+		wantLoser  int
+	}{
+		{name: "even match", winner: 1000, loser: 1000, k: 32, wantWinner: 1016, wantLoser: 984},
+		{name: "favourite wins", winner: 1400, loser: 1000, k: 32, wantWinner: 1403, wantLoser: 997},
+		{name: "upset", winner: 1000, loser: 1400, k: 32, wantWinner: 1029, wantLoser: 1371},
+		{name: "placement k", winner: 1000, loser: 1000, k: 64, wantWinner: 1032, wantLoser: 968},
+		{name: "no k", winner: 1200, loser: 1100, k: 0, wantWinner: 1200, wantLoser: 1100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			winner, loser := UpdateElo(tt.winner, tt.loser, tt.k)
+			if winner != tt.wantWinner || loser != tt.wantLoser {
+				t.Errorf("UpdateElo = %d, %d, want %d, %d", winner, loser, tt.wantWinner, tt.wantLoser)
+			}
+			if winner-tt.winner != tt.loser-loser {
+				t.Errorf("winner gained %d but loser lost %d", winner-tt.winner, tt.loser-loser)
+			}
+		})
+	}
+}
+
+func TestUpdateEloMirrorsTheUpset(t *testing.T) {
+	favourite, underdog := UpdateElo(1300, 1100, ratingKFactor)
+	upsetWinner, upsetLoser := UpdateElo(1100, 1300, ratingKFactor)
+	if gain, upset := favourite-1300, upsetWinner-1100; gain+upset != int(ratingKFactor) {
+		t.Errorf("favourite gains %d and underdog %d, want them to add up to k", gain, upset)
+	}
+	if underdog-1100 != -(favourite-1300) || upsetLoser-1300 != -(upsetWinner-1100) {
+		t.Error("losses do not mirror the gains")
+	}
+}
+
+func TestRateMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		winners []string
+		losers  []string
+		want    map[string]int
+	}{
+		{name: "one on one", winners: []string{"a"}, losers: []string{"b"}, want: map[string]int{"a": 1032, "b": 968}},
+		{name: "two on two moves each player one game", winners: []string{"a", "b"}, losers: []string{"c", "d"}, want: map[string]int{"a": 1032, "b": 1032, "c": 968, "d": 968}},
+		{name: "free for all winner", winners: []string{"a"}, losers: []string{"b", "c", "d"}, want: map[string]int{"a": 1032, "b": 968, "c": 968, "d": 968}},
+		{name: "no losers rates nobody", winners: []string{"a", "b"}, want: map[string]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			ratings, err := rateMatch(newTestContext(""), logger, nk, tt.winners, tt.losers)
+			if err != nil {
+				t.Fatalf("rateMatch: %v", err)
+			}
+			if len(ratings) != len(tt.want) {
+				t.Fatalf("rated %d players, want %d", len(ratings), len(tt.want))
+			}
+			for userID, want := range tt.want {
+				if ratings[userID].MMR != want || ratings[userID].Games != 1 {
+					t.Errorf("%s = %+v, want mmr %d after one game", userID, ratings[userID], want)
+				}
+			}
+		})
+	}
+}
+
+// The order opponents are rated in must not change anyone's result.
+func TestRateMatchUsesRatingsBeforeTheMatch(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestObject(t, nk, ratingCollection, ratingKey, "a", &PlayerRating{MMR: 1200, Games: 20})
+	writeTestObject(t, nk, ratingCollection, ratingKey, "b", &PlayerRating{MMR: 1000, Games: 20})
+	writeTestObject(t, nk, ratingCollection, ratingKey, "c", &PlayerRating{MMR: 1400, Games: 20})
+
+	ratings, err := rateMatch(newTestContext(""), logger, nk, []string{"a"}, []string{"b", "c"})
+	if err != nil {
+		t.Fatalf("rateMatch: %v", err)
+	}
+	// Against b (1000) a gains 8, against c (1400) 24, the average of the two is 16.
+	if got := ratings["a"].MMR; got != 1216 {
+		t.Errorf("a = %d, want 1216", got)
+	}
+	if got := ratings["b"].MMR; got != 992 {
+		t.Errorf("b = %d, want 992", got)
+	}
+	if got := ratings["c"].MMR; got != 1376 {
+		t.Errorf("c = %d, want 1376", got)
+	}
+}
+
+func TestRateMatchPlacementMovesFaster(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestObject(t, nk, ratingCollection, ratingKey, "veteran", &PlayerRating{MMR: 1000, Games: ratingPlacementGames})
+
+	ratings, err := rateMatch(newTestContext(""), logger, nk, []string{"newcomer"}, []string{"veteran"})
+	if err != nil {
+		t.Fatalf("rateMatch: %v", err)
+	}
+	if got := ratings["newcomer"].MMR; got != 1032 {
+		t.Errorf("newcomer = %d, want 1032 with the placement k", got)
+	}
+	if got := ratings["veteran"]; got.MMR != 984 || got.Games != ratingPlacementGames+1 {
+		t.Errorf("veteran = %+v, want 984 with the regular k", got)
+	}
+}
+
+func TestReportResultRpc(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		wantCode int
+	}{
+		{name: "records the result", payload: `{"winner_id":"a","loser_id":"b"}`},
+		{name: "missing loser", payload: `{"winner_id":"a"}`, wantCode: CodeInvalidArgument},
+		{name: "same player", payload: `{"winner_id":"a","loser_id":"a"}`, wantCode: CodeInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			response, err := ReportResultRpc(newTestContext(""), logger, nil, nk, tt.payload)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			if tt.wantCode != 0 {
+				return
+			}
+			result := decodeResponse[ReportResultResponse](t, response)
+			if result.Winner.MMR != 1032 || result.Loser.MMR != 968 {
+				t.Errorf("result = %+v, %+v, want 1032 and 968", result.Winner, result.Loser)
+			}
+			stored := &PlayerRating{}
+			readTestObject(t, nk, ratingCollection, ratingKey, "b", stored)
+			if stored.MMR != 968 || stored.Games != 1 {
+				t.Errorf("stored loser = %+v, want 968 after one game", stored)
+			}
+		})
+	}
+}
+
+func TestBracketMatchmakerQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "wildcard", query: "*", want: "+properties.mmr:>=800 +properties.mmr:<=1200"},
+		{name: "empty", want: "+properties.mmr:>=800 +properties.mmr:<=1200"},
+		{name: "appended", query: "+properties.region:eu", want: "+properties.region:eu +properties.mmr:>=800 +properties.mmr:<=1200"},
+		{name: "client bracket kept", query: "+properties.mmr:>=0", want: "+properties.mmr:>=0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bracketMatchmakerQuery(tt.query, 1000); got != tt.want {
+				t.Errorf("bracketMatchmakerQuery = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"runtime/debug"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const metricRPCPanics = "rpc_panics_total"
+
+// withRecovery turns a panic in fn into a plain internal error, logging the stack with the rpc name and caller so it
+// can be traced back while the client only sees a generic message.
+func withRecovery(name string, fn rpcFunc) rpcFunc {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (response string, err error) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+			logger.Error("Panic in rpc %s called by %s: %v\n%s", name, userID, recovered, debug.Stack())
+			nk.MetricsCounterAdd(metricRPCPanics, map[string]string{"rpc": name}, 1)
+			response, err = errorResponse(CodeInternal, "internal error")
+		}()
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
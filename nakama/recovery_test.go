@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func TestWithRecoveryTurnsPanicsIntoInternalErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler rpcFunc
+		secret  string
+	}{
+		{name: "panic with a string", secret: "wallet ledger corrupt", handler: func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+			panic("wallet ledger corrupt")
+		}},
+		{name: "panic with an error", secret: "db password rejected", handler: func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+			panic(errors.New("db password rejected"))
+		}},
+		{name: "runtime error", secret: "nil map", handler: func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+			var counts map[string]int
+			counts["calls"]++
+			return "", nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+
+			response, err := withRecovery("explode", tt.handler)(newTestContext("u1"), logger, nil, nk, "{}")
+			if code := errorCode(err); code != CodeInternal {
+				t.Fatalf("error = %v, want code %d", err, CodeInternal)
+			}
+			body := decodeResponse[ErrorResponse](t, err.Error())
+			if body.Message != "internal error" || response != err.Error() {
+				t.Errorf("response = %q, error = %q, want a generic internal error", response, err.Error())
+			}
+			if strings.Contains(err.Error(), tt.secret) {
+				t.Errorf("error %q leaks the panic value", err.Error())
+			}
+
+			lines := logger.Lines["error"]
+			if len(lines) != 1 {
+				t.Fatalf("logged %d errors, want 1", len(lines))
+			}
+			for _, want := range []string{"explode", "u1", tt.secret, "recovery_test.go"} {
+				if !strings.Contains(lines[0], want) {
+					t.Errorf("log line does not mention %q:\n%s", want, lines[0])
+				}
+			}
+			if nk.Counters[metricRPCPanics] != 1 {
+				t.Errorf("%s = %d, want 1", metricRPCPanics, nk.Counters[metricRPCPanics])
+			}
+		})
+	}
+}
+
+func TestWithRecoveryPassesResultsThrough(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	wantErr := newError(CodeNotFound, "missing")
+	calls := 0
+	handler := withRecovery("plain", func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		calls++
+		if payload == "fail" {
+			return "", wantErr
+		}
+		return `{"ok":true}`, nil
+	})
+
+	if response, err := handler(newTestContext("u1"), logger, nil, nk, ""); err != nil || response != `{"ok":true}` {
+		t.Errorf("response = %q, %v, want the handler's response", response, err)
+	}
+	if _, err := handler(newTestContext("u1"), logger, nil, nk, "fail"); err != wantErr {
+		t.Errorf("error = %v, want the handler's error", err)
+	}
+	if calls != 2 || len(logger.Lines["error"]) != 0 || nk.Counters[metricRPCPanics] != 0 {
+		t.Errorf("calls = %d, error lines = %v, panics = %d", calls, logger.Lines["error"], nk.Counters[metricRPCPanics])
+	}
+}
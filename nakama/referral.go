@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	referralConfigKey      = "referrals"
+	referralCodeCollection = "referral_codes"
+	referralCollection     = "referrals"
+	referralKey            = "state"
+
+	referralCodeLength        = 8
+	referralCodeAlphabet      = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	referralCodeAttempts      = 5
+	referralDefaultMaxRewards = 10
+	referralDefaultWindowDays = 7
+)
+
+var (
+	errReferralUnknownCode = newError(CodeNotFound, "referral code not found")
+	errReferralSelf        = newError(CodeInvalidArgument, "cannot redeem your own referral code")
+	errReferralRedeemed    = newError(CodeAlreadyExists, "a referral code was already redeemed")
+	errReferralTooLate     = newError(CodeFailedPrecondition, "referral codes can only be redeemed by new players")
+)
+
+// ReferralConfig sets the rewards for both sides, MaxRewarded caps how many referrals pay out to one referrer.
+type ReferralConfig struct {
+	NewPlayerReward *Reward `json:"new_player_reward"`
+	ReferrerReward  *Reward `json:"referrer_reward"`
+	MaxRewarded     int     `json:"max_rewarded"`
+	WindowDays      int     `json:"window_days"`
+}
+
+type ReferralCode struct {
+	UserID string `json:"user_id"`
+}
+
+type ReferralState struct {
+	Code       string `json:"code"`
+	ReferredBy string `json:"referred_by,omitempty"`
+	RedeemedAt int64  `json:"redeemed_at,omitempty"`
+	Referrals  int    `json:"referrals"`
+	Rewarded   int    `json:"rewarded"`
+}
+
+type RedeemReferralRequest struct {
+	Code string `json:"code"`
+}
+
+type ReferralCodeResponse struct {
+	Code      string `json:"code"`
+	Referrals int    `json:"referrals"`
+	Rewarded  int    `json:"rewarded"`
+}
+
+type RedeemReferralResponse struct {
+	ReferrerID string  `json:"referrer_id"`
+	Reward     *Reward `json:"reward"`
+}
+
+// GetReferralCodeRpc hands back the caller's code, generating and reserving one on the first request.
+func GetReferralCodeRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GetReferralCode Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := readReferralState(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Error reading referral state: %v", err)
+		return errorResponse(CodeInternal, "error reading referral code")
+	}
+	if state.Code == "" {
+		if state, err = assignReferralCode(ctx, nk, userID); err != nil {
+			logger.Error("Error assigning referral code: %v", err)
+			return errorResponse(CodeInternal, "error generating referral code")
+		}
+	}
+	return marshalResponse(&ReferralCodeResponse{Code: state.Code, Referrals: state.Referrals, Rewarded: state.Rewarded})
+}
+
+func RedeemReferralRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("RedeemReferral Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[RedeemReferralRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToUpper(strings.TrimSpace(request.Code))
+	if code == "" {
+		return errorResponse(CodeInvalidArgument, "code is required")
+	}
+
+	config := &ReferralConfig{MaxRewarded: referralDefaultMaxRewards, WindowDays: referralDefaultWindowDays}
+	if _, err := readConfig(ctx, nk, referralConfigKey, config); err != nil {
+		logger.Error("Error reading referral config: %v", err)
+		return errorResponse(CodeInternal, "error redeeming referral")
+	}
+
+	referrerID, err := referralCodeOwner(ctx, nk, code)
+	if err != nil {
+		return "", runtimeError(logger, err, "redeeming referral")
+	}
+	if referrerID == userID {
+		return "", errReferralSelf
+	}
+
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		logger.Error("Error reading account: %v", err)
+		return errorResponse(CodeInternal, "error redeeming referral")
+	}
+	createdAt := account.GetUser().GetCreateTime().AsTime()
+	if config.WindowDays > 0 && time.Since(createdAt) > time.Duration(config.WindowDays)*24*time.Hour {
+		return "", errReferralTooLate
+	}
+
+	now := time.Now().UTC().Unix()
+	if _, err := updateReferralState(ctx, nk, userID, func(state *ReferralState) error {
+		if state.ReferredBy != "" {
+			return errReferralRedeemed
+		}
+		state.ReferredBy = referrerID
+		state.RedeemedAt = now
+		return nil
+	}); err != nil {
+		return "", runtimeError(logger, err, "redeeming referral")
+	}
+
+	metadata := map[string]interface{}{"reason": "referral", "referrer_id": referrerID, "referred_id": userID}
+	if err := grantReward(ctx, nk, userID, config.NewPlayerReward, metadata); err != nil {
+		logger.Error("Error granting referral reward to %s: %v", userID, err)
+		return errorResponse(CodeInternal, "error granting referral reward")
+	}
+	content := map[string]interface{}{"referrer_id": referrerID, "reward": config.NewPlayerReward}
+	if err := sendNotification(ctx, nk, userID, translate(localeFromContext(ctx), msgReferralReward), content, notificationReferral, notificationPriorityNormal); err != nil {
+		logger.Warn("Error notifying %s of referral reward: %v", userID, err)
+	}
+
+	rewarded := false
+	if _, err := updateReferralState(ctx, nk, referrerID, func(state *ReferralState) error {
+		state.Referrals++
+		rewarded = config.MaxRewarded <= 0 || state.Rewarded < config.MaxRewarded
+		if rewarded {
+			state.Rewarded++
+		}
+		return nil
+	}); err != nil {
+		logger.Error("Error counting referral for %s: %v", referrerID, err)
+		return marshalResponse(&RedeemReferralResponse{ReferrerID: referrerID, Reward: config.NewPlayerReward})
+	}
+	if rewarded {
+		if err := grantReward(ctx, nk, referrerID, config.ReferrerReward, metadata); err != nil {
+			logger.Error("Error granting referral reward to %s: %v", referrerID, err)
+		} else {
+			content := map[string]interface{}{"referred_id": userID, "reward": config.ReferrerReward}
+			if err := sendNotification(ctx, nk, referrerID, translate(userLocale(ctx, nk, referrerID), msgReferralJoined), content, notificationReferral, notificationPriorityLow); err != nil {
+				logger.Warn("Error notifying %s of referral reward: %v", referrerID, err)
+			}
+		}
+	} else {
+		logger.Info("Referrer %s reached the referral reward cap", referrerID)
+	}
+
+	return marshalResponse(&RedeemReferralResponse{ReferrerID: referrerID, Reward: config.NewPlayerReward})
+}
+
+// assignReferralCode reserves a fresh code with a create only write, retrying on the unlikely collision.
+func assignReferralCode(ctx context.Context, nk runtime.NakamaModule, userID string) (*ReferralState, error) {
+	value, err := json.Marshal(&ReferralCode{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	code := ""
+	for attempt := 0; attempt < referralCodeAttempts && code == ""; attempt++ {
+		candidate, err := newReferralCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+			Collection:      referralCodeCollection,
+			Key:             candidate,
+			Value:           string(value),
+			Version:         "*",
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		}})
+		if errors.Is(err, runtime.ErrStorageRejectedVersion) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		code = candidate
+	}
+	if code == "" {
+		return nil, errors.New("no free referral code found")
+	}
+
+	state, err := updateReferralState(ctx, nk, userID, func(state *ReferralState) error {
+		if state.Code == "" {
+			state.Code = code
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if state.Code != code {
+		// A concurrent request assigned a code first, release the one reserved here.
+		_ = nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: referralCodeCollection, Key: code}})
+	}
+	return state, nil
+}
+
+func newReferralCode() (string, error) {
+	buf := make([]byte, referralCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = referralCodeAlphabet[int(b)%len(referralCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+func referralCodeOwner(ctx context.Context, nk runtime.NakamaModule, code string) (string, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: referralCodeCollection, Key: code}})
+	if err != nil {
+		return "", err
+	}
+	if len(objects) == 0 {
+		return "", errReferralUnknownCode
+	}
+	owner := &ReferralCode{}
+	if err := json.Unmarshal([]byte(objects[0].Value), owner); err != nil {
+		return "", err
+	}
+	users, err := nk.UsersGetId(ctx, []string{owner.UserID}, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(users) == 0 {
+		return "", errReferralUnknownCode
+	}
+	return owner.UserID, nil
+}
+
+func updateReferralState(ctx context.Context, nk runtime.NakamaModule, userID string, mutate func(*ReferralState) error) (*ReferralState, error) {
+	state := &ReferralState{}
+	write := runtime.StorageWrite{
+		Collection:      referralCollection,
+		Key:             referralKey,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		state = &ReferralState{}
+		if current != "" {
+			if err := json.Unmarshal([]byte(current), state); err != nil {
+				return "", err
+			}
+		}
+		if err := mutate(state); err != nil {
+			return "", err
+		}
+		value, err := json.Marshal(state)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func readReferralState(ctx context.Context, nk runtime.NakamaModule, userID string) (*ReferralState, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: referralCollection, Key: referralKey, UserID: userID}})
+	if err != nil {
+		return nil, err
+	}
+	state := &ReferralState{}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].Value), state); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+func newTestReferralRuntime(t *testing.T, maxRewarded int) (*testutil.Logger, *testutil.NakamaModule) {
+	t.Helper()
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, referralConfigKey, &ReferralConfig{
+		NewPlayerReward: &Reward{Currency: map[string]int64{"gold": 10}},
+		ReferrerReward:  &Reward{Currency: map[string]int64{"gold": 25}},
+		MaxRewarded:     maxRewarded,
+	})
+	nk.AddUser("referrer", "rin")
+	nk.AddUser("other", "sol")
+	return logger, nk
+}
+
+func testReferralCode(t *testing.T, logger *testutil.Logger, nk *testutil.NakamaModule, userID string) string {
+	t.Helper()
+	response, err := GetReferralCodeRpc(newTestContext(userID), logger, nil, nk, "")
+	if err != nil {
+		t.Fatalf("GetReferralCodeRpc: %v", err)
+	}
+	return decodeResponse[ReferralCodeResponse](t, response).Code
+}
+
+func redeemTestReferral(logger *testutil.Logger, nk *testutil.NakamaModule, userID, code string) error {
+	_, err := RedeemReferralRpc(newTestContext(userID), logger, nil, nk, fmt.Sprintf(`{"code":%q}`, code))
+	return err
+}
+
+func TestGetReferralCodeRpcIsStable(t *testing.T) {
+	logger, nk := newTestReferralRuntime(t, 0)
+	code := testReferralCode(t, logger, nk, "referrer")
+	if len(code) != referralCodeLength {
+		t.Errorf("code = %q, want %d characters", code, referralCodeLength)
+	}
+	if again := testReferralCode(t, logger, nk, "referrer"); again != code {
+		t.Errorf("second code = %q, want %q", again, code)
+	}
+	if other := testReferralCode(t, logger, nk, "other"); other == code {
+		t.Errorf("two players share code %q", code)
+	}
+}
+
+func TestRedeemReferralRpc(t *testing.T) {
+	logger, nk := newTestReferralRuntime(t, 0)
+	code := testReferralCode(t, logger, nk, "referrer")
+
+	if err := redeemTestReferral(logger, nk, "newcomer", " "+strings.ToLower(code)+" "); err != nil {
+		t.Fatalf("RedeemReferralRpc: %v", err)
+	}
+	if nk.Wallets["newcomer"]["gold"] != 10 || nk.Wallets["referrer"]["gold"] != 25 {
+		t.Errorf("gold = %d / %d, want 10 for the new player and 25 for the referrer", nk.Wallets["newcomer"]["gold"], nk.Wallets["referrer"]["gold"])
+	}
+	if len(nk.NotificationsFor("newcomer")) != 1 || len(nk.NotificationsFor("referrer")) != 1 {
+		t.Error("want one reward notification for each side")
+	}
+}
+
+func TestRedeemReferralRpcRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		redeem   func(t *testing.T, logger *testutil.Logger, nk *testutil.NakamaModule, code string) error
+		wantCode int
+	}{
+		{name: "self referral", wantCode: CodeInvalidArgument, redeem: func(t *testing.T, logger *testutil.Logger, nk *testutil.NakamaModule, code string) error {
+			return redeemTestReferral(logger, nk, "referrer", code)
+		}},
+		{name: "unknown code", wantCode: CodeNotFound, redeem: func(t *testing.T, logger *testutil.Logger, nk *testutil.NakamaModule, code string) error {
+			return redeemTestReferral(logger, nk, "newcomer", "NOPE2345")
+		}},
+		{name: "reused by the same player", wantCode: CodeAlreadyExists, redeem: func(t *testing.T, logger *testutil.Logger, nk *testutil.NakamaModule, code string) error {
+			if err := redeemTestReferral(logger, nk, "newcomer", code); err != nil {
+				t.Fatalf("first redeem: %v", err)
+			}
+			return redeemTestReferral(logger, nk, "newcomer", testReferralCode(t, logger, nk, "other"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestReferralRuntime(t, 0)
+			code := testReferralCode(t, logger, nk, "referrer")
+			if err := tt.redeem(t, logger, nk, code); errorCode(err) != tt.wantCode {
+				t.Errorf("redeem = %v, want code %d", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRedeemReferralRpcOnlyNewPlayers(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	writeTestConfig(t, nk, referralConfigKey, &ReferralConfig{WindowDays: 7})
+	nk.AddUser("referrer", "rin")
+	code := testReferralCode(t, logger, nk, "referrer")
+	nk.Users["veteran"] = &api.User{Id: "veteran", CreateTime: timestamppb.New(timestamppb.Now().AsTime().AddDate(0, 0, -30))}
+	nk.Users["newcomer"] = &api.User{Id: "newcomer", CreateTime: timestamppb.Now()}
+
+	if err := redeemTestReferral(logger, nk, "veteran", code); errorCode(err) != CodeFailedPrecondition {
+		t.Errorf("veteran redeem = %v, want failed precondition", err)
+	}
+	if err := redeemTestReferral(logger, nk, "newcomer", code); err != nil {
+		t.Errorf("newcomer redeem = %v, want it inside the window", err)
+	}
+}
+
+func TestRedeemReferralRpcCapsReferrerRewards(t *testing.T) {
+	logger, nk := newTestReferralRuntime(t, 2)
+	code := testReferralCode(t, logger, nk, "referrer")
+
+	for i := 0; i < 3; i++ {
+		if err := redeemTestReferral(logger, nk, fmt.Sprintf("newcomer-%d", i), code); err != nil {
+			t.Fatalf("redeem %d: %v", i, err)
+		}
+	}
+	if got := nk.Wallets["newcomer-2"]["gold"]; got != 10 {
+		t.Errorf("new player past the cap got %d gold, want their own reward", got)
+	}
+	if got := nk.Wallets["referrer"]["gold"]; got != 50 {
+		t.Errorf("referrer gold = %d, want two capped rewards", got)
+	}
+	response, err := GetReferralCodeRpc(newTestContext("referrer"), logger, nil, nk, "")
+	if err != nil {
+		t.Fatalf("GetReferralCodeRpc: %v", err)
+	}
+	if state := decodeResponse[ReferralCodeResponse](t, response); state.Referrals != 3 || state.Rewarded != 2 {
+		t.Errorf("referral counts = %+v, want 3 referrals and 2 rewarded", state)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+type Reward struct {
+	Currency map[string]int64 `json:"currency,omitempty"`
+	Items    map[string]int64 `json:"items,omitempty"`
+}
+
+// grantReward credits the currency with metadata on the ledger and then stacks the items onto the inventory. Currency
+// credited before the items fail is taken back, so a failed grant leaves nothing behind and the claim can be retried.
+// Items past their max stack are dropped, see grantRewardOverflow for a grant that must not lose them.
+func grantReward(ctx context.Context, nk runtime.NakamaModule, userID string, reward *Reward, metadata map[string]interface{}) error {
+	_, err := grantRewardOverflow(ctx, nk, userID, reward, metadata)
+	return err
+}
+
+// grantRewardOverflow is grantReward returning the item counts that did not fit under their max stack.
+func grantRewardOverflow(ctx context.Context, nk runtime.NakamaModule, userID string, reward *Reward, metadata map[string]interface{}) (map[string]int64, error) {
+	if reward == nil {
+		return nil, nil
+	}
+	if len(reward.Currency) > 0 {
+		if _, _, err := nk.WalletUpdate(ctx, userID, reward.Currency, metadata, true); err != nil {
+			return nil, err
+		}
+	}
+	if len(reward.Items) == 0 {
+		return nil, nil
+	}
+	_, applied, err := addInventoryItems(ctx, nk, userID, reward.Items)
+	if err != nil {
+		if len(reward.Currency) > 0 {
+			changeset := make(map[string]int64, len(reward.Currency))
+			for currency, amount := range reward.Currency {
+				changeset[currency] = -amount
+			}
+			if _, _, revertErr := nk.WalletUpdate(ctx, userID, changeset, metadata, true); revertErr != nil {
+				return nil, errors.Join(err, revertErr)
+			}
+		}
+		return nil, err
+	}
+	overflow := make(map[string]int64)
+	for itemID, count := range reward.Items {
+		if left := count - applied[itemID]; left > 0 {
+			overflow[itemID] = left
+		}
+	}
+	return overflow, nil
+}
+
+// takeReward removes the currency and items from the user, failing with errInsufficientFunds or errInsufficientItems
+// when they are short. Currency taken before an item shortfall is refunded so the user is never left half charged.
+func takeReward(ctx context.Context, nk runtime.NakamaModule, userID string, reward *Reward, metadata map[string]interface{}) error {
+	if reward == nil {
+		return nil
+	}
+	if len(reward.Currency) > 0 {
+		changeset := make(map[string]int64, len(reward.Currency))
+		for currency, amount := range reward.Currency {
+			changeset[currency] = -amount
+		}
+		if _, _, err := nk.WalletUpdate(ctx, userID, changeset, metadata, true); err != nil {
+			var negativeErr *runtime.WalletNegativeError
+			if errors.As(err, &negativeErr) {
+				return errInsufficientFunds
+			}
+			return err
+		}
+	}
+	if len(reward.Items) == 0 {
+		return nil
+	}
+	if _, err := consumeInventoryItems(ctx, nk, userID, reward.Items); err != nil {
+		if len(reward.Currency) > 0 {
+			if _, _, refundErr := nk.WalletUpdate(ctx, userID, reward.Currency, metadata, true); refundErr != nil {
+				return errors.Join(err, refundErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Package rng provides seeded random sources for outcomes that must be reproducible, such as lootbox rolls and
+// daily quest picks. Every Rand owns its source, so rolls never depend on global state or on other requests.
+package rng
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"strings"
+)
+
+// Rand is not safe for concurrent use, create one per roll or per match.
+type Rand struct {
+	r *rand.Rand
+}
+
+func New(seed int64) *Rand {
+	return &Rand{r: rand.New(rand.NewSource(seed))}
+}
+
+// Seed derives a seed from stable inputs such as a user id, a date and a nonce. The same parts always give the
+// same seed, so support can replay an outcome from what was logged.
+func Seed(parts ...string) int64 {
+	sum := sha256.Sum256([]byte(strings.Join(parts, ":")))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}
+
+// Weighted picks an index with probability proportional to its weight, negative weights count as 0. It returns -1
+// without consuming randomness when no weight is positive.
+func (r *Rand) Weighted(weights []int) int {
+	total := 0
+	for _, weight := range weights {
+		total += max(weight, 0)
+	}
+	if total <= 0 {
+		return -1
+	}
+	pick := r.r.Intn(total)
+	for i, weight := range weights {
+		weight = max(weight, 0)
+		if pick < weight {
+			return i
+		}
+		pick -= weight
+	}
+	return len(weights) - 1
+}
+
+func (r *Rand) Shuffle(n int, swap func(i, j int)) {
+	r.r.Shuffle(n, swap)
+}
+
+// IntRange returns a number in [lo, hi], lo when the range is empty.
+func (r *Rand) IntRange(lo, hi int) int {
+	if hi <= lo {
+		return lo
+	}
+	return lo + r.r.Intn(hi-lo+1)
+}
+
+func (r *Rand) Float64() float64 {
+	return r.r.Float64()
+}
@@ -0,0 +1,95 @@
+package rng
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestSameSeedSameSequence(t *testing.T) {
+	a, b := New(42), New(42)
+	for i := 0; i < 100; i++ {
+		if x, y := a.IntRange(0, 1000), b.IntRange(0, 1000); x != y {
+			t.Fatalf("draw %d: %d != %d", i, x, y)
+		}
+		if x, y := a.Weighted([]int{1, 2, 3}), b.Weighted([]int{1, 2, 3}); x != y {
+			t.Fatalf("weighted draw %d: %d != %d", i, x, y)
+		}
+	}
+
+	first, second := []int{1, 2, 3, 4, 5, 6, 7, 8}, []int{1, 2, 3, 4, 5, 6, 7, 8}
+	a.Shuffle(len(first), func(i, j int) { first[i], first[j] = first[j], first[i] })
+	b.Shuffle(len(second), func(i, j int) { second[i], second[j] = second[j], second[i] })
+	if !slices.Equal(first, second) {
+		t.Errorf("shuffles differ: %v and %v", first, second)
+	}
+}
+
+func TestDifferentSeedsDiverge(t *testing.T) {
+	a, b := New(1), New(2)
+	for i := 0; i < 20; i++ {
+		if a.IntRange(0, math.MaxInt32) != b.IntRange(0, math.MaxInt32) {
+			return
+		}
+	}
+	t.Error("seeds 1 and 2 gave the same 20 draws")
+}
+
+func TestSeed(t *testing.T) {
+	if Seed("u1", "2026-01-01", "0") != Seed("u1", "2026-01-01", "0") {
+		t.Error("the same parts gave different seeds")
+	}
+	if Seed("u1", "2026-01-01", "0") == Seed("u1", "2026-01-02", "0") {
+		t.Error("different dates gave the same seed")
+	}
+}
+
+func TestWeightedDistribution(t *testing.T) {
+	weights := []int{1, 0, 3, -5, 6}
+	r := New(7)
+	counts := make([]int, len(weights))
+	const samples = 100000
+	for i := 0; i < samples; i++ {
+		counts[r.Weighted(weights)]++
+	}
+
+	for i, want := range []float64{0.1, 0, 0.3, 0, 0.6} {
+		got := float64(counts[i]) / samples
+		if math.Abs(got-want) > 0.01 {
+			t.Errorf("index %d drawn %.3f of the time, want %.3f", i, got, want)
+		}
+	}
+}
+
+func TestWeightedWithoutPositiveWeights(t *testing.T) {
+	for _, weights := range [][]int{nil, {}, {0, 0}, {-1, 0}} {
+		r := New(3)
+		if got := r.Weighted(weights); got != -1 {
+			t.Errorf("Weighted(%v) = %d, want -1", weights, got)
+		}
+		if r.IntRange(0, 1000) != New(3).IntRange(0, 1000) {
+			t.Errorf("Weighted(%v) consumed randomness", weights)
+		}
+	}
+}
+
+func TestIntRange(t *testing.T) {
+	r := New(11)
+	seen := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		n := r.IntRange(-2, 2)
+		if n < -2 || n > 2 {
+			t.Fatalf("IntRange(-2, 2) = %d", n)
+		}
+		seen[n] = true
+	}
+	if len(seen) != 5 {
+		t.Errorf("IntRange(-2, 2) only drew %v", seen)
+	}
+	if got := r.IntRange(5, 5); got != 5 {
+		t.Errorf("IntRange(5, 5) = %d, want 5", got)
+	}
+	if got := r.IntRange(5, 1); got != 5 {
+		t.Errorf("IntRange(5, 1) = %d, want lo", got)
+	}
+}
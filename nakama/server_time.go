@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	dailyResetSchedule = "0 0 * * *"
+)
+
+type ServerTimeResponse struct {
+	Now             int64  `json:"now"`
+	TZ              string `json:"tz"`
+	NextDailyReset  int64  `json:"next_daily_reset"`
+	NextWeeklyReset int64  `json:"next_weekly_reset"`
+}
+
+// ServerTimeRpc needs no user context, reset boundaries come from the same cron expressions the server schedules with.
+func ServerTimeRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	now := time.Now().UTC()
+	response := &ServerTimeResponse{Now: now.UnixMilli(), TZ: "UTC"}
+
+	nextDaily, err := nk.CronNext(dailyResetSchedule, now.Unix())
+	if err != nil {
+		logger.Error("Error computing next daily reset: %v", err)
+		return errorResponse(CodeInternal, "error computing reset times")
+	}
+	nextWeekly, err := nk.CronNext(tournamentWeeklySchedule, now.Unix())
+	if err != nil {
+		logger.Error("Error computing next weekly reset: %v", err)
+		return errorResponse(CodeInternal, "error computing reset times")
+	}
+	response.NextDailyReset = nextDaily * 1000
+	response.NextWeeklyReset = nextWeekly * 1000
+	return marshalResponse(response)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Derived session vars land in the runtime.RUNTIME_CTX_VARS map[string]string of RPCs and realtime hooks called by
+// the session, and of match handlers for matches it creates. They are computed at login and kept on session refresh.
+const (
+	sessionVarVIPTier  = "vip_tier"
+	sessionVarGuildID  = "guild_id"
+	sessionVarSeasonID = "season_id"
+
+	vipConfigKey        = "vip"
+	vipPurchasePageLen  = 100
+	sessionGroupPageLen = 100
+)
+
+// VIPConfig lists the validated purchase counts needed for each VIP tier, in increasing order.
+type VIPConfig struct {
+	Thresholds []int `json:"thresholds"`
+}
+
+// enrichSessionVars is shared by every authentication variant. Session vars are sealed into the token when it is
+// issued, so it runs from the before authentication hooks. An empty userID is the first login of a new account and
+// gets the defaults, errors are logged and never block the login. The derived keys are always overwritten so a
+// client cannot send its own.
+func enrichSessionVars(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, vars map[string]string) map[string]string {
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	vars[sessionVarVIPTier] = "0"
+	vars[sessionVarGuildID] = ""
+
+	var battlepass BattlepassConfig
+	if _, err := readConfig(ctx, nk, battlepassConfigKey, &battlepass); err != nil {
+		logger.Warn("Error reading active season for session vars: %v", err)
+	}
+	vars[sessionVarSeasonID] = battlepass.SeasonID
+
+	if userID == "" {
+		return vars
+	}
+
+	tier, err := vipTier(ctx, nk, userID)
+	if err != nil {
+		logger.Warn("Error computing VIP tier for %s: %v", userID, err)
+	}
+	vars[sessionVarVIPTier] = strconv.Itoa(tier)
+
+	groups, _, err := nk.UserGroupsList(ctx, userID, sessionGroupPageLen, nil, "")
+	if err != nil {
+		logger.Warn("Error listing guild for %s: %v", userID, err)
+	}
+	for _, group := range groups {
+		if group.GetState().GetValue() <= guildStateMember {
+			vars[sessionVarGuildID] = group.GetGroup().GetId()
+			break
+		}
+	}
+	return vars
+}
+
+func vipTier(ctx context.Context, nk runtime.NakamaModule, userID string) (int, error) {
+	var config VIPConfig
+	if _, err := readConfig(ctx, nk, vipConfigKey, &config); err != nil || len(config.Thresholds) == 0 {
+		return 0, err
+	}
+	target := config.Thresholds[len(config.Thresholds)-1]
+
+	purchases := 0
+	cursor := ""
+	for purchases < target {
+		list, err := nk.PurchasesList(ctx, userID, vipPurchasePageLen, cursor)
+		if err != nil {
+			return 0, err
+		}
+		for _, purchase := range list.GetValidatedPurchases() {
+			if purchase.GetRefundTime() == nil {
+				purchases++
+			}
+		}
+		if list.GetCursor() == "" {
+			break
+		}
+		cursor = list.GetCursor()
+	}
+
+	tier := 0
+	for _, threshold := range config.Thresholds {
+		if purchases < threshold {
+			break
+		}
+		tier++
+	}
+	return tier, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	shutdownDrainTimeout   = 5 * time.Second
+	shutdownMatchListLimit = 1000
+)
+
+// Shutdown stops the background jobs and asks every horde match on this node to persist its snapshot and warn
+// its players, waiting at most shutdownDrainTimeout for the matches to finish their writes.
+func Shutdown(stopBackground context.CancelFunc) func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) {
+		logger.Info("Shutting down module MHTH")
+		stopBackground()
+
+		matches, err := nk.MatchList(ctx, shutdownMatchListLimit, true, "", nil, nil, "+label.mode:"+hordeModuleName)
+		if err != nil {
+			logger.Error("Error listing matches on shutdown: %v", err)
+			return
+		}
+
+		drainCtx, cancel := context.WithTimeout(ctx, shutdownDrainTimeout)
+		defer cancel()
+		var wg sync.WaitGroup
+		for _, match := range matches {
+			wg.Add(1)
+			go func(matchID string) {
+				defer wg.Done()
+				if _, err := nk.MatchSignal(drainCtx, matchID, hordeSignalShutdown); err != nil {
+					logger.Error("Error draining match %s: %v", matchID, err)
+				}
+			}(match.MatchId)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			logger.Info("Drained %d matches", len(matches))
+		case <-drainCtx.Done():
+			logger.Warn("Drain window of %s elapsed before all %d matches finished", shutdownDrainTimeout, len(matches))
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+func TestShutdownPersistsActiveMatches(t *testing.T) {
+	logger, fake := newTestRuntime(t)
+	nk := newHordeMatchModule(t, fake, map[string]interface{}{"user_ids": []string{"u1", "u2"}})
+	state := nk.state.(*HordeMatchState)
+	for _, userID := range []string{"u1", "u2"} {
+		addTestHordePlayer(state, userID)
+	}
+	state.players["u1"].x = 12
+	state.wave = 3
+	nk.tick = 900
+
+	stopped := false
+	Shutdown(func() { stopped = true })(newTestContext(""), logger, nil, nk)
+
+	if !stopped {
+		t.Error("background jobs still running after shutdown")
+	}
+	snapshot := &HordeSnapshot{}
+	if !readTestObject(t, fake, hordeSnapshotCollection, testHordeMatchID, "", snapshot) {
+		t.Fatal("no snapshot persisted for the active match")
+	}
+	if snapshot.MatchID != testHordeMatchID || snapshot.Tick != 900 || snapshot.Wave != 3 || len(snapshot.Players) != 2 {
+		t.Errorf("snapshot = %+v, want the match at tick 900 on wave 3 with both players", snapshot)
+	}
+	for _, userID := range []string{"u1", "u2"} {
+		notifications := fake.NotificationsFor(userID)
+		if len(notifications) != 1 || notifications[0].Code != notificationMatchEnding {
+			t.Errorf("%s notifications = %v, want one match ending notice", userID, notifications)
+		}
+	}
+}
+
+func TestDrainForShutdownSkipsDisconnectedPlayers(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	state := newTestHordeState(t, "u1", "u2")
+	ctx := context.WithValue(newTestContext(""), runtime.RUNTIME_CTX_MATCH_ID, testHordeMatchID)
+	addTestHordePlayer(state, "u1")
+	state.players["u2"] = &HordePlayer{presence: &testutil.Presence{UserID: "u2"}, disconnected: true}
+
+	drainForShutdown(ctx, logger, nk, 10, state)
+	if len(nk.NotificationsFor("u1")) != 1 || len(nk.NotificationsFor("u2")) != 0 {
+		t.Errorf("notified u1 %d and u2 %d times, want only the connected player", len(nk.NotificationsFor("u1")), len(nk.NotificationsFor("u2")))
+	}
+}
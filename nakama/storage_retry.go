@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	storageWriteAttempts = 5
+	storageRetryBackoff  = 10 * time.Millisecond
+)
+
+var errStorageConflict = newError(CodeAborted, "storage changed concurrently, retry")
+
+// writeWithRetry reads the record targeted by write, passes its value to mutate (empty when missing) and
+// writes the result guarded by the version it read. Version conflicts are retried with a linear backoff,
+// any error returned by mutate aborts immediately. It returns the value that was written.
+func writeWithRetry(ctx context.Context, nk runtime.NakamaModule, write runtime.StorageWrite, mutate func(current string) (string, error), attempts int) (string, error) {
+	for attempt := 1; attempt <= attempts; attempt++ {
+		objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: write.Collection, Key: write.Key, UserID: write.UserID}})
+		if err != nil {
+			return "", err
+		}
+		current := ""
+		write.Version = "*"
+		if len(objects) > 0 {
+			current = objects[0].Value
+			write.Version = objects[0].Version
+		}
+
+		if write.Value, err = mutate(current); err != nil {
+			return "", err
+		}
+
+		_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{&write})
+		if err == nil {
+			return write.Value, nil
+		}
+		if !errors.Is(err, runtime.ErrStorageRejectedVersion) {
+			return "", err
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Duration(attempt) * storageRetryBackoff):
+		}
+	}
+	return "", errStorageConflict
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+// conflictingModule lands a concurrent write just before each of the first conflicts writes, so they fail the version check.
+type conflictingModule struct {
+	*testutil.NakamaModule
+	conflicts int
+	writes    int
+}
+
+func (m *conflictingModule) StorageWrite(ctx context.Context, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error) {
+	m.writes++
+	if m.writes <= m.conflicts {
+		concurrent := *writes[0]
+		concurrent.Version = ""
+		concurrent.Value = `"concurrent ` + strconv.Itoa(m.writes) + `"`
+		if _, err := m.NakamaModule.StorageWrite(ctx, []*runtime.StorageWrite{&concurrent}); err != nil {
+			return nil, err
+		}
+	}
+	return m.NakamaModule.StorageWrite(ctx, writes)
+}
+
+func TestWriteWithRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		conflicts  int
+		wantErr    error
+		wantWrites int
+		wantValue  string
+	}{
+		{name: "no conflict", wantWrites: 1, wantValue: "seed+1"},
+		{name: "retries onto the concurrent value", conflicts: 2, wantWrites: 3, wantValue: "concurrent 2+1"},
+		{name: "gives up after the attempts", conflicts: 5, wantErr: errStorageConflict, wantWrites: 3, wantValue: "concurrent 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, fake := newTestRuntime(t)
+			nk := &conflictingModule{NakamaModule: fake, conflicts: tt.conflicts}
+			writeTestObject(t, fake, "counters", "c", "u1", "seed")
+			write := runtime.StorageWrite{Collection: "counters", Key: "c", UserID: "u1"}
+
+			_, err := writeWithRetry(newTestContext(""), nk, write, func(current string) (string, error) {
+				return current[:len(current)-1] + `+1"`, nil
+			}, 3)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("writeWithRetry = %v, want %v", err, tt.wantErr)
+			}
+			if nk.writes != tt.wantWrites {
+				t.Errorf("wrote %d times, want %d", nk.writes, tt.wantWrites)
+			}
+			var stored string
+			readTestObject(t, fake, "counters", "c", "u1", &stored)
+			if stored != tt.wantValue {
+				t.Errorf("stored %q, want %q", stored, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestWriteWithRetryConflictIsAborted(t *testing.T) {
+	if code := errorCode(errStorageConflict); code != CodeAborted {
+		t.Errorf("conflict code = %d, want aborted", code)
+	}
+}
+
+func TestWriteWithRetryMutateErrorWritesNothing(t *testing.T) {
+	_, fake := newTestRuntime(t)
+	nk := &conflictingModule{NakamaModule: fake}
+	errRefused := errors.New("refused")
+	write := runtime.StorageWrite{Collection: "counters", Key: "c", UserID: "u1"}
+
+	var seen *string
+	_, err := writeWithRetry(newTestContext(""), nk, write, func(current string) (string, error) {
+		seen = &current
+		return "", errRefused
+	}, 3)
+	if !errors.Is(err, errRefused) {
+		t.Fatalf("writeWithRetry = %v, want the mutate error", err)
+	}
+	if seen == nil || *seen != "" {
+		t.Errorf("mutate saw %v, want an empty value for a missing record", seen)
+	}
+	if nk.writes != 0 {
+		t.Errorf("wrote %d times after mutate failed, want none", nk.writes)
+	}
+}
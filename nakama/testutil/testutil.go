@@ -0,0 +1,632 @@
+// Package testutil provides in-memory fakes of the Nakama runtime so handlers can be exercised without a server.
+// Only storage, accounts, purchases, wallets, notifications, leaderboard writes and listings, match creation, streams,
+// events and metrics are implemented, any other NakamaModule method panics.
+package testutil
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// NewContext returns the context Nakama passes to an RPC called by userID's session, "" is a server to server call.
+func NewContext(userID string, vars map[string]string) context.Context {
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_ENV, map[string]string{})
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_MODE, "rpc")
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_NODE, "test")
+	if userID == "" {
+		return ctx
+	}
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_USER_ID, userID)
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_USERNAME, "user_"+userID)
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_VARS, vars)
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_SESSION_ID, "session_"+userID)
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_CLIENT_IP, "127.0.0.1")
+	return ctx
+}
+
+// Logger records every formatted line by level.
+type Logger struct {
+	mu     sync.Mutex
+	fields map[string]interface{}
+	Lines  map[string][]string
+}
+
+func NewLogger() *Logger {
+	return &Logger{fields: make(map[string]interface{}), Lines: make(map[string][]string)}
+}
+
+func (l *Logger) Debug(format string, v ...interface{}) { l.log("debug", format, v...) }
+func (l *Logger) Info(format string, v ...interface{})  { l.log("info", format, v...) }
+func (l *Logger) Warn(format string, v ...interface{})  { l.log("warn", format, v...) }
+func (l *Logger) Error(format string, v ...interface{}) { l.log("error", format, v...) }
+
+func (l *Logger) WithField(key string, v interface{}) runtime.Logger {
+	return l.WithFields(map[string]interface{}{key: v})
+}
+
+// WithFields returns a logger sharing the recorded lines of l.
+func (l *Logger) WithFields(fields map[string]interface{}) runtime.Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	merged := maps.Clone(l.fields)
+	maps.Copy(merged, fields)
+	return &Logger{fields: merged, Lines: l.Lines}
+}
+
+func (l *Logger) Fields() map[string]interface{} {
+	return l.fields
+}
+
+func (l *Logger) log(level, format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Lines[level] = append(l.Lines[level], fmt.Sprintf(format, v...))
+}
+
+type streamID struct {
+	mode       uint8
+	subject    string
+	subcontext string
+	label      string
+}
+
+type storageID struct {
+	collection string
+	key        string
+	userID     string
+}
+
+// NakamaModule keeps storage, wallets and sent notifications in memory. Versions follow Nakama's rules: "*" only
+// creates, any other non-empty version must match the stored one.
+type NakamaModule struct {
+	runtime.NakamaModule
+
+	mu            sync.Mutex
+	version       int
+	objects       map[storageID]*api.StorageObject
+	Users         map[string]*api.User
+	Banned        map[string]bool
+	LoggedOut     []string
+	Wallets       map[string]map[string]int64
+	Ledger        map[string][]*LedgerItem
+	Purchases     []*api.ValidatedPurchase
+	Receipts      map[string]*api.ValidatedPurchase
+	Notifications []*runtime.NotificationSend
+	Leaderboards  map[string]map[string]int64
+	Matches       map[string]map[string]interface{}
+	Streams       []*StreamMessage
+	Events        []*api.Event
+	Counters      map[string]int64
+	presences     map[streamID][]*Presence
+}
+
+// StreamMessage is a message sent with StreamSend.
+type StreamMessage struct {
+	Mode       uint8
+	Subject    string
+	Subcontext string
+	Label      string
+	Data       string
+}
+
+func NewNakamaModule() *NakamaModule {
+	return &NakamaModule{
+		objects:      make(map[storageID]*api.StorageObject),
+		Users:        make(map[string]*api.User),
+		Banned:       make(map[string]bool),
+		Wallets:      make(map[string]map[string]int64),
+		Ledger:       make(map[string][]*LedgerItem),
+		Receipts:     make(map[string]*api.ValidatedPurchase),
+		Leaderboards: make(map[string]map[string]int64),
+		Matches:      make(map[string]map[string]interface{}),
+		presences:    make(map[streamID][]*Presence),
+		Counters:     make(map[string]int64),
+	}
+}
+
+// AddUser registers an account so UsersGetId finds it, AccountGetId answers for any user id.
+func (n *NakamaModule) AddUser(userID, username string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Users[userID] = &api.User{Id: userID, Username: username}
+}
+
+func (n *NakamaModule) AccountGetId(ctx context.Context, userID string) (*api.Account, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	user, ok := n.Users[userID]
+	if !ok {
+		user = &api.User{Id: userID}
+	}
+	wallet, err := json.Marshal(n.Wallets[userID])
+	if err != nil {
+		return nil, err
+	}
+	if n.Wallets[userID] == nil {
+		wallet = []byte("{}")
+	}
+	return &api.Account{User: user, Wallet: string(wallet)}, nil
+}
+
+func (n *NakamaModule) UsersGetId(ctx context.Context, userIDs []string, facebookIDs []string) ([]*api.User, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	users := make([]*api.User, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if user, ok := n.Users[userID]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (n *NakamaModule) UsersBanId(ctx context.Context, userIDs []string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, userID := range userIDs {
+		n.Banned[userID] = true
+	}
+	return nil
+}
+
+func (n *NakamaModule) UsersUnbanId(ctx context.Context, userIDs []string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, userID := range userIDs {
+		delete(n.Banned, userID)
+	}
+	return nil
+}
+
+// SessionLogout records the user whose tokens were invalidated.
+func (n *NakamaModule) SessionLogout(userID, token, refreshToken string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.LoggedOut = append(n.LoggedOut, userID)
+	return nil
+}
+
+func (n *NakamaModule) StorageRead(ctx context.Context, reads []*runtime.StorageRead) ([]*api.StorageObject, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	objects := make([]*api.StorageObject, 0, len(reads))
+	for _, read := range reads {
+		if object, ok := n.objects[storageID{read.Collection, read.Key, read.UserID}]; ok {
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+// StorageWrite applies every write or none of them, like the transaction Nakama runs them in.
+func (n *NakamaModule) StorageWrite(ctx context.Context, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, write := range writes {
+		current, exists := n.objects[storageID{write.Collection, write.Key, write.UserID}]
+		if (write.Version == "*" && exists) || (write.Version != "" && write.Version != "*" && (!exists || current.Version != write.Version)) {
+			return nil, runtime.ErrStorageRejectedVersion
+		}
+	}
+	acks := make([]*api.StorageObjectAck, 0, len(writes))
+	for _, write := range writes {
+		n.version++
+		object := &api.StorageObject{
+			Collection:      write.Collection,
+			Key:             write.Key,
+			UserId:          write.UserID,
+			Value:           write.Value,
+			Version:         strconv.Itoa(n.version),
+			PermissionRead:  int32(write.PermissionRead),
+			PermissionWrite: int32(write.PermissionWrite),
+		}
+		n.objects[storageID{write.Collection, write.Key, write.UserID}] = object
+		acks = append(acks, &api.StorageObjectAck{Collection: object.Collection, Key: object.Key, Version: object.Version, UserId: object.UserId})
+	}
+	return acks, nil
+}
+
+func (n *NakamaModule) StorageDelete(ctx context.Context, deletes []*runtime.StorageDelete) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, del := range deletes {
+		current, exists := n.objects[storageID{del.Collection, del.Key, del.UserID}]
+		if del.Version != "" && (!exists || current.Version != del.Version) {
+			return runtime.ErrStorageRejectedVersion
+		}
+	}
+	for _, del := range deletes {
+		delete(n.objects, storageID{del.Collection, del.Key, del.UserID})
+	}
+	return nil
+}
+
+// StorageList pages through a collection in key order, an empty userID lists every owner. The cursor is an offset.
+func (n *NakamaModule) StorageList(ctx context.Context, callerID, userID, collection string, limit int, cursor string) ([]*api.StorageObject, string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	matches := make([]*api.StorageObject, 0)
+	for id, object := range n.objects {
+		if id.collection == collection && (userID == "" || id.userID == userID) {
+			matches = append(matches, object)
+		}
+	}
+	slices.SortFunc(matches, func(a, b *api.StorageObject) int {
+		if c := strings.Compare(a.UserId, b.UserId); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	start := 0
+	if cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil || start < 0 || start > len(matches) {
+			return nil, "", errors.New("invalid cursor")
+		}
+	}
+	end := len(matches)
+	if limit > 0 {
+		end = min(start+limit, len(matches))
+	}
+	next := ""
+	if end < len(matches) {
+		next = strconv.Itoa(end)
+	}
+	return matches[start:end], next, nil
+}
+
+// PurchaseValidateApple answers for the purchases registered in Receipts, any other receipt is rejected. A
+// transaction already in Purchases comes back as seen before, as Nakama reports it.
+func (n *NakamaModule) PurchaseValidateApple(ctx context.Context, userID, receipt string, persist bool, passwordOverride ...string) (*api.ValidatePurchaseResponse, error) {
+	return n.validatePurchase(userID, receipt, persist)
+}
+
+func (n *NakamaModule) PurchaseValidateGoogle(ctx context.Context, userID, receipt string, persist bool, overrides ...struct {
+	ClientEmail string
+	PrivateKey  string
+}) (*api.ValidatePurchaseResponse, error) {
+	return n.validatePurchase(userID, receipt, persist)
+}
+
+func (n *NakamaModule) validatePurchase(userID, receipt string, persist bool) (*api.ValidatePurchaseResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	registered, ok := n.Receipts[receipt]
+	if !ok {
+		return nil, errors.New("store rejected receipt " + receipt)
+	}
+	purchase := &api.ValidatedPurchase{UserId: userID, ProductId: registered.ProductId, TransactionId: registered.TransactionId, Store: registered.Store}
+	purchase.SeenBefore = slices.ContainsFunc(n.Purchases, func(seen *api.ValidatedPurchase) bool {
+		return seen.TransactionId == purchase.TransactionId
+	})
+	if persist && !purchase.SeenBefore {
+		n.Purchases = append(n.Purchases, purchase)
+	}
+	return &api.ValidatePurchaseResponse{ValidatedPurchases: []*api.ValidatedPurchase{purchase}}, nil
+}
+
+// PurchasesList pages through Purchases in order, an empty userID lists the purchases of every user.
+func (n *NakamaModule) PurchasesList(ctx context.Context, userID string, limit int, cursor string) (*api.PurchaseList, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	matches := make([]*api.ValidatedPurchase, 0)
+	for _, purchase := range n.Purchases {
+		if userID == "" || purchase.UserId == userID {
+			matches = append(matches, purchase)
+		}
+	}
+	start := 0
+	if cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil || start < 0 || start > len(matches) {
+			return nil, errors.New("invalid cursor")
+		}
+	}
+	end := len(matches)
+	if limit > 0 {
+		end = min(start+limit, len(matches))
+	}
+	list := &api.PurchaseList{ValidatedPurchases: matches[start:end]}
+	if end < len(matches) {
+		list.Cursor = strconv.Itoa(end)
+	}
+	return list, nil
+}
+
+// LedgerItem is a recorded wallet update, it implements runtime.WalletLedgerItem.
+type LedgerItem struct {
+	ID         string
+	UserID     string
+	CreateTime int64
+	Changeset  map[string]int64
+	Metadata   map[string]interface{}
+}
+
+func (i *LedgerItem) GetID() string                       { return i.ID }
+func (i *LedgerItem) GetUserID() string                   { return i.UserID }
+func (i *LedgerItem) GetCreateTime() int64                { return i.CreateTime }
+func (i *LedgerItem) GetUpdateTime() int64                { return i.CreateTime }
+func (i *LedgerItem) GetChangeset() map[string]int64      { return i.Changeset }
+func (i *LedgerItem) GetMetadata() map[string]interface{} { return i.Metadata }
+
+// WalletUpdate rejects the whole changeset with a *runtime.WalletNegativeError when any balance would go negative.
+func (n *NakamaModule) WalletUpdate(ctx context.Context, userID string, changeset map[string]int64, metadata map[string]interface{}, updateLedger bool) (map[string]int64, map[string]int64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	previous := maps.Clone(n.Wallets[userID])
+	if previous == nil {
+		previous = make(map[string]int64)
+	}
+	updated := maps.Clone(previous)
+	for currency, delta := range changeset {
+		updated[currency] += delta
+		if updated[currency] < 0 {
+			return nil, nil, &runtime.WalletNegativeError{UserID: userID, Path: currency, Current: previous[currency], Amount: delta}
+		}
+	}
+	n.Wallets[userID] = updated
+	if updateLedger {
+		n.version++
+		n.Ledger[userID] = append(n.Ledger[userID], &LedgerItem{
+			ID:         "ledger-" + strconv.Itoa(n.version),
+			UserID:     userID,
+			CreateTime: time.Now().UTC().Unix(),
+			Changeset:  maps.Clone(changeset),
+			Metadata:   metadata,
+		})
+	}
+	return maps.Clone(updated), previous, nil
+}
+
+// WalletLedgerList returns the newest items first, the cursor is an offset.
+func (n *NakamaModule) WalletLedgerList(ctx context.Context, userID string, limit int, cursor string) ([]runtime.WalletLedgerItem, string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ledger := n.Ledger[userID]
+	start := 0
+	if cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil || start < 0 || start > len(ledger) {
+			return nil, "", errors.New("invalid cursor")
+		}
+	}
+	items := make([]runtime.WalletLedgerItem, 0)
+	for i := len(ledger) - 1 - start; i >= 0 && (limit <= 0 || len(items) < limit); i-- {
+		items = append(items, ledger[i])
+	}
+	next := ""
+	if start+len(items) < len(ledger) {
+		next = strconv.Itoa(start + len(items))
+	}
+	return items, next, nil
+}
+
+func (n *NakamaModule) NotificationSend(ctx context.Context, userID, subject string, content map[string]interface{}, code int, sender string, persistent bool) error {
+	return n.NotificationsSend(ctx, []*runtime.NotificationSend{{UserID: userID, Subject: subject, Content: content, Code: code, Sender: sender, Persistent: persistent}})
+}
+
+func (n *NakamaModule) NotificationsSend(ctx context.Context, notifications []*runtime.NotificationSend) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Notifications = append(n.Notifications, notifications...)
+	return nil
+}
+
+// NotificationsFor returns what was sent to userID, in order.
+func (n *NakamaModule) NotificationsFor(userID string) []*runtime.NotificationSend {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sent := make([]*runtime.NotificationSend, 0)
+	for _, notification := range n.Notifications {
+		if notification.UserID == userID {
+			sent = append(sent, notification)
+		}
+	}
+	return sent
+}
+
+// LeaderboardRecordWrite keeps the last score written per owner, whatever operator the leaderboard was created with.
+func (n *NakamaModule) LeaderboardRecordWrite(ctx context.Context, id, ownerID, username string, score, subscore int64, metadata map[string]interface{}, overrideOperator *int) (*api.LeaderboardRecord, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.Leaderboards[id] == nil {
+		n.Leaderboards[id] = make(map[string]int64)
+	}
+	n.Leaderboards[id][ownerID] = score
+	return &api.LeaderboardRecord{LeaderboardId: id, OwnerId: ownerID, Score: score, Subscore: subscore}, nil
+}
+
+// LeaderboardRecordsList ranks the owners by score, highest first, the cursor is the offset of the next page.
+// Owners and the expiry are ignored.
+func (n *NakamaModule) LeaderboardRecordsList(ctx context.Context, id string, ownerIDs []string, limit int, cursor string, expiry int64) ([]*api.LeaderboardRecord, []*api.LeaderboardRecord, string, string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	offset := 0
+	if cursor != "" {
+		var err error
+		if offset, err = strconv.Atoi(cursor); err != nil {
+			return nil, nil, "", "", errors.New("invalid cursor")
+		}
+	}
+	owners := slices.Collect(maps.Keys(n.Leaderboards[id]))
+	slices.SortFunc(owners, func(a, b string) int {
+		if scoreA, scoreB := n.Leaderboards[id][a], n.Leaderboards[id][b]; scoreA != scoreB {
+			return cmp.Compare(scoreB, scoreA)
+		}
+		return strings.Compare(a, b)
+	})
+	records := make([]*api.LeaderboardRecord, 0, limit)
+	for i := offset; i < len(owners) && len(records) < limit; i++ {
+		records = append(records, &api.LeaderboardRecord{LeaderboardId: id, OwnerId: owners[i], Score: n.Leaderboards[id][owners[i]], Rank: int64(i + 1)})
+	}
+	next := ""
+	if offset+len(records) < len(owners) {
+		next = strconv.Itoa(offset + len(records))
+	}
+	return records, nil, next, "", nil
+}
+
+// MatchCreate records the params under a new match id, no match handler runs.
+func (n *NakamaModule) MatchCreate(ctx context.Context, module string, params map[string]interface{}) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.version++
+	matchID := fmt.Sprintf("%s-%d.node", module, n.version)
+	n.Matches[matchID] = params
+	return matchID, nil
+}
+
+// Presence is a session on a stream or in a match.
+type Presence struct {
+	UserID    string
+	SessionID string
+	Username  string
+	Status    string
+	Hidden    bool
+}
+
+func (p *Presence) GetHidden() bool                   { return p.Hidden }
+func (p *Presence) GetPersistence() bool              { return false }
+func (p *Presence) GetUsername() string               { return p.Username }
+func (p *Presence) GetStatus() string                 { return p.Status }
+func (p *Presence) GetReason() runtime.PresenceReason { return runtime.PresenceReasonUnknown }
+func (p *Presence) GetUserId() string                 { return p.UserID }
+func (p *Presence) GetSessionId() string              { return p.SessionID }
+func (p *Presence) GetNodeId() string                 { return "node" }
+
+// StreamUserJoin reports true when the session was already on the stream, its status is then updated.
+func (n *NakamaModule) StreamUserJoin(mode uint8, subject, subcontext, label, userID, sessionID string, hidden, persistence bool, status string) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	stream := streamID{mode: mode, subject: subject, subcontext: subcontext, label: label}
+	for _, presence := range n.presences[stream] {
+		if presence.UserID == userID && presence.SessionID == sessionID {
+			presence.Hidden, presence.Status = hidden, status
+			return true, nil
+		}
+	}
+	n.presences[stream] = append(n.presences[stream], &Presence{UserID: userID, SessionID: sessionID, Status: status, Hidden: hidden})
+	return false, nil
+}
+
+func (n *NakamaModule) StreamUserLeave(mode uint8, subject, subcontext, label, userID, sessionID string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	stream := streamID{mode: mode, subject: subject, subcontext: subcontext, label: label}
+	n.presences[stream] = slices.DeleteFunc(n.presences[stream], func(presence *Presence) bool {
+		return presence.UserID == userID && presence.SessionID == sessionID
+	})
+	return nil
+}
+
+func (n *NakamaModule) StreamUserList(mode uint8, subject, subcontext, label string, includeHidden, includeNotHidden bool) ([]runtime.Presence, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	presences := make([]runtime.Presence, 0)
+	for _, presence := range n.presences[streamID{mode: mode, subject: subject, subcontext: subcontext, label: label}] {
+		if (presence.Hidden && includeHidden) || (!presence.Hidden && includeNotHidden) {
+			presences = append(presences, presence)
+		}
+	}
+	return presences, nil
+}
+
+func (n *NakamaModule) StreamSend(mode uint8, subject, subcontext, label, data string, presences []runtime.Presence, reliable bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Streams = append(n.Streams, &StreamMessage{Mode: mode, Subject: subject, Subcontext: subcontext, Label: label, Data: data})
+	return nil
+}
+
+func (n *NakamaModule) Event(ctx context.Context, evt *api.Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Events = append(n.Events, evt)
+	return nil
+}
+
+func (n *NakamaModule) MetricsCounterAdd(name string, tags map[string]string, delta int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Counters[name] += delta
+}
+
+func (n *NakamaModule) MetricsGaugeSet(name string, tags map[string]string, value float64) {}
+
+func (n *NakamaModule) MetricsTimerRecord(name string, tags map[string]string, value time.Duration) {}
+
+// MatchDispatcher records what a match handler broadcasts, kicks and labels.
+type MatchDispatcher struct {
+	Broadcasts []*Broadcast
+	Kicked     []runtime.Presence
+	Label      string
+}
+
+// Broadcast is one message sent through a MatchDispatcher, Presences is nil for everyone in the match.
+type Broadcast struct {
+	OpCode    int64
+	Data      []byte
+	Presences []runtime.Presence
+}
+
+func (d *MatchDispatcher) BroadcastMessage(opCode int64, data []byte, presences []runtime.Presence, sender runtime.Presence, reliable bool) error {
+	d.Broadcasts = append(d.Broadcasts, &Broadcast{OpCode: opCode, Data: data, Presences: presences})
+	return nil
+}
+
+func (d *MatchDispatcher) BroadcastMessageDeferred(opCode int64, data []byte, presences []runtime.Presence, sender runtime.Presence, reliable bool) error {
+	return d.BroadcastMessage(opCode, data, presences, sender, reliable)
+}
+
+func (d *MatchDispatcher) MatchKick(presences []runtime.Presence) error {
+	d.Kicked = append(d.Kicked, presences...)
+	return nil
+}
+
+func (d *MatchDispatcher) MatchLabelUpdate(label string) error {
+	d.Label = label
+	return nil
+}
+
+// MatchData is a message a presence sent to a match.
+type MatchData struct {
+	*Presence
+	OpCode int64
+	Data   []byte
+}
+
+func (m *MatchData) GetOpCode() int64      { return m.OpCode }
+func (m *MatchData) GetData() []byte       { return m.Data }
+func (m *MatchData) GetReliable() bool     { return true }
+func (m *MatchData) GetReceiveTime() int64 { return 0 }
+
+// MatchmakerEntry is one matched ticket.
+type MatchmakerEntry struct {
+	*Presence
+	Ticket     string
+	Properties map[string]interface{}
+	PartyID    string
+}
+
+func (e *MatchmakerEntry) GetPresence() runtime.Presence         { return e.Presence }
+func (e *MatchmakerEntry) GetTicket() string                     { return e.Ticket }
+func (e *MatchmakerEntry) GetProperties() map[string]interface{} { return e.Properties }
+func (e *MatchmakerEntry) GetPartyId() string                    { return e.PartyID }
+func (e *MatchmakerEntry) GetCreateTime() int64                  { return 0 }
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	ticketCollection = "tickets"
+
+	ticketStatusOpen    = "open"
+	ticketStatusPending = "pending"
+	ticketStatusClosed  = "closed"
+
+	ticketMaxSubject   = 120
+	ticketMaxBody      = 2000
+	ticketDefaultLimit = 20
+	ticketMaxLimit     = 100
+)
+
+var (
+	errTicketNotFound = newError(CodeNotFound, "ticket not found")
+	errTicketClosed   = newError(CodeFailedPrecondition, "ticket is closed")
+)
+
+type TicketMessage struct {
+	AuthorID  string `json:"author_id"`
+	Staff     bool   `json:"staff"`
+	Body      string `json:"body"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// TicketContext is captured by the server when the ticket is created so it cannot be forged by the client.
+type TicketContext struct {
+	Username    string            `json:"username"`
+	ClientIP    string            `json:"client_ip"`
+	SessionVars map[string]string `json:"session_vars,omitempty"`
+}
+
+// Ticket is owned by the reporter under its id, status is open while it waits on staff and pending while it waits on the player.
+type Ticket struct {
+	ID            string           `json:"id"`
+	UserID        string           `json:"user_id"`
+	Subject       string           `json:"subject"`
+	Status        string           `json:"status"`
+	Platform      string           `json:"platform,omitempty"`
+	ClientVersion string           `json:"client_version,omitempty"`
+	Context       *TicketContext   `json:"context"`
+	Messages      []*TicketMessage `json:"messages"`
+	CreatedAt     int64            `json:"created_at"`
+	UpdatedAt     int64            `json:"updated_at"`
+}
+
+type CreateTicketRequest struct {
+	Subject       string `json:"subject"`
+	Body          string `json:"body"`
+	Platform      string `json:"platform"`
+	ClientVersion string `json:"client_version"`
+}
+
+type ListTicketsRequest struct {
+	Status string `json:"status"`
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+type ListTicketsResponse struct {
+	Tickets []*Ticket `json:"tickets"`
+	Cursor  string    `json:"cursor,omitempty"`
+}
+
+type ReplyTicketRequest struct {
+	TicketID string `json:"ticket_id"`
+	Body     string `json:"body"`
+}
+
+type StaffReplyTicketRequest struct {
+	UserID   string `json:"user_id"`
+	TicketID string `json:"ticket_id"`
+	Body     string `json:"body"`
+	Status   string `json:"status"`
+}
+
+func CreateTicketRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("CreateTicket Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[CreateTicketRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.Subject == "" || len(request.Subject) > ticketMaxSubject {
+		return errorResponse(CodeInvalidArgument, "subject is required and at most 120 bytes")
+	}
+	if request.Body == "" || len(request.Body) > ticketMaxBody {
+		return errorResponse(CodeInvalidArgument, "body is required and at most 2000 bytes")
+	}
+
+	id, err := newLedgerRef()
+	if err != nil {
+		logger.Error("Error generating ticket id: %v", err)
+		return errorResponse(CodeInternal, "error creating ticket")
+	}
+	username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+	clientIP, _ := ctx.Value(runtime.RUNTIME_CTX_CLIENT_IP).(string)
+	vars, _ := ctx.Value(runtime.RUNTIME_CTX_VARS).(map[string]string)
+	now := time.Now().UTC().Unix()
+	ticket := &Ticket{
+		ID:            id,
+		UserID:        userID,
+		Subject:       request.Subject,
+		Status:        ticketStatusOpen,
+		Platform:      request.Platform,
+		ClientVersion: request.ClientVersion,
+		Context:       &TicketContext{Username: username, ClientIP: clientIP, SessionVars: vars},
+		Messages:      []*TicketMessage{{AuthorID: userID, Body: request.Body, CreatedAt: now}},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if ticket.ClientVersion == "" {
+		ticket.ClientVersion = vars[sessionVarClientVersion]
+	}
+
+	value, err := json.Marshal(ticket)
+	if err != nil {
+		logger.Error("Error marshalling ticket: %v", err)
+		return errorResponse(CodeInternal, "error creating ticket")
+	}
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      ticketCollection,
+		Key:             id,
+		UserID:          userID,
+		Value:           string(value),
+		Version:         "*",
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}}); err != nil {
+		logger.Error("Error writing ticket: %v", err)
+		return errorResponse(CodeInternal, "error creating ticket")
+	}
+	return marshalResponse(ticket)
+}
+
+// ListMyTicketsRpc pages through the caller's tickets, the status filter applies within each page so a filtered
+// page can hold fewer tickets than the limit while the cursor still moves on.
+func ListMyTicketsRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ListMyTickets Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[ListTicketsRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.Status != "" && !validTicketStatus(request.Status) {
+		return errorResponse(CodeInvalidArgument, "status must be open, pending or closed")
+	}
+	limit := request.Limit
+	if limit <= 0 {
+		limit = ticketDefaultLimit
+	}
+	limit = min(limit, ticketMaxLimit)
+
+	objects, cursor, err := nk.StorageList(ctx, "", userID, ticketCollection, limit, request.Cursor)
+	if err != nil {
+		logger.Error("Error listing tickets: %v", err)
+		return errorResponse(CodeInternal, "error listing tickets")
+	}
+	response := &ListTicketsResponse{Tickets: make([]*Ticket, 0, len(objects)), Cursor: cursor}
+	for _, object := range objects {
+		ticket := &Ticket{}
+		if err := json.Unmarshal([]byte(object.Value), ticket); err != nil {
+			logger.Error("Error unmarshalling ticket %s: %v", object.Key, err)
+			continue
+		}
+		if request.Status == "" || ticket.Status == request.Status {
+			response.Tickets = append(response.Tickets, ticket)
+		}
+	}
+	sort.Slice(response.Tickets, func(i, j int) bool { return response.Tickets[i].UpdatedAt > response.Tickets[j].UpdatedAt })
+	return marshalResponse(response)
+}
+
+func ReplyTicketRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ReplyTicket Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[ReplyTicketRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.Body == "" || len(request.Body) > ticketMaxBody {
+		return errorResponse(CodeInvalidArgument, "body is required and at most 2000 bytes")
+	}
+
+	ticket, err := updateTicket(ctx, nk, userID, request.TicketID, func(ticket *Ticket, now int64) error {
+		if ticket.Status == ticketStatusClosed {
+			return errTicketClosed
+		}
+		ticket.Messages = append(ticket.Messages, &TicketMessage{AuthorID: userID, Body: request.Body, CreatedAt: now})
+		ticket.Status = ticketStatusOpen
+		return nil
+	})
+	if err != nil {
+		return "", runtimeError(logger, err, "updating ticket")
+	}
+	return marshalResponse(ticket)
+}
+
+// StaffReplyTicketRpc is registered admin only, the reply moves the ticket to pending unless staff set another status.
+func StaffReplyTicketRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("StaffReplyTicket Called - Payload: `%s`", payload)
+	request, err := parsePayload[StaffReplyTicketRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.UserID == "" {
+		return errorResponse(CodeInvalidArgument, "user_id is required")
+	}
+	if request.Body == "" || len(request.Body) > ticketMaxBody {
+		return errorResponse(CodeInvalidArgument, "body is required and at most 2000 bytes")
+	}
+	status := request.Status
+	if status == "" {
+		status = ticketStatusPending
+	}
+	if !validTicketStatus(status) {
+		return errorResponse(CodeInvalidArgument, "status must be open, pending or closed")
+	}
+
+	staffID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	ticket, err := updateTicket(ctx, nk, request.UserID, request.TicketID, func(ticket *Ticket, now int64) error {
+		ticket.Messages = append(ticket.Messages, &TicketMessage{AuthorID: staffID, Staff: true, Body: request.Body, CreatedAt: now})
+		ticket.Status = status
+		return nil
+	})
+	if err != nil {
+		return "", runtimeError(logger, err, "updating ticket")
+	}
+
+	content := map[string]interface{}{"ticket_id": ticket.ID, "status": ticket.Status}
+	subject := translate(userLocale(ctx, nk, ticket.UserID), msgTicketReply, ticket.Subject)
+	if err := nk.NotificationSend(ctx, ticket.UserID, subject, content, notificationTicketReply, "", true); err != nil {
+		logger.Warn("Error notifying %s of ticket reply: %v", ticket.UserID, err)
+	}
+	return marshalResponse(ticket)
+}
+
+func updateTicket(ctx context.Context, nk runtime.NakamaModule, userID, ticketID string, mutate func(*Ticket, int64) error) (*Ticket, error) {
+	if ticketID == "" {
+		return nil, newError(CodeInvalidArgument, "ticket_id is required")
+	}
+	ticket := &Ticket{}
+	write := runtime.StorageWrite{
+		Collection:      ticketCollection,
+		Key:             ticketID,
+		UserID:          userID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		if current == "" {
+			return "", errTicketNotFound
+		}
+		ticket = &Ticket{}
+		if err := json.Unmarshal([]byte(current), ticket); err != nil {
+			return "", err
+		}
+		now := time.Now().UTC().Unix()
+		if err := mutate(ticket, now); err != nil {
+			return "", err
+		}
+		ticket.UpdatedAt = now
+		value, err := json.Marshal(ticket)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+func validTicketStatus(status string) bool {
+	return status == ticketStatusOpen || status == ticketStatusPending || status == ticketStatusClosed
+}
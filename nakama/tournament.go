@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	tournamentWeekly          = "weekly"
+	tournamentWeeklySchedule  = "0 0 * * 1"
+	tournamentWeeklyDuration  = 7 * 24 * 60 * 60
+	tournamentRewardWinners   = 10
+	tournamentRewardConfigKey = "tournament_rewards"
+)
+
+type TournamentRewardConfig struct {
+	Currency string          `json:"currency"`
+	Tiers    map[int64]int64 `json:"tiers"`
+}
+
+var defaultTournamentRewards = TournamentRewardConfig{
+	Currency: "coins",
+	Tiers:    map[int64]int64{1: 1000, 2: 750, 3: 500, 4: 250, 5: 250, 6: 100, 7: 100, 8: 100, 9: 100, 10: 100},
+}
+
+func createTournaments(ctx context.Context, nk runtime.NakamaModule) error {
+	return nk.TournamentCreate(ctx, tournamentWeekly, true, "descending", "best", tournamentWeeklySchedule,
+		map[string]interface{}{}, "Weekly Tournament", "Top players of the week earn rewards.",
+		0, 0, 0, tournamentWeeklyDuration, 0, 0, false, true)
+}
+
+func TournamentEnd(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, tournament *api.Tournament, end, reset int64) error {
+	logger.Info("Tournament %s ended at %d", tournament.Id, end)
+
+	var rewards TournamentRewardConfig
+	found, err := readCachedConfig(ctx, nk, tournamentRewardConfigKey, &rewards)
+	if err != nil {
+		logger.Error("Error reading tournament reward config, using defaults: %v", err)
+	}
+	if !found || err != nil {
+		rewards = defaultTournamentRewards
+	}
+	if rewards.Currency == "" {
+		rewards.Currency = defaultTournamentRewards.Currency
+	}
+
+	records, _, _, _, err := nk.TournamentRecordsList(ctx, tournament.Id, nil, tournamentRewardWinners, "", end)
+	if err != nil {
+		logger.Error("Error listing tournament records: %v", err)
+		return err
+	}
+
+	for _, record := range records {
+		amount, ok := rewards.Tiers[record.Rank]
+		if !ok || amount <= 0 {
+			continue
+		}
+
+		changeset := map[string]int64{rewards.Currency: amount}
+		metadata := map[string]interface{}{"reason": "tournament_reward", "tournament_id": tournament.Id, "rank": record.Rank}
+		if _, _, err := nk.WalletUpdate(ctx, record.OwnerId, changeset, metadata, true); err != nil {
+			logger.Error("Error granting tournament reward to %s: %v", record.OwnerId, err)
+			continue
+		}
+
+		content := map[string]interface{}{"tournament_id": tournament.Id, "rank": record.Rank, "currency": rewards.Currency, "amount": amount}
+		subject := translate(userLocale(ctx, nk, record.OwnerId), msgTournamentReward, record.Rank, tournament.Title)
+		if err := sendNotification(ctx, nk, record.OwnerId, subject, content, notificationTournamentReward, notificationPriorityLow); err != nil {
+			logger.Error("Error notifying %s of tournament reward: %v", record.OwnerId, err)
+		}
+	}
+
+	emitEvent(ctx, logger, nk, eventTournamentEnded, map[string]string{
+		"tournament_id": tournament.Id,
+		"end":           strconv.FormatInt(end, 10),
+		"records":       strconv.Itoa(len(records)),
+	})
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracingExporterEnv    = "TRACING_EXPORTER"
+	tracingExporterStdout = "stdout"
+	tracerName            = "mhth.net/matchmaking-server"
+)
+
+// tracer stays nil until an exporter is configured, every span helper is then a pass through.
+var tracer trace.Tracer
+
+var tracePropagator = propagation.TraceContext{}
+
+// setupTracing installs a tracer when TRACING_EXPORTER names an exporter. Only stdout is supported, the OTLP
+// exporters depend on grpc which a plugin has to share with the Nakama binary, so spans are shipped by a collector
+// reading the logs instead. The provider is flushed once ctx is done.
+func setupTracing(ctx context.Context, logger runtime.Logger) error {
+	exporter := envString(ctx, tracingExporterEnv, "")
+	switch exporter {
+	case "":
+		return nil
+	case tracingExporterStdout:
+		spanExporter, err := stdouttrace.New()
+		if err != nil {
+			return err
+		}
+		useTracerProvider(ctx, logger, sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter)))
+		logger.Info("Tracing enabled with %s exporter", exporter)
+		return nil
+	default:
+		logger.Warn("Unknown tracing exporter `%s`, tracing disabled", exporter)
+		return nil
+	}
+}
+
+func useTracerProvider(ctx context.Context, logger runtime.Logger, provider *sdktrace.TracerProvider) {
+	tracer = provider.Tracer(tracerName)
+	go func() {
+		<-ctx.Done()
+		if err := provider.Shutdown(context.Background()); err != nil {
+			logger.Warn("Error flushing trace spans: %v", err)
+		}
+	}()
+}
+
+// withTracing runs fn in a span named after the rpc, continuing any trace carried in the request headers or session vars.
+func withTracing(name string, fn rpcFunc) rpcFunc {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		if tracer == nil {
+			return fn(ctx, logger, db, nk, payload)
+		}
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		ctx, span := tracer.Start(tracePropagator.Extract(ctx, traceCarrier(ctx)), "rpc "+name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("rpc.name", name), attribute.String("user.id", userID)))
+		defer span.End()
+
+		response, err := fn(ctx, logger, db, nk, payload)
+		if err != nil {
+			var runtimeErr *runtime.Error
+			if errors.As(err, &runtimeErr) {
+				span.SetAttributes(attribute.Int("rpc.error_code", runtimeErr.Code))
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return response, err
+	}
+}
+
+// startMatchTickSpan starts a span for one match loop tick, the returned span is a no-op while tracing is off.
+func startMatchTickSpan(ctx context.Context, tick int64) (context.Context, trace.Span) {
+	if tracer == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	matchID, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	return tracer.Start(ctx, "match_loop "+hordeModuleName,
+		trace.WithAttributes(attribute.String("match.id", matchID), attribute.Int64("match.tick", tick)))
+}
+
+// traceCarrier collects the W3C trace context fields from the session vars, overridden by the request headers.
+func traceCarrier(ctx context.Context) propagation.MapCarrier {
+	carrier := propagation.MapCarrier{}
+	fields := tracePropagator.Fields()
+	if vars, ok := ctx.Value(runtime.RUNTIME_CTX_VARS).(map[string]string); ok {
+		for _, field := range fields {
+			if value := vars[field]; value != "" {
+				carrier.Set(field, value)
+			}
+		}
+	}
+	if headers, ok := ctx.Value(runtime.RUNTIME_CTX_HEADERS).(map[string][]string); ok {
+		for name, values := range headers {
+			for _, field := range fields {
+				if strings.EqualFold(name, field) && len(values) > 0 {
+					carrier.Set(field, values[0])
+				}
+			}
+		}
+	}
+	return carrier
+}
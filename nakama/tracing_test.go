@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// recordSpans installs a tracer backed by an in-memory recorder for the duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(tracerName)
+	t.Cleanup(func() { tracer = nil })
+	return recorder
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attributes := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	return attributes
+}
+
+func TestWithTracingIsANoOpWithoutAnExporter(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	tracer = nil
+	handler := withTracing("ping", func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		if trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			t.Error("handler runs inside a span with tracing off")
+		}
+		return "pong", nil
+	})
+	if response, err := handler(newTestContext("u1"), logger, nil, nk, ""); err != nil || response != "pong" {
+		t.Errorf("handler = %q, %v, want the handler's response", response, err)
+	}
+}
+
+func TestWithTracingRecordsTheRpcSpan(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	recorder := recordSpans(t)
+	handler := withTracing("propose_trade", func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		_, child := tracer.Start(ctx, "storage")
+		child.End()
+		return "", errTradeNotFound
+	})
+	ctx := context.WithValue(newTestContext("u1"), runtime.RUNTIME_CTX_HEADERS, map[string][]string{"Traceparent": {testTraceParent}})
+
+	if _, err := handler(ctx, logger, nil, nk, ""); err != errTradeNotFound {
+		t.Fatalf("handler = %v, want the handler error", err)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want the rpc and its child", len(spans))
+	}
+	child, rpc := spans[0], spans[1]
+	if rpc.Name() != "rpc propose_trade" || rpc.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span = %s (%v), want a server span for the rpc", rpc.Name(), rpc.SpanKind())
+	}
+	if got := rpc.Parent().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("parent trace = %s, want the one from the traceparent header", got)
+	}
+	if child.Parent().SpanID() != rpc.SpanContext().SpanID() {
+		t.Error("downstream span is not a child of the rpc span")
+	}
+	attributes := spanAttributes(rpc)
+	if attributes["rpc.name"].AsString() != "propose_trade" || attributes["user.id"].AsString() != "u1" || attributes["rpc.error_code"].AsInt64() != CodeNotFound {
+		t.Errorf("attributes = %v, want the rpc name, user id and error code", attributes)
+	}
+	if rpc.Status().Code != codes.Error {
+		t.Errorf("status = %v, want error", rpc.Status())
+	}
+}
+
+func TestTraceCarrierPrefersHeadersOverSessionVars(t *testing.T) {
+	ctx := testutil.NewContext("u1", map[string]string{"traceparent": "from-vars", "tracestate": "vendor=vars"})
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_HEADERS, map[string][]string{"TraceParent": {"from-headers"}})
+
+	carrier := traceCarrier(ctx)
+	if carrier.Get("traceparent") != "from-headers" || carrier.Get("tracestate") != "vendor=vars" {
+		t.Errorf("carrier = %v, want the header traceparent and the session var tracestate", carrier)
+	}
+}
+
+func TestStartMatchTickSpan(t *testing.T) {
+	recorder := recordSpans(t)
+	ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_MATCH_ID, testHordeMatchID)
+
+	_, span := startMatchTickSpan(ctx, 42)
+	span.End()
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	attributes := spanAttributes(spans[0])
+	if attributes["match.id"].AsString() != testHordeMatchID || attributes["match.tick"].AsInt64() != 42 {
+		t.Errorf("attributes = %v, want the match id and tick", attributes)
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	tradeCollection       = "trades"
+	tradeExpiryCollection = "trade_expiries"
+
+	tradeStatusPending   = "pending"
+	tradeStatusAccepted  = "accepted"
+	tradeStatusCancelled = "cancelled"
+	tradeStatusExpired   = "expired"
+
+	tradeDefaultExpiry  = 24 * time.Hour
+	tradeMaxExpiry      = 7 * 24 * time.Hour
+	tradeExpiryInterval = 5 * time.Minute
+	tradePageSize       = 100
+)
+
+var (
+	errTradeNotFound   = newError(CodeNotFound, "trade not found")
+	errTradeNotPending = newError(CodeFailedPrecondition, "trade is no longer pending")
+	errTradeExpired    = newError(CodeFailedPrecondition, "trade expired")
+	errTradeForbidden  = newError(CodePermissionDenied, "not a party to this trade")
+)
+
+// Trade is stored system owned so neither party can edit it, Offer is held in escrow while it is pending.
+type Trade struct {
+	ID          string  `json:"id"`
+	ProposerID  string  `json:"proposer_id"`
+	RecipientID string  `json:"recipient_id"`
+	Offer       *Reward `json:"offer"`
+	Request     *Reward `json:"request,omitempty"`
+	Status      string  `json:"status"`
+	CreatedAt   int64   `json:"created_at"`
+	ExpiresAt   int64   `json:"expires_at"`
+}
+
+// TradeExpiry indexes a pending trade by when it runs out, the sweep reads these in key order instead of every trade.
+type TradeExpiry struct {
+	TradeID   string `json:"trade_id"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type ProposeTradeRequest struct {
+	RecipientID      string  `json:"recipient_id"`
+	Offer            *Reward `json:"offer"`
+	Request          *Reward `json:"request"`
+	ExpiresInSeconds int64   `json:"expires_in_seconds"`
+}
+
+type TradeRequest struct {
+	TradeID string `json:"trade_id"`
+}
+
+func ProposeTradeRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("ProposeTrade Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[ProposeTradeRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.RecipientID == "" || request.RecipientID == userID {
+		return errorResponse(CodeInvalidArgument, "another player must be the recipient")
+	}
+	if !validTradeGoods(request.Offer, false) || !validTradeGoods(request.Request, true) {
+		return errorResponse(CodeInvalidArgument, "offer must be non-empty and all amounts positive")
+	}
+
+	users, err := nk.UsersGetId(ctx, []string{request.RecipientID}, nil)
+	if err != nil {
+		logger.Error("Error getting trade recipient: %v", err)
+		return errorResponse(CodeInternal, "error proposing trade")
+	}
+	if len(users) == 0 {
+		return errorResponse(CodeNotFound, "recipient not found")
+	}
+
+	id, err := newLedgerRef()
+	if err != nil {
+		logger.Error("Error generating trade id: %v", err)
+		return errorResponse(CodeInternal, "error proposing trade")
+	}
+	expiry := tradeDefaultExpiry
+	if request.ExpiresInSeconds > 0 {
+		expiry = min(time.Duration(request.ExpiresInSeconds)*time.Second, tradeMaxExpiry)
+	}
+	now := time.Now().UTC()
+	trade := &Trade{
+		ID:          id,
+		ProposerID:  userID,
+		RecipientID: request.RecipientID,
+		Offer:       request.Offer,
+		Request:     request.Request,
+		Status:      tradeStatusPending,
+		CreatedAt:   now.Unix(),
+		ExpiresAt:   now.Add(expiry).Unix(),
+	}
+
+	metadata := map[string]interface{}{"reason": "trade_escrow", "trade_id": id}
+	if err := takeReward(ctx, nk, userID, trade.Offer, metadata); err != nil {
+		return "", runtimeError(logger, err, "updating trade")
+	}
+
+	value, err := json.Marshal(trade)
+	if err == nil {
+		var expiry []byte
+		if expiry, err = json.Marshal(&TradeExpiry{TradeID: id, ExpiresAt: trade.ExpiresAt}); err == nil {
+			_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+				Collection:      tradeCollection,
+				Key:             id,
+				Value:           string(value),
+				Version:         "*",
+				PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+				PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+			}, {
+				Collection:      tradeExpiryCollection,
+				Key:             tradeExpiryKey(trade),
+				Value:           string(expiry),
+				PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+				PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+			}})
+		}
+	}
+	if err != nil {
+		logger.Error("Error writing trade %s, returning escrow: %v", id, err)
+		returnEscrow(ctx, logger, nk, trade)
+		return errorResponse(CodeInternal, "error proposing trade")
+	}
+
+	return marshalResponse(trade)
+}
+
+// AcceptTradeRpc takes the requested goods from the recipient before claiming the trade, so a lost race refunds them instead of duplicating the escrow.
+func AcceptTradeRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("AcceptTrade Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[TradeRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	trade, err := readTrade(ctx, nk, request.TradeID)
+	if err != nil {
+		return "", runtimeError(logger, err, "updating trade")
+	}
+	if trade.RecipientID != userID {
+		return "", errTradeForbidden
+	}
+	if trade.Status != tradeStatusPending {
+		return "", errTradeNotPending
+	}
+	if trade.ExpiresAt <= time.Now().UTC().Unix() {
+		expireTrade(ctx, logger, nk, trade.ID)
+		return "", errTradeExpired
+	}
+
+	metadata := map[string]interface{}{"reason": "trade", "trade_id": trade.ID}
+	if err := takeReward(ctx, nk, userID, trade.Request, metadata); err != nil {
+		return "", runtimeError(logger, err, "updating trade")
+	}
+
+	accepted, err := updateTrade(ctx, nk, trade.ID, func(trade *Trade) error {
+		if trade.Status != tradeStatusPending {
+			return errTradeNotPending
+		}
+		if trade.ExpiresAt <= time.Now().UTC().Unix() {
+			return errTradeExpired
+		}
+		trade.Status = tradeStatusAccepted
+		return nil
+	})
+	if err != nil {
+		if refundErr := grantReward(ctx, nk, userID, trade.Request, metadata); refundErr != nil {
+			logger.Error("Error refunding trade %s goods to %s: %v", trade.ID, userID, refundErr)
+		}
+		return "", runtimeError(logger, err, "updating trade")
+	}
+	deleteTradeExpiry(ctx, logger, nk, accepted)
+
+	if err := deliverTradeGoods(ctx, logger, nk, accepted, accepted.ProposerID, accepted.RecipientID, accepted.Offer, metadata); err != nil {
+		logger.Error("Error delivering trade %s offer to %s: %v", accepted.ID, accepted.RecipientID, err)
+		return errorResponse(CodeInternal, "error completing trade")
+	}
+	if err := deliverTradeGoods(ctx, logger, nk, accepted, accepted.RecipientID, accepted.ProposerID, accepted.Request, metadata); err != nil {
+		logger.Error("Error delivering trade %s request to %s: %v", accepted.ID, accepted.ProposerID, err)
+		return errorResponse(CodeInternal, "error completing trade")
+	}
+
+	return marshalResponse(accepted)
+}
+
+func CancelTradeRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("CancelTrade Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[TradeRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	trade, err := updateTrade(ctx, nk, request.TradeID, func(trade *Trade) error {
+		if trade.ProposerID != userID && trade.RecipientID != userID {
+			return errTradeForbidden
+		}
+		if trade.Status != tradeStatusPending {
+			return errTradeNotPending
+		}
+		trade.Status = tradeStatusCancelled
+		return nil
+	})
+	if err != nil {
+		return "", runtimeError(logger, err, "updating trade")
+	}
+
+	deleteTradeExpiry(ctx, logger, nk, trade)
+	returnEscrow(ctx, logger, nk, trade)
+	return marshalResponse(trade)
+}
+
+// startTradeExpiry returns the escrow of pending trades that ran out on a fixed interval until ctx is done, the expiry index is
+// listed in key order so the sweep stops at the first trade still running.
+func startTradeExpiry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	runEvery(ctx, tradeExpiryInterval, func() {
+		sweepExpiredTrades(ctx, logger, nk, time.Now().UTC().Unix())
+	})
+}
+
+func sweepExpiredTrades(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, now int64) {
+	expired := make([]*TradeExpiry, 0)
+	deletes := make([]*runtime.StorageDelete, 0)
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", tradeExpiryCollection, tradePageSize, cursor)
+		if err != nil {
+			logger.Error("Error listing trade expiries: %v", err)
+			return
+		}
+		reachedNow := false
+		for _, object := range objects {
+			expiry := &TradeExpiry{}
+			if err := json.Unmarshal([]byte(object.Value), expiry); err != nil {
+				logger.Error("Error unmarshalling trade expiry %s: %v", object.Key, err)
+				deletes = append(deletes, &runtime.StorageDelete{Collection: tradeExpiryCollection, Key: object.Key})
+				continue
+			}
+			if expiry.ExpiresAt > now {
+				reachedNow = true
+				break
+			}
+			expired = append(expired, expiry)
+			deletes = append(deletes, &runtime.StorageDelete{Collection: tradeExpiryCollection, Key: object.Key})
+		}
+		if reachedNow || next == "" {
+			break
+		}
+		cursor = next
+	}
+	for _, expiry := range expired {
+		expireTrade(ctx, logger, nk, expiry.TradeID)
+	}
+	for start := 0; start < len(deletes); start += tradePageSize {
+		if err := nk.StorageDelete(ctx, deletes[start:min(start+tradePageSize, len(deletes))]); err != nil {
+			logger.Error("Error deleting trade expiries: %v", err)
+			return
+		}
+	}
+}
+
+func expireTrade(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, tradeID string) {
+	trade, err := updateTrade(ctx, nk, tradeID, func(trade *Trade) error {
+		if trade.Status != tradeStatusPending {
+			return errTradeNotPending
+		}
+		trade.Status = tradeStatusExpired
+		return nil
+	})
+	if errors.Is(err, errTradeNotPending) {
+		return
+	}
+	if err != nil {
+		logger.Error("Error expiring trade %s: %v", tradeID, err)
+		return
+	}
+	deleteTradeExpiry(ctx, logger, nk, trade)
+	returnEscrow(ctx, logger, nk, trade)
+}
+
+// tradeExpiryKey zero pads the expiry so keys sort in time order, the trade id keeps trades expiring together apart.
+func tradeExpiryKey(trade *Trade) string {
+	return fmt.Sprintf("%020d-%s", trade.ExpiresAt, trade.ID)
+}
+
+// deleteTradeExpiry drops the index entry of a trade that is no longer pending, a failure only leaves work for the sweep.
+func deleteTradeExpiry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, trade *Trade) {
+	if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: tradeExpiryCollection, Key: tradeExpiryKey(trade)}}); err != nil {
+		logger.Error("Error deleting trade %s expiry: %v", trade.ID, err)
+	}
+}
+
+// deliverTradeGoods hands goods to the receiver, items that do not fit under the receiver's max stack go back to the giver
+// instead of being lost.
+func deliverTradeGoods(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, trade *Trade, giverID, receiverID string, goods *Reward, metadata map[string]interface{}) error {
+	overflow, err := grantRewardOverflow(ctx, nk, receiverID, goods, metadata)
+	if err != nil || len(overflow) == 0 {
+		return err
+	}
+	logger.Warn("Trade %s items %v did not fit for %s, returning them to %s", trade.ID, overflow, receiverID, giverID)
+	returned := map[string]interface{}{"reason": "trade_overflow_return", "trade_id": trade.ID}
+	if lost, err := grantRewardOverflow(ctx, nk, giverID, &Reward{Items: overflow}, returned); err != nil {
+		logger.Error("Error returning trade %s overflow to %s: %v", trade.ID, giverID, err)
+	} else if len(lost) > 0 {
+		logger.Error("Trade %s items %v fit neither %s nor %s", trade.ID, lost, receiverID, giverID)
+	}
+	return nil
+}
+
+func returnEscrow(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, trade *Trade) {
+	metadata := map[string]interface{}{"reason": "trade_escrow_return", "trade_id": trade.ID}
+	if err := grantReward(ctx, nk, trade.ProposerID, trade.Offer, metadata); err != nil {
+		logger.Error("Error returning trade %s escrow to %s: %v", trade.ID, trade.ProposerID, err)
+	}
+}
+
+// updateTrade applies mutate guarded by the stored version, a concurrent accept or cancel makes the loser see the new status.
+func updateTrade(ctx context.Context, nk runtime.NakamaModule, tradeID string, mutate func(*Trade) error) (*Trade, error) {
+	if tradeID == "" {
+		return nil, newError(CodeInvalidArgument, "trade_id is required")
+	}
+	trade := &Trade{}
+	write := runtime.StorageWrite{
+		Collection:      tradeCollection,
+		Key:             tradeID,
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	_, err := writeWithRetry(ctx, nk, write, func(current string) (string, error) {
+		if current == "" {
+			return "", errTradeNotFound
+		}
+		trade = &Trade{}
+		if err := json.Unmarshal([]byte(current), trade); err != nil {
+			return "", err
+		}
+		if err := mutate(trade); err != nil {
+			return "", err
+		}
+		value, err := json.Marshal(trade)
+		return string(value), err
+	}, storageWriteAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+func readTrade(ctx context.Context, nk runtime.NakamaModule, tradeID string) (*Trade, error) {
+	if tradeID == "" {
+		return nil, newError(CodeInvalidArgument, "trade_id is required")
+	}
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: tradeCollection, Key: tradeID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, errTradeNotFound
+	}
+	trade := &Trade{}
+	if err := json.Unmarshal([]byte(objects[0].Value), trade); err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+func validTradeGoods(goods *Reward, optional bool) bool {
+	if goods == nil || len(goods.Currency)+len(goods.Items) == 0 {
+		return optional
+	}
+	for _, amount := range goods.Currency {
+		if amount <= 0 {
+			return false
+		}
+	}
+	for _, count := range goods.Items {
+		if count <= 0 {
+			return false
+		}
+	}
+	return true
+}
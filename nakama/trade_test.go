@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+func newTestTrade(t *testing.T, logger runtime.Logger, nk *testutil.NakamaModule, expiresInSeconds int64) *Trade {
+	t.Helper()
+	nk.AddUser("recipient", "rin")
+	if nk.Wallets["proposer"] == nil {
+		nk.Wallets["proposer"] = map[string]int64{"gold": 100}
+		nk.Wallets["recipient"] = map[string]int64{"gems": 10}
+	}
+	payload := fmt.Sprintf(`{"recipient_id":"recipient","offer":{"currency":{"gold":30}},"request":{"currency":{"gems":5}},"expires_in_seconds":%d}`, expiresInSeconds)
+	response, err := ProposeTradeRpc(newTestContext("proposer"), logger, nil, nk, payload)
+	if err != nil {
+		t.Fatalf("ProposeTradeRpc: %v", err)
+	}
+	return decodeResponse[Trade](t, response)
+}
+
+func tradePayload(trade *Trade) string {
+	return fmt.Sprintf(`{"trade_id":%q}`, trade.ID)
+}
+
+func TestAcceptTradeRpcDoubleAcceptRace(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	trade := newTestTrade(t, logger, nk, 0)
+	if got := nk.Wallets["proposer"]["gold"]; got != 70 {
+		t.Fatalf("proposer gold = %d after proposing, want 70 held in escrow", got)
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := AcceptTradeRpc(newTestContext("recipient"), logger, nil, nk, tradePayload(trade))
+			codes[i] = errorCode(err)
+		}()
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, code := range codes {
+		switch code {
+		case 0:
+			accepted++
+		case CodeFailedPrecondition:
+		default:
+			t.Errorf("accept error code = %d, want ok or failed precondition", code)
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("%d accepts succeeded, want exactly one", accepted)
+	}
+	want := map[string]map[string]int64{
+		"proposer":  {"gold": 70, "gems": 5},
+		"recipient": {"gold": 30, "gems": 5},
+	}
+	for userID, currencies := range want {
+		for currency, amount := range currencies {
+			if got := nk.Wallets[userID][currency]; got != amount {
+				t.Errorf("%s %s = %d, want %d", userID, currency, got, amount)
+			}
+		}
+	}
+}
+
+func TestCancelTradeRpcReturnsEscrow(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	trade := newTestTrade(t, logger, nk, 0)
+
+	if _, err := CancelTradeRpc(newTestContext("stranger"), logger, nil, nk, tradePayload(trade)); errorCode(err) != CodePermissionDenied {
+		t.Fatalf("stranger cancel = %v, want permission denied", err)
+	}
+	if _, err := CancelTradeRpc(newTestContext("recipient"), logger, nil, nk, tradePayload(trade)); err != nil {
+		t.Fatalf("CancelTradeRpc: %v", err)
+	}
+	if got := nk.Wallets["proposer"]["gold"]; got != 100 {
+		t.Errorf("proposer gold = %d after cancel, want the escrow back", got)
+	}
+	if _, err := AcceptTradeRpc(newTestContext("recipient"), logger, nil, nk, tradePayload(trade)); errorCode(err) != CodeFailedPrecondition {
+		t.Errorf("accept after cancel = %v, want failed precondition", err)
+	}
+	if _, err := CancelTradeRpc(newTestContext("proposer"), logger, nil, nk, tradePayload(trade)); errorCode(err) != CodeFailedPrecondition {
+		t.Errorf("second cancel = %v, want failed precondition", err)
+	}
+	if got := nk.Wallets["proposer"]["gold"]; got != 100 {
+		t.Errorf("proposer gold = %d after a second cancel, want the escrow returned once", got)
+	}
+	if objects, _, _ := nk.StorageList(newTestContext(""), "", "", tradeExpiryCollection, 0, ""); len(objects) != 0 {
+		t.Errorf("%d expiry entries left after cancel, want none", len(objects))
+	}
+}
+
+func TestSweepExpiredTrades(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	soon := newTestTrade(t, logger, nk, 60)
+	later := newTestTrade(t, logger, nk, 3600)
+
+	sweepExpiredTrades(newTestContext(""), logger, nk, time.Now().UTC().Unix()+120)
+
+	expired := &Trade{}
+	readTestObject(t, nk, tradeCollection, soon.ID, "", expired)
+	if expired.Status != tradeStatusExpired {
+		t.Errorf("soon status = %s, want expired", expired.Status)
+	}
+	pending := &Trade{}
+	readTestObject(t, nk, tradeCollection, later.ID, "", pending)
+	if pending.Status != tradeStatusPending {
+		t.Errorf("later status = %s, want pending", pending.Status)
+	}
+	if got := nk.Wallets["proposer"]["gold"]; got != 70 {
+		t.Errorf("proposer gold = %d, want only the expired escrow back", got)
+	}
+	objects, _, _ := nk.StorageList(newTestContext(""), "", "", tradeExpiryCollection, 0, "")
+	if len(objects) != 1 || objects[0].Key != tradeExpiryKey(later) {
+		t.Errorf("expiry entries = %d, want only the pending trade", len(objects))
+	}
+}
+
+func TestAcceptTradeRpcReturnsItemsOverTheMaxStack(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	defineTestItem(t, nk, "potion", &ItemDefinition{Name: "Potion", MaxStack: 5})
+	nk.AddUser("recipient", "rin")
+	writeTestObject(t, nk, inventoryCollection, inventoryKey, "proposer", &Inventory{Items: map[string]int64{"potion": 4}})
+	writeTestObject(t, nk, inventoryCollection, inventoryKey, "recipient", &Inventory{Items: map[string]int64{"potion": 3}})
+	response, err := ProposeTradeRpc(newTestContext("proposer"), logger, nil, nk, `{"recipient_id":"recipient","offer":{"items":{"potion":4}}}`)
+	if err != nil {
+		t.Fatalf("ProposeTradeRpc: %v", err)
+	}
+
+	if _, err := AcceptTradeRpc(newTestContext("recipient"), logger, nil, nk, tradePayload(decodeResponse[Trade](t, response))); err != nil {
+		t.Fatalf("AcceptTradeRpc: %v", err)
+	}
+	for userID, want := range map[string]int64{"recipient": 5, "proposer": 2} {
+		inventory := &Inventory{}
+		readTestObject(t, nk, inventoryCollection, inventoryKey, userID, inventory)
+		if got := inventory.Items["potion"]; got != want {
+			t.Errorf("%s potions = %d, want %d", userID, got, want)
+		}
+	}
+}
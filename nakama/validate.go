@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// rpcSchemas holds the JSON schema each RPC payload must satisfy, RPCs without one are passed through unchecked.
+var rpcSchemas = map[string]string{
+	rpcSubmitScore: `{
+		"type": "object",
+		"properties": {
+			"score": {"type": "integer", "minimum": 0}
+		},
+		"required": ["score"]
+	}`,
+	rpcValidatePurchase: `{
+		"type": "object",
+		"properties": {
+			"store": {"type": "string", "enum": ["apple", "google"]},
+			"receipt": {"type": "string", "minLength": 1}
+		},
+		"required": ["store", "receipt"]
+	}`,
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func compileSchemas(sources map[string]string) (map[string]*gojsonschema.Schema, error) {
+	schemas := make(map[string]*gojsonschema.Schema, len(sources))
+	for id, source := range sources {
+		schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(source))
+		if err != nil {
+			return nil, fmt.Errorf("schema for rpc %s: %w", id, err)
+		}
+		schemas[id] = schema
+	}
+	return schemas, nil
+}
+
+// validate checks payload against schema, an empty payload is validated as an empty object like parsePayload treats it.
+func validate(schema *gojsonschema.Schema, payload string) error {
+	if payload == "" {
+		payload = "{}"
+	}
+	result, err := schema.Validate(gojsonschema.NewStringLoader(payload))
+	if err != nil {
+		return newError(CodeInvalidArgument, "invalid payload")
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	fields := make([]*FieldError, 0, len(result.Errors()))
+	for _, failure := range result.Errors() {
+		field := failure.Field()
+		if failure.Type() == "required" {
+			if property, ok := failure.Details()["property"].(string); ok {
+				field = property
+			}
+		}
+		fields = append(fields, &FieldError{Field: field, Message: failure.Description()})
+	}
+	body, err := json.Marshal(&ErrorResponse{Code: CodeInvalidArgument, Message: "invalid payload", Fields: fields})
+	if err != nil {
+		return newError(CodeInvalidArgument, "invalid payload")
+	}
+	return runtime.NewError(string(body), CodeInvalidArgument)
+}
+
+// withValidation rejects payloads that fail schema before the handler runs.
+func withValidation(schema *gojsonschema.Schema, fn rpcFunc) rpcFunc {
+	if schema == nil {
+		return fn
+	}
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		if err := validate(schema, payload); err != nil {
+			logger.Debug("Rejected payload failing schema: %v", err)
+			return "", err
+		}
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	walletHistoryDefaultLimit = 25
+	walletHistoryMaxLimit     = 100
+)
+
+var errInsufficientFunds = newError(CodeFailedPrecondition, "insufficient funds")
+
+type GrantCurrencyRequest struct {
+	UserID   string `json:"user_id"`
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+	Reason   string `json:"reason"`
+	Source   string `json:"source"`
+}
+
+type SpendCurrencyRequest struct {
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+	Reason   string `json:"reason"`
+}
+
+type WalletUpdateResponse struct {
+	Balance      map[string]int64 `json:"balance"`
+	LedgerItemID string           `json:"ledger_item_id"`
+}
+
+type WalletHistoryRequest struct {
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+type WalletHistoryItem struct {
+	ID         string                 `json:"id"`
+	Changeset  map[string]int64       `json:"changeset"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	CreateTime int64                  `json:"create_time"`
+}
+
+type WalletHistoryResponse struct {
+	Items  []*WalletHistoryItem `json:"items"`
+	Cursor string               `json:"cursor,omitempty"`
+}
+
+// GrantCurrencyRpc is registered admin only, clients never mint currency for themselves.
+func GrantCurrencyRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("GrantCurrency Called - Payload: `%s`", payload)
+	request, err := parsePayload[GrantCurrencyRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.UserID == "" || request.Currency == "" || request.Amount <= 0 {
+		return errorResponse(CodeInvalidArgument, "user_id, currency and a positive amount are required")
+	}
+
+	balance, ledgerID, err := walletUpdateWithLedger(ctx, nk, request.UserID, map[string]int64{request.Currency: request.Amount}, request.Reason, request.Source)
+	if err != nil {
+		logger.Error("Error granting currency: %v", err)
+		return errorResponse(CodeInternal, "error updating wallet")
+	}
+
+	return marshalResponse(&WalletUpdateResponse{Balance: balance, LedgerItemID: ledgerID})
+}
+
+func SpendCurrencyRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("SpendCurrency Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[SpendCurrencyRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.Currency == "" || request.Amount <= 0 {
+		return errorResponse(CodeInvalidArgument, "currency and a positive amount are required")
+	}
+
+	wallet, err := readWallet(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Error reading wallet: %v", err)
+		return errorResponse(CodeInternal, "error reading wallet")
+	}
+	if wallet[request.Currency] < request.Amount {
+		return "", errInsufficientFunds
+	}
+
+	balance, ledgerID, err := walletUpdateWithLedger(ctx, nk, userID, map[string]int64{request.Currency: -request.Amount}, request.Reason, "spend_currency")
+	if err != nil {
+		var negativeErr *runtime.WalletNegativeError
+		if errors.As(err, &negativeErr) {
+			// The balance moved between the read and the update.
+			return "", errInsufficientFunds
+		}
+		logger.Error("Error spending currency: %v", err)
+		return errorResponse(CodeInternal, "error updating wallet")
+	}
+
+	return marshalResponse(&WalletUpdateResponse{Balance: balance, LedgerItemID: ledgerID})
+}
+
+func WalletHistoryRpc(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger.Debug("WalletHistory Called - Payload: `%s`", payload)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := parsePayload[WalletHistoryRequest](payload)
+	if err != nil {
+		return "", err
+	}
+	if request.Limit <= 0 {
+		request.Limit = walletHistoryDefaultLimit
+	}
+	request.Limit = min(request.Limit, walletHistoryMaxLimit)
+
+	items, cursor, err := nk.WalletLedgerList(ctx, userID, request.Limit, request.Cursor)
+	if err != nil {
+		logger.Error("Error listing wallet ledger: %v", err)
+		return errorResponse(CodeInternal, "error listing wallet history")
+	}
+
+	response := &WalletHistoryResponse{Items: make([]*WalletHistoryItem, 0, len(items)), Cursor: cursor}
+	for _, item := range items {
+		response.Items = append(response.Items, &WalletHistoryItem{
+			ID:         item.GetID(),
+			Changeset:  item.GetChangeset(),
+			Metadata:   item.GetMetadata(),
+			CreateTime: item.GetCreateTime(),
+		})
+	}
+
+	return marshalResponse(response)
+}
+
+func readWallet(ctx context.Context, nk runtime.NakamaModule, userID string) (map[string]int64, error) {
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	wallet := make(map[string]int64)
+	if account.Wallet == "" {
+		return wallet, nil
+	}
+	if err := json.Unmarshal([]byte(account.Wallet), &wallet); err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// walletUpdateWithLedger applies the changeset with a ledger entry and returns the new balance with the id of that entry.
+func walletUpdateWithLedger(ctx context.Context, nk runtime.NakamaModule, userID string, changeset map[string]int64, reason, source string) (map[string]int64, string, error) {
+	ref, err := newLedgerRef()
+	if err != nil {
+		return nil, "", err
+	}
+	metadata := map[string]interface{}{
+		"reason":    reason,
+		"source":    source,
+		"timestamp": time.Now().UTC().Unix(),
+		"ref":       ref,
+	}
+
+	updated, _, err := nk.WalletUpdate(ctx, userID, changeset, metadata, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// WalletUpdate does not hand back the ledger item, look it up by the reference we stamped on it.
+	// The update has already been applied by now, so a failed lookup only loses the ledger id.
+	items, _, err := nk.WalletLedgerList(ctx, userID, 10, "")
+	if err != nil {
+		return updated, "", nil
+	}
+	for _, item := range items {
+		if item.GetMetadata()["ref"] == ref {
+			return updated, item.GetID(), nil
+		}
+	}
+	return updated, "", nil
+}
+
+func newLedgerRef() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
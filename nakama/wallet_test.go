@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+
+	"mhth.net/matchmaking-server/testutil"
+)
+
+// staleWalletModule reports a balance the wallet no longer holds, as when a concurrent spend lands between the
+// read and the update.
+type staleWalletModule struct {
+	*testutil.NakamaModule
+	balance string
+}
+
+func (m *staleWalletModule) AccountGetId(ctx context.Context, userID string) (*api.Account, error) {
+	return &api.Account{User: &api.User{Id: userID}, Wallet: m.balance}, nil
+}
+
+func TestSpendCurrencyRpc(t *testing.T) {
+	tests := []struct {
+		name        string
+		balance     int64
+		payload     string
+		wantCode    int
+		wantBalance int64
+	}{
+		{name: "spends within the balance", balance: 100, payload: `{"currency":"gold","amount":40}`, wantBalance: 60},
+		{name: "spends the whole balance", balance: 40, payload: `{"currency":"gold","amount":40}`, wantBalance: 0},
+		{name: "rejects overspending", balance: 10, payload: `{"currency":"gold","amount":40}`, wantCode: CodeFailedPrecondition, wantBalance: 10},
+		{name: "rejects a non-positive amount", balance: 10, payload: `{"currency":"gold","amount":0}`, wantCode: CodeInvalidArgument, wantBalance: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, nk := newTestRuntime(t)
+			nk.Wallets["u1"] = map[string]int64{"gold": tt.balance}
+
+			response, err := SpendCurrencyRpc(newTestContext("u1"), logger, nil, nk, tt.payload)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			if got := nk.Wallets["u1"]["gold"]; got != tt.wantBalance {
+				t.Errorf("balance = %d, want %d", got, tt.wantBalance)
+			}
+			if tt.wantCode != 0 {
+				return
+			}
+			spent := decodeResponse[WalletUpdateResponse](t, response)
+			if spent.Balance["gold"] != tt.wantBalance || spent.LedgerItemID == "" {
+				t.Errorf("response = %+v, want balance %d with a ledger id", spent, tt.wantBalance)
+			}
+		})
+	}
+}
+
+func TestSpendCurrencyRpcBalanceMovedConcurrently(t *testing.T) {
+	logger, fake := newTestRuntime(t)
+	fake.Wallets["u1"] = map[string]int64{"gold": 10}
+	nk := &staleWalletModule{NakamaModule: fake, balance: `{"gold":100}`}
+
+	_, err := SpendCurrencyRpc(newTestContext("u1"), logger, nil, nk, `{"currency":"gold","amount":40}`)
+	if err != errInsufficientFunds {
+		t.Fatalf("error = %v, want errInsufficientFunds", err)
+	}
+	if got := fake.Wallets["u1"]["gold"]; got != 10 {
+		t.Errorf("balance = %d, want it untouched at 10", got)
+	}
+}
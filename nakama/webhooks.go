@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	webhookConfigKey       = "webhooks"
+	webhookSecretEnv       = "WEBHOOK_SECRET"
+	webhookSignatureHeader = "X-MHTH-Signature"
+	webhookQueueSize       = 256
+	webhookMaxAttempts     = 5
+	webhookBackoff         = 500 * time.Millisecond
+	webhookTimeout         = 5 * time.Second
+
+	eventPurchaseValidated = "purchase_validated"
+	eventTournamentEnded   = "tournament_ended"
+	eventPlayerBanned      = "player_banned"
+	eventLeaderboardReset  = "leaderboard_reset"
+)
+
+var webhooks *webhookDispatcher
+
+// WebhookConfig points at the receiver and lists which event names are forwarded to it.
+type WebhookConfig struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type WebhookPayload struct {
+	Event      string            `json:"event"`
+	Timestamp  int64             `json:"timestamp"`
+	Properties map[string]string `json:"properties"`
+}
+
+type webhookDispatcher struct {
+	logger runtime.Logger
+	nk     runtime.NakamaModule
+	secret []byte
+	client *http.Client
+	queue  chan *WebhookPayload
+}
+
+// newWebhookDispatcher returns nil without a secret, since an empty HMAC key signs payloads anyone can forge. Webhooks
+// then stay off and events are not forwarded.
+func newWebhookDispatcher(logger runtime.Logger, nk runtime.NakamaModule, secret string) *webhookDispatcher {
+	if secret == "" {
+		logger.Error("%s is not set, webhooks are disabled", webhookSecretEnv)
+		return nil
+	}
+	return &webhookDispatcher{
+		logger: logger,
+		nk:     nk,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan *WebhookPayload, webhookQueueSize),
+	}
+}
+
+// emitEvent publishes a server event, the registered event handler forwards it to the webhook when configured.
+func emitEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, name string, properties map[string]string) {
+	if err := nk.Event(ctx, &api.Event{Name: name, Properties: properties}); err != nil {
+		logger.Error("Error emitting event %s: %v", name, err)
+	}
+}
+
+// WebhookEvent queues the event for delivery without blocking, events are dropped while the queue is full or while
+// webhooks are disabled.
+func WebhookEvent(ctx context.Context, logger runtime.Logger, evt *api.Event) {
+	if webhooks == nil {
+		return
+	}
+	payload := &WebhookPayload{Event: evt.Name, Timestamp: time.Now().UTC().Unix(), Properties: evt.Properties}
+	if evt.Timestamp != nil {
+		payload.Timestamp = evt.Timestamp.AsTime().Unix()
+	}
+	select {
+	case webhooks.queue <- payload:
+	default:
+		logger.Warn("Webhook queue full, dropping event %s", evt.Name)
+	}
+}
+
+func (d *webhookDispatcher) start(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case payload := <-d.queue:
+				d.deliver(ctx, payload)
+			}
+		}
+	}()
+}
+
+// deliver retries 5xx responses and transport errors with exponential backoff, anything else is final.
+func (d *webhookDispatcher) deliver(ctx context.Context, payload *WebhookPayload) {
+	var config WebhookConfig
+	if _, err := readConfig(ctx, d.nk, webhookConfigKey, &config); err != nil {
+		d.logger.Error("Error reading webhook config, dropping event %s: %v", payload.Event, err)
+		return
+	}
+	if config.URL == "" || !slices.Contains(config.Events, payload.Event) {
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.logger.Error("Error marshalling webhook payload: %v", err)
+		return
+	}
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	backoff := webhookBackoff
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		err := d.post(ctx, config.URL, body, signature)
+		if err == nil {
+			return
+		}
+		retryable, ok := err.(*webhookRetryableError)
+		if !ok {
+			d.logger.Error("Webhook delivery of %s rejected: %v", payload.Event, err)
+			return
+		}
+		d.logger.Warn("Webhook delivery of %s failed, attempt %d/%d: %v", payload.Event, attempt, webhookMaxAttempts, retryable.err)
+		if attempt == webhookMaxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	d.logger.Error("Dropping webhook event %s after %d attempts", payload.Event, webhookMaxAttempts)
+}
+
+type webhookRetryableError struct {
+	err error
+}
+
+func (e *webhookRetryableError) Error() string {
+	return e.err.Error()
+}
+
+func (d *webhookDispatcher) post(ctx context.Context, url string, body []byte, signature string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhookSignatureHeader, signature)
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return &webhookRetryableError{err: err}
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 500:
+		return &webhookRetryableError{err: fmt.Errorf("status %d", response.StatusCode)}
+	case response.StatusCode >= 300:
+		return fmt.Errorf("status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+)
+
+func TestWebhooksAreDisabledWithoutASecret(t *testing.T) {
+	logger, nk := newTestRuntime(t)
+	previous := webhooks
+	t.Cleanup(func() { webhooks = previous })
+
+	webhooks = newWebhookDispatcher(logger, nk, "")
+	if webhooks != nil {
+		t.Fatal("dispatcher created without a secret")
+	}
+	if lines := logger.Lines["error"]; len(lines) != 1 || !strings.Contains(lines[0], webhookSecretEnv) {
+		t.Errorf("error lines = %v, want the missing secret logged", lines)
+	}
+	WebhookEvent(newTestContext(""), logger, &api.Event{Name: eventPlayerBanned})
+	webhooks.start(newTestContext(""))
+
+	if webhooks = newWebhookDispatcher(logger, nk, "shared"); webhooks == nil {
+		t.Fatal("no dispatcher with a secret")
+	}
+	WebhookEvent(newTestContext(""), logger, &api.Event{Name: eventPlayerBanned})
+	if queued := len(webhooks.queue); queued != 1 {
+		t.Errorf("queued %d events, want 1", queued)
+	}
+}